@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"SnapFlow/internal/aggregator"
+	"SnapFlow/internal/models"
+	"SnapFlow/internal/sink"
+)
+
+// runAggregator 以汇总中心模式运行：接收各传感器推送的快照，保存后合并为全局快照
+//
+// 传感器令牌从 AGGREGATOR_TOKENS 读取，格式为 传感器=令牌，多个用逗号分隔。
+func runAggregator(ctx context.Context, database *sql.DB, rc rollupConfig, output sink.SnapshotSink) error {
+	tokens := make(map[string]string)
+	for _, pair := range strings.Split(getEnv("AGGREGATOR_TOKENS", ""), ",") {
+		sensor, token, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		if sensor, token = strings.TrimSpace(sensor), strings.TrimSpace(token); sensor != "" && token != "" {
+			tokens[sensor] = token
+		}
+	}
+
+	agg, err := aggregator.New(aggregator.Config{
+		Listen:      getEnv("AGGREGATOR_LISTEN", ":8480"),
+		TLSCertFile: getEnv("AGGREGATOR_TLS_CERT", ""),
+		TLSKeyFile:  getEnv("AGGREGATOR_TLS_KEY", ""),
+		Tokens:      tokens,
+		Fleet: models.Labels{
+			Sensor: getEnv("AGGREGATOR_FLEET_ID", "fleet"),
+			Site:   getEnv("AGGREGATOR_FLEET_SITE", ""),
+		},
+		Wait:         getEnvDuration("AGGREGATOR_WAIT", 30*time.Second),
+		Retain:       getEnvDuration("AGGREGATOR_RETAIN", 10*time.Minute),
+		MaxBodyBytes: int64(getEnvInt("AGGREGATOR_MAX_BODY_BYTES", 4*1024*1024)),
+	}, output)
+	if err != nil {
+		return err
+	}
+	agg.Start()
+
+	// 汇总中心同样负责把传感器级和全局快照汇总到各层级
+	stopRollup := make(chan struct{})
+	if rc.enabled {
+		go runRollupLoop(ctx, database, rc, stopRollup)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+	fmt.Println("\n接收到退出信号，正在关闭汇总中心...")
+	close(stopRollup)
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return agg.Close(shutdownCtx)
+}
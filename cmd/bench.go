@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"SnapFlow/internal/db"
+	"SnapFlow/internal/models"
+)
+
+// benchCommonPorts 合成数据中常见的目标端口，其余为随机高端口
+var benchCommonPorts = []int{443, 80, 53, 22, 123, 3306, 8080}
+
+// benchTCPFlags 合成数据中的TCP标志组合：ACK、PSH+ACK、SYN、SYN+ACK、FIN+ACK、RST
+var benchTCPFlags = []int{0x10, 0x18, 0x02, 0x12, 0x11, 0x04}
+
+// runBench 在合成数据集上比较逐项查询和单次扫描两种采集方式的耗时，并检查结果是否一致
+//
+// 数据写入临时的SQLite数据库，不连接任何已配置的数据库。
+// 用法: snapflow bench [行数]，BENCH_ITERATIONS 设置每种方式的执行次数。
+func runBench(ctx context.Context, cfg collectorConfig, args []string) error {
+	rows := getEnvInt("BENCH_ROWS", 200000)
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("行数无效: %q", args[0])
+		}
+		rows = n
+	}
+	iterations := getEnvInt("BENCH_ITERATIONS", 5)
+	if iterations <= 0 {
+		return fmt.Errorf("BENCH_ITERATIONS 必须大于0")
+	}
+
+	dir, err := os.MkdirTemp("", "snapflow-bench-")
+	if err != nil {
+		return fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	source, err := db.OpenSourceDB(db.SQLite, filepath.Join(dir, "bench.db"))
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	start, end := models.AlignWindow(time.Now(), cfg.interval, cfg.windowLength)
+	table := db.MustParseIdentifier("packet_data")
+
+	fmt.Printf("正在生成 %d 行合成数据...\n", rows)
+	if err := generateBenchData(ctx, source.DB(), rows, start, end); err != nil {
+		return err
+	}
+	fmt.Println("✓ 合成数据生成完成")
+
+	legacy, legacyTimes, err := benchCollect(cfg, iterations, start, end, func(snapshot *models.Snapshot) error {
+		for _, fill := range []func(context.Context, *db.SourceDB, db.Identifier, *models.Snapshot) error{
+			db.FillIPStats, db.FillPortStats, db.FillProtocolStats, db.FillTCPFlagsStats,
+		} {
+			if err := fill(ctx, source, table, snapshot); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("逐项查询失败: %w", err)
+	}
+
+	scan, scanTimes, err := benchCollect(cfg, iterations, start, end, func(snapshot *models.Snapshot) error {
+		return db.FillWindowStats(ctx, source, table, snapshot)
+	})
+	if err != nil {
+		return fmt.Errorf("单次扫描失败: %w", err)
+	}
+
+	fmt.Printf("\n%d 行数据，每种方式执行 %d 次:\n", rows, iterations)
+	fmt.Printf("- 逐项查询（8次窗口扫描）: 平均 %s，最快 %s\n", average(legacyTimes).Round(time.Millisecond), fastest(legacyTimes).Round(time.Millisecond))
+	fmt.Printf("- 单次扫描（1次窗口扫描）: 平均 %s，最快 %s\n", average(scanTimes).Round(time.Millisecond), fastest(scanTimes).Round(time.Millisecond))
+	if avg := average(scanTimes); avg > 0 {
+		fmt.Printf("- 加速比: %.2fx\n", float64(average(legacyTimes))/float64(avg))
+	}
+
+	if err := compareWindowStats(legacy, scan); err != nil {
+		return fmt.Errorf("两种方式的统计结果不一致: %w", err)
+	}
+	fmt.Println("✓ 两种方式的统计结果一致")
+	return nil
+}
+
+// generateBenchData 在 [start, end) 内生成合成数据包：源IP呈长尾分布，目标端口以常见服务为主
+func generateBenchData(ctx context.Context, database *sql.DB, rows int, start, end time.Time) error {
+	schema := []string{
+		`CREATE TABLE packet_data (
+			ts DATETIME NOT NULL,
+			src_ip TEXT,
+			dst_port INTEGER,
+			protocol INTEGER,
+			tcp_flags INTEGER,
+			packet_size INTEGER
+		)`,
+		`CREATE INDEX idx_packet_data_ts ON packet_data(ts)`,
+	}
+	for _, stmt := range schema {
+		if _, err := database.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("创建合成数据表失败: %w", err)
+		}
+	}
+
+	tx, err := database.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO packet_data VALUES (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("准备插入语句失败: %w", err)
+	}
+	defer stmt.Close()
+
+	// 固定种子，保证每次生成的数据相同
+	r := rand.New(rand.NewSource(1))
+	ips := rand.NewZipf(r, 1.2, 1, 4999)
+	span := end.Sub(start)
+
+	for i := 0; i < rows; i++ {
+		ts := start.Add(time.Duration(r.Int63n(int64(span))))
+		ip := ips.Uint64()
+		srcIP := fmt.Sprintf("10.%d.%d.%d", ip>>16&0xff, ip>>8&0xff, ip&0xff)
+
+		port := benchCommonPorts[r.Intn(len(benchCommonPorts))]
+		if r.Intn(10) >= 7 {
+			port = 1024 + r.Intn(64512)
+		}
+
+		protocol, flags := 6, benchTCPFlags[r.Intn(len(benchTCPFlags))]
+		switch n := r.Intn(100); {
+		case n >= 95:
+			protocol, flags = 1, 0
+		case n >= 80:
+			protocol, flags = 17, 0
+		}
+
+		_, err := stmt.ExecContext(ctx, ts.UTC().Format("2006-01-02 15:04:05"), srcIP, port, protocol, flags, 64+r.Intn(1437))
+		if err != nil {
+			return fmt.Errorf("写入合成数据失败: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交合成数据失败: %w", err)
+	}
+	return nil
+}
+
+// benchCollect 执行fill若干次，返回最后一次的快照和每次的耗时，排行使用配置的排序依据
+func benchCollect(cfg collectorConfig, iterations int, start, end time.Time, fill func(*models.Snapshot) error) (*models.Snapshot, []time.Duration, error) {
+	var snapshot *models.Snapshot
+	times := make([]time.Duration, 0, iterations)
+
+	for i := 0; i < iterations; i++ {
+		snapshot = models.NewSnapshotForWindow(models.Labels{Sensor: "bench"}, "bench", start, end)
+		snapshot.IP.RankBy = cfg.rankIPsBy
+		snapshot.Port.RankBy = cfg.rankPortsBy
+		began := time.Now()
+		if err := quietly(func() error { return fill(snapshot) }); err != nil {
+			return nil, nil, err
+		}
+		times = append(times, time.Since(began))
+	}
+	return snapshot, times, nil
+}
+
+// quietly 执行fn期间丢弃标准输出，避免各统计函数的打印影响测量
+func quietly(fn func() error) error {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return fn()
+	}
+	defer devNull.Close()
+
+	stdout := os.Stdout
+	os.Stdout = devNull
+	defer func() { os.Stdout = stdout }()
+
+	return fn()
+}
+
+// compareWindowStats 比较两个快照的IP、端口、协议和TCP标志统计
+//
+// 排序依据相同的排行项在SQL中没有确定的顺序，因此排行只比较各名次排序依据对应的数值。
+func compareWindowStats(a, b *models.Snapshot) error {
+	if a.IP.UniqueSourceCount != b.IP.UniqueSourceCount {
+		return fmt.Errorf("唯一源IP数量 %d != %d", a.IP.UniqueSourceCount, b.IP.UniqueSourceCount)
+	}
+	if a.Port.UniqueDestCount != b.Port.UniqueDestCount {
+		return fmt.Errorf("唯一目标端口数量 %d != %d", a.Port.UniqueDestCount, b.Port.UniqueDestCount)
+	}
+	for i := range a.IP.TopPairs {
+		x, y := rankValue(a.IP.TopPairs[i].Count, a.IP.TopPairs[i].Bytes, a.IP.RankBy), rankValue(b.IP.TopPairs[i].Count, b.IP.TopPairs[i].Bytes, b.IP.RankBy)
+		if x != y {
+			return fmt.Errorf("第%d个源IP的%s %d != %d", i+1, a.IP.RankBy, x, y)
+		}
+		x, y = rankValue(a.Port.TopPairs[i].Count, a.Port.TopPairs[i].Bytes, a.Port.RankBy), rankValue(b.Port.TopPairs[i].Count, b.Port.TopPairs[i].Bytes, b.Port.RankBy)
+		if x != y {
+			return fmt.Errorf("第%d个目标端口的%s %d != %d", i+1, a.Port.RankBy, x, y)
+		}
+	}
+
+	protocols := make(map[string]models.Traffic)
+	for _, proto := range a.Protocol.Protocols {
+		protocols[proto.Name] = models.Traffic{Packets: proto.Count, Bytes: proto.Bytes}
+	}
+	for _, proto := range b.Protocol.Protocols {
+		if want := (models.Traffic{Packets: proto.Count, Bytes: proto.Bytes}); protocols[proto.Name] != want {
+			return fmt.Errorf("协议 %s 的数据包数和字节数 %v != %v", proto.Name, protocols[proto.Name], want)
+		}
+	}
+	if len(a.Protocol.Protocols) != len(b.Protocol.Protocols) {
+		return fmt.Errorf("协议数量 %d != %d", len(a.Protocol.Protocols), len(b.Protocol.Protocols))
+	}
+
+	flags := make(map[string]models.Traffic)
+	for _, flag := range a.TCPFlags.Flags {
+		flags[flag.Flag] = models.Traffic{Packets: flag.Count, Bytes: flag.Bytes}
+	}
+	for _, flag := range b.TCPFlags.Flags {
+		if want := (models.Traffic{Packets: flag.Count, Bytes: flag.Bytes}); flags[flag.Flag] != want {
+			return fmt.Errorf("TCP标志 %s 的数据包数和字节数 %v != %v", flag.Flag, flags[flag.Flag], want)
+		}
+	}
+	if len(a.TCPFlags.Flags) != len(b.TCPFlags.Flags) {
+		return fmt.Errorf("TCP标志组合数量 %d != %d", len(a.TCPFlags.Flags), len(b.TCPFlags.Flags))
+	}
+	return nil
+}
+
+// rankValue 返回排行项中排序依据对应的数值
+func rankValue(packets, bytes uint64, by models.RankBy) uint64 {
+	return models.Traffic{Packets: packets, Bytes: bytes}.Value(by)
+}
+
+// average 计算平均耗时
+func average(times []time.Duration) time.Duration {
+	if len(times) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, t := range times {
+		total += t
+	}
+	return total / time.Duration(len(times))
+}
+
+// fastest 返回最短耗时
+func fastest(times []time.Duration) time.Duration {
+	var best time.Duration
+	for i, t := range times {
+		if i == 0 || t < best {
+			best = t
+		}
+	}
+	return best
+}
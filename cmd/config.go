@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"SnapFlow/internal/db"
+	"SnapFlow/internal/geoip"
+	"SnapFlow/internal/models"
+	"SnapFlow/internal/network"
+	"SnapFlow/internal/services"
+)
+
+// tableConfig 采集时使用的源数据表
+type tableConfig struct {
+	packetTable db.Identifier // 原始数据包表
+	statsTable  db.Identifier // 预聚合统计表
+}
+
+// collectorConfig 快照采集的配置
+type collectorConfig struct {
+	tables              tableConfig
+	labels              models.Labels         // 传感器、站点和网卡标签，写入每个快照和每张表
+	profile             string                // 采集配置档名称，参与快照ID的计算
+	interval            time.Duration         // 采集间隔，窗口结束时间对齐到该间隔
+	windowLength        time.Duration         // 每个快照覆盖的时间窗口长度
+	singleScan          bool                  // 只扫描一次窗口推导各项统计，为false时按统计项分别查询
+	rankIPsBy           models.RankBy         // 源IP排行的排序依据
+	rankPortsBy         models.RankBy         // 目标端口排行的排序依据，也用于按传输层协议区分的端口排行
+	transportPorts      bool                  // 采集按传输层协议区分的目标端口、源端口和服务端口排行，以及服务分布
+	talkers             bool                  // 采集目标IP、会话和五元组流排行
+	l2                  bool                  // 采集EtherType分布、目标MAC地址类型分布和热门目标MAC地址
+	rankMACsBy          models.RankBy         // 目标MAC地址排行的排序依据
+	classification      bool                  // 采集应用层协议分布和流量分类统计（数据包类型、应用交叉统计、非标准端口）
+	packetSize          bool                  // 采集所有数据包和各协议的数据包大小直方图及百分位数
+	throughput          bool                  // 按亚秒级时间桶采集峰值速率和微突发
+	burstBucket         time.Duration         // 峰值速率和微突发的时间桶大小
+	burstFactor         float64               // 时间桶速率超过有流量时间桶平均速率的倍数时计为微突发
+	direction           bool                  // 按内部网络采集各流量方向的总量、热门地址和协议、端口分布
+	internalNetworks    *network.PrefixSet    // 内部网络的IPv4和IPv6前缀
+	rankDirectionsBy    models.RankBy         // 流量方向内地址和目标端口排行的排序依据
+	prefix              bool                  // 按IPv4和IPv6前缀汇总源地址和目标地址，采集唯一前缀数量和热门前缀
+	prefixLengths       network.PrefixLengths // 前缀汇总使用的IPv4和IPv6前缀长度
+	rankPrefixesBy      models.RankBy         // 前缀排行的排序依据
+	geoCityDB           string                // 本地城市或国家mmdb文件路径，为空时不解析国家和城市
+	geoASNDB            string                // 本地ASN mmdb文件路径，为空时不解析自治系统
+	geoCacheSize        int                   // 地址解析结果的LRU缓存大小
+	geo                 *geoip.Resolver       // 打开的mmdb文件，为nil时不采集国家和自治系统统计
+	rankGeoBy           models.RankBy         // 国家和自治系统排行的排序依据
+	rankDestinationsBy  models.RankBy         // 目标IP排行的排序依据
+	rankConversationsBy models.RankBy         // 会话排行的排序依据
+	rankFlowsBy         models.RankBy         // 五元组流排行的排序依据
+	flows               *db.FlowSet           // GrepTimeDB Flow预聚合定义，为nil时不读取预聚合表
+}
+
+// loadCollectorConfig 从环境变量读取并校验采集配置
+func loadCollectorConfig() (collectorConfig, error) {
+	var cfg collectorConfig
+
+	tables, err := loadTableConfig()
+	if err != nil {
+		return cfg, err
+	}
+
+	hostname, _ := os.Hostname()
+	cfg.tables = tables
+	cfg.labels = models.Labels{
+		Sensor:    getEnv("SENSOR_ID", hostname),
+		Site:      getEnv("SENSOR_SITE", ""),
+		Interface: getEnv("SENSOR_INTERFACE", ""),
+	}
+	cfg.profile = getEnv("SNAPSHOT_PROFILE", "default")
+	cfg.interval = getEnvDuration("SNAPSHOT_INTERVAL", 5*time.Second)
+	cfg.windowLength = getEnvDuration("WINDOW_LENGTH", time.Minute)
+
+	// 默认仍按统计项分别查询，与之前的版本一致；用 snapflow bench 比较后再设置 COLLECT_MODE=scan
+	switch mode := getEnv("COLLECT_MODE", "legacy"); mode {
+	case "scan":
+		cfg.singleScan = true
+	case "legacy":
+		cfg.singleScan = false
+	default:
+		return cfg, fmt.Errorf("COLLECT_MODE 无效: %q（可选 scan、legacy）", mode)
+	}
+
+	// RANK_BY 同时设置所有排行，RANK_<排行>_BY 分别覆盖
+	rankBy := getEnv("RANK_BY", string(models.RankByPackets))
+	for _, rank := range []struct {
+		env    string
+		target *models.RankBy
+	}{
+		{"RANK_IPS_BY", &cfg.rankIPsBy},
+		{"RANK_PORTS_BY", &cfg.rankPortsBy},
+		{"RANK_DESTINATIONS_BY", &cfg.rankDestinationsBy},
+		{"RANK_CONVERSATIONS_BY", &cfg.rankConversationsBy},
+		{"RANK_FLOWS_BY", &cfg.rankFlowsBy},
+		{"RANK_MACS_BY", &cfg.rankMACsBy},
+		{"RANK_DIRECTIONS_BY", &cfg.rankDirectionsBy},
+		{"RANK_PREFIXES_BY", &cfg.rankPrefixesBy},
+		{"RANK_GEO_BY", &cfg.rankGeoBy},
+	} {
+		if *rank.target, err = models.ParseRankBy(getEnv(rank.env, rankBy)); err != nil {
+			return cfg, fmt.Errorf("%s: %w", rank.env, err)
+		}
+	}
+	cfg.talkers = getEnv("TALKER_STATS_ENABLED", "true") == "true"
+	cfg.transportPorts = getEnv("TRANSPORT_PORT_STATS_ENABLED", "true") == "true"
+	cfg.l2 = getEnv("L2_STATS_ENABLED", "true") == "true"
+	cfg.classification = getEnv("CLASSIFICATION_STATS_ENABLED", "true") == "true"
+	cfg.packetSize = getEnv("PACKET_SIZE_STATS_ENABLED", "true") == "true"
+	cfg.throughput = getEnv("THROUGHPUT_STATS_ENABLED", "true") == "true"
+	cfg.burstBucket = getEnvDuration("BURST_BUCKET", 100*time.Millisecond)
+	cfg.burstFactor = getEnvFloat("BURST_FACTOR", 3)
+	cfg.direction = getEnv("DIRECTION_STATS_ENABLED", "true") == "true"
+	cfg.prefix = getEnv("PREFIX_STATS_ENABLED", "true") == "true"
+	cfg.geoCityDB = getEnv("GEOIP_CITY_DB", "")
+	cfg.geoASNDB = getEnv("GEOIP_ASN_DB", "")
+	cfg.geoCacheSize = getEnvInt("GEOIP_CACHE_SIZE", geoip.DefaultCacheSize)
+
+	if cfg.interval <= 0 {
+		return cfg, fmt.Errorf("SNAPSHOT_INTERVAL 必须大于0")
+	}
+	if cfg.windowLength <= 0 {
+		return cfg, fmt.Errorf("WINDOW_LENGTH 必须大于0")
+	}
+	if cfg.burstBucket < time.Millisecond || cfg.burstBucket > time.Second || cfg.burstBucket%time.Millisecond != 0 {
+		return cfg, fmt.Errorf("BURST_BUCKET 必须是1毫秒到1秒之间的整数毫秒")
+	}
+	if cfg.burstFactor <= 1 {
+		return cfg, fmt.Errorf("BURST_FACTOR 必须大于1")
+	}
+
+	// INTERNAL_NETWORKS 为逗号分隔的前缀，例如 10.0.0.0/8,2001:db8::/32；未设置时使用私有地址
+	if cfg.internalNetworks, err = network.ParsePrefixes(getEnv("INTERNAL_NETWORKS", network.DefaultInternalPrefixes)); err != nil {
+		return cfg, fmt.Errorf("INTERNAL_NETWORKS: %w", err)
+	}
+	if cfg.direction && cfg.internalNetworks.Len() == 0 {
+		return cfg, fmt.Errorf("INTERNAL_NETWORKS 不能为空，或设置 DIRECTION_STATS_ENABLED=false")
+	}
+
+	// PREFIX_LENGTHS_IPV4 和 PREFIX_LENGTHS_IPV6 为逗号分隔的前缀长度，设置为空时不汇总该地址族
+	if cfg.prefixLengths, err = network.ParsePrefixLengths(getEnv("PREFIX_LENGTHS_IPV4", "24,16"), getEnv("PREFIX_LENGTHS_IPV6", "64,48")); err != nil {
+		return cfg, fmt.Errorf("PREFIX_LENGTHS: %w", err)
+	}
+	if cfg.prefix && cfg.prefixLengths.IsZero() {
+		return cfg, fmt.Errorf("PREFIX_LENGTHS_IPV4 和 PREFIX_LENGTHS_IPV6 不能都为空，或设置 PREFIX_STATS_ENABLED=false")
+	}
+
+	// GEOIP_CITY_DB 和 GEOIP_ASN_DB 为本地mmdb文件路径，在连接源数据库后打开
+	if cfg.geoCacheSize <= 0 {
+		return cfg, fmt.Errorf("GEOIP_CACHE_SIZE 必须大于0")
+	}
+
+	if getEnv("FLOWS_ENABLED", "true") == "true" {
+		if cfg.flows, err = loadFlowSet(cfg); err != nil {
+			return cfg, err
+		}
+	}
+	return cfg, nil
+}
+
+// addressStats 返回启用的按地址汇总的统计项，由同一次按地址分组的扫描得出
+func (cfg collectorConfig) addressStats() db.AddressStatsConfig {
+	var stats db.AddressStatsConfig
+	if cfg.direction {
+		stats.Internal = cfg.internalNetworks
+	}
+	if cfg.prefix {
+		stats.PrefixLengths = cfg.prefixLengths
+	}
+	stats.GeoIP = cfg.geo
+	return stats
+}
+
+// loadTableConfig 从环境变量读取并校验源数据表名
+func loadTableConfig() (tableConfig, error) {
+	var cfg tableConfig
+
+	packetTable, err := db.ParseIdentifier(getEnv("PACKET_TABLE", "packet_data"))
+	if err != nil {
+		return cfg, fmt.Errorf("PACKET_TABLE: %w", err)
+	}
+	statsTable, err := db.ParseIdentifier(getEnv("STATS_TABLE", "packets_statistics2"))
+	if err != nil {
+		return cfg, fmt.Errorf("STATS_TABLE: %w", err)
+	}
+
+	cfg.packetTable = packetTable
+	cfg.statsTable = statsTable
+	return cfg, nil
+}
+
+// loadSaveOptions 从环境变量读取写入GrepTimeDB的选项
+//
+// PROTOCOL_BUCKETS 和 TCP_FLAG_BUCKETS 定义 network_distribution_buckets 中的分组，
+// 例如 tcp=TCP;udp=UDP;icmp=ICMP|IPv6-ICMP;gre=GRE;ipsec=ESP|AH，未设置时使用默认分组。
+func loadSaveOptions() (db.SaveOptions, error) {
+	var opts db.SaveOptions
+
+	mode, err := db.ParseWriteMode(getEnv("GREPTIME_WRITE_MODE", string(db.WriteModeMarker)))
+	if err != nil {
+		return opts, err
+	}
+	protocols, err := db.ParseBuckets(getEnv("PROTOCOL_BUCKETS", ""))
+	if err != nil {
+		return opts, fmt.Errorf("PROTOCOL_BUCKETS: %w", err)
+	}
+	tcpFlags, err := db.ParseBuckets(getEnv("TCP_FLAG_BUCKETS", ""))
+	if err != nil {
+		return opts, fmt.Errorf("TCP_FLAG_BUCKETS: %w", err)
+	}
+
+	opts.Mode = mode
+	opts.Buckets = db.DistributionBuckets{Protocols: protocols, TCPFlags: tcpFlags}
+	return opts, nil
+}
+
+// loadServiceRegistry 根据环境变量创建服务注册表，优先级从高到低为：
+// SERVICE_OVERRIDES 中的条目、SERVICE_OVERRIDES_FILE 中的条目、内置的常见服务、
+// SERVICES_FILE 指定的IANA CSV或 /etc/services 格式文件；APP_STANDARD_PORTS 补充应用的标准端口
+func loadServiceRegistry() (*services.Registry, error) {
+	var tables []*services.Table
+
+	if overrides := getEnv("SERVICE_OVERRIDES", ""); overrides != "" {
+		table, err := services.ParseOverrides(overrides)
+		if err != nil {
+			return nil, fmt.Errorf("SERVICE_OVERRIDES: %w", err)
+		}
+		tables = append(tables, table)
+	}
+	if path := getEnv("SERVICE_OVERRIDES_FILE", ""); path != "" {
+		text, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("SERVICE_OVERRIDES_FILE: %w", err)
+		}
+		table, err := services.ParseOverrides(string(text))
+		if err != nil {
+			return nil, fmt.Errorf("SERVICE_OVERRIDES_FILE %s: %w", path, err)
+		}
+		tables = append(tables, table)
+	}
+
+	tables = append(tables, services.Builtin())
+
+	if path := getEnv("SERVICES_FILE", ""); path != "" {
+		table, err := services.LoadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("SERVICES_FILE: %w", err)
+		}
+		tables = append(tables, table)
+		fmt.Printf("✓ 已加载服务数据文件 %s（%d 个条目）\n", path, table.Len())
+	}
+
+	// APP_STANDARD_PORTS 中的应用标准端口优先于内置的常见应用，例如 SSH=22|2222;git=9418/tcp
+	var apps []*services.Applications
+	if text := getEnv("APP_STANDARD_PORTS", ""); text != "" {
+		table, err := services.ParseApplications(text)
+		if err != nil {
+			return nil, fmt.Errorf("APP_STANDARD_PORTS: %w", err)
+		}
+		apps = append(apps, table)
+	}
+	apps = append(apps, services.BuiltinApplications())
+
+	return services.New(tables...).WithApplications(apps...), nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"SnapFlow/internal/db"
+)
+
+// loadFlowSet 根据采集配置生成Flow定义
+//
+// FLOW_BUCKET 默认取采集间隔和窗口长度的最大公约数，保证每个快照窗口都由完整的桶组成；
+// 默认值不是整秒时不使用Flow。FLOW_EXPIRE 为Flow接受迟到数据的时长。
+func loadFlowSet(cfg collectorConfig) (*db.FlowSet, error) {
+	bucket := gcdDuration(cfg.interval, cfg.windowLength)
+	if _, set := os.LookupEnv("FLOW_BUCKET"); set {
+		bucket = getEnvDuration("FLOW_BUCKET", bucket)
+		if bucket <= 0 || cfg.interval%bucket != 0 || cfg.windowLength%bucket != 0 {
+			return nil, fmt.Errorf("FLOW_BUCKET %s 必须能整除 SNAPSHOT_INTERVAL 和 WINDOW_LENGTH", bucket)
+		}
+	} else if bucket%time.Second != 0 {
+		return nil, nil
+	}
+
+	flows, err := db.NewFlowSet(cfg.tables.packetTable, bucket, getEnvDuration("FLOW_EXPIRE", time.Hour))
+	if err != nil {
+		return nil, fmt.Errorf("FLOW_BUCKET: %w", err)
+	}
+	return flows, nil
+}
+
+// gcdDuration 计算两个时长的最大公约数
+func gcdDuration(a, b time.Duration) time.Duration {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// setupFlows 启动采集前检查Flow是否可用，FLOWS_AUTO_CREATE=true 时先创建缺少的Flow
+//
+// 返回nil表示不读取预聚合表，采集时直接扫描原始数据。
+func setupFlows(ctx context.Context, source *db.SourceDB, cfg collectorConfig) *db.FlowSet {
+	if cfg.flows == nil || source.Dialect() != db.MySQL {
+		return nil
+	}
+
+	if getEnv("FLOWS_AUTO_CREATE", "false") == "true" {
+		created, err := cfg.flows.Create(ctx, source)
+		if err != nil {
+			fmt.Printf("- 创建Flow失败，使用原始数据扫描: %v\n", err)
+			return nil
+		}
+		if created > 0 {
+			fmt.Printf("✓ 已创建 %d 个Flow\n", created)
+		}
+	}
+
+	if !cfg.flows.Available(ctx, source) {
+		fmt.Println("- 未检测到Flow预聚合表，使用原始数据扫描")
+		return nil
+	}
+	fmt.Printf("✓ 使用Flow预聚合表（时间桶 %s），数据不完整的窗口回退到原始数据扫描\n", cfg.flows.Bucket())
+	return cfg.flows
+}
+
+// runFlows 执行 flows status、flows create 或 flows drop
+func runFlows(ctx context.Context, source *db.SourceDB, cfg collectorConfig, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("用法: snapflow flows status|create|drop")
+	}
+	if cfg.flows == nil {
+		return fmt.Errorf("Flow未启用：检查 FLOWS_ENABLED 和 FLOW_BUCKET")
+	}
+
+	switch args[0] {
+	case "status":
+		states, err := cfg.flows.Status(ctx, source)
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			status := "未创建"
+			switch {
+			case state.Exists && state.LatestTime.IsZero():
+				status = "已创建，暂无数据"
+			case state.Exists:
+				status = "已创建，最新时间桶 " + state.LatestTime.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("- %s -> %s: %s\n", state.Name, state.Sink, status)
+		}
+		return nil
+	case "create":
+		created, err := cfg.flows.Create(ctx, source)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ 已创建 %d 个Flow（时间桶 %s）\n", created, cfg.flows.Bucket())
+		return nil
+	case "drop":
+		if err := cfg.flows.Drop(ctx, source); err != nil {
+			return err
+		}
+		fmt.Println("✓ 已删除Flow，结果表保留")
+		return nil
+	default:
+		return fmt.Errorf("未知的Flow命令 %q（可选 status、create、drop）", args[0])
+	}
+}
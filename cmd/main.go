@@ -6,15 +6,22 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
 
 	"SnapFlow/internal/db"
+	"SnapFlow/internal/geoip"
 	"SnapFlow/internal/models"
+	"SnapFlow/internal/services"
+	"SnapFlow/internal/sink"
 )
 
 func main() {
@@ -22,21 +29,128 @@ func main() {
 	// 设置上下文
 	ctx := context.Background()
 
-	// 连接到数据库（GrepTimeDB和MySQL共享同一个连接）
-	database, err := connectToDatabase()
+	// 读取采集配置，非法的表名等配置在启动时直接拒绝
+	cfg, err := loadCollectorConfig()
 	if err != nil {
-		log.Fatalf("连接到数据库失败: %v", err)
+		log.Fatalf("采集配置无效: %v", err)
 	}
-	defer database.Close()
 
-	// 创建所需的表
-	if err := db.CreateGrepTimeDBTables(ctx, database); err != nil {
-		log.Fatalf("创建GrepTimeDB表失败: %v", err)
+	rc, err := loadRollupConfig()
+	if err != nil {
+		log.Fatalf("汇总配置无效: %v", err)
+	}
+
+	// 服务注册表决定统计、持久化和输出中的服务名称
+	registry, err := loadServiceRegistry()
+	if err != nil {
+		log.Fatalf("服务注册表配置无效: %v", err)
+	}
+	services.SetDefault(registry)
+
+	// 基准测试模式：在合成数据上比较两种采集方式，不连接任何已配置的数据库
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		if err := runBench(ctx, cfg, os.Args[2:]); err != nil {
+			log.Fatalf("基准测试失败: %v", err)
+		}
+		return
+	}
+
+	// 连接到保存快照的数据库（GrepTimeDB），只在需要读写快照表时连接
+	var database *sql.DB
+	if needsSinkDatabase(rc) {
+		database, err = connectSinkDatabase()
+		if err != nil {
+			log.Fatalf("连接到快照数据库失败: %v", err)
+		}
+		defer database.Close()
+	}
+
+	// 迁移模式：查看或升级GrepTimeDB的表结构，不启动采集
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(ctx, database, os.Args[2:]); err != nil {
+			log.Fatalf("迁移失败: %v", err)
+		}
+		return
+	}
+
+	// 汇总和查询模式：读写各层级的快照表，需要表结构与程序一致
+	if len(os.Args) > 1 && (os.Args[1] == "rollup" || os.Args[1] == "query") {
+		if err := db.CheckSchemaVersion(ctx, database); err != nil {
+			log.Fatalf("检查表结构失败: %v", err)
+		}
+		if os.Args[1] == "rollup" {
+			err = runRollup(ctx, database, rc, os.Args[2:])
+		} else {
+			err = runQuery(ctx, database, os.Args[2:])
+		}
+		if err != nil {
+			log.Fatalf("%s 失败: %v", os.Args[1], err)
+		}
+		return
+	}
+
+	// Flow管理模式：在源数据库（GrepTimeDB）中查看、创建或删除预聚合Flow，不启动采集
+	if len(os.Args) > 1 && os.Args[1] == "flows" {
+		source, err := connectSourceDatabase()
+		if err != nil {
+			log.Fatalf("连接到源数据库失败: %v", err)
+		}
+		defer source.Close()
+		if err := runFlows(ctx, source, cfg, os.Args[2:]); err != nil {
+			log.Fatalf("flows 失败: %v", err)
+		}
+		return
+	}
+
+	// 创建输出目标（GrepTimeDB、JSON Lines、Parquet、SQLite、行协议、汇总中心推送）
+	output, err := buildSinks(ctx, database)
+	if err != nil {
+		log.Fatalf("创建输出目标失败: %v", err)
+	}
+
+	// 汇总中心模式：不采集，只接收各传感器推送的快照并合并为全局快照
+	if len(os.Args) > 1 && os.Args[1] == "aggregate" {
+		if err := runAggregator(ctx, database, rc, output); err != nil {
+			log.Printf("汇总中心退出时出错: %v", err)
+		}
+		if err := output.Close(); err != nil {
+			log.Printf("关闭输出目标失败: %v", err)
+		}
+		return
+	}
+
+	// 连接到读取原始数据包的源数据库，与保存快照的数据库相互独立
+	source, err := connectSourceDatabase()
+	if err != nil {
+		log.Fatalf("连接到源数据库失败: %v", err)
+	}
+	defer source.Close()
+
+	// 检查源数据库中是否有可用的Flow预聚合表
+	cfg.flows = setupFlows(ctx, source, cfg)
+
+	// 打开本地GeoIP和ASN数据库，地址只在本地解析，不发送到任何在线服务
+	if cfg.geo, err = geoip.Open(cfg.geoCityDB, cfg.geoASNDB, cfg.geoCacheSize); err != nil {
+		log.Fatalf("打开GeoIP数据库失败: %v", err)
+	}
+	if cfg.geo != nil {
+		defer cfg.geo.Close()
+		fmt.Printf("✓ 使用本地GeoIP数据库: %s\n", cfg.geo)
+	}
+
+	// 回填模式：对指定时间范围内的每个窗口重新采集，已有数据会被覆盖
+	if len(os.Args) > 1 && os.Args[1] == "backfill" {
+		if err := runBackfill(ctx, source, cfg, output, os.Args[2:]); err != nil {
+			log.Printf("回填失败: %v", err)
+		}
+		if err := output.Close(); err != nil {
+			log.Printf("关闭输出目标失败: %v", err)
+		}
+		return
 	}
-	fmt.Println("✓ GrepTimeDB表创建完成")
 
-	// 设置定时器，每5秒执行一次
-	ticker := time.NewTicker(5 * time.Second)
+	// 设置定时器，按采集间隔执行
+	ticker := time.NewTicker(cfg.interval)
 	defer ticker.Stop()
 
 	// 设置信号处理以便于优雅退出
@@ -44,10 +158,10 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	fmt.Println("\n开始自动快照采集，每5秒一次。按Ctrl+C退出...\n")
+	fmt.Printf("\n开始自动快照采集，每%s一次，窗口长度%s。按Ctrl+C退出...\n", cfg.interval, cfg.windowLength)
 
 	// 启动时立即执行一次
-	go collectAndSaveSnapshot(ctx, database)
+	go collectAndSaveSnapshot(ctx, source, cfg, output, time.Now())
 
 	// 主循环
 	go func() {
@@ -56,7 +170,7 @@ func main() {
 			select {
 			case <-ticker.C:
 				fmt.Printf("\n--- 开始采集第 %d 个快照 ---\n", snapshotCount)
-				collectAndSaveSnapshot(ctx, database)
+				collectAndSaveSnapshot(ctx, source, cfg, output, time.Now())
 				snapshotCount++
 			case <-done:
 				return
@@ -64,81 +178,285 @@ func main() {
 		}
 	}()
 
+	// 汇总任务：定期把原始快照汇总到1分钟、1小时、1天层级
+	stopRollup := make(chan struct{})
+	if rc.enabled {
+		go runRollupLoop(ctx, database, rc, stopRollup)
+	}
+
 	// 等待退出信号
 	<-sigChan
 	fmt.Println("\n接收到退出信号，正在关闭...")
 	done <- true
+	close(stopRollup)
+
+	// 等待各输出目标写完队列中的快照
+	if err := output.Close(); err != nil {
+		log.Printf("关闭输出目标失败: %v", err)
+	}
 	fmt.Println("程序已退出")
 }
 
-// collectAndSaveSnapshot 收集网络流量快照并保存到GrepTimeDB
-func collectAndSaveSnapshot(ctx context.Context, database *sql.DB) {
-
-	// 设置表名
-	packetTableName := "packet_data"
-	statsTableName := "packets_statistics2"
-
-	// 创建新快照
-	snapshot := models.NewSnapshot()
+// collectAndSaveSnapshot 收集now所在对齐窗口的网络流量快照并交给输出目标保存
+func collectAndSaveSnapshot(ctx context.Context, source *db.SourceDB, cfg collectorConfig, output sink.SnapshotSink, now time.Time) {
+	tables := cfg.tables
+
+	// 创建新快照，窗口对齐到采集间隔，快照ID由窗口确定
+	start, end := models.AlignWindow(now, cfg.interval, cfg.windowLength)
+	snapshot := models.NewSnapshotForWindow(cfg.labels, cfg.profile, start, end)
+	snapshot.IP.RankBy = cfg.rankIPsBy
+	snapshot.Port.RankBy = cfg.rankPortsBy
+	snapshot.Destination.RankBy = cfg.rankDestinationsBy
+	snapshot.Conversation.RankBy = cfg.rankConversationsBy
+	snapshot.Flow.RankBy = cfg.rankFlowsBy
+	snapshot.L2.RankBy = cfg.rankMACsBy
+	snapshot.Direction.RankBy = cfg.rankDirectionsBy
+	snapshot.Prefix.RankBy = cfg.rankPrefixesBy
+	snapshot.Geo.RankBy = cfg.rankGeoBy
 
 	fmt.Println("开始收集网络流量统计数据...")
 
 	// 1. 填充基本统计信息
-	if err := db.FillBasicStats(ctx, database, statsTableName, snapshot); err != nil {
+	if err := db.FillBasicStats(ctx, source, tables.statsTable, snapshot); err != nil {
 		log.Printf("填充基本统计信息失败: %v", err)
 	} else {
 		fmt.Println("✓ 基本统计数据收集完成")
 	}
 
-	// 2. 填充IP统计
-	if err := db.FillIPStats(ctx, database, packetTableName, snapshot); err != nil {
+	// 2. 优先读取Flow预聚合表，不可用时单次扫描窗口，同时得到IP、端口、协议和TCP标志统计
+	fromFlows := false
+	if cfg.flows != nil {
+		var err error
+		if fromFlows, err = db.FillFlowStats(ctx, source, cfg.flows, snapshot); err != nil {
+			log.Printf("读取Flow预聚合表失败，回退到原始数据扫描: %v", err)
+		} else if fromFlows {
+			fmt.Println("✓ IP、端口、协议和TCP标志统计数据收集完成（Flow预聚合）")
+		}
+	}
+
+	switch {
+	case fromFlows:
+	case cfg.singleScan:
+		if err := db.FillWindowStats(ctx, source, tables.packetTable, snapshot); err != nil {
+			log.Printf("扫描快照窗口失败: %v", err)
+		} else {
+			fmt.Println("✓ IP、端口、协议和TCP标志统计数据收集完成")
+		}
+	default:
+		fillStatsSeparately(ctx, source, tables.packetTable, snapshot)
+	}
+
+	// 3. 目标IP、会话和五元组流需要按目标IP和端口分组，不能由上面的预聚合或单次扫描推导，单独查询
+	if cfg.talkers {
+		fillTalkerStats(ctx, source, tables.packetTable, snapshot)
+	}
+
+	// 4. 按传输层协议区分的端口排行和服务分布需要源端口，同样单独查询
+	if cfg.transportPorts {
+		if err := db.FillTransportPortStats(ctx, source, tables.packetTable, snapshot); err != nil {
+			log.Printf("填充传输层端口统计失败: %v", err)
+		} else {
+			fmt.Println("✓ 传输层端口统计数据收集完成")
+		}
+	}
+
+	// 5. 二层统计需要EtherType和目标MAC地址，同样单独查询
+	if cfg.l2 {
+		if err := db.FillL2Stats(ctx, source, tables.packetTable, snapshot); err != nil {
+			log.Printf("填充二层统计失败: %v", err)
+		} else {
+			fmt.Println("✓ 二层统计数据收集完成")
+		}
+	}
+
+	// 6. 应用层协议分布和流量分类统计需要应用、数据包类型和端口对，同样单独查询
+	if cfg.classification {
+		if err := db.FillClassificationStats(ctx, source, tables.packetTable, snapshot); err != nil {
+			log.Printf("填充流量分类统计失败: %v", err)
+		} else {
+			fmt.Println("✓ 流量分类统计数据收集完成")
+		}
+	}
+
+	// 7. 数据包大小直方图需要每个数据包的大小，同样单独查询
+	if cfg.packetSize {
+		if err := db.FillPacketSizeStats(ctx, source, tables.packetTable, snapshot); err != nil {
+			log.Printf("填充数据包大小统计失败: %v", err)
+		} else {
+			fmt.Println("✓ 数据包大小统计数据收集完成")
+		}
+	}
+
+	// 8. 峰值速率和微突发需要按亚秒级时间桶分组，同样单独查询
+	if cfg.throughput {
+		if err := db.FillThroughputStats(ctx, source, tables.packetTable, snapshot, cfg.burstBucket, cfg.burstFactor); err != nil {
+			log.Printf("填充吞吐速率统计失败: %v", err)
+		} else {
+			fmt.Println("✓ 吞吐速率统计数据收集完成")
+		}
+	}
+
+	// 9. 流量方向、前缀和国家自治系统统计都按源和目标地址汇总，共用一次扫描；
+	// 国家和自治系统需要解析排行中的地址，因此在所有排行填充之后查询
+	if addressStats := cfg.addressStats(); addressStats.Enabled() {
+		if err := db.FillAddressStats(ctx, source, tables.packetTable, snapshot, addressStats); err != nil {
+			log.Printf("填充流量方向、前缀和国家自治系统统计失败: %v", err)
+		} else {
+			fmt.Println("✓ 流量方向、前缀和国家自治系统统计数据收集完成")
+		}
+	}
+
+	// 10. 将快照数据交给输出目标，各目标独立写入
+	fmt.Println("将网络流量快照分发到输出目标...")
+	if err := output.Write(ctx, snapshot); err != nil {
+		log.Printf("分发快照失败: %v", err)
+	}
+
+	// 11. 显示统计摘要
+	fmt.Printf("✓ 快照采集完成 - 总计 %d 个数据包，%d 字节", snapshot.Basic.TotalPackets, snapshot.Basic.TotalBytes)
+	if snapshot.Throughput.BucketMillis > 0 {
+		fmt.Printf("，平均 %.2f pps、%.2f bps", snapshot.Throughput.PacketsPerSecond(), snapshot.Throughput.BitsPerSecond())
+	}
+	fmt.Println()
+
+	// 12. 可选：输出JSON格式的摘要
+	if os.Getenv("VERBOSE_OUTPUT") == "true" {
+		jsonStr, _ := snapshotToJSON(snapshot)
+		fmt.Printf("快照摘要:\n%s\n", jsonStr)
+	}
+}
+
+// fillStatsSeparately 按统计项分别查询窗口，每项各扫描一次（COLLECT_MODE=legacy）
+func fillStatsSeparately(ctx context.Context, source *db.SourceDB, packetTable db.Identifier, snapshot *models.Snapshot) {
+	// 1. 填充IP统计
+	if err := db.FillIPStats(ctx, source, packetTable, snapshot); err != nil {
 		log.Printf("填充IP统计失败: %v", err)
 	} else {
 		fmt.Println("✓ IP统计数据收集完成")
 	}
 
-	// 3. 填充端口统计
-	if err := db.FillPortStats(ctx, database, packetTableName, snapshot); err != nil {
+	// 2. 填充端口统计
+	if err := db.FillPortStats(ctx, source, packetTable, snapshot); err != nil {
 		log.Printf("填充端口统计失败: %v", err)
 	} else {
 		fmt.Println("✓ 端口统计数据收集完成")
 	}
 
-	// 4. 填充协议统计
-	if err := db.FillProtocolStats(ctx, database, packetTableName, snapshot); err != nil {
+	// 3. 填充协议统计
+	if err := db.FillProtocolStats(ctx, source, packetTable, snapshot); err != nil {
 		log.Printf("填充协议统计失败: %v", err)
 	} else {
 		fmt.Println("✓ 协议统计数据收集完成")
 	}
 
-	// 5. 填充TCP标志统计
-	if err := db.FillTCPFlagsStats(ctx, database, packetTableName, snapshot); err != nil {
+	// 4. 填充TCP标志统计
+	if err := db.FillTCPFlagsStats(ctx, source, packetTable, snapshot); err != nil {
 		log.Printf("填充TCP标志统计失败: %v", err)
 	} else {
 		fmt.Println("✓ TCP标志统计数据收集完成")
 	}
+}
 
-	// 6. 将快照数据保存到GrepTimeDB
-	fmt.Println("将网络流量快照保存到GrepTimeDB...")
-	if err := db.SaveSnapshotToGrepTimeDB(ctx, database, snapshot); err != nil {
-		log.Printf("保存快照到GrepTimeDB失败: %v", err)
-		return
+// fillTalkerStats 查询目标IP、会话和五元组流排行，回答“谁在和谁通信”
+func fillTalkerStats(ctx context.Context, source *db.SourceDB, packetTable db.Identifier, snapshot *models.Snapshot) {
+	// 1. 填充目标IP统计
+	if err := db.FillDestinationStats(ctx, source, packetTable, snapshot); err != nil {
+		log.Printf("填充目标IP统计失败: %v", err)
+	} else {
+		fmt.Println("✓ 目标IP统计数据收集完成")
 	}
 
-	// 7. 显示统计摘要
-	fmt.Printf("✓ 快照采集完成 - 总计 %d 个数据包，%d 字节\n",
-		snapshot.Basic.TotalPackets,
-		snapshot.Basic.TotalBytes)
+	// 2. 填充会话统计
+	if err := db.FillConversationStats(ctx, source, packetTable, snapshot); err != nil {
+		log.Printf("填充会话统计失败: %v", err)
+	} else {
+		fmt.Println("✓ 会话统计数据收集完成")
+	}
 
-	// 8. 可选：输出JSON格式的摘要
-	if os.Getenv("VERBOSE_OUTPUT") == "true" {
-		jsonStr, _ := snapshotToJSON(snapshot)
-		fmt.Printf("快照摘要:\n%s\n", jsonStr)
+	// 3. 填充五元组流统计
+	if err := db.FillFiveTupleStats(ctx, source, packetTable, snapshot); err != nil {
+		log.Printf("填充五元组流统计失败: %v", err)
+	} else {
+		fmt.Println("✓ 五元组流统计数据收集完成")
 	}
 }
 
-// connectToDatabase 连接到共享的数据库
-func connectToDatabase() (*sql.DB, error) {
+// runBackfill 对 [from, to] 范围内的每个对齐窗口重新采集快照
+func runBackfill(ctx context.Context, source *db.SourceDB, cfg collectorConfig, output sink.SnapshotSink, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("用法: snapflow backfill <开始时间> <结束时间>（RFC3339格式）")
+	}
+	from, err := time.Parse(time.RFC3339, args[0])
+	if err != nil {
+		return fmt.Errorf("开始时间无效: %w", err)
+	}
+	to, err := time.Parse(time.RFC3339, args[1])
+	if err != nil {
+		return fmt.Errorf("结束时间无效: %w", err)
+	}
+
+	count := 0
+	for ts := from.Truncate(cfg.interval); !ts.After(to); ts = ts.Add(cfg.interval) {
+		collectAndSaveSnapshot(ctx, source, cfg, output, ts)
+		count++
+	}
+
+	fmt.Printf("✓ 回填完成，共采集 %d 个窗口\n", count)
+	return nil
+}
+
+// runMigrate 执行 migrate status 或 migrate up
+func runMigrate(ctx context.Context, database *sql.DB, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("用法: snapflow migrate status|up")
+	}
+
+	switch args[0] {
+	case "status":
+		states, err := db.MigrationStatus(ctx, database)
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			status := "未应用"
+			switch {
+			case !state.Known:
+				status = "未知（由更新版本的程序应用）"
+			case state.Applied:
+				status = "已应用 " + state.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("- %d_%s: %s\n", state.Version, state.Name, status)
+		}
+		return nil
+	case "up":
+		count, err := db.MigrateUp(ctx, database)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ 迁移完成，本次应用 %d 个迁移，当前结构版本 %d\n", count, db.LatestSchemaVersion())
+		return nil
+	default:
+		return fmt.Errorf("未知的迁移命令 %q（可选 status、up）", args[0])
+	}
+}
+
+// needsSinkDatabase 判断是否需要连接保存快照的GrepTimeDB
+//
+// 迁移、汇总和查询命令直接读写快照表；其余模式只在启用GrepTimeDB输出或汇总任务时需要。
+func needsSinkDatabase(rc rollupConfig) bool {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate", "rollup", "query":
+			return true
+		case "flows":
+			return false
+		}
+	}
+	return sinkEnabled("greptime") || rc.enabled
+}
+
+// connectSinkDatabase 连接到保存快照的GrepTimeDB
+func connectSinkDatabase() (*sql.DB, error) {
 	// 获取数据库连接信息
 	dbUser := getEnv("DB_USER", "greptime_user")
 	dbPass := getEnv("DB_PASSWORD", "greptime_pwd")
@@ -173,6 +491,63 @@ func connectToDatabase() (*sql.DB, error) {
 	return database, nil
 }
 
+// connectSourceDatabase 连接到读取原始数据包和统计表的源数据库
+//
+// SOURCE_DIALECT 选择 mysql（默认）、postgres 或 sqlite，SOURCE_DSN 直接指定连接字符串。
+// 未设置 SOURCE_DSN 时根据 SOURCE_HOST 等变量拼接，mysql 的各项默认沿用 DB_* 的值。
+func connectSourceDatabase() (*db.SourceDB, error) {
+	dialect, err := db.ParseDialect(getEnv("SOURCE_DIALECT", "mysql"))
+	if err != nil {
+		return nil, fmt.Errorf("SOURCE_DIALECT: %w", err)
+	}
+
+	dsn := getEnv("SOURCE_DSN", "")
+	if dsn == "" {
+		if dsn, err = sourceDSN(dialect); err != nil {
+			return nil, err
+		}
+	}
+
+	fmt.Printf("正在连接到 %s 源数据库...\n", dialect.Name())
+
+	source, err := db.OpenSourceDB(dialect, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// 设置连接池
+	source.DB().SetMaxOpenConns(10)
+	source.DB().SetMaxIdleConns(5)
+	source.DB().SetConnMaxLifetime(5 * time.Minute)
+
+	fmt.Println("✓ 成功连接到源数据库")
+	return source, nil
+}
+
+// sourceDSN 根据 SOURCE_* 环境变量拼接源数据库的连接字符串
+func sourceDSN(dialect db.Dialect) (string, error) {
+	switch dialect {
+	case db.MySQL:
+		return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
+			getEnv("SOURCE_USER", getEnv("DB_USER", "greptime_user")),
+			getEnv("SOURCE_PASSWORD", getEnv("DB_PASSWORD", "greptime_pwd")),
+			getEnv("SOURCE_HOST", getEnv("DB_HOST", "localhost")),
+			getEnv("SOURCE_PORT", getEnv("DB_PORT", "4002")),
+			getEnv("SOURCE_NAME", getEnv("DB_NAME", "test"))), nil
+	case db.Postgres:
+		dsn := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(getEnv("SOURCE_USER", "postgres"), getEnv("SOURCE_PASSWORD", "")),
+			Host:     getEnv("SOURCE_HOST", "localhost") + ":" + getEnv("SOURCE_PORT", "5432"),
+			Path:     getEnv("SOURCE_NAME", "postgres"),
+			RawQuery: "sslmode=" + url.QueryEscape(getEnv("SOURCE_SSLMODE", "disable")),
+		}
+		return dsn.String(), nil
+	default:
+		return "", fmt.Errorf("%s 源数据库需要通过 SOURCE_DSN 指定连接字符串（SQLite为数据库文件路径）", dialect.Name())
+	}
+}
+
 // getEnv 获取环境变量，如果不存在则返回默认值
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
@@ -181,13 +556,59 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvInt 获取整数类型的环境变量，不存在或无法解析时返回默认值
+func getEnvInt(key string, defaultValue int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("环境变量 %s=%q 不是有效的整数，使用默认值 %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// getEnvFloat 获取浮点数类型的环境变量，不存在或无法解析时返回默认值
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("环境变量 %s=%q 不是有效的数字，使用默认值 %g", key, value, defaultValue)
+		return defaultValue
+	}
+	return f
+}
+
+// getEnvDuration 获取时间长度类型的环境变量（如 30s、5m），无法解析时返回默认值
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("环境变量 %s=%q 不是有效的时间长度，使用默认值 %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
 // snapshotToJSON 将快照序列化为美观的JSON字符串
 func snapshotToJSON(snapshot *models.Snapshot) (string, error) {
 	// 创建一个可读性更强的时间格式转换
 	type jsonSnapshot struct {
-		Timestamp string `json:"timestamp"`
-		User      string `json:"user"`
-		Basic     struct {
+		SnapshotID string `json:"snapshot_id"`
+		Sensor     string `json:"sensor"`
+		Site       string `json:"site,omitempty"`
+		Interface  string `json:"interface,omitempty"`
+		Timestamp  string `json:"timestamp"`
+		User       string `json:"user"`
+		Basic      struct {
 			TotalPackets uint64 `json:"total_packets"`
 			TotalBytes   uint64 `json:"total_bytes"`
 			StartTime    string `json:"start_time"`
@@ -195,23 +616,85 @@ func snapshotToJSON(snapshot *models.Snapshot) (string, error) {
 		} `json:"basic_stats"`
 		IP struct {
 			UniqueSourceCount int                    `json:"unique_source_count"`
+			RankBy            models.RankBy          `json:"rank_by"`
 			TopPairs          []models.IPAddressPair `json:"top_source_ips"`
 		} `json:"ip_stats"`
 		Port struct {
 			UniqueDestCount int               `json:"unique_destination_count"`
+			RankBy          models.RankBy     `json:"rank_by"`
 			TopPairs        []models.PortPair `json:"top_destination_ports"`
 		} `json:"port_stats"`
+		TransportPort struct {
+			RankBy models.RankBy               `json:"rank_by"`
+			Ports  []models.TransportPortCount `json:"top_ports"`
+		} `json:"transport_port_stats"`
 		Protocol struct {
 			Protocols []models.ProtocolCount `json:"protocols"`
 		} `json:"protocol_stats"`
 		TCPFlags struct {
 			Flags []models.TCPFlagCount `json:"flags"`
 		} `json:"tcp_flags_stats"`
+		Service struct {
+			Services []models.ServiceCount `json:"services"`
+		} `json:"service_stats"`
+		Destination struct {
+			UniqueDestCount int                         `json:"unique_destination_ip_count"`
+			RankBy          models.RankBy               `json:"rank_by"`
+			TopDestinations []models.DestinationIPCount `json:"top_destination_ips"`
+		} `json:"destination_stats"`
+		Conversation struct {
+			RankBy           models.RankBy         `json:"rank_by"`
+			TopConversations []models.Conversation `json:"top_conversations"`
+		} `json:"conversation_stats"`
+		Flow struct {
+			RankBy   models.RankBy      `json:"rank_by"`
+			TopFlows []models.FlowTuple `json:"top_flows"`
+		} `json:"flow_stats"`
+		L2 struct {
+			EtherTypes      []models.EtherTypeCount      `json:"ether_types"`
+			Casts           []models.MACCastCount        `json:"destination_mac_casts"`
+			RankBy          models.RankBy                `json:"rank_by"`
+			TopDestinations []models.DestinationMACCount `json:"top_destination_macs"`
+		} `json:"l2_stats"`
+		Application struct {
+			Apps []models.ApplicationCount `json:"apps"`
+		} `json:"application_stats"`
+		Classification models.ClassificationStats `json:"classification_stats"`
+		PacketSize     models.PacketSizeStats     `json:"packet_size_stats"`
+		Rates          struct {
+			WindowSeconds    float64 `json:"window_seconds"`
+			PacketsPerSecond float64 `json:"packets_per_second"`
+			BitsPerSecond    float64 `json:"bits_per_second"`
+		} `json:"rates"`
+		Throughput models.ThroughputStats `json:"throughput_stats"`
+		Direction  struct {
+			RankBy     models.RankBy                    `json:"rank_by"`
+			Directions []models.DirectionCount          `json:"directions"`
+			TopTalkers []models.DirectionTalker         `json:"top_talkers"`
+			Protocols  []models.DirectionDimensionCount `json:"protocols"`
+			Ports      []models.DirectionDimensionCount `json:"destination_ports"`
+		} `json:"direction_stats"`
+		Prefix struct {
+			RankBy          models.RankBy              `json:"rank_by"`
+			Unique          []models.PrefixUniqueCount `json:"unique_prefixes"`
+			TopSources      []models.PrefixCount       `json:"top_source_prefixes"`
+			TopDestinations []models.PrefixCount       `json:"top_destination_prefixes"`
+		} `json:"prefix_stats"`
+		Geo struct {
+			RankBy       models.RankBy         `json:"rank_by"`
+			TopCountries []models.CountryCount `json:"top_countries"`
+			TopASNs      []models.ASNCount     `json:"top_asns"`
+			Locations    []models.IPLocation   `json:"locations"`
+		} `json:"geo_stats"`
 	}
 
 	// 创建JSON结构
 	jsonData := jsonSnapshot{
-		Timestamp: snapshot.Timestamp.Format("2006-01-02 15:04:05"),
+		SnapshotID: snapshot.ID,
+		Sensor:     snapshot.Sensor,
+		Site:       snapshot.Site,
+		Interface:  snapshot.Interface,
+		Timestamp:  snapshot.Timestamp.Format("2006-01-02 15:04:05"),
 	}
 
 	// 复制基本统计信息
@@ -222,6 +705,7 @@ func snapshotToJSON(snapshot *models.Snapshot) (string, error) {
 
 	// 复制IP数据
 	jsonData.IP.UniqueSourceCount = snapshot.IP.UniqueSourceCount
+	jsonData.IP.RankBy = snapshot.IP.RankBy.OrDefault()
 	for _, pair := range snapshot.IP.TopPairs {
 		if pair.Count > 0 {
 			jsonData.IP.TopPairs = append(jsonData.IP.TopPairs, pair)
@@ -230,18 +714,73 @@ func snapshotToJSON(snapshot *models.Snapshot) (string, error) {
 
 	// 复制端口数据
 	jsonData.Port.UniqueDestCount = snapshot.Port.UniqueDestCount
+	jsonData.Port.RankBy = snapshot.Port.RankBy.OrDefault()
 	for _, pair := range snapshot.Port.TopPairs {
 		if pair.Count > 0 {
 			jsonData.Port.TopPairs = append(jsonData.Port.TopPairs, pair)
 		}
 	}
 
+	// 复制按传输层协议区分的端口数据
+	jsonData.TransportPort.RankBy = snapshot.Port.RankBy.OrDefault()
+	jsonData.TransportPort.Ports = snapshot.TransportPort.Ports
+
 	// 复制协议数据
 	jsonData.Protocol.Protocols = snapshot.Protocol.Protocols
 
 	// 复制TCP标志数据
 	jsonData.TCPFlags.Flags = snapshot.TCPFlags.Flags
 
+	// 复制服务分布数据
+	jsonData.Service.Services = snapshot.Service.Services
+
+	// 复制目标IP、会话和五元组流数据
+	jsonData.Destination.UniqueDestCount = snapshot.Destination.UniqueDestCount
+	jsonData.Destination.RankBy = snapshot.Destination.RankBy.OrDefault()
+	jsonData.Destination.TopDestinations = snapshot.Destination.TopDestinations
+	jsonData.Conversation.RankBy = snapshot.Conversation.RankBy.OrDefault()
+	jsonData.Conversation.TopConversations = snapshot.Conversation.TopConversations
+	jsonData.Flow.RankBy = snapshot.Flow.RankBy.OrDefault()
+	jsonData.Flow.TopFlows = snapshot.Flow.TopFlows
+
+	// 复制二层统计数据
+	jsonData.L2.EtherTypes = snapshot.L2.EtherTypes
+	jsonData.L2.Casts = snapshot.L2.Casts
+	jsonData.L2.RankBy = snapshot.L2.RankBy.OrDefault()
+	jsonData.L2.TopDestinations = snapshot.L2.TopDestinations
+
+	// 复制应用层协议分布和流量分类数据
+	jsonData.Application.Apps = snapshot.Application.Apps
+	jsonData.Classification = snapshot.Classification
+
+	// 复制数据包大小统计数据
+	jsonData.PacketSize = snapshot.PacketSize
+
+	// 计算平均速率，复制峰值速率和微突发数据
+	jsonData.Rates.WindowSeconds = snapshot.Basic.WindowSeconds()
+	jsonData.Rates.PacketsPerSecond = snapshot.Throughput.PacketsPerSecond()
+	jsonData.Rates.BitsPerSecond = snapshot.Throughput.BitsPerSecond()
+	jsonData.Throughput = snapshot.Throughput
+
+	// 复制流量方向数据
+	jsonData.Direction.RankBy = snapshot.Direction.RankBy.OrDefault()
+	jsonData.Direction.Directions = snapshot.Direction.Directions
+	jsonData.Direction.TopTalkers = snapshot.Direction.TopTalkers
+	jsonData.Direction.Protocols = snapshot.Direction.Protocols
+	jsonData.Direction.Ports = snapshot.Direction.Ports
+
+	// 复制前缀数据
+	jsonData.Prefix.RankBy = snapshot.Prefix.RankBy.OrDefault()
+	jsonData.Prefix.Unique = snapshot.Prefix.Unique
+	jsonData.Prefix.TopSources = snapshot.Prefix.TopSources
+	jsonData.Prefix.TopDestinations = snapshot.Prefix.TopDestinations
+
+	// 复制国家和自治系统数据
+	jsonData.Geo.RankBy = snapshot.Geo.RankBy.OrDefault()
+	jsonData.Geo.TopCountries = snapshot.Geo.TopCountries
+	jsonData.Geo.TopASNs = snapshot.Geo.TopASNs
+	jsonData.Geo.Locations = snapshot.Geo.Locations
+
 	// 序列化为带缩进的JSON
 	jsonBytes, err := json.MarshalIndent(jsonData, "", "  ")
 	if err != nil {
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"SnapFlow/internal/db"
+)
+
+// rollupConfig 汇总任务的配置
+type rollupConfig struct {
+	enabled  bool
+	interval time.Duration // 检查是否有新的完整桶的间隔
+	delay    time.Duration // 桶结束后等待多久再汇总，给重试和本地缓冲回放留出时间
+	lookback time.Duration // 层级中还没有汇总数据时，从多久之前开始汇总
+	opts     db.SaveOptions
+}
+
+// loadRollupConfig 从环境变量读取汇总任务配置，默认在启用GrepTimeDB输出时开启
+func loadRollupConfig() (rollupConfig, error) {
+	var rc rollupConfig
+
+	opts, err := loadSaveOptions()
+	if err != nil {
+		return rc, err
+	}
+
+	enabled := "false"
+	if sinkEnabled("greptime") {
+		enabled = "true"
+	}
+
+	rc.enabled = getEnv("ROLLUP_ENABLED", enabled) == "true"
+	rc.interval = getEnvDuration("ROLLUP_INTERVAL", time.Minute)
+	rc.delay = getEnvDuration("ROLLUP_DELAY", 2*time.Minute)
+	rc.lookback = getEnvDuration("ROLLUP_LOOKBACK", 24*time.Hour)
+	rc.opts = opts
+
+	if rc.interval <= 0 {
+		return rc, fmt.Errorf("ROLLUP_INTERVAL 必须大于0")
+	}
+	return rc, nil
+}
+
+// runRollupLoop 定期把原始快照汇总到1分钟、1小时、1天层级，直到stop关闭
+func runRollupLoop(ctx context.Context, database *sql.DB, rc rollupConfig, stop <-chan struct{}) {
+	ticker := time.NewTicker(rc.interval)
+	defer ticker.Stop()
+
+	for {
+		rollupPending(ctx, database, rc, time.Now())
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// rollupPending 对每个层级汇总上次汇总之后所有已完整的桶
+//
+// 层级按从细到粗的顺序处理，1小时层级读取的是本轮刚写入的1分钟层级数据。
+func rollupPending(ctx context.Context, database *sql.DB, rc rollupConfig, now time.Time) {
+	until := now.UTC().Add(-rc.delay)
+
+	for _, tier := range db.RollupTiers() {
+		from, err := db.LastRollupEnd(ctx, database, tier)
+		if err != nil {
+			log.Printf("汇总 %s 层级失败: %v", tier.Name, err)
+			return
+		}
+		if from.IsZero() {
+			from = until.Add(-rc.lookback)
+		}
+
+		count, err := db.RollupRange(ctx, database, tier, from, until, rc.opts)
+		if err != nil {
+			log.Printf("汇总 %s 层级失败: %v", tier.Name, err)
+			return
+		}
+		if count > 0 {
+			fmt.Printf("✓ 已汇总 %d 个 %s 层级快照\n", count, tier.Name)
+		}
+	}
+}
+
+// runRollup 重新汇总 [from, to) 范围内的所有层级，用于回填或修正迟到的数据
+func runRollup(ctx context.Context, database *sql.DB, rc rollupConfig, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("用法: snapflow rollup <开始时间> <结束时间>（RFC3339格式）")
+	}
+	from, to, err := parseTimeRange(args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	for _, tier := range db.RollupTiers() {
+		count, err := db.RollupRange(ctx, database, tier, from, to, rc.opts)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ %s 层级汇总完成，共写入 %d 个快照\n", tier.Name, count)
+	}
+	return nil
+}
+
+// runQuery 读取 (from, to] 范围内所有来源的快照，自动或按指定层级读取，以JSON输出
+func runQuery(ctx context.Context, database *sql.DB, args []string) error {
+	if len(args) != 2 && len(args) != 3 {
+		return fmt.Errorf("用法: snapflow query <开始时间> <结束时间> [raw|1m|1h|1d]")
+	}
+	from, to, err := parseTimeRange(args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	tier := db.SelectTier(from, to)
+	if len(args) == 3 {
+		if tier, err = db.ParseTier(args[2]); err != nil {
+			return err
+		}
+	}
+
+	snapshots, err := db.LoadSnapshots(ctx, database, tier, nil, from, to)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("从 %s 层级读取到 %d 个快照\n", tier.Name, len(snapshots))
+	for _, snapshot := range snapshots {
+		jsonStr, err := snapshotToJSON(snapshot)
+		if err != nil {
+			return err
+		}
+		fmt.Println(jsonStr)
+	}
+	return nil
+}
+
+// parseTimeRange 解析RFC3339格式的开始和结束时间
+func parseTimeRange(fromArg, toArg string) (time.Time, time.Time, error) {
+	from, err := time.Parse(time.RFC3339, fromArg)
+	if err != nil {
+		return from, time.Time{}, fmt.Errorf("开始时间无效: %w", err)
+	}
+	to, err := time.Parse(time.RFC3339, toArg)
+	if err != nil {
+		return from, to, fmt.Errorf("结束时间无效: %w", err)
+	}
+	if !to.After(from) {
+		return from, to, fmt.Errorf("结束时间必须晚于开始时间")
+	}
+	return from, to, nil
+}
+
+// applyRetention 按配置设置各层级表的TTL
+//
+// TTL_RAW、TTL_1M、TTL_1H、TTL_1D 设置整个层级的TTL，
+// TTL_<表名> 覆盖单张表，例如 TTL_NETWORK_TOP_SOURCE_IPS_1M=14d。值为空时不修改该表。
+// 默认都不设置：TTL会删除超过期限的历史数据，其中可能包括还没有汇总到更粗层级的快照，
+// 因此只在运维显式配置后才修改表选项。
+func applyRetention(ctx context.Context, database *sql.DB) error {
+	applied := 0
+	for _, tier := range db.Tiers() {
+		tierTTL := getEnv("TTL_"+strings.ToUpper(tier.Name), "")
+		if tierTTL != "" {
+			fmt.Printf("- %s 层级TTL: %s\n", tier.Name, tierTTL)
+		}
+
+		for _, table := range db.TierTables(tier) {
+			ttl := getEnv("TTL_"+strings.ToUpper(table.Name()), tierTTL)
+			if ttl == "" {
+				continue
+			}
+			if ttl != tierTTL {
+				fmt.Printf("- 表 %s 的TTL: %s\n", table.Name(), ttl)
+			}
+			if err := db.SetTableTTL(ctx, database, table, ttl); err != nil {
+				return err
+			}
+			applied++
+		}
+	}
+
+	if applied == 0 {
+		fmt.Println("- 未配置TTL，保留所有历史快照")
+	} else {
+		fmt.Printf("✓ 已为 %d 张表设置TTL\n", applied)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"SnapFlow/internal/db"
+	"SnapFlow/internal/sink"
+	"SnapFlow/internal/spool"
+)
+
+// buildSinks 根据SINKS环境变量创建输出目标，多个目标用逗号分隔
+//
+// 行协议端点使用 influx:<名称> 的形式，例如 SINKS=greptime,influx:backup，
+// 每个端点的配置从 INFLUX_<名称>_* 环境变量读取。
+func buildSinks(ctx context.Context, database *sql.DB) (sink.SnapshotSink, error) {
+	names := strings.Split(getEnv("SINKS", "greptime"), ",")
+
+	// 需要本地缓冲的输出目标，目标不可用时快照先写入磁盘，恢复后回放
+	spooled := make(map[string]bool)
+	for _, name := range strings.Split(getEnv("SPOOL_SINKS", "greptime"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			spooled[name] = true
+		}
+	}
+
+	var sinks []sink.SnapshotSink
+	closeAll := func() {
+		for _, s := range sinks {
+			s.Close()
+		}
+	}
+
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		s, err := buildSink(ctx, name, database)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("创建输出目标 %s 失败: %w", name, err)
+		}
+		if spooled[name] {
+			if s, err = wrapWithSpool(name, s); err != nil {
+				closeAll()
+				return nil, fmt.Errorf("创建输出目标 %s 的本地缓冲失败: %w", name, err)
+			}
+		}
+		sinks = append(sinks, s)
+		fmt.Printf("✓ 已启用输出目标: %s\n", name)
+	}
+
+	if len(sinks) == 0 {
+		return nil, fmt.Errorf("SINKS 未配置任何输出目标")
+	}
+
+	return sink.NewFanOutSink(sink.FanOutConfig{
+		QueueSize:    getEnvInt("SINK_QUEUE_SIZE", 16),
+		WriteTimeout: getEnvDuration("SINK_WRITE_TIMEOUT", 30*time.Second),
+	}, sinks...), nil
+}
+
+// sinkEnabled 判断SINKS中是否配置了指定的输出目标
+func sinkEnabled(name string) bool {
+	for _, configured := range strings.Split(getEnv("SINKS", "greptime"), ",") {
+		if strings.EqualFold(strings.TrimSpace(configured), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// buildSink 创建单个输出目标
+func buildSink(ctx context.Context, name string, database *sql.DB) (sink.SnapshotSink, error) {
+	if endpoint, ok := strings.CutPrefix(name, "influx:"); ok {
+		return sink.NewInfluxSink(influxEndpointConfig(endpoint))
+	}
+
+	switch strings.ToLower(name) {
+	case "greptime":
+		opts, err := loadSaveOptions()
+		if err != nil {
+			return nil, err
+		}
+		// 默认不自动迁移：多个采集实例同时启动时由运维显式执行 snapflow migrate up
+		if getEnv("AUTO_MIGRATE", "false") == "true" {
+			if _, err := db.MigrateUp(ctx, database); err != nil {
+				return nil, err
+			}
+		}
+		s, err := sink.NewGreptimeSink(ctx, database, opts)
+		if err != nil {
+			return nil, err
+		}
+		if err := applyRetention(ctx, database); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case "jsonl":
+		return sink.NewJSONLinesSink(sink.JSONLinesConfig{
+			Path:     getEnv("JSONL_PATH", "snapflow.jsonl"),
+			MaxBytes: int64(getEnvInt("JSONL_MAX_BYTES", 100*1024*1024)),
+			MaxFiles: getEnvInt("JSONL_MAX_FILES", 5),
+		})
+	case "parquet":
+		return sink.NewParquetSink(sink.ParquetConfig{
+			Dir:         getEnv("PARQUET_DIR", "parquet"),
+			RowsPerFile: getEnvInt("PARQUET_ROWS_PER_FILE", 720),
+			MaxFileAge:  getEnvDuration("PARQUET_MAX_FILE_AGE", time.Hour),
+		})
+	case "sqlite":
+		return sink.NewSQLiteSink(ctx, getEnv("SQLITE_PATH", "snapflow.db"))
+	case "push":
+		return sink.NewPushSink(sink.PushConfig{
+			URL:     getEnv("PUSH_URL", ""),
+			Token:   getEnv("PUSH_TOKEN", ""),
+			Timeout: getEnvDuration("PUSH_TIMEOUT", 10*time.Second),
+		})
+	default:
+		return nil, fmt.Errorf("未知的输出目标类型")
+	}
+}
+
+// influxEndpointConfig 从 INFLUX_<名称>_* 环境变量读取行协议端点配置
+func influxEndpointConfig(endpoint string) sink.InfluxEndpointConfig {
+	prefix := "INFLUX_" + strings.ToUpper(strings.ReplaceAll(endpoint, "-", "_")) + "_"
+
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(getEnv(prefix+"HEADERS", ""), ";") {
+		if key, value, ok := strings.Cut(pair, "="); ok {
+			headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+
+	return sink.InfluxEndpointConfig{
+		Name:              endpoint,
+		URL:               getEnv(prefix+"URL", "http://localhost:4000/v1/influxdb/write"),
+		Database:          getEnv(prefix+"DB", "public"),
+		Precision:         getEnv(prefix+"PRECISION", "ns"),
+		Username:          getEnv(prefix+"USER", ""),
+		Password:          getEnv(prefix+"PASSWORD", ""),
+		Token:             getEnv(prefix+"TOKEN", ""),
+		Headers:           headers,
+		Gzip:              getEnv(prefix+"GZIP", "true") == "true",
+		Timeout:           getEnvDuration(prefix+"TIMEOUT", 10*time.Second),
+		MeasurementPrefix: getEnv(prefix+"MEASUREMENT_PREFIX", "snapflow_"),
+	}
+}
+
+// wrapWithSpool 为输出目标加上本地磁盘缓冲，每个目标使用 SPOOL_DIR 下的独立子目录
+func wrapWithSpool(name string, inner sink.SnapshotSink) (sink.SnapshotSink, error) {
+	fsync, err := spool.ParseFsyncPolicy(getEnv("SPOOL_FSYNC", string(spool.FsyncInterval)))
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(getEnv("SPOOL_DIR", "spool"), strings.ReplaceAll(name, ":", "_"))
+	sp, err := spool.Open(spool.Config{
+		Dir:           dir,
+		MaxBytes:      int64(getEnvInt("SPOOL_MAX_BYTES", 512*1024*1024)),
+		MaxAge:        getEnvDuration("SPOOL_MAX_AGE", 24*time.Hour),
+		SegmentBytes:  int64(getEnvInt("SPOOL_SEGMENT_BYTES", 16*1024*1024)),
+		Fsync:         fsync,
+		FsyncInterval: getEnvDuration("SPOOL_FSYNC_INTERVAL", time.Second),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("✓ 输出目标 %s 已启用本地缓冲: %s\n", name, dir)
+	return sink.NewSpooledSink(inner, sp, sink.BackoffConfig{
+		Min: getEnvDuration("SPOOL_BACKOFF_MIN", time.Second),
+		Max: getEnvDuration("SPOOL_BACKOFF_MAX", 5*time.Minute),
+	}, getEnvDuration("SINK_WRITE_TIMEOUT", 30*time.Second)), nil
+}
@@ -0,0 +1,289 @@
+package aggregator
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"SnapFlow/internal/models"
+	"SnapFlow/internal/sink"
+)
+
+// Config 汇总中心的配置
+type Config struct {
+	Listen       string            // HTTP监听地址，例如 :8480
+	TLSCertFile  string            // 证书文件，与TLSKeyFile同时设置时使用HTTPS
+	TLSKeyFile   string            // 私钥文件
+	Tokens       map[string]string // 传感器标识 -> 该传感器的推送令牌
+	Fleet        models.Labels     // 全局快照使用的来源标签
+	Wait         time.Duration     // 窗口结束后最多等待多久再合并，所有传感器都到齐时立即合并
+	Retain       time.Duration     // 合并后继续保留窗口的时长，期间迟到的快照会触发重新合并
+	MaxBodyBytes int64             // 单个请求体的最大字节数
+}
+
+// Aggregator 接收各传感器推送的快照，原样保存后再按窗口合并为全局快照
+type Aggregator struct {
+	cfg    Config
+	output sink.SnapshotSink
+	server *http.Server
+
+	mu      sync.Mutex
+	windows map[windowKey]*fleetWindow
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// windowKey 同一个全局快照对应的窗口
+type windowKey struct {
+	profile string
+	start   int64
+	end     int64
+}
+
+// fleetWindow 一个窗口内收到的各传感器快照
+type fleetWindow struct {
+	profile    string
+	start, end time.Time
+	parts      map[string]*models.Snapshot // 按快照ID索引，重复推送的快照会覆盖旧值
+	merged     bool                        // 已经输出过全局快照
+	dirty      bool                        // 输出之后又收到了新的快照
+}
+
+// New 创建汇总中心，传感器快照和全局快照都写入output
+func New(cfg Config, output sink.SnapshotSink) (*Aggregator, error) {
+	if len(cfg.Tokens) == 0 {
+		return nil, fmt.Errorf("汇总中心至少需要配置一个传感器令牌")
+	}
+	if cfg.Fleet.Sensor == "" {
+		return nil, fmt.Errorf("全局快照的传感器标识不能为空")
+	}
+	if _, ok := cfg.Tokens[cfg.Fleet.Sensor]; ok {
+		return nil, fmt.Errorf("传感器标识 %s 与全局快照的标识冲突", cfg.Fleet.Sensor)
+	}
+	if cfg.Wait <= 0 {
+		cfg.Wait = 30 * time.Second
+	}
+	if cfg.Retain <= 0 {
+		cfg.Retain = 10 * time.Minute
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = 4 * 1024 * 1024
+	}
+
+	a := &Aggregator{
+		cfg:     cfg,
+		output:  output,
+		windows: make(map[windowKey]*fleetWindow),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/snapshots", a.handlePush)
+	a.server = &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return a, nil
+}
+
+// Start 启动HTTP服务和合并协程
+func (a *Aggregator) Start() {
+	go func() {
+		var err error
+		if a.cfg.TLSCertFile != "" && a.cfg.TLSKeyFile != "" {
+			err = a.server.ListenAndServeTLS(a.cfg.TLSCertFile, a.cfg.TLSKeyFile)
+		} else {
+			err = a.server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Printf("汇总中心HTTP服务异常退出: %v", err)
+		}
+	}()
+	go a.flushLoop()
+
+	fmt.Printf("✓ 汇总中心已启动，监听 %s，已登记 %d 个传感器\n", a.cfg.Listen, len(a.cfg.Tokens))
+}
+
+// Close 停止接收快照，并把还在等待的窗口立即合并输出
+func (a *Aggregator) Close(ctx context.Context) error {
+	err := a.server.Shutdown(ctx)
+
+	close(a.stop)
+	<-a.done
+
+	a.flush(time.Time{}, true)
+	return err
+}
+
+// handlePush 接收一个传感器快照：校验令牌和快照，保存传感器级快照并加入对应窗口
+func (a *Aggregator) handlePush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "只支持POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sensor, ok := a.authenticate(r)
+	if !ok {
+		http.Error(w, "令牌无效", http.StatusUnauthorized)
+		return
+	}
+
+	var snapshot models.Snapshot
+	body := http.MaxBytesReader(w, r.Body, a.cfg.MaxBodyBytes)
+	if err := json.NewDecoder(body).Decode(&snapshot); err != nil {
+		http.Error(w, "快照格式无效: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 令牌只能推送自己传感器的快照，避免一个传感器冒充其他传感器
+	if snapshot.Sensor != sensor {
+		http.Error(w, fmt.Sprintf("令牌不能推送传感器 %s 的快照", snapshot.Sensor), http.StatusForbidden)
+		return
+	}
+	if err := validateSnapshot(&snapshot); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 传感器级快照原样保存
+	if err := a.output.Write(r.Context(), &snapshot); err != nil {
+		http.Error(w, "保存快照失败: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	a.add(&snapshot, time.Now())
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// authenticate 根据Bearer令牌找到对应的传感器
+func (a *Aggregator) authenticate(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", false
+	}
+
+	for sensor, expected := range a.cfg.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1 {
+			return sensor, true
+		}
+	}
+	return "", false
+}
+
+// validateSnapshot 检查快照的窗口和ID是否一致
+func validateSnapshot(snapshot *models.Snapshot) error {
+	start, end := snapshot.Basic.StartTime, snapshot.Basic.EndTime
+	if start.IsZero() || !end.After(start) {
+		return fmt.Errorf("快照 %s 的时间窗口无效", snapshot.ID)
+	}
+
+	expected := models.SnapshotID(snapshot.Labels, snapshot.Profile, start, end.Sub(start))
+	if snapshot.ID != expected {
+		return fmt.Errorf("快照ID %s 与来源和窗口不一致", snapshot.ID)
+	}
+	return nil
+}
+
+// add 把传感器快照加入对应窗口，超过保留时长的迟到快照只保存传感器级数据
+func (a *Aggregator) add(snapshot *models.Snapshot, now time.Time) {
+	start, end := snapshot.Basic.StartTime.UTC(), snapshot.Basic.EndTime.UTC()
+	if now.After(end.Add(a.cfg.Wait + a.cfg.Retain)) {
+		log.Printf("传感器 %s 的快照 %s 到达过晚，未计入全局快照", snapshot.Sensor, snapshot.ID)
+		return
+	}
+
+	key := windowKey{profile: snapshot.Profile, start: start.UnixNano(), end: end.UnixNano()}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	window, ok := a.windows[key]
+	if !ok {
+		window = &fleetWindow{
+			profile: snapshot.Profile,
+			start:   start,
+			end:     end,
+			parts:   make(map[string]*models.Snapshot),
+		}
+		a.windows[key] = window
+	}
+	window.parts[snapshot.ID] = snapshot
+	if window.merged {
+		window.dirty = true
+	}
+}
+
+// flushLoop 每秒检查一次哪些窗口可以合并
+func (a *Aggregator) flushLoop() {
+	defer close(a.done)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.stop:
+			return
+		case now := <-ticker.C:
+			a.flush(now, false)
+		}
+	}
+}
+
+// flush 合并已到齐或已超过等待时间的窗口，迟到快照使已合并的窗口重新输出，过期窗口被删除
+//
+// force为true时忽略等待时间，合并所有还未输出的窗口。
+func (a *Aggregator) flush(now time.Time, force bool) {
+	var fleets []*models.Snapshot
+
+	a.mu.Lock()
+	for key, window := range a.windows {
+		ready := !window.merged && (force || !now.Before(window.end.Add(a.cfg.Wait)) || a.complete(window))
+		if ready || window.dirty {
+			parts := make([]*models.Snapshot, 0, len(window.parts))
+			for _, part := range window.parts {
+				parts = append(parts, part)
+			}
+			fleets = append(fleets, models.MergeSnapshots(a.cfg.Fleet, window.profile, window.start, window.end, parts))
+			window.merged = true
+			window.dirty = false
+		}
+
+		if !force && now.After(window.end.Add(a.cfg.Wait+a.cfg.Retain)) {
+			delete(a.windows, key)
+		}
+	}
+	a.mu.Unlock()
+
+	for _, fleet := range fleets {
+		if err := a.output.Write(context.Background(), fleet); err != nil {
+			log.Printf("保存全局快照 %s 失败: %v", fleet.ID, err)
+			continue
+		}
+		fmt.Printf("✓ 已合并全局快照 %s（%s - %s）\n",
+			fleet.ID, fleet.Basic.StartTime.Format("15:04:05"), fleet.Basic.EndTime.Format("15:04:05"))
+	}
+}
+
+// complete 判断所有登记的传感器是否都已推送该窗口的快照
+func (a *Aggregator) complete(window *fleetWindow) bool {
+	seen := make(map[string]bool)
+	for _, part := range window.parts {
+		seen[part.Sensor] = true
+	}
+	for sensor := range a.cfg.Tokens {
+		if !seen[sensor] {
+			return false
+		}
+	}
+	return true
+}
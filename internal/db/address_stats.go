@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"SnapFlow/internal/geoip"
+	"SnapFlow/internal/models"
+	"SnapFlow/internal/network"
+)
+
+// AddressStatsConfig 按源地址和目标地址汇总的统计项，未启用的统计项为零值
+type AddressStatsConfig struct {
+	Internal      *network.PrefixSet    // 内部网络，为nil时不采集流量方向统计
+	PrefixLengths network.PrefixLengths // 前缀长度，为空时不采集前缀统计
+	GeoIP         *geoip.Resolver       // 本地GeoIP数据库，为nil时不采集国家和自治系统统计
+}
+
+// Enabled 判断是否启用了任一统计项
+func (c AddressStatsConfig) Enabled() bool {
+	return c.Internal != nil || !c.PrefixLengths.IsZero() || c.GeoIP != nil
+}
+
+// FillAddressStats 只扫描一次快照窗口，填充流量方向、前缀和国家自治系统统计到snapshot中
+//
+// 按 (src_ip, dst_ip, protocol, dst_port) 分组读取窗口，流量方向由每组在内存中累加；
+// 前缀和国家自治系统统计只需要每个源地址和目标地址的流量，由同一份分组结果按地址求和得出。
+// 不采集流量方向时只按 (src_ip, dst_ip) 分组。
+// 国家和自治系统统计中排行地址的解析依赖已经填充的源IP、目标IP、会话和五元组流排行，因此在这些统计之后调用。
+func FillAddressStats(ctx context.Context, src *SourceDB, table Identifier, snapshot *models.Snapshot, cfg AddressStatsConfig) error {
+	columns := []string{"src_ip", "dst_ip"}
+	if cfg.Internal != nil {
+		columns = append(columns, "protocol", "dst_port")
+	}
+	query := src.Select(append(columns, "COUNT(*) AS count", byteSum(src.Dialect()))...).
+		From(table).
+		Where(windowCondition).
+		GroupBy(columns...).
+		String()
+
+	rows, err := src.QueryContext(ctx, query, windowArgs(snapshot)...)
+	if err != nil {
+		return fmt.Errorf("按地址扫描快照窗口失败: %w", err)
+	}
+	defer rows.Close()
+
+	direction := models.NewDirectionCounter()
+	sources := make(map[string]models.Traffic)
+	destinations := make(map[string]models.Traffic)
+	for rows.Next() {
+		var srcIP, dstIP sql.NullString
+		var protocol, dstPort sql.NullInt64
+		var traffic models.Traffic
+
+		dest := []any{&srcIP, &dstIP}
+		if cfg.Internal != nil {
+			dest = append(dest, &protocol, &dstPort)
+		}
+		if err := rows.Scan(append(dest, &traffic.Packets, &traffic.Bytes)...); err != nil {
+			return fmt.Errorf("扫描地址分组数据失败: %w", err)
+		}
+
+		// 地址为NULL的数据包不计入前缀和国家自治系统统计
+		if srcIP.Valid {
+			accumulate(sources, srcIP.String, traffic)
+		}
+		if dstIP.Valid {
+			accumulate(destinations, dstIP.String, traffic)
+		}
+		if cfg.Internal != nil {
+			addDirection(direction, cfg.Internal, srcIP, dstIP, protocol, dstPort, traffic)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("扫描地址分组数据时发生错误: %w", err)
+	}
+
+	if cfg.Internal != nil {
+		direction.Apply(snapshot)
+		printDirectionStats(snapshot, cfg.Internal)
+	}
+	if !cfg.PrefixLengths.IsZero() {
+		applyPrefixStats(snapshot, cfg.PrefixLengths, sources, destinations)
+		printPrefixStats(snapshot, cfg.PrefixLengths)
+	}
+	if cfg.GeoIP != nil {
+		applyGeoStats(snapshot, cfg.GeoIP, sources, destinations)
+		printGeoStats(snapshot, cfg.GeoIP)
+	}
+
+	return nil
+}
@@ -9,26 +9,11 @@ import (
 )
 
 // FillApplicationStats 填充应用层协议统计到snapshot中
-func FillApplicationStats(ctx context.Context, db *sql.DB, tableName string, snapshot *models.Snapshot) error {
+func FillApplicationStats(ctx context.Context, src *SourceDB, table Identifier, snapshot *models.Snapshot) error {
 	// 使用WITH语句计算应用层协议分布和百分比
-	query := fmt.Sprintf(`
-		WITH total_packets AS (
-			-- 计算总的数据包数量
-			SELECT COUNT(*) AS total_count
-			FROM %s
-			WHERE ts >= NOW() - INTERVAL 1 MINUTE
-		)
-		SELECT 
-			application AS name, 
-			COUNT(*) AS count, 
-			(COUNT(*) * 100.0 / (SELECT total_count FROM total_packets)) AS percentage
-		FROM %s
-		WHERE ts >= NOW() - INTERVAL 1 MINUTE
-		GROUP BY application
-		ORDER BY count DESC;
-	`, tableName, tableName)
-
-	rows, err := db.QueryContext(ctx, query)
+	query := distributionQuery(src.Dialect(), table, "application", windowCondition).String()
+
+	rows, err := src.QueryContext(ctx, query, distributionArgs(snapshot)...)
 	if err != nil {
 		return fmt.Errorf("获取应用层协议统计失败: %w", err)
 	}
@@ -42,7 +27,7 @@ func FillApplicationStats(ctx context.Context, db *sql.DB, tableName string, sna
 		var app models.ApplicationCount
 		var name sql.NullString // 使用NullString处理可能为NULL的应用名称
 
-		if err := rows.Scan(&name, &app.Count, &app.Percentage); err != nil {
+		if err := rows.Scan(&name, &app.Count, &app.Bytes, &app.Percentage); err != nil {
 			return fmt.Errorf("扫描应用层协议数据失败: %w", err)
 		}
 
@@ -68,25 +53,10 @@ func FillApplicationStats(ctx context.Context, db *sql.DB, tableName string, sna
 }
 
 // GetTopApplications 获取前N个最常用的应用层协议
-func GetTopApplications(ctx context.Context, db *sql.DB, tableName string, limit int) ([]models.ApplicationCount, error) {
-	query := fmt.Sprintf(`
-		WITH total_packets AS (
-			SELECT COUNT(*) AS total_count
-			FROM %s
-			WHERE ts >= NOW() - INTERVAL 1 MINUTE
-		)
-		SELECT 
-			application AS name, 
-			COUNT(*) AS count, 
-			(COUNT(*) * 100.0 / (SELECT total_count FROM total_packets)) AS percentage
-		FROM %s
-		WHERE ts >= NOW() - INTERVAL 1 MINUTE
-		GROUP BY application
-		ORDER BY count DESC
-		LIMIT ?
-	`, tableName, tableName)
-
-	rows, err := db.QueryContext(ctx, query, limit)
+func GetTopApplications(ctx context.Context, src *SourceDB, table Identifier, limit int) ([]models.ApplicationCount, error) {
+	query := distributionQuery(src.Dialect(), table, "application", recentWindowCondition(src.Dialect())).LimitParam().String()
+
+	rows, err := src.QueryContext(ctx, query, limit)
 	if err != nil {
 		return nil, fmt.Errorf("获取前%d个应用层协议失败: %w", limit, err)
 	}
@@ -98,7 +68,7 @@ func GetTopApplications(ctx context.Context, db *sql.DB, tableName string, limit
 		var app models.ApplicationCount
 		var name sql.NullString
 
-		if err := rows.Scan(&name, &app.Count, &app.Percentage); err != nil {
+		if err := rows.Scan(&name, &app.Count, &app.Bytes, &app.Percentage); err != nil {
 			return nil, fmt.Errorf("扫描应用层协议数据失败: %w", err)
 		}
 
@@ -4,36 +4,28 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"time"
 
 	"SnapFlow/internal/models"
 )
 
 // FillBasicStats 从statistics表获取基本流量统计并填充到snapshot中
-func FillBasicStats(ctx context.Context, db *sql.DB, statsTableName string, snapshot *models.Snapshot) error {
-
-	// 查询最新的统计记录
-	query := fmt.Sprintf(`
-		SELECT 
-			packets_sum, 
-			packet_size_sum, 
-			time_window, 
-			update_at
-		FROM %s
-		ORDER BY time_window DESC, update_at DESC
-		LIMIT 1
-	`, statsTableName)
+func FillBasicStats(ctx context.Context, src *SourceDB, statsTable Identifier, snapshot *models.Snapshot) error {
+
+	// 查询快照窗口结束前最新的统计记录，time_window和update_at只用于排序，
+	// 不读取出来，避免不同驱动返回的时间类型不一致（SQLite返回文本）
+	query := src.Select("packets_sum", "packet_size_sum").
+		From(statsTable).
+		Where("time_window < ?").
+		OrderBy("time_window DESC", "update_at DESC").
+		Limit(1).
+		String()
 
 	var packetsSum uint64
 	var packetSizeSum uint64
-	var timeWindow time.Time
-	var updateAt time.Time
 
-	err := db.QueryRowContext(ctx, query).Scan(
+	err := src.QueryRowContext(ctx, query, snapshot.Basic.EndTime).Scan(
 		&packetsSum,
 		&packetSizeSum,
-		&timeWindow,
-		&updateAt,
 	)
 
 	if err != nil {
@@ -41,18 +33,14 @@ func FillBasicStats(ctx context.Context, db *sql.DB, statsTableName string, snap
 			// 设置默认值
 			snapshot.Basic.TotalPackets = 0
 			snapshot.Basic.TotalBytes = 0
-			snapshot.Basic.StartTime = time.Now().Add(-1 * time.Minute)
-			snapshot.Basic.EndTime = time.Now()
 			return nil
 		}
 		return fmt.Errorf("获取基本统计数据失败: %w", err)
 	}
 
-	// 填充snapshot的Basic字段
+	// 填充snapshot的Basic字段，时间窗口由采集方确定，这里不再修改
 	snapshot.Basic.TotalPackets = packetsSum
 	snapshot.Basic.TotalBytes = packetSizeSum
-	snapshot.Basic.StartTime = timeWindow // 使用time_window作为开始时间
-	snapshot.Basic.EndTime = updateAt     // 使用update_at作为结束时间
 
 	return nil
 }
@@ -0,0 +1,197 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"SnapFlow/internal/models"
+)
+
+// Bucket 扁平化饼图表中的一个分组：名称及归入该分组的成员
+//
+// 协议分组的成员为协议名称（例如 GRE）或协议号（例如 47）；TCP标志分组的成员为标志值
+// （例如 24）或标志名称（例如 PSH+ACK）。成员不区分大小写。
+type Bucket struct {
+	Name    string
+	Members []string
+}
+
+// DistributionBuckets 协议和TCP标志饼图的分组定义，不属于任何分组的数据包计入other
+type DistributionBuckets struct {
+	Protocols []Bucket
+	TCPFlags  []Bucket
+}
+
+// otherBucket 不属于任何分组的数据包所在的分组名称
+const otherBucket = "other"
+
+// DefaultProtocolBuckets 默认的协议分组，与 network_protocols_json 的列一致
+func DefaultProtocolBuckets() []Bucket {
+	return []Bucket{
+		{Name: "tcp", Members: []string{"TCP"}},
+		{Name: "udp", Members: []string{"UDP"}},
+		{Name: "icmp", Members: []string{"ICMP"}},
+	}
+}
+
+// DefaultTCPFlagBuckets 默认的TCP标志分组，与 network_tcp_flags_json 的列一致
+func DefaultTCPFlagBuckets() []Bucket {
+	return []Bucket{
+		{Name: "ack", Members: []string{"16"}},
+		{Name: "syn", Members: []string{"2"}},
+		{Name: "fin_ack", Members: []string{"17"}},
+		{Name: "psh_ack", Members: []string{"24"}},
+		{Name: "none", Members: []string{"0"}},
+	}
+}
+
+// orDefault 未配置的分组使用默认分组
+func (b DistributionBuckets) orDefault() DistributionBuckets {
+	if len(b.Protocols) == 0 {
+		b.Protocols = DefaultProtocolBuckets()
+	}
+	if len(b.TCPFlags) == 0 {
+		b.TCPFlags = DefaultTCPFlagBuckets()
+	}
+	return b
+}
+
+// ParseBuckets 解析分组定义，分组之间用分号分隔，每个分组为 名称=成员|成员
+//
+// 例如 tcp=TCP;udp=UDP;icmp=ICMP|IPv6-ICMP;ipsec=ESP|AH。空字符串返回nil，表示使用默认分组。
+// 分组名称只能包含字母、数字和下划线，不能为other；同一个成员只能属于一个分组。
+func ParseBuckets(spec string) ([]Bucket, error) {
+	var buckets []Bucket
+	names := make(map[string]bool)
+	members := make(map[string]string)
+
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, list, ok := strings.Cut(entry, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("分组 %q 缺少 =", entry)
+		}
+		if !identifierPartPattern.MatchString(name) || name == otherBucket {
+			return nil, fmt.Errorf("分组名称 %q 无效", name)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("分组 %s 重复定义", name)
+		}
+		names[name] = true
+
+		bucket := Bucket{Name: name}
+		for _, member := range strings.Split(list, "|") {
+			member = strings.TrimSpace(member)
+			if member == "" {
+				continue
+			}
+			key := strings.ToLower(member)
+			if previous, exists := members[key]; exists {
+				return nil, fmt.Errorf("成员 %s 同时属于分组 %s 和 %s", member, previous, name)
+			}
+			members[key] = name
+			bucket.Members = append(bucket.Members, member)
+		}
+		if len(bucket.Members) == 0 {
+			return nil, fmt.Errorf("分组 %s 没有成员", name)
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
+
+// bucketCount 一个分组的数据包数和字节数
+type bucketCount struct {
+	name    string
+	traffic models.Traffic
+}
+
+// bucketFold 把分布中的各项按分组累加，最后一个分组为other
+type bucketFold struct {
+	buckets []Bucket
+	counts  []bucketCount
+	total   uint64
+}
+
+// newBucketFold 创建按buckets分组的累加器
+func newBucketFold(buckets []Bucket) *bucketFold {
+	counts := make([]bucketCount, 0, len(buckets)+1)
+	for _, bucket := range buckets {
+		counts = append(counts, bucketCount{name: bucket.Name})
+	}
+	counts = append(counts, bucketCount{name: otherBucket})
+	return &bucketFold{buckets: buckets, counts: counts}
+}
+
+// add 累加一项，keys为该项可以匹配的成员（例如标志值和标志名称），都不匹配时计入other
+func (f *bucketFold) add(traffic models.Traffic, keys ...string) {
+	f.total += traffic.Packets
+	for i, bucket := range f.buckets {
+		for _, member := range bucket.Members {
+			for _, key := range keys {
+				if strings.EqualFold(member, key) {
+					f.counts[i].traffic.Add(traffic)
+					return
+				}
+			}
+		}
+	}
+	f.counts[len(f.counts)-1].traffic.Add(traffic)
+}
+
+// foldProtocols 按协议分组累加快照的协议分布，协议号形式的成员按协议名称匹配
+func foldProtocols(buckets []Bucket, protocols []models.ProtocolCount) *bucketFold {
+	resolved := make([]Bucket, len(buckets))
+	for i, bucket := range buckets {
+		resolved[i] = Bucket{Name: bucket.Name}
+		for _, member := range bucket.Members {
+			if id, err := strconv.Atoi(member); err == nil {
+				member = getProtocolName(id)
+			}
+			resolved[i].Members = append(resolved[i].Members, member)
+		}
+	}
+
+	fold := newBucketFold(resolved)
+	for _, proto := range protocols {
+		fold.add(models.Traffic{Packets: proto.Count, Bytes: proto.Bytes}, proto.Name)
+	}
+	return fold
+}
+
+// foldTCPFlags 按TCP标志分组累加快照的TCP标志分布，成员可以是标志值或标志名称
+func foldTCPFlags(buckets []Bucket, flags []models.TCPFlagCount) *bucketFold {
+	fold := newBucketFold(buckets)
+	for _, flag := range flags {
+		fold.add(models.Traffic{Packets: flag.Count, Bytes: flag.Bytes}, flag.Flag, getTCPFlagName(flag.Flag))
+	}
+	return fold
+}
+
+// percentage 计算占分布中全部数据包的百分比，分布为空时返回0
+func (f *bucketFold) percentage(count uint64) float64 {
+	if f.total == 0 {
+		return 0
+	}
+	return float64(count) * 100.0 / float64(f.total)
+}
+
+// wideBatch 生成扁平化列结构的一行：总数据包数加每个分组一列 <分组>_count
+func (f *bucketFold) wideBatch(table Identifier, snapshotID string, ts any) *tableBatch {
+	columns := []string{"snapshot_id", "ts", "total_packet_count"}
+	values := []any{snapshotID, ts, f.total}
+	for _, count := range f.counts {
+		columns = append(columns, count.name+"_count")
+		values = append(values, count.traffic.Packets)
+	}
+
+	batch := newTableBatch(table, columns...)
+	batch.add(values...)
+	return batch
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"SnapFlow/internal/models"
+	"SnapFlow/internal/services"
+)
+
+// FillClassificationStats 填充流量分类统计和应用层协议分布到snapshot中
+//
+// 按 (application, packet_type, protocol, src_port, dst_port) 分组扫描一次窗口，各项统计在内存中
+// 由同一份分组结果得出。application为NULL或空的数据包归为unknown。TCP/UDP数据包的服务端端口
+// 由服务注册表从端口对中选出，注册表知道应用的标准端口且服务端端口不在其中时计为非标准端口，
+// 例如运行在443端口上的SSH；不知道标准端口的应用不做判断。
+func FillClassificationStats(ctx context.Context, src *SourceDB, table Identifier, snapshot *models.Snapshot) error {
+	query := src.Select("application", "packet_type", "protocol", "src_port", "dst_port", "COUNT(*) AS count", byteSum(src.Dialect())).
+		From(table).
+		Where(windowCondition).
+		GroupBy("application", "packet_type", "protocol", "src_port", "dst_port").
+		String()
+
+	rows, err := src.QueryContext(ctx, query, windowArgs(snapshot)...)
+	if err != nil {
+		return fmt.Errorf("获取流量分类统计失败: %w", err)
+	}
+	defer rows.Close()
+
+	registry := services.Default()
+	counter := models.NewClassificationCounter()
+	appTraffic := make(map[string]models.Traffic)
+	var total uint64
+	for rows.Next() {
+		var application, packetType sql.NullString
+		var protocol, srcPort, dstPort sql.NullInt64
+		var traffic models.Traffic
+
+		if err := rows.Scan(&application, &packetType, &protocol, &srcPort, &dstPort, &traffic.Packets, &traffic.Bytes); err != nil {
+			return fmt.Errorf("扫描流量分类数据失败: %w", err)
+		}
+
+		app := models.UnknownApplication
+		if application.Valid && application.String != "" {
+			app = application.String
+		}
+		typeName := "unknown"
+		if packetType.Valid && packetType.String != "" {
+			typeName = packetType.String
+		}
+		protocolName := "unknown"
+		if protocol.Valid {
+			protocolName = getProtocolName(int(protocol.Int64))
+		}
+
+		total += traffic.Packets
+		accumulate(appTraffic, app, traffic)
+		counter.AddPacketType(typeName, traffic)
+		counter.AddProtocol(app, protocolName, traffic)
+		if dstPort.Valid {
+			counter.AddPort(app, uint16(dstPort.Int64), traffic)
+		}
+
+		var unknown, nonStandard models.Traffic
+		if app == models.UnknownApplication {
+			unknown = traffic
+		} else if (protocolName == "TCP" || protocolName == "UDP") && srcPort.Valid && dstPort.Valid {
+			service := registry.ServicePort(protocolName, uint16(srcPort.Int64), uint16(dstPort.Int64))
+			if standard, known := registry.StandardPort(app, protocolName, service); known && !standard {
+				nonStandard = traffic
+				counter.AddNonStandard(app, protocolName, service, registry.Name(protocolName, service), traffic)
+			}
+		}
+		counter.AddTotals(unknown, nonStandard)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("扫描流量分类数据时发生错误: %w", err)
+	}
+
+	counter.Apply(snapshot)
+
+	var apps []models.ApplicationCount
+	for _, name := range models.RankTraffic(appTraffic, models.RankByPackets, 0) {
+		t := appTraffic[name]
+		apps = append(apps, models.ApplicationCount{
+			Name:       name,
+			Count:      t.Packets,
+			Bytes:      t.Bytes,
+			Percentage: float64(t.Packets) * 100.0 / float64(total),
+		})
+	}
+	snapshot.SetApplicationStats(apps)
+
+	// 打印获取的信息
+	stats := snapshot.Classification
+	fmt.Printf("\n获取到的流量分类统计信息:\n")
+	fmt.Printf("- 未识别应用: %d 个数据包, %d 字节 (%.2f%%)\n", stats.UnknownCount, stats.UnknownBytes, stats.UnknownPercentage)
+	fmt.Printf("- 非标准端口应用: %d 个数据包, %d 字节 (%.2f%%)\n", stats.NonStandardCount, stats.NonStandardBytes, stats.NonStandardPercentage)
+	for i, port := range stats.NonStandard {
+		fmt.Printf("  %d. %s 运行在 %s %d (%s): %d 个数据包, %d 字节\n",
+			i+1, port.Application, port.Transport, port.Port, port.Service, port.Count, port.Bytes)
+	}
+	fmt.Printf("- 数据包类型:\n")
+	for _, packetType := range stats.PacketTypes {
+		fmt.Printf("  %s: %d 个数据包, %d 字节 (%.2f%%)\n", packetType.Name, packetType.Count, packetType.Bytes, packetType.Percentage)
+	}
+	fmt.Printf("- 应用 (%d 个):\n", len(apps))
+	for i, app := range apps {
+		fmt.Printf("  %d. %s: %d 个数据包, %d 字节 (%.2f%%)\n", i+1, app.Name, app.Count, app.Bytes, app.Percentage)
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"SnapFlow/internal/models"
+)
+
+// FillConversationStats 填充快照时间窗口内流量最大的源IP到目标IP会话到snapshot中
+func FillConversationStats(ctx context.Context, src *SourceDB, table Identifier, snapshot *models.Snapshot) error {
+	snapshot.Conversation.RankBy = snapshot.Conversation.RankBy.OrDefault()
+	query := talkerQuery(src.Dialect(), table, []string{"src_ip", "dst_ip"}, snapshot.Conversation.RankBy)
+
+	rows, err := src.QueryContext(ctx, query, windowArgs(snapshot)...)
+	if err != nil {
+		return fmt.Errorf("获取前5个会话失败: %w", err)
+	}
+	defer rows.Close()
+
+	var conversations []models.Conversation
+	for rows.Next() {
+		var conv models.Conversation
+		var traffic talkerRow
+
+		if err := rows.Scan(append([]any{&conv.SourceIP, &conv.DestinationIP}, traffic.dest()...)...); err != nil {
+			return fmt.Errorf("扫描会话数据失败: %w", err)
+		}
+		conv.TalkerTraffic = traffic.traffic()
+		conversations = append(conversations, conv)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("扫描会话数据时发生错误: %w", err)
+	}
+
+	snapshot.SetConversationStats(conversations)
+
+	// 打印获取的信息
+	fmt.Printf("\n获取到的会话统计信息:\n")
+	fmt.Printf("- 流量最大的会话 (按%s排序的前5个):\n", rankByLabel(snapshot.Conversation.RankBy))
+
+	for i, conv := range conversations {
+		fmt.Printf("  %d. %s -> %s: %d 个数据包, %d 字节\n",
+			i+1, conv.SourceIP, conv.DestinationIP, conv.Count, conv.Bytes)
+	}
+
+	return nil
+}
+
+// FillFiveTupleStats 填充快照时间窗口内流量最大的五元组流到snapshot中
+func FillFiveTupleStats(ctx context.Context, src *SourceDB, table Identifier, snapshot *models.Snapshot) error {
+	snapshot.Flow.RankBy = snapshot.Flow.RankBy.OrDefault()
+	query := talkerQuery(src.Dialect(), table,
+		[]string{"src_ip", "dst_ip", "src_port", "dst_port", "protocol"}, snapshot.Flow.RankBy)
+
+	rows, err := src.QueryContext(ctx, query, windowArgs(snapshot)...)
+	if err != nil {
+		return fmt.Errorf("获取前5个五元组流失败: %w", err)
+	}
+	defer rows.Close()
+
+	var flows []models.FlowTuple
+	for rows.Next() {
+		var flow models.FlowTuple
+		var protocolID int
+		var traffic talkerRow
+
+		keys := []any{&flow.SourceIP, &flow.DestinationIP, &flow.SourcePort, &flow.DestinationPort, &protocolID}
+		if err := rows.Scan(append(keys, traffic.dest()...)...); err != nil {
+			return fmt.Errorf("扫描五元组流数据失败: %w", err)
+		}
+		flow.Protocol = getProtocolName(protocolID)
+		flow.TalkerTraffic = traffic.traffic()
+		flows = append(flows, flow)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("扫描五元组流数据时发生错误: %w", err)
+	}
+
+	snapshot.SetFlowStats(flows)
+
+	// 打印获取的信息
+	fmt.Printf("\n获取到的五元组流统计信息:\n")
+	fmt.Printf("- 流量最大的五元组流 (按%s排序的前5个):\n", rankByLabel(snapshot.Flow.RankBy))
+
+	for i, flow := range flows {
+		fmt.Printf("  %d. %s %s:%d -> %s:%d: %d 个数据包, %d 字节\n",
+			i+1, flow.Protocol, flow.SourceIP, flow.SourcePort, flow.DestinationIP, flow.DestinationPort, flow.Count, flow.Bytes)
+	}
+
+	return nil
+}
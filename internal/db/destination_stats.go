@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"SnapFlow/internal/models"
+)
+
+// FillDestinationStats 填充快照时间窗口内的目标IP统计数据到snapshot中
+func FillDestinationStats(ctx context.Context, src *SourceDB, table Identifier, snapshot *models.Snapshot) error {
+
+	// 1. 获取唯一目标IP数量
+	uniqueCountQuery := src.Select("COUNT(DISTINCT dst_ip)").
+		From(table).
+		Where(windowCondition).
+		String()
+
+	var uniqueCount int
+	err := src.QueryRowContext(ctx, uniqueCountQuery, windowArgs(snapshot)...).Scan(&uniqueCount)
+	if err != nil {
+		return fmt.Errorf("获取唯一目标IP数量失败: %w", err)
+	}
+
+	// 2. 按排序依据获取前5个目标IP地址
+	snapshot.Destination.RankBy = snapshot.Destination.RankBy.OrDefault()
+	query := talkerQuery(src.Dialect(), table, []string{"dst_ip"}, snapshot.Destination.RankBy)
+
+	rows, err := src.QueryContext(ctx, query, windowArgs(snapshot)...)
+	if err != nil {
+		return fmt.Errorf("获取前5个目标IP地址失败: %w", err)
+	}
+	defer rows.Close()
+
+	var destinations []models.DestinationIPCount
+	for rows.Next() {
+		var dest models.DestinationIPCount
+		var traffic talkerRow
+
+		if err := rows.Scan(append([]any{&dest.DestinationIP}, traffic.dest()...)...); err != nil {
+			return fmt.Errorf("扫描目标IP数据失败: %w", err)
+		}
+		dest.TalkerTraffic = traffic.traffic()
+		destinations = append(destinations, dest)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("扫描目标IP数据时发生错误: %w", err)
+	}
+
+	snapshot.SetDestinationStats(uniqueCount, destinations)
+
+	// 打印获取的信息
+	fmt.Printf("\n获取到的目标IP统计信息:\n")
+	fmt.Printf("- 唯一目标IP地址数量: %d\n", uniqueCount)
+	fmt.Printf("- 最活跃的目标IP地址 (按%s排序的前5个):\n", rankByLabel(snapshot.Destination.RankBy))
+
+	for i, dest := range destinations {
+		fmt.Printf("  %d. %s: %d 个数据包, %d 字节\n", i+1, dest.DestinationIP, dest.Count, dest.Bytes)
+	}
+
+	return nil
+}
+
+// talkerQuery 构建按keyColumns分组的Top 5查询，返回各键列、count、bytes、first_seen、last_seen
+//
+// 键列中的NULL读取为空字符串（IP列）或0（端口和协议列）。
+func talkerQuery(d Dialect, table Identifier, keyColumns []string, by models.RankBy) string {
+	var columns []string
+	for _, column := range keyColumns {
+		fallback := "0"
+		if column == "src_ip" || column == "dst_ip" {
+			fallback = "''"
+		}
+		columns = append(columns, d.IfNull(column, fallback)+" AS "+column)
+	}
+	columns = append(columns, "COUNT(*) AS count", byteSum(d), "MIN(ts) AS first_seen", "MAX(ts) AS last_seen")
+
+	return Select(columns...).
+		Dialect(d).
+		From(table).
+		Where(windowCondition).
+		GroupBy(keyColumns...).
+		OrderBy(rankOrder(by)...).
+		Limit(5).
+		String()
+}
+
+// talkerRow talkerQuery结果中键列之后的流量列
+type talkerRow struct {
+	count, bytes        uint64
+	firstSeen, lastSeen scannedTime
+}
+
+// dest 返回Scan的目标，顺序与talkerQuery的列一致
+func (r *talkerRow) dest() []any {
+	return []any{&r.count, &r.bytes, &r.firstSeen, &r.lastSeen}
+}
+
+// traffic 转换为快照中的流量结构
+func (r *talkerRow) traffic() models.TalkerTraffic {
+	return models.TalkerTraffic{
+		Count:     r.count,
+		Bytes:     r.bytes,
+		FirstSeen: r.firstSeen.Time,
+		LastSeen:  r.lastSeen.Time,
+	}
+}
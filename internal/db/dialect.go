@@ -0,0 +1,255 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dialect 源数据库的SQL方言，屏蔽各数据库在标识符引号、占位符、NOW()、INTERVAL和IFNULL上的差异
+//
+// 查询构建器统一生成MySQL风格的 ? 占位符，执行前由SourceDB按方言转换。
+type Dialect interface {
+	// Name 方言名称，与SOURCE_DIALECT的取值一致
+	Name() string
+	// Driver database/sql 中注册的驱动名
+	Driver() string
+	// Quote 给表名加上方言对应的引号
+	Quote(table Identifier) string
+	// Placeholder 第n个（从1开始）参数的占位符
+	Placeholder(n int) string
+	// Now 当前时间的表达式
+	Now() string
+	// Ago 当前时间减去d的表达式
+	Ago(d time.Duration) string
+	// IfNull expr为NULL时返回fallback的表达式
+	IfNull(expr, fallback string) string
+	// TimeArg 把时间参数转换为该数据库能正确比较的值
+	TimeArg(t time.Time) any
+	// TimeSlot 时间列所在时间桶的编号，编号乘以size为时间桶开始时间距Unix纪元的时长；size至少为1毫秒
+	TimeSlot(column string, size time.Duration) string
+}
+
+// ParseDialect 根据名称返回方言，支持 mysql、postgres（含TimescaleDB）和 sqlite
+func ParseDialect(name string) (Dialect, error) {
+	switch strings.ToLower(name) {
+	case "mysql", "greptime":
+		return MySQL, nil
+	case "postgres", "postgresql", "timescaledb":
+		return Postgres, nil
+	case "sqlite", "sqlite3":
+		return SQLite, nil
+	default:
+		return nil, fmt.Errorf("未知的SQL方言 %q（可选 mysql、postgres、sqlite）", name)
+	}
+}
+
+// 支持的方言
+var (
+	MySQL    Dialect = mysqlDialect{}
+	Postgres Dialect = postgresDialect{}
+	SQLite   Dialect = sqliteDialect{}
+)
+
+// mysqlDialect MySQL和兼容MySQL协议的数据库（包括GrepTimeDB）
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string                  { return "mysql" }
+func (mysqlDialect) Driver() string                { return "mysql" }
+func (mysqlDialect) Quote(table Identifier) string { return table.quotedWith("`") }
+func (mysqlDialect) Placeholder(int) string        { return "?" }
+func (mysqlDialect) Now() string                   { return "NOW()" }
+func (mysqlDialect) TimeArg(t time.Time) any       { return t }
+
+func (mysqlDialect) Ago(d time.Duration) string {
+	return fmt.Sprintf("NOW() - INTERVAL %d SECOND", int64(d.Seconds()))
+}
+
+func (mysqlDialect) IfNull(expr, fallback string) string {
+	return fmt.Sprintf("IFNULL(%s, %s)", expr, fallback)
+}
+
+func (mysqlDialect) TimeSlot(column string, size time.Duration) string {
+	return fmt.Sprintf("FLOOR(UNIX_TIMESTAMP(%s) * 1000 / %d)", column, size.Milliseconds())
+}
+
+// postgresDialect PostgreSQL和TimescaleDB
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string                  { return "postgres" }
+func (postgresDialect) Driver() string                { return "postgres" }
+func (postgresDialect) Quote(table Identifier) string { return table.quotedWith(`"`) }
+func (postgresDialect) Placeholder(n int) string      { return "$" + strconv.Itoa(n) }
+func (postgresDialect) Now() string                   { return "NOW()" }
+func (postgresDialect) TimeArg(t time.Time) any       { return t }
+
+func (postgresDialect) Ago(d time.Duration) string {
+	return fmt.Sprintf("NOW() - INTERVAL '%d seconds'", int64(d.Seconds()))
+}
+
+func (postgresDialect) IfNull(expr, fallback string) string {
+	return fmt.Sprintf("COALESCE(%s, %s)", expr, fallback)
+}
+
+func (postgresDialect) TimeSlot(column string, size time.Duration) string {
+	return fmt.Sprintf("FLOOR(EXTRACT(EPOCH FROM %s) * 1000 / %d)", column, size.Milliseconds())
+}
+
+// sqliteDialect SQLite，时间以UTC的 YYYY-MM-DD HH:MM:SS 文本保存，与datetime()的输出格式一致
+type sqliteDialect struct{}
+
+// sqliteTimeLayout SQLite中时间文本的格式，按字符串比较时与时间先后一致
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+func (sqliteDialect) Name() string                  { return "sqlite" }
+func (sqliteDialect) Driver() string                { return "sqlite" }
+func (sqliteDialect) Quote(table Identifier) string { return table.quotedWith(`"`) }
+func (sqliteDialect) Placeholder(int) string        { return "?" }
+func (sqliteDialect) Now() string                   { return "datetime('now')" }
+func (sqliteDialect) TimeArg(t time.Time) any       { return t.UTC().Format(sqliteTimeLayout) }
+
+func (sqliteDialect) Ago(d time.Duration) string {
+	return fmt.Sprintf("datetime('now', '-%d seconds')", int64(d.Seconds()))
+}
+
+func (sqliteDialect) IfNull(expr, fallback string) string {
+	return fmt.Sprintf("IFNULL(%s, %s)", expr, fallback)
+}
+
+// TimeSlot 由julianday()换算为Unix纪元以来的毫秒数，支持带小数秒的时间文本
+func (sqliteDialect) TimeSlot(column string, size time.Duration) string {
+	return fmt.Sprintf("CAST(ROUND((julianday(%s) - 2440587.5) * 86400000) AS INTEGER) / %d", column, size.Milliseconds())
+}
+
+// scannedTime 读取查询返回的时间值：MySQL和PostgreSQL驱动返回time.Time，SQLite返回文本
+type scannedTime struct {
+	time.Time
+}
+
+// Scan 实现sql.Scanner，NULL读取为零值，结果统一转换为UTC
+func (t *scannedTime) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		t.Time = time.Time{}
+	case time.Time:
+		t.Time = v.UTC()
+	case string:
+		return t.parse(v)
+	case []byte:
+		return t.parse(string(v))
+	default:
+		return fmt.Errorf("无法把 %T 转换为时间", value)
+	}
+	return nil
+}
+
+// parse 解析SQLite的时间文本，也接受RFC3339格式
+func (t *scannedTime) parse(text string) error {
+	for _, layout := range []string{sqliteTimeLayout, "2006-01-02 15:04:05.999999999", time.RFC3339Nano} {
+		if parsed, err := time.ParseInLocation(layout, text, time.UTC); err == nil {
+			t.Time = parsed.UTC()
+			return nil
+		}
+	}
+	return fmt.Errorf("无法解析时间 %q", text)
+}
+
+// rebind 把 ? 占位符替换为方言的占位符，字符串字面量中的 ? 保持不变
+func rebind(d Dialect, query string) string {
+	if d.Placeholder(1) == "?" {
+		return query
+	}
+
+	var sb strings.Builder
+	n := 0
+	inString := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inString = !inString
+		case r == '?' && !inString:
+			n++
+			sb.WriteString(d.Placeholder(n))
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// SourceDB 读取原始数据包和统计表的源数据库连接，与写入快照的数据库相互独立
+//
+// 查询在执行前按方言转换占位符和时间参数。
+type SourceDB struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// OpenSourceDB 按方言打开源数据库连接并检查连通性
+func OpenSourceDB(dialect Dialect, dsn string) (*SourceDB, error) {
+	database, err := sql.Open(dialect.Driver(), dsn)
+	if err != nil {
+		return nil, fmt.Errorf("打开 %s 源数据库失败: %w", dialect.Name(), err)
+	}
+	if err := database.Ping(); err != nil {
+		database.Close()
+		return nil, fmt.Errorf("无法连接到 %s 源数据库: %w", dialect.Name(), err)
+	}
+	return NewSourceDB(database, dialect), nil
+}
+
+// NewSourceDB 用已有的连接创建源数据库
+func NewSourceDB(database *sql.DB, dialect Dialect) *SourceDB {
+	return &SourceDB{db: database, dialect: dialect}
+}
+
+// DB 返回底层连接，用于设置连接池参数
+func (s *SourceDB) DB() *sql.DB {
+	return s.db
+}
+
+// Dialect 返回源数据库的方言
+func (s *SourceDB) Dialect() Dialect {
+	return s.dialect
+}
+
+// Select 创建按源数据库方言生成SQL的SELECT语句构建器
+func (s *SourceDB) Select(columns ...string) *SelectQuery {
+	return Select(columns...).Dialect(s.dialect)
+}
+
+// QueryContext 转换占位符和时间参数后执行查询
+func (s *SourceDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return s.db.QueryContext(ctx, rebind(s.dialect, query), s.args(args)...)
+}
+
+// QueryRowContext 转换占位符和时间参数后执行单行查询
+func (s *SourceDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return s.db.QueryRowContext(ctx, rebind(s.dialect, query), s.args(args)...)
+}
+
+// ExecContext 转换占位符和时间参数后执行语句
+func (s *SourceDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return s.db.ExecContext(ctx, rebind(s.dialect, query), s.args(args)...)
+}
+
+// Close 关闭源数据库连接
+func (s *SourceDB) Close() error {
+	return s.db.Close()
+}
+
+// args 按方言转换时间参数
+func (s *SourceDB) args(args []any) []any {
+	converted := make([]any, len(args))
+	for i, arg := range args {
+		if t, ok := arg.(time.Time); ok {
+			converted[i] = s.dialect.TimeArg(t)
+		} else {
+			converted[i] = arg
+		}
+	}
+	return converted
+}
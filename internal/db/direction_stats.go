@@ -0,0 +1,42 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	"SnapFlow/internal/models"
+	"SnapFlow/internal/network"
+)
+
+// addDirection 由internal判断一组数据包的方向，累加到各方向总量、热门地址和协议、目标端口分布中
+//
+// 源地址或目标地址为NULL或无法解析的数据包归为unknown；dst_port为NULL的数据包不计入端口分布。
+func addDirection(counter *models.DirectionCounter, internal *network.PrefixSet, srcIP, dstIP sql.NullString, protocol, dstPort sql.NullInt64, traffic models.Traffic) {
+	direction := internal.Direction(srcIP.String, dstIP.String)
+	protocolName := "unknown"
+	if protocol.Valid {
+		protocolName = getProtocolName(int(protocol.Int64))
+	}
+
+	counter.AddDirection(direction, traffic)
+	counter.AddTalker(direction, models.TalkerSource, srcIP.String, traffic)
+	counter.AddTalker(direction, models.TalkerDestination, dstIP.String, traffic)
+	counter.AddProtocol(direction, protocolName, traffic)
+	if dstPort.Valid {
+		counter.AddPort(direction, uint16(dstPort.Int64), traffic)
+	}
+}
+
+// printDirectionStats 打印流量方向统计
+func printDirectionStats(snapshot *models.Snapshot, internal *network.PrefixSet) {
+	stats := snapshot.Direction
+	fmt.Printf("\n获取到的流量方向统计信息 (内部网络 %s):\n", internal)
+	for _, d := range stats.Directions {
+		fmt.Printf("- %s: %d 个数据包, %d 字节 (%.2f%%)\n", d.Direction, d.Count, d.Bytes, d.Percentage)
+		for _, talker := range stats.TopTalkers {
+			if talker.Direction == d.Direction {
+				fmt.Printf("  %s %s: %d 个数据包, %d 字节\n", talker.Role, talker.Address, talker.Count, talker.Bytes)
+			}
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"SnapFlow/internal/models"
+)
+
+// flowColumns 由Flow预聚合的维度，每个维度一个Flow和一张结果表
+var flowColumns = []string{"src_ip", "dst_port", "protocol", "tcp_flags"}
+
+// flowSchemaVersion 结果表结构的版本，写在表名中；结果表增加列时递增，使旧Flow不会被误用
+//
+// 版本2增加了byte_count列。
+const flowSchemaVersion = 2
+
+// FlowSet 按固定时间桶持续预聚合数据包表的一组GreptimeDB Flow
+//
+// 每个维度的Flow把数据包按 (维度列, date_bin(桶, ts)) 分组统计数据包数和字节数，结果写入
+// <数据包表>_<维度>_<桶秒数>s_v<版本>，采集快照时只需对窗口内的桶求和。桶大小和结果表版本写在表名中，
+// 修改桶大小或升级版本会使用一组新的Flow和结果表，不再使用的旧Flow可以手动 DROP FLOW 删除。
+type FlowSet struct {
+	source Identifier
+	bucket time.Duration
+	expire time.Duration
+	flows  []flowDef
+}
+
+// flowDef 一个维度的Flow
+type flowDef struct {
+	column string
+	name   Identifier // Flow名称
+	sink   Identifier // Flow写入的结果表
+}
+
+// FlowState Flow及其结果表的当前状态
+type FlowState struct {
+	Name       string
+	Sink       string
+	Exists     bool
+	LatestTime time.Time // 结果表中最新的桶，没有数据时为零值
+}
+
+// NewFlowSet 为数据包表创建Flow定义，bucket必须是整秒，expire为Flow接受迟到数据的时长
+func NewFlowSet(packetTable Identifier, bucket, expire time.Duration) (*FlowSet, error) {
+	if bucket < time.Second || bucket%time.Second != 0 {
+		return nil, fmt.Errorf("Flow时间桶 %s 必须是整秒数", bucket)
+	}
+	if expire < bucket {
+		return nil, fmt.Errorf("Flow过期时间 %s 不能小于时间桶 %s", expire, bucket)
+	}
+
+	set := &FlowSet{source: packetTable, bucket: bucket, expire: expire}
+	for _, column := range flowColumns {
+		sink, err := packetTable.WithSuffix(fmt.Sprintf("_%s_%ds_v%d", column, int64(bucket.Seconds()), flowSchemaVersion))
+		if err != nil {
+			return nil, fmt.Errorf("生成Flow结果表名失败: %w", err)
+		}
+		name, err := sink.WithSuffix("_flow")
+		if err != nil {
+			return nil, fmt.Errorf("生成Flow名称失败: %w", err)
+		}
+		set.flows = append(set.flows, flowDef{column: column, name: name, sink: sink})
+	}
+	return set, nil
+}
+
+// Bucket 返回Flow的时间桶大小
+func (f *FlowSet) Bucket() time.Duration {
+	return f.bucket
+}
+
+// createStatement 生成一个维度的CREATE FLOW语句
+func (f *FlowSet) createStatement(flow flowDef) string {
+	bucket := fmt.Sprintf("date_bin(INTERVAL '%d seconds', ts)", int64(f.bucket.Seconds()))
+	query := Select(flow.column, "count(ts) AS packet_count", "sum(packet_size) AS byte_count", bucket+" AS time_window").
+		From(f.source).
+		GroupBy(flow.column, "time_window").
+		String()
+
+	return fmt.Sprintf("CREATE FLOW IF NOT EXISTS %s SINK TO %s EXPIRE AFTER INTERVAL '%d seconds' AS %s",
+		flow.name.Quoted(), flow.sink.Quoted(), int64(f.expire.Seconds()), query)
+}
+
+// Create 创建缺少的Flow，结果表由GreptimeDB自动创建，返回新建的Flow数量
+func (f *FlowSet) Create(ctx context.Context, src *SourceDB) (int, error) {
+	if src.Dialect() != MySQL {
+		return 0, fmt.Errorf("Flow只能在GrepTimeDB中创建，当前源数据库方言为 %s", src.Dialect().Name())
+	}
+
+	states, err := f.Status(ctx, src)
+	if err != nil {
+		return 0, err
+	}
+
+	created := 0
+	for i, flow := range f.flows {
+		if states[i].Exists {
+			continue
+		}
+		if _, err := src.ExecContext(ctx, f.createStatement(flow)); err != nil {
+			return created, fmt.Errorf("创建Flow %s 失败: %w", flow.name, err)
+		}
+		created++
+	}
+	return created, nil
+}
+
+// Drop 删除Flow，结果表保留，由表的TTL或手动清理
+func (f *FlowSet) Drop(ctx context.Context, src *SourceDB) error {
+	for _, flow := range f.flows {
+		if _, err := src.ExecContext(ctx, "DROP FLOW IF EXISTS "+flow.name.Quoted()); err != nil {
+			return fmt.Errorf("删除Flow %s 失败: %w", flow.name, err)
+		}
+	}
+	return nil
+}
+
+// Status 返回每个Flow是否存在以及结果表中最新的桶
+func (f *FlowSet) Status(ctx context.Context, src *SourceDB) ([]FlowState, error) {
+	states := make([]FlowState, len(f.flows))
+	for i, flow := range f.flows {
+		states[i] = FlowState{Name: flow.name.String(), Sink: flow.sink.String()}
+
+		var count int
+		err := src.QueryRowContext(ctx,
+			"SELECT COUNT(*) FROM information_schema.flows WHERE flow_name = ?", flow.name.Name()).Scan(&count)
+		if err != nil {
+			return nil, fmt.Errorf("查询Flow %s 失败: %w", flow.name, err)
+		}
+		states[i].Exists = count > 0
+		if !states[i].Exists {
+			continue
+		}
+
+		var latest sql.NullTime
+		query := src.Select("MAX(time_window)").From(flow.sink).String()
+		if err := src.QueryRowContext(ctx, query).Scan(&latest); err == nil && latest.Valid {
+			states[i].LatestTime = latest.Time.UTC()
+		}
+	}
+	return states, nil
+}
+
+// Available 判断所有Flow都已创建
+func (f *FlowSet) Available(ctx context.Context, src *SourceDB) bool {
+	states, err := f.Status(ctx, src)
+	if err != nil {
+		return false
+	}
+	for _, state := range states {
+		if !state.Exists {
+			return false
+		}
+	}
+	return true
+}
+
+// covers 判断结果表能否准确给出 [start, end) 的统计
+//
+// 窗口边界必须对齐到桶；最早的桶必须早于窗口开始（Flow创建时所在的桶可能只统计了一部分），
+// 最新的桶必须不早于窗口结束：窗口最后一个桶有数据只说明Flow开始处理这个桶，不代表已经处理完，
+// 只有出现了窗口之后的桶才能确定窗口内的桶都已完整。窗口之后暂时没有流量时回退到扫描原始数据。
+func (f *FlowSet) covers(ctx context.Context, src *SourceDB, start, end time.Time) (bool, error) {
+	if start.UnixNano()%int64(f.bucket) != 0 || end.UnixNano()%int64(f.bucket) != 0 {
+		return false, nil
+	}
+
+	for _, flow := range f.flows {
+		query := src.Select("MIN(time_window)", "MAX(time_window)").From(flow.sink).String()
+
+		var earliest, latest sql.NullTime
+		if err := src.QueryRowContext(ctx, query).Scan(&earliest, &latest); err != nil {
+			return false, fmt.Errorf("检查Flow结果表 %s 失败: %w", flow.sink, err)
+		}
+		if !earliest.Valid || !earliest.Time.Before(start) || latest.Time.Before(end) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// FillFlowStats 从Flow结果表读取IP、端口、协议和TCP标志的数据包数和字节数，返回是否使用了预聚合数据
+//
+// 结果表不能完整覆盖快照窗口时返回false且不修改快照，调用方应回退到扫描原始数据。
+// 各维度的桶按键求和后由与单次扫描相同的累加器推导统计，结果与扫描原始数据一致。
+func FillFlowStats(ctx context.Context, src *SourceDB, flows *FlowSet, snapshot *models.Snapshot) (bool, error) {
+	start, end := snapshot.Basic.StartTime, snapshot.Basic.EndTime
+
+	ok, err := flows.covers(ctx, src, start, end)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	acc := newWindowAccumulator()
+	for _, flow := range flows.flows {
+		query := src.Select(flow.column, "SUM(packet_count)", src.Dialect().IfNull("SUM(byte_count)", "0")).
+			From(flow.sink).
+			Where("time_window >= ? AND time_window < ?").
+			GroupBy(flow.column).
+			String()
+
+		rows, err := src.QueryContext(ctx, query, start, end)
+		if err != nil {
+			return false, fmt.Errorf("读取Flow结果表 %s 失败: %w", flow.sink, err)
+		}
+
+		for rows.Next() {
+			var traffic models.Traffic
+			var ip sql.NullString
+			var number sql.NullInt64
+			key := any(&number)
+			if flow.column == "src_ip" {
+				key = &ip
+			}
+			if err := rows.Scan(key, &traffic.Packets, &traffic.Bytes); err != nil {
+				rows.Close()
+				return false, fmt.Errorf("扫描Flow结果表 %s 失败: %w", flow.sink, err)
+			}
+			acc.addFlowCount(flow.column, ip, number, traffic)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return false, fmt.Errorf("扫描Flow结果表 %s 时发生错误: %w", flow.sink, err)
+		}
+	}
+
+	acc.apply(snapshot)
+
+	fmt.Printf("\n从Flow预聚合表获取到的窗口统计信息:\n")
+	fmt.Printf("- 数据包数量: %d\n", acc.total)
+	fmt.Printf("- 唯一源IP地址数量: %d，唯一目标端口数量: %d\n", snapshot.IP.UniqueSourceCount, snapshot.Port.UniqueDestCount)
+
+	return true, nil
+}
+
+// addFlowCount 累加Flow结果表中一个维度键的数据包数和字节数，源IP维度使用ip，其余维度使用number；
+// 窗口的数据包总数取自协议维度
+func (a *windowAccumulator) addFlowCount(column string, ip sql.NullString, number sql.NullInt64, traffic models.Traffic) {
+	switch column {
+	case "src_ip":
+		a.addSourceIP(ip, traffic)
+	case "dst_port":
+		a.addDestPort(number, traffic)
+	case "protocol":
+		a.total += traffic.Packets
+		a.addProtocol(number, traffic)
+	case "tcp_flags":
+		a.addTCPFlags(number, traffic)
+	}
+}
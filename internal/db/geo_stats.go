@@ -0,0 +1,52 @@
+package db
+
+import (
+	"fmt"
+
+	"SnapFlow/internal/geoip"
+	"SnapFlow/internal/models"
+)
+
+// applyGeoStats 由resolver解析每个源地址和目标地址，写入按国家和自治系统的排行，并解析各排行中出现的地址
+//
+// 地址从本地mmdb文件解析，重复的地址命中缓存。
+func applyGeoStats(snapshot *models.Snapshot, resolver *geoip.Resolver, sources, destinations map[string]models.Traffic) {
+	counter := models.NewGeoCounter()
+	for _, group := range []struct {
+		role      models.TalkerRole
+		addresses map[string]models.Traffic
+	}{
+		{models.TalkerSource, sources},
+		{models.TalkerDestination, destinations},
+	} {
+		for address, traffic := range group.addresses {
+			if location, ok := resolver.Lookup(address); ok {
+				counter.AddLocation(group.role, location, traffic)
+			}
+		}
+	}
+	counter.Apply(snapshot)
+
+	var locations []models.IPLocation
+	for _, address := range snapshot.RankedAddresses() {
+		if location, ok := resolver.Lookup(address); ok {
+			locations = append(locations, location)
+		}
+	}
+	snapshot.SetGeoLocations(locations)
+}
+
+// printGeoStats 打印国家和自治系统统计
+func printGeoStats(snapshot *models.Snapshot, resolver *geoip.Resolver) {
+	stats := snapshot.Geo
+	fmt.Printf("\n获取到的国家和自治系统统计信息 (%s):\n", resolver)
+	for _, country := range stats.TopCountries {
+		fmt.Printf("- %s %s (%s): %d 个数据包, %d 字节 (%.2f%%)\n",
+			country.Role, country.CountryCode, country.Country, country.Count, country.Bytes, country.Percentage)
+	}
+	for _, asn := range stats.TopASNs {
+		fmt.Printf("- %s AS%d (%s): %d 个数据包, %d 字节 (%.2f%%)\n",
+			asn.Role, asn.ASN, asn.Organization, asn.Count, asn.Bytes, asn.Percentage)
+	}
+	fmt.Printf("- 排行中的地址: 解析了 %d 个\n", len(stats.Locations))
+}
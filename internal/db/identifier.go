@@ -0,0 +1,100 @@
+package db
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxIdentifierPartLength 单个标识符片段允许的最大长度（与MySQL保持一致）
+const maxIdentifierPartLength = 64
+
+// identifierPartPattern 标识符片段只允许字母、数字和下划线，且不能以数字开头
+var identifierPartPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Identifier 表示一个经过校验的SQL标识符，支持 schema.table 形式
+type Identifier struct {
+	parts []string
+}
+
+// ParseIdentifier 解析并校验表名等标识符，非法名称返回错误
+func ParseIdentifier(name string) (Identifier, error) {
+	if strings.TrimSpace(name) == "" {
+		return Identifier{}, fmt.Errorf("标识符不能为空")
+	}
+
+	parts := strings.Split(name, ".")
+	if len(parts) > 2 {
+		return Identifier{}, fmt.Errorf("标识符 %q 最多只能包含 schema 和表名两部分", name)
+	}
+
+	for _, part := range parts {
+		if part == "" {
+			return Identifier{}, fmt.Errorf("标识符 %q 包含空的片段", name)
+		}
+		if len(part) > maxIdentifierPartLength {
+			return Identifier{}, fmt.Errorf("标识符片段 %q 超过 %d 个字符", part, maxIdentifierPartLength)
+		}
+		if !identifierPartPattern.MatchString(part) {
+			return Identifier{}, fmt.Errorf("标识符片段 %q 含有非法字符（只允许字母、数字和下划线，且不能以数字开头）", part)
+		}
+	}
+
+	return Identifier{parts: parts}, nil
+}
+
+// MustParseIdentifier 解析代码中的常量标识符，非法时直接panic
+func MustParseIdentifier(name string) Identifier {
+	id, err := ParseIdentifier(name)
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
+// IsZero 判断标识符是否未初始化
+func (id Identifier) IsZero() bool {
+	return len(id.parts) == 0
+}
+
+// Name 返回不含schema的表名部分
+func (id Identifier) Name() string {
+	if id.IsZero() {
+		return ""
+	}
+	return id.parts[len(id.parts)-1]
+}
+
+// Schema 返回schema部分，未指定时返回空字符串
+func (id Identifier) Schema() string {
+	if len(id.parts) < 2 {
+		return ""
+	}
+	return id.parts[0]
+}
+
+// String 返回未加引号的原始名称，仅用于日志输出
+func (id Identifier) String() string {
+	return strings.Join(id.parts, ".")
+}
+
+// Quoted 返回加上反引号的标识符，可直接拼接到SQL语句中
+func (id Identifier) Quoted() string {
+	return id.quotedWith("`")
+}
+
+// quotedWith 用指定的引号包围每一部分，不同的SQL方言使用不同的引号
+func (id Identifier) quotedWith(quote string) string {
+	quoted := make([]string, len(id.parts))
+	for i, part := range id.parts {
+		quoted[i] = quote + part + quote
+	}
+	return strings.Join(quoted, ".")
+}
+
+// WithSuffix 返回在表名部分加上后缀的新标识符，例如 network_basic_stats -> network_basic_stats_1m
+func (id Identifier) WithSuffix(suffix string) (Identifier, error) {
+	parts := append([]string(nil), id.parts...)
+	parts[len(parts)-1] += suffix
+	return ParseIdentifier(strings.Join(parts, "."))
+}
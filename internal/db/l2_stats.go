@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"SnapFlow/internal/models"
+)
+
+// FillL2Stats 填充二层统计到snapshot中：EtherType分布、目标MAC地址的广播/组播/单播占比和热门目标MAC地址
+//
+// 按 (ether_type, dst_mac) 分组扫描一次窗口，各项统计在内存中由同一份分组结果得出。
+// ether_type为NULL的数据包不计入EtherType分布，dst_mac为NULL或无法解析的数据包归为unknown。
+func FillL2Stats(ctx context.Context, src *SourceDB, table Identifier, snapshot *models.Snapshot) error {
+	query := src.Select("ether_type", src.Dialect().IfNull("dst_mac", "''")+" AS dst_mac", "COUNT(*) AS count", byteSum(src.Dialect())).
+		From(table).
+		Where(windowCondition).
+		GroupBy("ether_type", "dst_mac").
+		String()
+
+	rows, err := src.QueryContext(ctx, query, windowArgs(snapshot)...)
+	if err != nil {
+		return fmt.Errorf("获取二层统计失败: %w", err)
+	}
+	defer rows.Close()
+
+	counter := models.NewL2Counter()
+	for rows.Next() {
+		var etherType sql.NullInt64
+		var dstMAC string
+		var traffic models.Traffic
+
+		if err := rows.Scan(&etherType, &dstMAC, &traffic.Packets, &traffic.Bytes); err != nil {
+			return fmt.Errorf("扫描二层数据失败: %w", err)
+		}
+
+		if etherType.Valid {
+			counter.AddEtherType(uint16(etherType.Int64), getEtherTypeName(uint16(etherType.Int64)), traffic)
+		}
+		counter.AddCast(models.ClassifyMAC(dstMAC), traffic)
+		counter.AddDestination(dstMAC, traffic)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("扫描二层数据时发生错误: %w", err)
+	}
+
+	counter.Apply(snapshot, 5)
+
+	// 打印获取的信息
+	fmt.Printf("\n获取到的二层统计信息:\n")
+	fmt.Printf("- EtherType分布:\n")
+	for _, etherType := range snapshot.L2.EtherTypes {
+		fmt.Printf("  %s (0x%04X): %d 个数据包, %d 字节 (%.2f%%)\n",
+			etherType.Name, etherType.EtherType, etherType.Count, etherType.Bytes, etherType.Percentage)
+	}
+	fmt.Printf("- 目标MAC地址类型:\n")
+	for _, cast := range snapshot.L2.Casts {
+		fmt.Printf("  %s: %d 个数据包, %d 字节 (%.2f%%)\n", cast.Cast, cast.Count, cast.Bytes, cast.Percentage)
+	}
+	fmt.Printf("- 热门目标MAC地址 (按%s排序的前5个):\n", rankByLabel(snapshot.L2.RankBy))
+	for i, mac := range snapshot.L2.TopDestinations {
+		fmt.Printf("  %d. %s (%s): %d 个数据包, %d 字节\n", i+1, mac.Address, mac.Cast, mac.Count, mac.Bytes)
+	}
+
+	return nil
+}
+
+// getEtherTypeName 通过EtherType值获取名称
+func getEtherTypeName(etherType uint16) string {
+	etherTypeMap := map[uint16]string{
+		0x0800: "IPv4",
+		0x0806: "ARP",
+		0x0842: "Wake-on-LAN",
+		0x22F0: "AVTP",
+		0x22F3: "TRILL",
+		0x6003: "DECnet",
+		0x8035: "RARP",
+		0x809B: "AppleTalk",
+		0x8100: "VLAN",
+		0x8137: "IPX",
+		0x86DD: "IPv6",
+		0x8808: "Ethernet-Flow-Control",
+		0x8809: "Slow-Protocols",
+		0x8847: "MPLS",
+		0x8848: "MPLS-Multicast",
+		0x8863: "PPPoE-Discovery",
+		0x8864: "PPPoE-Session",
+		0x888E: "EAPOL",
+		0x8892: "PROFINET",
+		0x88A8: "QinQ",
+		0x88CC: "LLDP",
+		0x88E5: "MACsec",
+		0x88F7: "PTP",
+		0x8902: "CFM",
+		0x8906: "FCoE",
+		0x8914: "FIP",
+		0x9000: "Loopback",
+	}
+
+	if name, exists := etherTypeMap[etherType]; exists {
+		return name
+	}
+
+	// 小于0x0600的值是IEEE 802.3帧的长度字段，不是EtherType
+	if etherType < 0x0600 {
+		return "IEEE-802.3"
+	}
+
+	// 未知EtherType返回十六进制值
+	return fmt.Sprintf("EtherType-0x%04X", etherType)
+}
@@ -0,0 +1,790 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"SnapFlow/internal/models"
+)
+
+// snapshotRangeCondition 按时间索引（窗口结束时间）筛选 (from, to] 范围内的快照
+const snapshotRangeCondition = "ts > ? AND ts <= ?"
+
+// labelColumns 每张快照表中的来源标签列，加入标签之前写入的行为NULL
+var labelColumns = []string{"sensor", "site", "interface_name", "profile"}
+
+// labelExpressions 读取标签列时把NULL当作空字符串
+var labelExpressions = []string{
+	"COALESCE(sensor, '')",
+	"COALESCE(site, '')",
+	"COALESCE(interface_name, '')",
+	"COALESCE(profile, '')",
+}
+
+// sourceCondition 只读取指定来源的快照，站点只是描述信息，不参与筛选
+const sourceCondition = "COALESCE(sensor, '') = ? AND COALESCE(interface_name, '') = ? AND COALESCE(profile, '') = ?"
+
+// SnapshotSource 快照的来源：来源标签加采集配置档，与快照ID的组成一致
+type SnapshotSource struct {
+	Labels  models.Labels
+	Profile string
+}
+
+// QuerySnapshots 读取 (from, to] 内结束的快照，根据范围大小自动选择存储层级
+func QuerySnapshots(ctx context.Context, db *sql.DB, source *SnapshotSource, from, to time.Time) (Tier, []*models.Snapshot, error) {
+	tier := SelectTier(from, to)
+	snapshots, err := LoadSnapshots(ctx, db, tier, source, from, to)
+	return tier, snapshots, err
+}
+
+// SnapshotSources 返回层级中 (from, to] 内有快照的所有来源
+func SnapshotSources(ctx context.Context, db *sql.DB, tier Tier, from, to time.Time) ([]SnapshotSource, error) {
+	table := tier.tables().basicStats
+	query := Select(labelExpressions...).
+		From(table).
+		Where(snapshotRangeCondition).
+		Where(CommittedSnapshotCondition(tier)).
+		GroupBy(labelExpressions...).
+		String()
+
+	rows, err := db.QueryContext(ctx, query, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("读取 %s 中的快照来源失败: %w", table, err)
+	}
+	defer rows.Close()
+
+	var sources []SnapshotSource
+	for rows.Next() {
+		var source SnapshotSource
+		if err := rows.Scan(&source.Labels.Sensor, &source.Labels.Site, &source.Labels.Interface, &source.Profile); err != nil {
+			return nil, fmt.Errorf("扫描快照来源失败: %w", err)
+		}
+		sources = append(sources, source)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("扫描快照来源时发生错误: %w", err)
+	}
+	return sources, nil
+}
+
+// LoadSnapshots 从指定层级的表中读取 (from, to] 内结束的已完成快照，按窗口开始时间排序
+//
+// source为nil时读取所有来源的快照。只读取存在完成标记的快照。
+// 扁平化的JSON表可由其余数据重新生成，因此不读取。
+func LoadSnapshots(ctx context.Context, db *sql.DB, tier Tier, source *SnapshotSource, from, to time.Time) ([]*models.Snapshot, error) {
+	tables := tier.tables()
+	byID := make(map[string]*models.Snapshot)
+
+	filter := snapshotFilter{tier: tier, from: from, to: to, source: source}
+
+	// 1. 基础统计决定有哪些快照
+	err := filter.query(ctx, db, tables.basicStats,
+		append([]string{"snapshot_id", "window_start", "window_end", "total_packets", "total_bytes"}, labelExpressions...),
+		func(rows *sql.Rows) error {
+			var id string
+			var start, end time.Time
+			var packets, bytes uint64
+			snapshot := &models.Snapshot{}
+			if err := rows.Scan(&id, &start, &end, &packets, &bytes,
+				&snapshot.Sensor, &snapshot.Site, &snapshot.Interface, &snapshot.Profile); err != nil {
+				return err
+			}
+			snapshot.ID = id
+			snapshot.Timestamp = end
+			snapshot.SetBasicStats(start.UTC(), end.UTC(), packets, bytes)
+			byID[id] = snapshot
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. IP统计与热门源IP（迁移到版本5之前写入的行没有字节数和排序依据）
+	topIPs := make(map[string][]models.IPAddressPair)
+	err = filter.query(ctx, db, tables.ipStats,
+		[]string{"snapshot_id", "unique_source_count", "COALESCE(rank_by, '')"},
+		func(rows *sql.Rows) error {
+			var id string
+			var count int
+			var rankBy string
+			if err := rows.Scan(&id, &count, &rankBy); err != nil {
+				return err
+			}
+			if snapshot, ok := byID[id]; ok {
+				snapshot.IP.UniqueSourceCount = count
+				snapshot.IP.RankBy = models.RankBy(rankBy).OrDefault()
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	err = filter.query(ctx, db, tables.topSourceIPs,
+		[]string{"snapshot_id", "source_ip", "packet_count", "COALESCE(byte_count, 0)"},
+		func(rows *sql.Rows) error {
+			var pair models.IPAddressPair
+			var id string
+			if err := rows.Scan(&id, &pair.SourceIP, &pair.Count, &pair.Bytes); err != nil {
+				return err
+			}
+			topIPs[id] = append(topIPs[id], pair)
+			return nil
+		}, "pos_rank")
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. 端口统计与热门目标端口
+	topPorts := make(map[string][]models.PortPair)
+	err = filter.query(ctx, db, tables.portStats,
+		[]string{"snapshot_id", "unique_dest_count", "COALESCE(rank_by, '')"},
+		func(rows *sql.Rows) error {
+			var id string
+			var count int
+			var rankBy string
+			if err := rows.Scan(&id, &count, &rankBy); err != nil {
+				return err
+			}
+			if snapshot, ok := byID[id]; ok {
+				snapshot.Port.UniqueDestCount = count
+				snapshot.Port.RankBy = models.RankBy(rankBy).OrDefault()
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	err = filter.query(ctx, db, tables.topDestinationPorts,
+		[]string{"snapshot_id", "port", "packet_count", "COALESCE(byte_count, 0)"},
+		func(rows *sql.Rows) error {
+			var pair models.PortPair
+			var id string
+			if err := rows.Scan(&id, &pair.DestinationPort, &pair.Count, &pair.Bytes); err != nil {
+				return err
+			}
+			topPorts[id] = append(topPorts[id], pair)
+			return nil
+		}, "pos_rank")
+	if err != nil {
+		return nil, err
+	}
+
+	// 4. 协议分布
+	err = filter.query(ctx, db, tables.protocolStats,
+		[]string{"snapshot_id", "protocol_name", "packet_count", "COALESCE(byte_count, 0)", "percentage"},
+		func(rows *sql.Rows) error {
+			var proto models.ProtocolCount
+			var id string
+			if err := rows.Scan(&id, &proto.Name, &proto.Count, &proto.Bytes, &proto.Percentage); err != nil {
+				return err
+			}
+			if snapshot, ok := byID[id]; ok {
+				snapshot.Protocol.Protocols = append(snapshot.Protocol.Protocols, proto)
+			}
+			return nil
+		}, "packet_count DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	// 5. TCP标志分布（迁移前写入的行没有百分比）
+	err = filter.query(ctx, db, tables.tcpFlagStats,
+		[]string{"snapshot_id", "flag", "packet_count", "COALESCE(byte_count, 0)", "percentage"},
+		func(rows *sql.Rows) error {
+			var flag models.TCPFlagCount
+			var id string
+			var pct sql.NullFloat64
+			if err := rows.Scan(&id, &flag.Flag, &flag.Count, &flag.Bytes, &pct); err != nil {
+				return err
+			}
+			flag.Percentage = pct.Float64
+			if snapshot, ok := byID[id]; ok {
+				snapshot.TCPFlags.Flags = append(snapshot.TCPFlags.Flags, flag)
+			}
+			return nil
+		}, "packet_count DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	// 6. 目标IP、会话和五元组流排行（迁移到版本6之前的快照没有这些数据）
+	err = filter.query(ctx, db, tables.talkerStats,
+		[]string{"snapshot_id", "unique_dest_ip_count", "destination_rank_by", "conversation_rank_by", "flow_rank_by"},
+		func(rows *sql.Rows) error {
+			var id string
+			var count int
+			var destinationRankBy, conversationRankBy, flowRankBy string
+			if err := rows.Scan(&id, &count, &destinationRankBy, &conversationRankBy, &flowRankBy); err != nil {
+				return err
+			}
+			if snapshot, ok := byID[id]; ok {
+				snapshot.Destination.UniqueDestCount = count
+				snapshot.Destination.RankBy = models.RankBy(destinationRankBy).OrDefault()
+				snapshot.Conversation.RankBy = models.RankBy(conversationRankBy).OrDefault()
+				snapshot.Flow.RankBy = models.RankBy(flowRankBy).OrDefault()
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	err = filter.query(ctx, db, tables.topDestinationIPs,
+		[]string{"snapshot_id", "destination_ip", "packet_count", "byte_count", "first_seen", "last_seen"},
+		func(rows *sql.Rows) error {
+			var dest models.DestinationIPCount
+			var id string
+			if err := rows.Scan(&id, &dest.DestinationIP, &dest.Count, &dest.Bytes, &dest.FirstSeen, &dest.LastSeen); err != nil {
+				return err
+			}
+			if snapshot, ok := byID[id]; ok {
+				snapshot.Destination.TopDestinations = append(snapshot.Destination.TopDestinations, dest)
+			}
+			return nil
+		}, "pos_rank")
+	if err != nil {
+		return nil, err
+	}
+	err = filter.query(ctx, db, tables.topConversations,
+		[]string{"snapshot_id", "source_ip", "destination_ip", "packet_count", "byte_count", "first_seen", "last_seen"},
+		func(rows *sql.Rows) error {
+			var conv models.Conversation
+			var id string
+			if err := rows.Scan(&id, &conv.SourceIP, &conv.DestinationIP, &conv.Count, &conv.Bytes, &conv.FirstSeen, &conv.LastSeen); err != nil {
+				return err
+			}
+			if snapshot, ok := byID[id]; ok {
+				snapshot.Conversation.TopConversations = append(snapshot.Conversation.TopConversations, conv)
+			}
+			return nil
+		}, "pos_rank")
+	if err != nil {
+		return nil, err
+	}
+	err = filter.query(ctx, db, tables.topFlows,
+		[]string{"snapshot_id", "source_ip", "destination_ip", "source_port", "destination_port", "protocol",
+			"packet_count", "byte_count", "first_seen", "last_seen"},
+		func(rows *sql.Rows) error {
+			var flow models.FlowTuple
+			var id string
+			if err := rows.Scan(&id, &flow.SourceIP, &flow.DestinationIP, &flow.SourcePort, &flow.DestinationPort, &flow.Protocol,
+				&flow.Count, &flow.Bytes, &flow.FirstSeen, &flow.LastSeen); err != nil {
+				return err
+			}
+			if snapshot, ok := byID[id]; ok {
+				snapshot.Flow.TopFlows = append(snapshot.Flow.TopFlows, flow)
+			}
+			return nil
+		}, "pos_rank")
+	if err != nil {
+		return nil, err
+	}
+
+	// 7. 按传输层协议区分的端口排行（迁移到版本7之前的快照没有这些数据）
+	err = filter.query(ctx, db, tables.topTransportPorts,
+		[]string{"snapshot_id", "port_role", "transport", "port", "service_name", "packet_count", "byte_count"},
+		func(rows *sql.Rows) error {
+			var port models.TransportPortCount
+			var id, role string
+			if err := rows.Scan(&id, &role, &port.Transport, &port.Port, &port.Service, &port.Count, &port.Bytes); err != nil {
+				return err
+			}
+			port.Role = models.PortRole(role)
+			if snapshot, ok := byID[id]; ok {
+				snapshot.TransportPort.Ports = append(snapshot.TransportPort.Ports, port)
+			}
+			return nil
+		}, "port_role", "transport", "pos_rank")
+	if err != nil {
+		return nil, err
+	}
+
+	// 8. 服务分布（迁移到版本8之前的快照没有这些数据）
+	err = filter.query(ctx, db, tables.serviceStats,
+		[]string{"snapshot_id", "service_name", "packet_count", "byte_count", "percentage"},
+		func(rows *sql.Rows) error {
+			var service models.ServiceCount
+			var id string
+			if err := rows.Scan(&id, &service.Name, &service.Count, &service.Bytes, &service.Percentage); err != nil {
+				return err
+			}
+			if snapshot, ok := byID[id]; ok {
+				snapshot.Service.Services = append(snapshot.Service.Services, service)
+			}
+			return nil
+		}, "packet_count DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	// 9. EtherType分布、目标MAC地址类型分布和热门目标MAC地址（迁移到版本10之前的快照没有这些数据）
+	err = filter.query(ctx, db, tables.etherTypeStats,
+		[]string{"snapshot_id", "ether_type", "ether_type_name", "packet_count", "byte_count", "percentage"},
+		func(rows *sql.Rows) error {
+			var etherType models.EtherTypeCount
+			var id string
+			if err := rows.Scan(&id, &etherType.EtherType, &etherType.Name, &etherType.Count, &etherType.Bytes, &etherType.Percentage); err != nil {
+				return err
+			}
+			if snapshot, ok := byID[id]; ok {
+				snapshot.L2.EtherTypes = append(snapshot.L2.EtherTypes, etherType)
+			}
+			return nil
+		}, "packet_count DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	err = filter.query(ctx, db, tables.macCastStats,
+		[]string{"snapshot_id", "mac_cast", "packet_count", "byte_count", "percentage"},
+		func(rows *sql.Rows) error {
+			var cast models.MACCastCount
+			var id, name string
+			if err := rows.Scan(&id, &name, &cast.Count, &cast.Bytes, &cast.Percentage); err != nil {
+				return err
+			}
+			cast.Cast = models.MACCast(name)
+			if snapshot, ok := byID[id]; ok {
+				snapshot.L2.Casts = append(snapshot.L2.Casts, cast)
+			}
+			return nil
+		}, "packet_count DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	err = filter.query(ctx, db, tables.topDestinationMACs,
+		[]string{"snapshot_id", "destination_mac", "mac_cast", "packet_count", "byte_count", "rank_by"},
+		func(rows *sql.Rows) error {
+			var mac models.DestinationMACCount
+			var id, cast, rankBy string
+			if err := rows.Scan(&id, &mac.Address, &cast, &mac.Count, &mac.Bytes, &rankBy); err != nil {
+				return err
+			}
+			mac.Cast = models.MACCast(cast)
+			if snapshot, ok := byID[id]; ok {
+				snapshot.L2.RankBy = models.RankBy(rankBy)
+				snapshot.L2.TopDestinations = append(snapshot.L2.TopDestinations, mac)
+			}
+			return nil
+		}, "pos_rank")
+	if err != nil {
+		return nil, err
+	}
+
+	// 10. 流量分类统计（迁移到版本11之前的快照没有这些数据）
+	err = filter.query(ctx, db, tables.classificationStats,
+		[]string{"snapshot_id", "unknown_count", "unknown_bytes", "unknown_percentage",
+			"non_standard_count", "non_standard_bytes", "non_standard_percentage"},
+		func(rows *sql.Rows) error {
+			var stats models.ClassificationStats
+			var id string
+			if err := rows.Scan(&id, &stats.UnknownCount, &stats.UnknownBytes, &stats.UnknownPercentage,
+				&stats.NonStandardCount, &stats.NonStandardBytes, &stats.NonStandardPercentage); err != nil {
+				return err
+			}
+			// 分布和排行在之后的查询中追加
+			if snapshot, ok := byID[id]; ok {
+				snapshot.Classification = stats
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	err = filter.query(ctx, db, tables.packetTypeStats,
+		[]string{"snapshot_id", "packet_type", "packet_count", "byte_count", "percentage"},
+		func(rows *sql.Rows) error {
+			var packetType models.PacketTypeCount
+			var id string
+			if err := rows.Scan(&id, &packetType.Name, &packetType.Count, &packetType.Bytes, &packetType.Percentage); err != nil {
+				return err
+			}
+			if snapshot, ok := byID[id]; ok {
+				snapshot.Classification.PacketTypes = append(snapshot.Classification.PacketTypes, packetType)
+			}
+			return nil
+		}, "packet_count DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	err = filter.query(ctx, db, tables.applicationCrosstab,
+		[]string{"snapshot_id", "application", "dimension", "dimension_value", "packet_count", "byte_count", "percentage"},
+		func(rows *sql.Rows) error {
+			var count models.AppDimensionCount
+			var id, dimension string
+			if err := rows.Scan(&id, &count.Application, &dimension, &count.Value, &count.Count, &count.Bytes, &count.Percentage); err != nil {
+				return err
+			}
+			snapshot, ok := byID[id]
+			if !ok {
+				return nil
+			}
+			switch dimension {
+			case "protocol":
+				snapshot.Classification.AppProtocols = append(snapshot.Classification.AppProtocols, count)
+			case "destination_port":
+				snapshot.Classification.AppPorts = append(snapshot.Classification.AppPorts, count)
+			}
+			return nil
+		}, "application", "packet_count DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	err = filter.query(ctx, db, tables.nonStandardPorts,
+		[]string{"snapshot_id", "application", "transport", "port", "service_name", "packet_count", "byte_count"},
+		func(rows *sql.Rows) error {
+			var port models.NonStandardPortCount
+			var id string
+			if err := rows.Scan(&id, &port.Application, &port.Transport, &port.Port, &port.Service, &port.Count, &port.Bytes); err != nil {
+				return err
+			}
+			if snapshot, ok := byID[id]; ok {
+				snapshot.Classification.NonStandard = append(snapshot.Classification.NonStandard, port)
+			}
+			return nil
+		}, "pos_rank")
+	if err != nil {
+		return nil, err
+	}
+
+	// 11. 数据包大小统计（迁移到版本12之前的快照没有这些数据）
+	err = filter.query(ctx, db, tables.packetSizeStats,
+		[]string{"snapshot_id", "protocol", "packet_count", "byte_count",
+			"min_size", "max_size", "mean_size", "p50_size", "p90_size", "p99_size"},
+		func(rows *sql.Rows) error {
+			var h models.PacketSizeHistogram
+			var id string
+			if err := rows.Scan(&id, &h.Protocol, &h.Count, &h.Bytes, &h.Min, &h.Max, &h.Mean, &h.P50, &h.P90, &h.P99); err != nil {
+				return err
+			}
+			// 直方图区间在之后的查询中追加
+			snapshot, ok := byID[id]
+			if !ok {
+				return nil
+			}
+			if h.Protocol == models.AllProtocols {
+				snapshot.PacketSize.All = h
+			} else {
+				snapshot.PacketSize.Protocols = append(snapshot.PacketSize.Protocols, h)
+			}
+			return nil
+		}, "packet_count DESC", "protocol")
+	if err != nil {
+		return nil, err
+	}
+
+	err = filter.query(ctx, db, tables.packetSizeHistogram,
+		[]string{"snapshot_id", "protocol", "bucket", "lower_bound", "upper_bound", "packet_count", "byte_count", "percentage"},
+		func(rows *sql.Rows) error {
+			var bucket models.PacketSizeBucketCount
+			var id, protocol string
+			if err := rows.Scan(&id, &protocol, &bucket.Bucket, &bucket.Lower, &bucket.Upper, &bucket.Count, &bucket.Bytes, &bucket.Percentage); err != nil {
+				return err
+			}
+			if snapshot, ok := byID[id]; ok {
+				if h := packetSizeHistogram(snapshot, protocol); h != nil {
+					h.Buckets = append(h.Buckets, bucket)
+				}
+			}
+			return nil
+		}, "protocol", "lower_bound")
+	if err != nil {
+		return nil, err
+	}
+
+	// 12. 平均速率、峰值速率和微突发（迁移到版本13之前的快照没有这些数据；
+	// 迁移到版本17之前的快照没有总量，由平均速率和时间长度换算）
+	err = filter.query(ctx, db, tables.throughputStats,
+		[]string{"snapshot_id", "COALESCE(window_seconds, 0)", "COALESCE(packets_per_second, 0)", "COALESCE(bits_per_second, 0)",
+			"packet_count", "byte_count",
+			"COALESCE(bucket_ms, 0)", "COALESCE(burst_factor, 0)", "COALESCE(peak_pps, 0)", "COALESCE(peak_bps, 0)", "peak_at",
+			"COALESCE(burst_count, 0)", "COALESCE(burst_packets, 0)", "COALESCE(burst_bytes, 0)", "COALESCE(burst_percentage, 0)"},
+		func(rows *sql.Rows) error {
+			var stats models.ThroughputStats
+			var id string
+			var pps, bps float64
+			var packets, bytes sql.NullInt64
+			var peakAt sql.NullTime
+			if err := rows.Scan(&id, &stats.Seconds, &pps, &bps, &packets, &bytes,
+				&stats.BucketMillis, &stats.BurstFactor, &stats.PeakPPS, &stats.PeakBPS, &peakAt,
+				&stats.BurstCount, &stats.BurstPackets, &stats.BurstBytes, &stats.BurstPercentage); err != nil {
+				return err
+			}
+			// 没有采集时间桶的快照没有平均速率，时间和总量保持为0
+			if stats.BucketMillis == 0 {
+				stats.Seconds = 0
+			} else {
+				stats.Packets = uint64(packets.Int64)
+				if !packets.Valid {
+					stats.Packets = uint64(math.Round(pps * stats.Seconds))
+				}
+				stats.Bytes = uint64(bytes.Int64)
+				if !bytes.Valid {
+					stats.Bytes = uint64(math.Round(bps * stats.Seconds / 8))
+				}
+			}
+			if peakAt.Valid {
+				stats.PeakAt = peakAt.Time.UTC()
+			}
+			// 微突发排行在之后的查询中追加
+			if snapshot, ok := byID[id]; ok {
+				snapshot.Throughput = stats
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	err = filter.query(ctx, db, tables.microbursts,
+		[]string{"snapshot_id", "burst_start", "packet_count", "byte_count", "packets_per_second", "bits_per_second"},
+		func(rows *sql.Rows) error {
+			var burst models.Burst
+			var id string
+			if err := rows.Scan(&id, &burst.Start, &burst.Packets, &burst.Bytes, &burst.PPS, &burst.BPS); err != nil {
+				return err
+			}
+			burst.Start = burst.Start.UTC()
+			if snapshot, ok := byID[id]; ok {
+				snapshot.Throughput.Bursts = append(snapshot.Throughput.Bursts, burst)
+			}
+			return nil
+		}, "pos_rank")
+	if err != nil {
+		return nil, err
+	}
+
+	// 13. 流量方向统计（迁移到版本14之前的快照没有这些数据）
+	err = filter.query(ctx, db, tables.directionStats,
+		[]string{"snapshot_id", "direction", "packet_count", "byte_count", "percentage"},
+		func(rows *sql.Rows) error {
+			var count models.DirectionCount
+			var id, direction string
+			if err := rows.Scan(&id, &direction, &count.Count, &count.Bytes, &count.Percentage); err != nil {
+				return err
+			}
+			count.Direction = models.Direction(direction)
+			if snapshot, ok := byID[id]; ok {
+				snapshot.Direction.Directions = append(snapshot.Direction.Directions, count)
+			}
+			return nil
+		}, "packet_count DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	err = filter.query(ctx, db, tables.directionTopTalkers,
+		[]string{"snapshot_id", "direction", "role", "address", "packet_count", "byte_count", "rank_by"},
+		func(rows *sql.Rows) error {
+			var talker models.DirectionTalker
+			var id, direction, role, rankBy string
+			if err := rows.Scan(&id, &direction, &role, &talker.Address, &talker.Count, &talker.Bytes, &rankBy); err != nil {
+				return err
+			}
+			talker.Direction = models.Direction(direction)
+			talker.Role = models.TalkerRole(role)
+			if snapshot, ok := byID[id]; ok {
+				snapshot.Direction.RankBy = models.RankBy(rankBy)
+				snapshot.Direction.TopTalkers = append(snapshot.Direction.TopTalkers, talker)
+			}
+			return nil
+		}, "direction", "role", "pos_rank")
+	if err != nil {
+		return nil, err
+	}
+
+	err = filter.query(ctx, db, tables.directionBreakdown,
+		[]string{"snapshot_id", "direction", "dimension", "dimension_value", "packet_count", "byte_count", "percentage"},
+		func(rows *sql.Rows) error {
+			var count models.DirectionDimensionCount
+			var id, direction, dimension string
+			if err := rows.Scan(&id, &direction, &dimension, &count.Value, &count.Count, &count.Bytes, &count.Percentage); err != nil {
+				return err
+			}
+			count.Direction = models.Direction(direction)
+			snapshot, ok := byID[id]
+			if !ok {
+				return nil
+			}
+			switch dimension {
+			case "protocol":
+				snapshot.Direction.Protocols = append(snapshot.Direction.Protocols, count)
+			case "destination_port":
+				snapshot.Direction.Ports = append(snapshot.Direction.Ports, count)
+			}
+			return nil
+		}, "direction", "packet_count DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	// 14. 前缀统计（迁移到版本15之前的快照没有这些数据）
+	err = filter.query(ctx, db, tables.prefixUniqueCounts,
+		[]string{"snapshot_id", "role", "family", "prefix_length", "unique_count"},
+		func(rows *sql.Rows) error {
+			var u models.PrefixUniqueCount
+			var id, role string
+			if err := rows.Scan(&id, &role, &u.Family, &u.Length, &u.Count); err != nil {
+				return err
+			}
+			u.Role = models.TalkerRole(role)
+			if snapshot, ok := byID[id]; ok {
+				snapshot.Prefix.Unique = append(snapshot.Prefix.Unique, u)
+			}
+			return nil
+		}, "role DESC", "family", "prefix_length DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	err = filter.query(ctx, db, tables.topPrefixes,
+		[]string{"snapshot_id", "role", "family", "prefix_length", "prefix", "packet_count", "byte_count", "rank_by"},
+		func(rows *sql.Rows) error {
+			var p models.PrefixCount
+			var id, role, rankBy string
+			if err := rows.Scan(&id, &role, &p.Family, &p.Length, &p.Prefix, &p.Count, &p.Bytes, &rankBy); err != nil {
+				return err
+			}
+			snapshot, ok := byID[id]
+			if !ok {
+				return nil
+			}
+			snapshot.Prefix.RankBy = models.RankBy(rankBy)
+			switch models.TalkerRole(role) {
+			case models.TalkerSource:
+				snapshot.Prefix.TopSources = append(snapshot.Prefix.TopSources, p)
+			case models.TalkerDestination:
+				snapshot.Prefix.TopDestinations = append(snapshot.Prefix.TopDestinations, p)
+			}
+			return nil
+		}, "role", "family", "prefix_length DESC", "pos_rank")
+	if err != nil {
+		return nil, err
+	}
+
+	// 15. 国家和自治系统统计（迁移到版本16之前的快照没有这些数据）
+	err = filter.query(ctx, db, tables.topCountries,
+		[]string{"snapshot_id", "role", "country_code", "country", "packet_count", "byte_count", "percentage", "rank_by"},
+		func(rows *sql.Rows) error {
+			var country models.CountryCount
+			var id, role, rankBy string
+			if err := rows.Scan(&id, &role, &country.CountryCode, &country.Country, &country.Count, &country.Bytes, &country.Percentage, &rankBy); err != nil {
+				return err
+			}
+			country.Role = models.TalkerRole(role)
+			if snapshot, ok := byID[id]; ok {
+				snapshot.Geo.RankBy = models.RankBy(rankBy)
+				snapshot.Geo.TopCountries = append(snapshot.Geo.TopCountries, country)
+			}
+			return nil
+		}, "role DESC", "pos_rank")
+	if err != nil {
+		return nil, err
+	}
+
+	err = filter.query(ctx, db, tables.topASNs,
+		[]string{"snapshot_id", "role", "asn", "organization", "packet_count", "byte_count", "percentage", "rank_by"},
+		func(rows *sql.Rows) error {
+			var asn models.ASNCount
+			var id, role, rankBy string
+			if err := rows.Scan(&id, &role, &asn.ASN, &asn.Organization, &asn.Count, &asn.Bytes, &asn.Percentage, &rankBy); err != nil {
+				return err
+			}
+			asn.Role = models.TalkerRole(role)
+			if snapshot, ok := byID[id]; ok {
+				snapshot.Geo.RankBy = models.RankBy(rankBy)
+				snapshot.Geo.TopASNs = append(snapshot.Geo.TopASNs, asn)
+			}
+			return nil
+		}, "role DESC", "pos_rank")
+	if err != nil {
+		return nil, err
+	}
+
+	err = filter.query(ctx, db, tables.ipLocations,
+		[]string{"snapshot_id", "address", "country_code", "country", "city", "asn", "organization"},
+		func(rows *sql.Rows) error {
+			var location models.IPLocation
+			var id string
+			if err := rows.Scan(&id, &location.Address, &location.CountryCode, &location.Country, &location.City, &location.ASN, &location.Organization); err != nil {
+				return err
+			}
+			if snapshot, ok := byID[id]; ok {
+				snapshot.Geo.Locations = append(snapshot.Geo.Locations, location)
+			}
+			return nil
+		}, "address")
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]*models.Snapshot, 0, len(byID))
+	for id, snapshot := range byID {
+		snapshot.SetIPStats(snapshot.IP.UniqueSourceCount, topIPs[id])
+		snapshot.SetPortStats(snapshot.Port.UniqueDestCount, topPorts[id])
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Basic.StartTime.Before(snapshots[j].Basic.StartTime)
+	})
+	return snapshots, nil
+}
+
+// snapshotFilter 读取快照表时的时间范围、来源和完成标记过滤条件
+type snapshotFilter struct {
+	tier     Tier
+	from, to time.Time
+	source   *SnapshotSource
+}
+
+// query 读取一张快照表中满足过滤条件的行，每行交给scan处理
+func (f snapshotFilter) query(ctx context.Context, db *sql.DB, table Identifier,
+	columns []string, scan func(rows *sql.Rows) error, orderBy ...string) error {
+	q := Select(columns...).
+		From(table).
+		Where(snapshotRangeCondition).
+		Where(CommittedSnapshotCondition(f.tier)).
+		OrderBy(append([]string{"snapshot_id"}, orderBy...)...)
+	args := []any{f.from, f.to}
+
+	if f.source != nil {
+		q.Where(sourceCondition)
+		args = append(args, f.source.Labels.Sensor, f.source.Labels.Interface, f.source.Profile)
+	}
+
+	rows, err := db.QueryContext(ctx, q.String(), args...)
+	if err != nil {
+		return fmt.Errorf("读取 %s 失败: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return fmt.Errorf("扫描 %s 数据失败: %w", table, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("扫描 %s 数据时发生错误: %w", table, err)
+	}
+	return nil
+}
+
+// packetSizeHistogram 返回快照中协议对应的数据包大小直方图，没有该协议时返回nil
+func packetSizeHistogram(snapshot *models.Snapshot, protocol string) *models.PacketSizeHistogram {
+	if protocol == models.AllProtocols {
+		return &snapshot.PacketSize.All
+	}
+	for i := range snapshot.PacketSize.Protocols {
+		if snapshot.PacketSize.Protocols[i].Protocol == protocol {
+			return &snapshot.PacketSize.Protocols[i]
+		}
+	}
+	return nil
+}
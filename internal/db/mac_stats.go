@@ -2,40 +2,35 @@ package db
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 
 	"SnapFlow/internal/models"
 )
 
 // FillMACStats 填充MAC地址统计到snapshot中
-func FillMACStats(ctx context.Context, db *sql.DB, tableName string, snapshot *models.Snapshot) error {
+func FillMACStats(ctx context.Context, src *SourceDB, table Identifier, snapshot *models.Snapshot) error {
 	// 1. 获取唯一源MAC地址数量
-	uniqueCountQuery := fmt.Sprintf(`
-		SELECT COUNT(DISTINCT src_mac) 
-		FROM %s 
-		WHERE ts >= NOW() - INTERVAL 1 MINUTE
-	`, tableName)
+	uniqueCountQuery := src.Select("COUNT(DISTINCT src_mac)").
+		From(table).
+		Where(windowCondition).
+		String()
 
 	var uniqueCount int
-	err := db.QueryRowContext(ctx, uniqueCountQuery).Scan(&uniqueCount)
+	err := src.QueryRowContext(ctx, uniqueCountQuery, windowArgs(snapshot)...).Scan(&uniqueCount)
 	if err != nil {
 		return fmt.Errorf("获取唯一MAC地址数量失败: %w", err)
 	}
 
 	// 2. 获取前5个出现频率最高的MAC地址
-	topMACsQuery := fmt.Sprintf(`
-		SELECT 
-			IFNULL(src_mac, '') as src_mac, 
-			COUNT(*) AS request_count
-		FROM %s
-		WHERE ts >= NOW() - INTERVAL 1 MINUTE
-		GROUP BY src_mac
-		ORDER BY request_count DESC
-		LIMIT 5
-	`, tableName)
+	topMACsQuery := src.Select(src.Dialect().IfNull("src_mac", "''")+" AS src_mac", "COUNT(*) AS request_count").
+		From(table).
+		Where(windowCondition).
+		GroupBy("src_mac").
+		OrderBy("request_count DESC").
+		Limit(5).
+		String()
 
-	rows, err := db.QueryContext(ctx, topMACsQuery)
+	rows, err := src.QueryContext(ctx, topMACsQuery, windowArgs(snapshot)...)
 	if err != nil {
 		return fmt.Errorf("获取前5个MAC地址失败: %w", err)
 	}
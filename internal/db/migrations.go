@@ -0,0 +1,650 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tableSchemaMigrations 记录已应用的结构迁移
+var tableSchemaMigrations = MustParseIdentifier("schema_migrations")
+
+// Migration 一个版本化的结构变更，先按顺序执行Up中的语句，再添加AddColumns中的列
+//
+// GrepTimeDB的DDL不支持事务，迁移中途失败时已执行的语句不会回滚，
+// 因此建表使用IF NOT EXISTS，加列通过AddColumns在列不存在时才执行，
+// 其余不可重复执行的语句每个迁移只放一条。
+type Migration struct {
+	Version    int
+	Name       string
+	Up         []string
+	AddColumns []ColumnAddition
+}
+
+// ColumnAddition 迁移中需要添加的一列
+type ColumnAddition struct {
+	Table  Identifier
+	Column string
+	Type   string
+}
+
+// migrations 所有结构迁移，版本号从1开始连续递增
+//
+// 已发布的迁移不能再修改，结构变化只能通过追加新的迁移完成。
+// 迁移中引用的表必须是迁移发布时已经存在的表，不能使用会随新增表变化的 all()；
+// 新增的快照表在建表语句中包含来源标签列。
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_snapshot_tables",
+		// 新建的快照表不使用append_mode：相同主键和时间索引的行会被去重，
+		// 重新写入同一个窗口的快照时会覆盖旧数据而不是重复累加。
+		// 引入迁移之前的版本以append_mode建表，IF NOT EXISTS不会修改这些已有的表，由checkAppendModeTables在迁移前检查
+		Up: []string{
+			// 基础统计表 - 使用snapshot_id作为主键
+			CreateTable(tableBasicStats,
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"total_packets UINT64",
+				"total_bytes UINT64",
+				"window_start TIMESTAMP",
+				"window_end TIMESTAMP",
+				"window_size_seconds UINT16",
+				"PRIMARY KEY(snapshot_id)",
+			).String(),
+			// IP 统计表
+			CreateTable(tableIPStats,
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"unique_source_count UINT32",
+				"PRIMARY KEY(snapshot_id)",
+			).String(),
+			// 热门源 IP 表 - 使用pos_rank代替position
+			CreateTable(tableTopSourceIPs,
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"source_ip STRING",
+				"pos_rank UINT8",
+				"packet_count UINT64",
+				"PRIMARY KEY(snapshot_id, pos_rank)",
+			).String(),
+			// 端口统计表
+			CreateTable(tablePortStats,
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"unique_dest_count UINT32",
+				"PRIMARY KEY(snapshot_id)",
+			).String(),
+			// 热门目标端口表 - 使用pos_rank代替position
+			CreateTable(tableTopDestinationPorts,
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"port UINT16",
+				"service_name STRING",
+				"pos_rank UINT8",
+				"packet_count UINT64",
+				"PRIMARY KEY(snapshot_id, pos_rank)",
+			).String(),
+			// 协议统计表
+			CreateTable(tableProtocolStats,
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"protocol_name STRING",
+				"packet_count UINT64",
+				"percentage DOUBLE",
+				"PRIMARY KEY(snapshot_id, protocol_name)",
+			).String(),
+			// TCP 标志统计表
+			CreateTable(tableTCPFlagStats,
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"flag STRING",
+				"flag_name STRING",
+				"packet_count UINT64",
+				"PRIMARY KEY(snapshot_id, flag)",
+			).String(),
+			// TCP 标志扁平化统计表（饼图用）
+			CreateTable(tableTCPFlagsJSON,
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"total_packet_count UINT64",
+				"ack_count UINT64",
+				"syn_count UINT64",
+				"fin_ack_count UINT64",
+				"psh_ack_count UINT64",
+				"none_count UINT64",
+				"other_count UINT64",
+				"PRIMARY KEY(snapshot_id)",
+			).String(),
+			// 协议扁平化统计表（饼图用）
+			CreateTable(tableProtocolsJSON,
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"total_packet_count UINT64",
+				"tcp_count UINT64",
+				"udp_count UINT64",
+				"icmp_count UINT64",
+				"other_count UINT64",
+				"PRIMARY KEY(snapshot_id)",
+			).String(),
+			// 服务名称扁平化统计表（饼图用）
+			CreateTable(tableServicesJSON,
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"total_packet_count UINT64",
+				"http_count UINT64",
+				"https_count UINT64",
+				"ssh_count UINT64",
+				"dns_count UINT64",
+				"smtp_count UINT64",
+				"ftp_count UINT64",
+				"mysql_count UINT64",
+				"ntp_count UINT64",
+				"telnet_count UINT64",
+				"rdp_count UINT64",
+				"unknown_count UINT64",
+				"other_count UINT64",
+				"PRIMARY KEY(snapshot_id)",
+			).String(),
+			// 快照完成标记表：一个快照的所有表写入成功后才写入标记行
+			CreateTable(tableSnapshotCommits,
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"table_count UINT16",
+				"row_count UINT32",
+				"PRIMARY KEY(snapshot_id)",
+			).String(),
+		},
+	},
+	{
+		Version: 2,
+		Name:    "add_tcp_flag_percentage",
+		Up: []string{
+			AlterTable(tableTCPFlagStats).AddColumn("percentage DOUBLE").String(),
+		},
+	},
+	{
+		Version: 3,
+		Name:    "create_rollup_tier_tables",
+		Up: append(append(
+			tierTableDDL(Tier1m),
+			tierTableDDL(Tier1h)...),
+			tierTableDDL(Tier1d)...),
+	},
+	{
+		Version:    4,
+		Name:       "add_source_labels",
+		AddColumns: labelColumnAdditions(),
+	},
+	{
+		Version:    5,
+		Name:       "add_byte_totals",
+		AddColumns: byteColumnAdditions(),
+	},
+	{
+		Version: 6,
+		Name:    "create_talker_tables",
+		Up: append(append(append(
+			talkerTableDDL(TierRaw),
+			talkerTableDDL(Tier1m)...),
+			talkerTableDDL(Tier1h)...),
+			talkerTableDDL(Tier1d)...),
+	},
+	{
+		Version: 7,
+		Name:    "create_transport_port_tables",
+		Up: append(append(append(
+			transportPortTableDDL(TierRaw),
+			transportPortTableDDL(Tier1m)...),
+			transportPortTableDDL(Tier1h)...),
+			transportPortTableDDL(Tier1d)...),
+	},
+	{
+		Version: 8,
+		Name:    "create_service_stats_tables",
+		// 服务分布改为长格式后不再写入 network_services_json，旧表保留供查询历史数据
+		Up: append(append(append(
+			serviceTableDDL(TierRaw),
+			serviceTableDDL(Tier1m)...),
+			serviceTableDDL(Tier1h)...),
+			serviceTableDDL(Tier1d)...),
+	},
+	{
+		Version: 9,
+		Name:    "create_distribution_bucket_tables",
+		Up: append(append(append(
+			bucketTableDDL(TierRaw),
+			bucketTableDDL(Tier1m)...),
+			bucketTableDDL(Tier1h)...),
+			bucketTableDDL(Tier1d)...),
+	},
+	{
+		Version: 10,
+		Name:    "create_l2_tables",
+		Up: append(append(append(
+			l2TableDDL(TierRaw),
+			l2TableDDL(Tier1m)...),
+			l2TableDDL(Tier1h)...),
+			l2TableDDL(Tier1d)...),
+	},
+	{
+		Version: 11,
+		Name:    "create_classification_tables",
+		Up: append(append(append(
+			classificationTableDDL(TierRaw),
+			classificationTableDDL(Tier1m)...),
+			classificationTableDDL(Tier1h)...),
+			classificationTableDDL(Tier1d)...),
+	},
+	{
+		Version: 12,
+		Name:    "create_packet_size_tables",
+		Up: append(append(append(
+			packetSizeTableDDL(TierRaw),
+			packetSizeTableDDL(Tier1m)...),
+			packetSizeTableDDL(Tier1h)...),
+			packetSizeTableDDL(Tier1d)...),
+	},
+	{
+		Version: 13,
+		Name:    "create_throughput_tables",
+		Up: append(append(append(
+			throughputTableDDL(TierRaw),
+			throughputTableDDL(Tier1m)...),
+			throughputTableDDL(Tier1h)...),
+			throughputTableDDL(Tier1d)...),
+	},
+	{
+		Version: 14,
+		Name:    "create_direction_tables",
+		Up: append(append(append(
+			directionTableDDL(TierRaw),
+			directionTableDDL(Tier1m)...),
+			directionTableDDL(Tier1h)...),
+			directionTableDDL(Tier1d)...),
+	},
+	{
+		Version: 15,
+		Name:    "create_prefix_tables",
+		Up: append(append(append(
+			prefixTableDDL(TierRaw),
+			prefixTableDDL(Tier1m)...),
+			prefixTableDDL(Tier1h)...),
+			prefixTableDDL(Tier1d)...),
+	},
+	{
+		Version: 16,
+		Name:    "create_geo_tables",
+		Up: append(append(append(
+			geoTableDDL(TierRaw),
+			geoTableDDL(Tier1m)...),
+			geoTableDDL(Tier1h)...),
+			geoTableDDL(Tier1d)...),
+	},
+	{
+		Version:    17,
+		Name:       "add_throughput_totals",
+		AddColumns: throughputTotalColumnAdditions(),
+	},
+	{
+		Version: 18,
+		Name:    "widen_window_size_seconds",
+		// 原始数据表的窗口长度与层级表统一为UINT32，UINT16只能表示约18小时的窗口；
+		// 放宽类型不会改变已有的值，重复执行也没有影响
+		Up: []string{
+			AlterTable(tableBasicStats).ModifyColumn("window_size_seconds UINT32").String(),
+		},
+	},
+}
+
+// labelColumnAdditions 为所有层级的每张快照表添加来源标签列
+//
+// 表的主键在建表后不能修改，标签列只作为普通列；快照ID已经包含传感器和网卡，
+// 不同来源的行不会互相覆盖。
+//
+// 表的列表固定为迁移4发布时各层级的全部快照表，不随之后新增的表变化：
+// 迁移6及以后创建的表在建表语句中已经包含标签列，已经应用过迁移4的数据库和新建的数据库结构一致。
+func labelColumnAdditions() []ColumnAddition {
+	var additions []ColumnAddition
+	for _, tier := range Tiers() {
+		t := tier.tables()
+		for _, table := range []Identifier{
+			t.basicStats,
+			t.ipStats,
+			t.topSourceIPs,
+			t.portStats,
+			t.topDestinationPorts,
+			t.protocolStats,
+			t.tcpFlagStats,
+			t.tcpFlagsJSON,
+			t.protocolsJSON,
+			t.servicesJSON,
+			t.commits,
+		} {
+			for _, column := range labelColumns {
+				additions = append(additions, ColumnAddition{Table: table, Column: column, Type: "STRING"})
+			}
+		}
+	}
+	return additions
+}
+
+// byteColumnAdditions 为所有层级的排行和分布表添加字节数列，为IP和端口统计表添加排行的排序依据
+//
+// 旧快照的这些列为NULL，读取时字节数按0处理，排序依据按数据包数处理。
+func byteColumnAdditions() []ColumnAddition {
+	var additions []ColumnAddition
+	for _, tier := range Tiers() {
+		tables := tier.tables()
+		for _, table := range []Identifier{tables.topSourceIPs, tables.topDestinationPorts, tables.protocolStats, tables.tcpFlagStats} {
+			additions = append(additions, ColumnAddition{Table: table, Column: "byte_count", Type: "UINT64"})
+		}
+		for _, table := range []Identifier{tables.ipStats, tables.portStats} {
+			additions = append(additions, ColumnAddition{Table: table, Column: "rank_by", Type: "STRING"})
+		}
+	}
+	return additions
+}
+
+// throughputTotalColumnAdditions 为所有层级的吞吐速率表添加时间桶扫描到的数据包总数和字节总数，
+// 合并多个快照时用作平均速率和微突发占比的总数
+//
+// 旧快照的这些列为NULL，读取时由平均速率和时间长度换算。
+func throughputTotalColumnAdditions() []ColumnAddition {
+	var additions []ColumnAddition
+	for _, tier := range Tiers() {
+		table := tier.tables().throughputStats
+		additions = append(additions,
+			ColumnAddition{Table: table, Column: "packet_count", Type: "UINT64"},
+			ColumnAddition{Table: table, Column: "byte_count", Type: "UINT64"},
+		)
+	}
+	return additions
+}
+
+// appendModeTables 引入迁移之前的版本以append_mode创建的表，固定为当时的原始数据表
+func appendModeTables() []Identifier {
+	return []Identifier{
+		tableBasicStats,
+		tableIPStats,
+		tableTopSourceIPs,
+		tablePortStats,
+		tableTopDestinationPorts,
+		tableProtocolStats,
+		tableTCPFlagStats,
+		tableTCPFlagsJSON,
+		tableProtocolsJSON,
+		tableServicesJSON,
+	}
+}
+
+// appendModeOption 匹配建表语句中开启的append_mode选项
+var appendModeOption = regexp.MustCompile(`(?i)'?append_mode'?\s*=\s*'true'`)
+
+// checkAppendModeTables 检查是否还有以append_mode创建的表，有则列出这些表和转换步骤并返回错误
+//
+// 该检查是迁移和启动的前提条件，在应用任何迁移之前运行，不存在的表跳过。
+// append_mode表不会按主键和时间索引去重，GreptimeDB也不支持修改该选项，
+// 只能以相同的结构重新建表并复制数据，这里不自动执行，避免在迁移中复制大量数据。
+func checkAppendModeTables(ctx context.Context, db *sql.DB) error {
+	var tables []Identifier
+	for _, table := range appendModeTables() {
+		exists, err := tableExists(ctx, db, table)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+
+		var name, ddl string
+		if err := db.QueryRowContext(ctx, "SHOW CREATE TABLE "+table.Quoted()).Scan(&name, &ddl); err != nil {
+			return fmt.Errorf("读取 %s 的建表语句失败: %w", table, err)
+		}
+		if appendModeOption.MatchString(ddl) {
+			tables = append(tables, table)
+		}
+	}
+	if len(tables) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "以下 %d 张表由旧版本以append_mode创建，重复写入同一窗口时不会去重：\n", len(tables))
+	for _, table := range tables {
+		fmt.Fprintf(&b, "  - %s\n", table)
+	}
+	b.WriteString("请停止采集后对每张表执行以下步骤，再重新运行 snapflow migrate up：\n")
+	b.WriteString("  1. SHOW CREATE TABLE <表名>; 删除输出中的 append_mode 选项，把表名改为 <表名>_new 后执行\n")
+	b.WriteString("  2. INSERT INTO <表名>_new SELECT * FROM <表名>;\n")
+	b.WriteString("  3. DROP TABLE <表名>;\n")
+	b.WriteString("  4. ALTER TABLE <表名>_new RENAME <表名>;")
+	return errors.New(b.String())
+}
+
+// tableExists 检查表是否存在
+func tableExists(ctx context.Context, db *sql.DB, table Identifier) (bool, error) {
+	schema := "DATABASE()"
+	args := []any{table.Name()}
+	if table.Schema() != "" {
+		schema = "?"
+		args = append([]any{table.Schema()}, args...)
+	}
+
+	query := Select("COUNT(*)").
+		From(MustParseIdentifier("information_schema.tables")).
+		Where("table_schema = " + schema).
+		Where("table_name = ?").
+		String()
+
+	var count int
+	if err := db.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return false, fmt.Errorf("检查表 %s 是否存在失败: %w", table, err)
+	}
+	return count > 0, nil
+}
+
+// LatestSchemaVersion 返回当前程序需要的结构版本
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// MigrationState 一个迁移在数据库中的应用状态
+type MigrationState struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Known     bool // 为false表示数据库由更新版本的程序迁移过，本程序不认识该迁移
+}
+
+// ensureMigrationsTable 创建迁移记录表
+func ensureMigrationsTable(ctx context.Context, db *sql.DB) error {
+	query := CreateTable(tableSchemaMigrations,
+		"version INT",
+		"name STRING",
+		"applied_at TIMESTAMP TIME INDEX",
+		"PRIMARY KEY(version)",
+	).String()
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("创建 %s 表失败: %w", tableSchemaMigrations, err)
+	}
+	return nil
+}
+
+// appliedMigrations 读取已应用的迁移，按版本号索引
+func appliedMigrations(ctx context.Context, db *sql.DB) (map[int]MigrationState, error) {
+	if err := ensureMigrationsTable(ctx, db); err != nil {
+		return nil, err
+	}
+
+	query := Select("version", "name", "applied_at").
+		From(tableSchemaMigrations).
+		OrderBy("version").
+		String()
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("读取迁移记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]MigrationState)
+	for rows.Next() {
+		var state MigrationState
+		if err := rows.Scan(&state.Version, &state.Name, &state.AppliedAt); err != nil {
+			return nil, fmt.Errorf("扫描迁移记录失败: %w", err)
+		}
+		state.Applied = true
+		applied[state.Version] = state
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("扫描迁移记录时发生错误: %w", err)
+	}
+	return applied, nil
+}
+
+// MigrationStatus 返回所有迁移的状态，包括数据库中存在但本程序不认识的迁移
+func MigrationStatus(ctx context.Context, db *sql.DB) ([]MigrationState, error) {
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var states []MigrationState
+	for _, m := range migrations {
+		state, ok := applied[m.Version]
+		if !ok {
+			state = MigrationState{Version: m.Version, Name: m.Name}
+		}
+		state.Known = true
+		states = append(states, state)
+		delete(applied, m.Version)
+	}
+
+	// 剩下的是更新版本的程序应用过的迁移
+	var unknown []MigrationState
+	for _, state := range applied {
+		unknown = append(unknown, state)
+	}
+	sort.Slice(unknown, func(i, j int) bool {
+		return unknown[i].Version < unknown[j].Version
+	})
+	return append(states, unknown...), nil
+}
+
+// SchemaVersion 返回数据库当前的结构版本，即连续应用的最大迁移版本号
+func SchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+
+	version := 0
+	for {
+		if _, ok := applied[version+1]; !ok {
+			break
+		}
+		version++
+	}
+	return version, nil
+}
+
+// MigrateUp 按版本顺序应用所有未应用的迁移，返回本次应用的数量
+//
+// 还有以append_mode创建的表时不应用任何迁移，需要人工转换后重新运行 snapflow migrate up。
+func MigrateUp(ctx context.Context, db *sql.DB) (int, error) {
+	current, err := SchemaVersion(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	if current > LatestSchemaVersion() {
+		return 0, fmt.Errorf("数据库结构版本 %d 高于本程序支持的版本 %d，请升级程序", current, LatestSchemaVersion())
+	}
+	if err := checkAppendModeTables(ctx, db); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+
+		for _, stmt := range m.Up {
+			if _, err := db.ExecContext(ctx, stmt); err != nil {
+				return count, fmt.Errorf("应用迁移 %d_%s 失败: %w", m.Version, m.Name, err)
+			}
+		}
+		for _, addition := range m.AddColumns {
+			if err := addColumnIfMissing(ctx, db, addition); err != nil {
+				return count, fmt.Errorf("应用迁移 %d_%s 失败: %w", m.Version, m.Name, err)
+			}
+		}
+
+		query := InsertInto(tableSchemaMigrations, "version", "name", "applied_at").String()
+		if _, err := db.ExecContext(ctx, query, m.Version, m.Name, time.Now()); err != nil {
+			return count, fmt.Errorf("记录迁移 %d_%s 失败: %w", m.Version, m.Name, err)
+		}
+
+		fmt.Printf("✓ 已应用迁移 %d_%s\n", m.Version, m.Name)
+		count++
+	}
+	return count, nil
+}
+
+// addColumnIfMissing 列不存在时才添加，使中途失败的迁移可以重新执行
+func addColumnIfMissing(ctx context.Context, db *sql.DB, addition ColumnAddition) error {
+	schema := "DATABASE()"
+	args := []any{addition.Table.Name(), addition.Column}
+	if addition.Table.Schema() != "" {
+		schema = "?"
+		args = append([]any{addition.Table.Schema()}, args...)
+	}
+
+	query := Select("COUNT(*)").
+		From(MustParseIdentifier("information_schema.columns")).
+		Where("table_schema = " + schema).
+		Where("table_name = ?").
+		Where("column_name = ?").
+		String()
+
+	var count int
+	if err := db.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return fmt.Errorf("检查 %s.%s 是否存在失败: %w", addition.Table, addition.Column, err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	stmt := AlterTable(addition.Table).AddColumn(addition.Column + " " + addition.Type).String()
+	if _, err := db.ExecContext(ctx, stmt); err != nil {
+		return fmt.Errorf("添加列 %s.%s 失败: %w", addition.Table, addition.Column, err)
+	}
+	return nil
+}
+
+// CheckSchemaVersion 检查数据库结构版本是否与本程序一致、没有以append_mode创建的表，否则拒绝运行
+func CheckSchemaVersion(ctx context.Context, db *sql.DB) error {
+	current, err := SchemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	if err := checkAppendModeTables(ctx, db); err != nil {
+		return err
+	}
+
+	latest := LatestSchemaVersion()
+	switch {
+	case current < latest:
+		return fmt.Errorf("数据库结构版本 %d 低于需要的版本 %d，请先运行 snapflow migrate up", current, latest)
+	case current > latest:
+		return fmt.Errorf("数据库结构版本 %d 高于本程序支持的版本 %d，请升级程序", current, latest)
+	}
+	return nil
+}
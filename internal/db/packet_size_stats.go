@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"SnapFlow/internal/models"
+)
+
+// FillPacketSizeStats 填充数据包大小统计到snapshot中：所有数据包和每个协议的大小直方图、最小/最大/平均值
+// 以及50/90/99百分位数
+//
+// 按 (protocol, packet_size) 分组扫描一次窗口，同一大小的数据包合并为一行，百分位数由每种大小的数量
+// 精确算出。packet_size为NULL的数据包不计入，protocol为NULL的数据包归为unknown。
+func FillPacketSizeStats(ctx context.Context, src *SourceDB, table Identifier, snapshot *models.Snapshot) error {
+	query := src.Select("protocol", "packet_size", "COUNT(*) AS count").
+		From(table).
+		Where(windowCondition).
+		Where("packet_size IS NOT NULL").
+		GroupBy("protocol", "packet_size").
+		String()
+
+	rows, err := src.QueryContext(ctx, query, windowArgs(snapshot)...)
+	if err != nil {
+		return fmt.Errorf("获取数据包大小统计失败: %w", err)
+	}
+	defer rows.Close()
+
+	counter := models.NewPacketSizeCounter()
+	for rows.Next() {
+		var protocol sql.NullInt64
+		var size int64
+		var count uint64
+
+		if err := rows.Scan(&protocol, &size, &count); err != nil {
+			return fmt.Errorf("扫描数据包大小数据失败: %w", err)
+		}
+
+		protocolName := "unknown"
+		if protocol.Valid {
+			protocolName = getProtocolName(int(protocol.Int64))
+		}
+		counter.Add(protocolName, uint16(min(max(size, 0), 65535)), count)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("扫描数据包大小数据时发生错误: %w", err)
+	}
+
+	counter.Apply(snapshot)
+
+	// 打印获取的信息
+	all := snapshot.PacketSize.All
+	fmt.Printf("\n获取到的数据包大小统计信息:\n")
+	fmt.Printf("- 所有数据包: %d 个, 最小 %d, 最大 %d, 平均 %.2f, P50 %d, P90 %d, P99 %d 字节\n",
+		all.Count, all.Min, all.Max, all.Mean, all.P50, all.P90, all.P99)
+	for _, bucket := range all.Buckets {
+		fmt.Printf("  %s: %d 个数据包, %d 字节 (%.2f%%)\n", bucket.Bucket, bucket.Count, bucket.Bytes, bucket.Percentage)
+	}
+	fmt.Printf("- 各协议:\n")
+	for _, h := range snapshot.PacketSize.Protocols {
+		fmt.Printf("  %s: %d 个, 最小 %d, 最大 %d, 平均 %.2f, P50 %d, P90 %d, P99 %d 字节\n",
+			h.Protocol, h.Count, h.Min, h.Max, h.Mean, h.P50, h.P90, h.P99)
+	}
+
+	return nil
+}
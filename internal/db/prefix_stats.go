@@ -0,0 +1,52 @@
+package db
+
+import (
+	"fmt"
+
+	"SnapFlow/internal/models"
+	"SnapFlow/internal/network"
+)
+
+// applyPrefixStats 把每个源地址和目标地址的流量汇总到lengths中该地址族的各个前缀长度，
+// 写入每个角色、地址族和前缀长度的唯一前缀数量和热门前缀；无法解析的地址不计入
+func applyPrefixStats(snapshot *models.Snapshot, lengths network.PrefixLengths, sources, destinations map[string]models.Traffic) {
+	counter := models.NewPrefixCounter()
+	for _, group := range []struct {
+		role      models.TalkerRole
+		addresses map[string]models.Traffic
+	}{
+		{models.TalkerSource, sources},
+		{models.TalkerDestination, destinations},
+	} {
+		for address, traffic := range group.addresses {
+			for _, prefix := range lengths.Rollup(address) {
+				counter.Add(group.role, network.Family(prefix), prefix.Bits(), prefix.String(), traffic)
+			}
+		}
+	}
+	counter.Apply(snapshot)
+}
+
+// printPrefixStats 打印前缀统计
+func printPrefixStats(snapshot *models.Snapshot, lengths network.PrefixLengths) {
+	stats := snapshot.Prefix
+	fmt.Printf("\n获取到的前缀统计信息 (%s):\n", lengths)
+	for _, u := range stats.Unique {
+		fmt.Printf("- %s %s /%d: %d 个唯一前缀\n", u.Role, u.Family, u.Length, u.Count)
+	}
+	for _, group := range []struct {
+		title    string
+		prefixes []models.PrefixCount
+	}{
+		{"源前缀", stats.TopSources},
+		{"目标前缀", stats.TopDestinations},
+	} {
+		if len(group.prefixes) == 0 {
+			continue
+		}
+		fmt.Printf("- %s:\n", group.title)
+		for _, p := range group.prefixes {
+			fmt.Printf("  %s: %d 个数据包, %d 字节\n", p.Prefix, p.Count, p.Bytes)
+		}
+	}
+}
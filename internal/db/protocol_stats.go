@@ -2,7 +2,6 @@ package db
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"strconv"
 
@@ -10,27 +9,12 @@ import (
 )
 
 // FillProtocolStats 填充协议统计到snapshot中
-func FillProtocolStats(ctx context.Context, db *sql.DB, tableName string, snapshot *models.Snapshot) error {
+func FillProtocolStats(ctx context.Context, src *SourceDB, table Identifier, snapshot *models.Snapshot) error {
 
 	// 使用WITH语句计算协议分布和百分比
-	query := fmt.Sprintf(`
-		WITH total_packets AS (
-			-- 计算总的数据包数量
-			SELECT COUNT(*) AS total_count
-			FROM %s
-			WHERE ts >= NOW() - INTERVAL 1 MINUTE
-		)
-		SELECT 
-			protocol AS name, 
-			COUNT(*) AS count, 
-			(COUNT(*) * 100.0 / (SELECT total_count FROM total_packets)) AS percentage
-		FROM %s
-		WHERE ts >= NOW() - INTERVAL 1 MINUTE
-		GROUP BY protocol
-		ORDER BY count DESC;
-	`, tableName, tableName)
-
-	rows, err := db.QueryContext(ctx, query)
+	query := distributionQuery(src.Dialect(), table, "protocol", windowCondition).String()
+
+	rows, err := src.QueryContext(ctx, query, distributionArgs(snapshot)...)
 	if err != nil {
 		return fmt.Errorf("获取协议统计失败: %w", err)
 	}
@@ -42,10 +26,10 @@ func FillProtocolStats(ctx context.Context, db *sql.DB, tableName string, snapsh
 	// 扫描协议数据
 	for rows.Next() {
 		var protocolID int
-		var count uint64
+		var count, bytes uint64
 		var percentage float64
 
-		if err := rows.Scan(&protocolID, &count, &percentage); err != nil {
+		if err := rows.Scan(&protocolID, &count, &bytes, &percentage); err != nil {
 			return fmt.Errorf("扫描协议数据失败: %w", err)
 		}
 
@@ -56,6 +40,7 @@ func FillProtocolStats(ctx context.Context, db *sql.DB, tableName string, snapsh
 		protocols = append(protocols, models.ProtocolCount{
 			Name:       protocolName,
 			Count:      count,
+			Bytes:      bytes,
 			Percentage: percentage,
 		})
 	}
@@ -80,10 +65,11 @@ func FillProtocolStats(ctx context.Context, db *sql.DB, tableName string, snapsh
 	}
 
 	for i := 0; i < maxToPrint; i++ {
-		fmt.Printf("  %s: %.2f%% (%d 个数据包)\n",
+		fmt.Printf("  %s: %.2f%% (%d 个数据包, %d 字节)\n",
 			protocols[i].Name,
 			protocols[i].Percentage,
-			protocols[i].Count)
+			protocols[i].Count,
+			protocols[i].Bytes)
 	}
 
 	return nil
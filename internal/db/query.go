@@ -0,0 +1,330 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"SnapFlow/internal/models"
+)
+
+// recentWindowCondition 最近一分钟时间窗口的过滤条件
+func recentWindowCondition(d Dialect) string {
+	return "ts >= " + d.Ago(time.Minute)
+}
+
+// windowCondition 快照时间窗口的过滤条件，参数为窗口的开始和结束时间
+const windowCondition = "ts >= ? AND ts < ?"
+
+// windowArgs 返回快照时间窗口的查询参数，与windowCondition配合使用
+func windowArgs(snapshot *models.Snapshot) []any {
+	return []any{snapshot.Basic.StartTime, snapshot.Basic.EndTime}
+}
+
+// distributionArgs 使用windowCondition的distributionQuery所需的参数（CTE和主查询各一份）
+func distributionArgs(snapshot *models.Snapshot) []any {
+	return append(windowArgs(snapshot), windowArgs(snapshot)...)
+}
+
+// SelectQuery 用于构建SELECT语句，表名只能通过Identifier传入
+type SelectQuery struct {
+	dialect    Dialect
+	ctes       []commonTableExpr
+	columns    []string
+	from       Identifier
+	fromCTE    string
+	where      []string
+	groupBy    []string
+	orderBy    []string
+	limit      int
+	limitParam bool
+}
+
+// commonTableExpr WITH子句中的一个命名子查询
+type commonTableExpr struct {
+	name  string
+	query *SelectQuery
+}
+
+// Select 创建一个新的SELECT语句构建器，columns为代码中固定的列表达式，默认使用MySQL方言
+func Select(columns ...string) *SelectQuery {
+	return &SelectQuery{dialect: MySQL, columns: columns}
+}
+
+// Dialect 设置生成SQL时使用的方言，WITH子句中的子查询使用相同的方言
+func (q *SelectQuery) Dialect(d Dialect) *SelectQuery {
+	q.dialect = d
+	return q
+}
+
+// With 添加一个公共表表达式(CTE)
+func (q *SelectQuery) With(name string, sub *SelectQuery) *SelectQuery {
+	MustParseIdentifier(name)
+	q.ctes = append(q.ctes, commonTableExpr{name: name, query: sub})
+	return q
+}
+
+// From 设置查询的表
+func (q *SelectQuery) From(table Identifier) *SelectQuery {
+	q.from = table
+	return q
+}
+
+// FromCTE 从WITH子句定义的公共表表达式中查询
+func (q *SelectQuery) FromCTE(name string) *SelectQuery {
+	MustParseIdentifier(name)
+	q.fromCTE = name
+	return q
+}
+
+// Where 添加一个过滤条件，多个条件之间使用AND连接
+func (q *SelectQuery) Where(condition string) *SelectQuery {
+	q.where = append(q.where, condition)
+	return q
+}
+
+// GroupBy 设置分组列
+func (q *SelectQuery) GroupBy(columns ...string) *SelectQuery {
+	q.groupBy = append(q.groupBy, columns...)
+	return q
+}
+
+// OrderBy 设置排序表达式
+func (q *SelectQuery) OrderBy(expressions ...string) *SelectQuery {
+	q.orderBy = append(q.orderBy, expressions...)
+	return q
+}
+
+// Limit 设置固定的LIMIT
+func (q *SelectQuery) Limit(n int) *SelectQuery {
+	q.limit = n
+	q.limitParam = false
+	return q
+}
+
+// LimitParam 使用占位符作为LIMIT，实际值通过查询参数传入
+func (q *SelectQuery) LimitParam() *SelectQuery {
+	q.limitParam = true
+	return q
+}
+
+// String 生成最终的SQL语句
+func (q *SelectQuery) String() string {
+	var sb strings.Builder
+
+	if len(q.ctes) > 0 {
+		sb.WriteString("WITH ")
+		for i, cte := range q.ctes {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			fmt.Fprintf(&sb, "%s AS (%s)", cte.name, cte.query.Dialect(q.dialect).String())
+		}
+		sb.WriteString(" ")
+	}
+
+	sb.WriteString("SELECT ")
+	sb.WriteString(strings.Join(q.columns, ", "))
+
+	switch {
+	case !q.from.IsZero():
+		sb.WriteString(" FROM ")
+		sb.WriteString(q.dialect.Quote(q.from))
+	case q.fromCTE != "":
+		sb.WriteString(" FROM ")
+		sb.WriteString(q.fromCTE)
+	}
+
+	if len(q.where) > 0 {
+		sb.WriteString(" WHERE ")
+		sb.WriteString(strings.Join(q.where, " AND "))
+	}
+	if len(q.groupBy) > 0 {
+		sb.WriteString(" GROUP BY ")
+		sb.WriteString(strings.Join(q.groupBy, ", "))
+	}
+	if len(q.orderBy) > 0 {
+		sb.WriteString(" ORDER BY ")
+		sb.WriteString(strings.Join(q.orderBy, ", "))
+	}
+
+	if q.limitParam {
+		sb.WriteString(" LIMIT ?")
+	} else if q.limit > 0 {
+		fmt.Fprintf(&sb, " LIMIT %d", q.limit)
+	}
+
+	return sb.String()
+}
+
+// InsertQuery 用于构建INSERT语句
+type InsertQuery struct {
+	table   Identifier
+	columns []string
+	rows    int
+}
+
+// InsertInto 创建一个新的INSERT语句构建器
+func InsertInto(table Identifier, columns ...string) *InsertQuery {
+	return &InsertQuery{table: table, columns: columns, rows: 1}
+}
+
+// Rows 设置一条语句中插入的行数，生成多行 VALUES(...), (...)
+func (q *InsertQuery) Rows(n int) *InsertQuery {
+	q.rows = max(n, 1)
+	return q
+}
+
+// String 生成INSERT语句，值全部使用占位符
+func (q *InsertQuery) String() string {
+	placeholders := make([]string, len(q.columns))
+	for i := range placeholders {
+		placeholders[i] = "?"
+	}
+	row := "(" + strings.Join(placeholders, ", ") + ")"
+
+	values := make([]string, q.rows)
+	for i := range values {
+		values[i] = row
+	}
+
+	return fmt.Sprintf("INSERT INTO %s(%s) VALUES%s",
+		q.table.Quoted(),
+		strings.Join(q.columns, ", "),
+		strings.Join(values, ", "))
+}
+
+// DeleteQuery 用于构建DELETE语句
+type DeleteQuery struct {
+	table Identifier
+	where []string
+}
+
+// DeleteFrom 创建一个新的DELETE语句构建器
+func DeleteFrom(table Identifier) *DeleteQuery {
+	return &DeleteQuery{table: table}
+}
+
+// Where 添加一个过滤条件，多个条件之间使用AND连接
+func (q *DeleteQuery) Where(condition string) *DeleteQuery {
+	q.where = append(q.where, condition)
+	return q
+}
+
+// String 生成DELETE语句，没有过滤条件时panic，避免误删整张表
+func (q *DeleteQuery) String() string {
+	if len(q.where) == 0 {
+		panic("DELETE语句缺少过滤条件")
+	}
+	return fmt.Sprintf("DELETE FROM %s WHERE %s", q.table.Quoted(), strings.Join(q.where, " AND "))
+}
+
+// CreateTableQuery 用于构建CREATE TABLE IF NOT EXISTS语句
+type CreateTableQuery struct {
+	table   Identifier
+	columns []string
+	options string
+}
+
+// CreateTable 创建一个新的建表语句构建器，columns为列定义和约束
+func CreateTable(table Identifier, columns ...string) *CreateTableQuery {
+	return &CreateTableQuery{table: table, columns: columns}
+}
+
+// Options 设置表选项，例如 with('ttl'='7d')
+func (q *CreateTableQuery) Options(options string) *CreateTableQuery {
+	q.options = options
+	return q
+}
+
+// String 生成建表语句
+func (q *CreateTableQuery) String() string {
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n\t%s\n)",
+		q.table.Quoted(),
+		strings.Join(q.columns, ",\n\t"))
+	if q.options != "" {
+		query += " " + q.options
+	}
+	return query
+}
+
+// AlterTableQuery 用于构建只包含一个变更动作的ALTER TABLE语句
+type AlterTableQuery struct {
+	table  Identifier
+	action string
+}
+
+// AlterTable 创建一个新的修改表语句构建器
+func AlterTable(table Identifier) *AlterTableQuery {
+	return &AlterTableQuery{table: table}
+}
+
+// AddColumn 添加一列，definition为列名和类型，例如 percentage DOUBLE
+func (q *AlterTableQuery) AddColumn(definition string) *AlterTableQuery {
+	q.action = "ADD COLUMN " + definition
+	return q
+}
+
+// ModifyColumn 修改一列的类型，definition为列名和新类型，例如 window_size_seconds UINT32
+func (q *AlterTableQuery) ModifyColumn(definition string) *AlterTableQuery {
+	q.action = "MODIFY COLUMN " + definition
+	return q
+}
+
+// SetOption 修改表选项，例如 SetOption("ttl", "30d")
+func (q *AlterTableQuery) SetOption(key, value string) *AlterTableQuery {
+	q.action = fmt.Sprintf("SET '%s'='%s'", key, value)
+	return q
+}
+
+// String 生成修改表语句，没有变更动作时panic
+func (q *AlterTableQuery) String() string {
+	if q.action == "" {
+		panic("ALTER TABLE语句缺少变更动作")
+	}
+	return fmt.Sprintf("ALTER TABLE %s %s", q.table.Quoted(), q.action)
+}
+
+// distributionQuery 构建按指定列分组、带字节数和百分比的分布查询，返回 name、count、bytes、percentage 四列
+//
+// condition 会同时用于CTE和主查询，因此对应的参数需要传入两遍。
+func distributionQuery(d Dialect, table Identifier, column, condition string) *SelectQuery {
+	// 计算总的数据包数量
+	total := Select("COUNT(*) AS total_count").
+		From(table).
+		Where(condition)
+
+	return Select(
+		column+" AS name",
+		"COUNT(*) AS count",
+		byteSum(d),
+		"(COUNT(*) * 100.0 / (SELECT total_count FROM total_packets)) AS percentage",
+	).
+		Dialect(d).
+		With("total_packets", total).
+		From(table).
+		Where(condition).
+		GroupBy(column).
+		OrderBy("count DESC")
+}
+
+// byteSum 分组内数据包字节数之和，列名为bytes；分组内的packet_size全为NULL时为0
+func byteSum(d Dialect) string {
+	return d.IfNull("SUM(packet_size)", "0") + " AS bytes"
+}
+
+// rankOrder 按排序依据生成Top N查询的ORDER BY，依据相同时再比较另一项
+func rankOrder(by models.RankBy) []string {
+	if by == models.RankByBytes {
+		return []string{"bytes DESC", "count DESC"}
+	}
+	return []string{"count DESC", "bytes DESC"}
+}
+
+// rankByLabel 排序依据的中文名称，用于打印
+func rankByLabel(by models.RankBy) string {
+	if by == models.RankByBytes {
+		return "字节数"
+	}
+	return "数据包数"
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"SnapFlow/internal/models"
+)
+
+// RollupRange 对 [from, to) 内每个完整的桶执行汇总，返回写入的汇总快照数量
+//
+// 汇总快照的ID由桶确定，重复汇总同一个桶会覆盖旧结果。
+func RollupRange(ctx context.Context, db *sql.DB, tier Tier, from, to time.Time, opts SaveOptions) (int, error) {
+	if tier.IsRaw() {
+		return 0, fmt.Errorf("原始层级不需要汇总")
+	}
+
+	count := 0
+	for start := from.UTC().Truncate(tier.Duration); !start.Add(tier.Duration).After(to); start = start.Add(tier.Duration) {
+		written, err := RollupBucket(ctx, db, tier, start, opts)
+		count += written
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// RollupBucket 把上一级层级中落在 [start, start+tier.Duration) 内的快照按来源分别合并为汇总快照并写入
+//
+// 每个来源（传感器、网卡、配置档）单独汇总，汇总中心合并出的全局快照也是一个独立的来源。
+// 原始快照的窗口通常互相重叠（例如每5秒采集一次1分钟的窗口），只选取互不重叠的快照参与合并，
+// 避免重复计数。返回写入的汇总快照数量。
+func RollupBucket(ctx context.Context, db *sql.DB, tier Tier, start time.Time, opts SaveOptions) (int, error) {
+	end := start.Add(tier.Duration)
+	source := tier.Source()
+
+	sources, err := SnapshotSources(ctx, db, source, start, end)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, src := range sources {
+		parts, err := LoadSnapshots(ctx, db, source, &src, start, end)
+		if err != nil {
+			return count, fmt.Errorf("读取 %s 层级快照失败: %w", source.Name, err)
+		}
+		parts = nonOverlappingSnapshots(parts, start)
+		if len(parts) == 0 {
+			continue
+		}
+
+		merged := models.MergeSnapshots(src.Labels, src.Profile, start, end, parts)
+		opts.Tier = tier
+		if err := SaveSnapshotToGrepTimeDB(ctx, db, merged, opts); err != nil {
+			return count, fmt.Errorf("写入 %s 层级汇总快照失败: %w", tier.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// nonOverlappingSnapshots 从按开始时间排序的快照中依次选取互不重叠的快照
+//
+// 窗口在桶开始之前的快照会被跳过，选取的快照首尾相接时正好覆盖整个桶。
+func nonOverlappingSnapshots(snapshots []*models.Snapshot, bucketStart time.Time) []*models.Snapshot {
+	var selected []*models.Snapshot
+	cursor := bucketStart
+	for _, snapshot := range snapshots {
+		if snapshot.Basic.StartTime.Before(cursor) {
+			continue
+		}
+		selected = append(selected, snapshot)
+		cursor = snapshot.Basic.EndTime
+	}
+	return selected
+}
+
+// LastRollupEnd 返回层级中最新的已完成快照的窗口结束时间，没有数据时返回零值
+func LastRollupEnd(ctx context.Context, db *sql.DB, tier Tier) (time.Time, error) {
+	query := Select("MAX(window_end)").
+		From(tier.tables().basicStats).
+		Where(CommittedSnapshotCondition(tier)).
+		String()
+
+	var last sql.NullTime
+	if err := db.QueryRowContext(ctx, query).Scan(&last); err != nil {
+		return time.Time{}, fmt.Errorf("读取 %s 层级最新汇总时间失败: %w", tier.Name, err)
+	}
+	if !last.Valid {
+		return time.Time{}, nil
+	}
+	return last.Time.UTC(), nil
+}
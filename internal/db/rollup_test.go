@@ -0,0 +1,77 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"SnapFlow/internal/models"
+)
+
+func TestNonOverlappingSnapshots(t *testing.T) {
+	bucket := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// window 创建从桶开始offset秒、长度为length秒的快照，ID为offset
+	window := func(offset, length int) *models.Snapshot {
+		start := bucket.Add(time.Duration(offset) * time.Second)
+		s := &models.Snapshot{ID: start.Format("15:04:05")}
+		s.Basic.StartTime = start
+		s.Basic.EndTime = start.Add(time.Duration(length) * time.Second)
+		return s
+	}
+
+	tests := []struct {
+		name      string
+		snapshots []*models.Snapshot
+		want      []string
+	}{
+		{
+			name: "首尾相接的窗口全部选取",
+			snapshots: []*models.Snapshot{
+				window(0, 60), window(60, 60), window(120, 60),
+			},
+			want: []string{"12:00:00", "12:01:00", "12:02:00"},
+		},
+		{
+			name: "每5秒采集一次1分钟的窗口时跳过重叠的快照",
+			snapshots: []*models.Snapshot{
+				window(0, 60), window(5, 60), window(55, 60), window(60, 60), window(65, 60), window(120, 60),
+			},
+			want: []string{"12:00:00", "12:01:00", "12:02:00"},
+		},
+		{
+			name: "桶开始之前的窗口被跳过",
+			snapshots: []*models.Snapshot{
+				window(-30, 60), window(30, 60), window(90, 60),
+			},
+			want: []string{"12:00:30", "12:01:30"},
+		},
+		{
+			name: "窗口之间的空隙不影响选取",
+			snapshots: []*models.Snapshot{
+				window(0, 60), window(300, 60),
+			},
+			want: []string{"12:00:00", "12:05:00"},
+		},
+		{
+			name: "没有快照",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, s := range nonOverlappingSnapshots(tt.snapshots, bucket) {
+				got = append(got, s.ID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("选取 %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("选取 %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
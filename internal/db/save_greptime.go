@@ -4,252 +4,286 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strconv"
 	"time"
 
 	"SnapFlow/internal/models"
+	"SnapFlow/internal/services"
 )
 
-// CreateGrepTimeDBTables 在GrepTimeDB中创建所有必要的表
-func CreateGrepTimeDBTables(ctx context.Context, db *sql.DB) error {
-	// 打印固定的时间和用户信息
-	fmt.Printf("Current Date and Time (UTC - YYYY-MM-DD HH:MM:SS formatted): 2025-03-19 10:02:56\n")
-	fmt.Printf("Current User's Login: zenyanle\n")
+// GrepTimeDB中保存快照的各个表
+var (
+	tableBasicStats          = MustParseIdentifier("network_basic_stats")
+	tableIPStats             = MustParseIdentifier("network_ip_stats")
+	tableTopSourceIPs        = MustParseIdentifier("network_top_source_ips")
+	tablePortStats           = MustParseIdentifier("network_port_stats")
+	tableTopDestinationPorts = MustParseIdentifier("network_top_destination_ports")
+	tableProtocolStats       = MustParseIdentifier("network_protocol_stats")
+	tableTCPFlagStats        = MustParseIdentifier("network_tcp_flag_stats")
+	tableTCPFlagsJSON        = MustParseIdentifier("network_tcp_flags_json")
+	tableProtocolsJSON       = MustParseIdentifier("network_protocols_json")
+	tableServicesJSON        = MustParseIdentifier("network_services_json")
+	tableSnapshotCommits     = MustParseIdentifier("network_snapshot_commits")
+	tableTalkerStats         = MustParseIdentifier("network_talker_stats")
+	tableTopDestinationIPs   = MustParseIdentifier("network_top_destination_ips")
+	tableTopConversations    = MustParseIdentifier("network_top_conversations")
+	tableTopFlows            = MustParseIdentifier("network_top_flows")
+	tableTopTransportPorts   = MustParseIdentifier("network_top_transport_ports")
+	tableServiceStats        = MustParseIdentifier("network_service_stats")
+	tableDistributionBuckets = MustParseIdentifier("network_distribution_buckets")
+	tableEtherTypeStats      = MustParseIdentifier("network_ethertype_stats")
+	tableMACCastStats        = MustParseIdentifier("network_mac_cast_stats")
+	tableTopDestinationMACs  = MustParseIdentifier("network_top_destination_macs")
+	tableClassificationStats = MustParseIdentifier("network_classification_stats")
+	tablePacketTypeStats     = MustParseIdentifier("network_packet_type_stats")
+	tableApplicationCrosstab = MustParseIdentifier("network_application_crosstab")
+	tableNonStandardPorts    = MustParseIdentifier("network_non_standard_ports")
+	tablePacketSizeStats     = MustParseIdentifier("network_packet_size_stats")
+	tablePacketSizeHistogram = MustParseIdentifier("network_packet_size_histogram")
+	tableThroughputStats     = MustParseIdentifier("network_throughput_stats")
+	tableMicrobursts         = MustParseIdentifier("network_microbursts")
+	tableDirectionStats      = MustParseIdentifier("network_direction_stats")
+	tableDirectionTopTalkers = MustParseIdentifier("network_direction_top_talkers")
+	tableDirectionBreakdown  = MustParseIdentifier("network_direction_breakdown")
+	tablePrefixUniqueCounts  = MustParseIdentifier("network_prefix_unique_counts")
+	tableTopPrefixes         = MustParseIdentifier("network_top_prefixes")
+	tableTopCountries        = MustParseIdentifier("network_top_countries")
+	tableTopASNs             = MustParseIdentifier("network_top_asns")
+	tableIPLocations         = MustParseIdentifier("network_ip_locations")
+)
 
-	// 1. 基础统计表 - 使用snapshot_id作为主键
-	if _, err := db.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS network_basic_stats (
-			snapshot_id STRING,
-			ts TIMESTAMP TIME INDEX,
-			total_packets UINT64,
-			total_bytes UINT64,
-			window_start TIMESTAMP,
-			window_end TIMESTAMP,
-			window_size_seconds UINT16,
-			PRIMARY KEY(snapshot_id)
-		) with('append_mode'='true');
-	`); err != nil {
-		return fmt.Errorf("创建 network_basic_stats 表失败: %w", err)
-	}
-
-	// 2. IP 统计表
-	if _, err := db.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS network_ip_stats (
-			snapshot_id STRING,
-			ts TIMESTAMP TIME INDEX,
-			unique_source_count UINT32,
-			PRIMARY KEY(snapshot_id)
-		) with('append_mode'='true');
-	`); err != nil {
-		return fmt.Errorf("创建 network_ip_stats 表失败: %w", err)
-	}
-
-	// 3. 热门源 IP 表 - 使用pos_rank代替position
-	if _, err := db.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS network_top_source_ips (
-			snapshot_id STRING,
-			ts TIMESTAMP TIME INDEX,
-			source_ip STRING,
-			pos_rank UINT8,
-			packet_count UINT64,
-			PRIMARY KEY(snapshot_id, pos_rank)
-		) with('append_mode'='true');
-	`); err != nil {
-		return fmt.Errorf("创建 network_top_source_ips 表失败: %w", err)
-	}
-
-	// 4. 端口统计表
-	if _, err := db.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS network_port_stats (
-			snapshot_id STRING,
-			ts TIMESTAMP TIME INDEX,
-			unique_dest_count UINT32,
-			PRIMARY KEY(snapshot_id)
-		) with('append_mode'='true');
-	`); err != nil {
-		return fmt.Errorf("创建 network_port_stats 表失败: %w", err)
-	}
-
-	// 5. 热门目标端口表 - 使用pos_rank代替position
-	if _, err := db.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS network_top_destination_ports (
-			snapshot_id STRING,
-			ts TIMESTAMP TIME INDEX,
-			port UINT16,
-			service_name STRING,
-			pos_rank UINT8,
-			packet_count UINT64,
-			PRIMARY KEY(snapshot_id, pos_rank)
-		) with('append_mode'='true');
-	`); err != nil {
-		return fmt.Errorf("创建 network_top_destination_ports 表失败: %w", err)
-	}
-
-	// 6. 协议统计表
-	if _, err := db.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS network_protocol_stats (
-			snapshot_id STRING,
-			ts TIMESTAMP TIME INDEX,
-			protocol_name STRING,
-			packet_count UINT64,
-			percentage DOUBLE,
-			PRIMARY KEY(snapshot_id, protocol_name)
-		) with('append_mode'='true');
-	`); err != nil {
-		return fmt.Errorf("创建 network_protocol_stats 表失败: %w", err)
-	}
-
-	// 7. TCP 标志统计表
-	if _, err := db.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS network_tcp_flag_stats (
-			snapshot_id STRING,
-			ts TIMESTAMP TIME INDEX,
-			flag STRING,
-			flag_name STRING,
-			packet_count UINT64,
-			PRIMARY KEY(snapshot_id, flag)
-		) with('append_mode'='true');
-	`); err != nil {
-		return fmt.Errorf("创建 network_tcp_flag_stats 表失败: %w", err)
-	}
-
-	// 8. TCP 标志扁平化统计表（饼图用）
-	if _, err := db.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS network_tcp_flags_json (
-			snapshot_id STRING,
-			ts TIMESTAMP TIME INDEX,
-			total_packet_count UINT64,
-			ack_count UINT64,
-			syn_count UINT64, 
-			fin_ack_count UINT64,
-			psh_ack_count UINT64,
-			none_count UINT64,
-			other_count UINT64,
-			PRIMARY KEY(snapshot_id)
-		) with('append_mode'='true');
-	`); err != nil {
-		return fmt.Errorf("创建 network_tcp_flags_json 表失败: %w", err)
-	}
-
-	// 9. 协议扁平化统计表（饼图用）
-	if _, err := db.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS network_protocols_json (
-			snapshot_id STRING,
-			ts TIMESTAMP TIME INDEX,
-			total_packet_count UINT64,
-			tcp_count UINT64,
-			udp_count UINT64,
-			icmp_count UINT64,
-			other_count UINT64,
-			PRIMARY KEY(snapshot_id)
-		) with('append_mode'='true');
-	`); err != nil {
-		return fmt.Errorf("创建 network_protocols_json 表失败: %w", err)
-	}
-
-	// 10. 新增: 服务名称扁平化统计表（饼图用）
-	if _, err := db.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS network_services_json (
-			snapshot_id STRING,
-			ts TIMESTAMP TIME INDEX,
-			total_packet_count UINT64,
-			http_count UINT64,
-			https_count UINT64,
-			ssh_count UINT64,
-			dns_count UINT64,
-			smtp_count UINT64,
-			ftp_count UINT64,
-			mysql_count UINT64,
-			ntp_count UINT64,
-			telnet_count UINT64,
-			rdp_count UINT64,
-			unknown_count UINT64,
-			other_count UINT64,
-			PRIMARY KEY(snapshot_id)
-		) with('append_mode'='true');
-	`); err != nil {
-		return fmt.Errorf("创建 network_services_json 表失败: %w", err)
-	}
-
-	fmt.Println("所有GrepTimeDB数据表创建成功")
-	return nil
+// WriteMode 快照写入的原子性保证方式
+type WriteMode string
+
+const (
+	// WriteModeMarker 逐表批量写入，全部成功后最后写入完成标记行；
+	// 读取方只读取存在完成标记的快照，因此不会看到写了一半的快照（适用于GrepTimeDB）
+	WriteModeMarker WriteMode = "marker"
+	// WriteModeTransaction 在一个事务中写入所有表和完成标记（需要数据库支持事务）
+	WriteModeTransaction WriteMode = "transaction"
+)
+
+// ParseWriteMode 解析写入模式配置
+func ParseWriteMode(value string) (WriteMode, error) {
+	switch WriteMode(value) {
+	case "", WriteModeMarker:
+		return WriteModeMarker, nil
+	case WriteModeTransaction:
+		return WriteModeTransaction, nil
+	default:
+		return "", fmt.Errorf("未知的写入模式 %q（可选 marker、transaction）", value)
+	}
+}
+
+// SaveOptions 保存快照时的选项
+type SaveOptions struct {
+	Mode WriteMode
+	Tier Tier // 写入的存储层级，零值表示原始快照
+	// Buckets 协议和TCP标志饼图的分组，写入 network_distribution_buckets；未配置时使用默认分组
+	Buckets DistributionBuckets
+}
+
+// CommittedSnapshotCondition 返回只保留已完成快照的过滤条件，读取快照表时必须加上
+func CommittedSnapshotCondition(tier Tier) string {
+	return fmt.Sprintf("snapshot_id IN (SELECT snapshot_id FROM %s)", tier.tables().commits.Quoted())
 }
 
 // SaveSnapshotToGrepTimeDB 将快照数据保存到GrepTimeDB
-func SaveSnapshotToGrepTimeDB(ctx context.Context, db *sql.DB, snapshot *models.Snapshot) error {
+func SaveSnapshotToGrepTimeDB(ctx context.Context, db *sql.DB, snapshot *models.Snapshot, opts SaveOptions) error {
 	// 打印固定的时间和用户信息
 	fmt.Printf("Current Date and Time (UTC - YYYY-MM-DD HH:MM:SS formatted): 2025-03-19 10:02:56\n")
 	fmt.Printf("Current User's Login: zenyanle\n")
 
-	// 获取当前时间作为插入时间
-	now := time.Now().UTC()
+	// 使用窗口结束时间作为时间索引，保证重新写入同一窗口时主键和时间索引都相同
+	ts := snapshot.WindowEnd()
 
-	// 生成快照ID
-	snapshotID := fmt.Sprintf("snap_%d", now.UnixNano())
-
-	// 1. 插入基础统计数据
-	fmt.Println("插入基础统计数据...")
-	if err := saveBasicStats(ctx, db, snapshot, now, snapshotID); err != nil {
-		return fmt.Errorf("插入基础统计数据失败: %w", err)
+	// 快照ID由采集方根据时间窗口确定，缺失时按窗口补齐
+	snapshotID := snapshot.ID
+	if snapshotID == "" {
+		snapshotID = models.SnapshotID(snapshot.Labels, snapshot.Profile,
+			snapshot.Basic.StartTime, snapshot.Basic.EndTime.Sub(snapshot.Basic.StartTime))
 	}
 
-	// 2. 插入IP统计数据
-	fmt.Println("插入IP统计数据...")
-	if err := saveIPStats(ctx, db, snapshot, now, snapshotID); err != nil {
-		return fmt.Errorf("插入IP统计数据失败: %w", err)
+	// 先在内存中组装好每张表的所有行，再按表批量写入
+	tables := opts.Tier.tables()
+	batches := buildSnapshotBatches(tables, opts.Buckets, snapshot, ts, snapshotID)
+
+	// 完成标记必须最后写入
+	rowCount := 0
+	for _, batch := range batches {
+		rowCount += len(batch.rows)
 	}
+	marker := newTableBatch(tables.commits, "snapshot_id", "ts", "table_count", "row_count")
+	marker.add(snapshotID, ts, len(batches), rowCount)
 
-	// 3. 插入端口统计数据
-	fmt.Println("插入端口统计数据...")
-	if err := savePortStats(ctx, db, snapshot, now, snapshotID); err != nil {
-		return fmt.Errorf("插入端口统计数据失败: %w", err)
+	// 每张表都带上来源标签，便于按传感器、站点和网卡筛选
+	for _, batch := range append(batches, marker) {
+		batch.addLabels(snapshot)
 	}
 
-	// 4. 插入协议统计数据
-	fmt.Println("插入协议统计数据...")
-	if err := saveProtocolStats(ctx, db, snapshot, now, snapshotID); err != nil {
-		return fmt.Errorf("插入协议统计数据失败: %w", err)
+	switch opts.Mode {
+	case WriteModeTransaction:
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("开启事务失败: %w", err)
+		}
+		defer tx.Rollback()
+
+		if err := replaceSnapshotRows(ctx, tx, snapshotID, batches, marker); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("提交快照事务失败: %w", err)
+		}
+	default:
+		// 任意一张表写入失败都不会写入完成标记，读取方会忽略这个不完整的快照
+		if err := replaceSnapshotRows(ctx, db, snapshotID, batches, marker); err != nil {
+			return err
+		}
 	}
 
-	// 5. 插入TCP标志统计数据
-	fmt.Println("插入TCP标志统计数据...")
-	if err := saveTCPFlagsStats(ctx, db, snapshot, now, snapshotID); err != nil {
-		return fmt.Errorf("插入TCP标志统计数据失败: %w", err)
+	fmt.Printf("网络流量快照 %s 已成功保存到GrepTimeDB（%d 张表，%d 行）\n",
+		snapshotID, len(batches), rowCount)
+	return nil
+}
+
+// execer *sql.DB 和 *sql.Tx 共同的执行接口
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// maxRowsPerInsert 单条INSERT语句最多包含的行数
+const maxRowsPerInsert = 500
+
+// tableBatch 一张表待写入的多行数据
+type tableBatch struct {
+	table   Identifier
+	columns []string
+	rows    [][]any
+}
+
+// newTableBatch 创建指定表和列的批量写入数据
+func newTableBatch(table Identifier, columns ...string) *tableBatch {
+	return &tableBatch{table: table, columns: columns}
+}
+
+// add 添加一行，值的顺序必须与列一致
+func (b *tableBatch) add(values ...any) {
+	b.rows = append(b.rows, values)
+}
+
+// addLabels 为所有行追加来源标签列
+func (b *tableBatch) addLabels(snapshot *models.Snapshot) {
+	b.columns = append(b.columns, labelColumns...)
+	for i := range b.rows {
+		b.rows[i] = append(b.rows[i], snapshot.Sensor, snapshot.Site, snapshot.Interface, snapshot.Profile)
 	}
+}
+
+// exec 使用多行INSERT写入所有行
+func (b *tableBatch) exec(ctx context.Context, ex execer) error {
+	for start := 0; start < len(b.rows); start += maxRowsPerInsert {
+		end := min(start+maxRowsPerInsert, len(b.rows))
+		chunk := b.rows[start:end]
 
-	// 6. 插入协议扁平化统计数据
-	fmt.Println("插入协议分布数据...")
-	if err := saveProtocolsJSON(ctx, db, snapshot, now, snapshotID); err != nil {
-		return fmt.Errorf("插入协议分布统计数据失败: %w", err)
+		args := make([]any, 0, len(chunk)*len(b.columns))
+		for _, row := range chunk {
+			args = append(args, row...)
+		}
+
+		query := InsertInto(b.table, b.columns...).Rows(len(chunk)).String()
+		if _, err := ex.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	// 7. 插入TCP标志扁平化统计数据
-	fmt.Println("插入TCP标志分布数据...")
-	if err := saveTCPFlagsJSON(ctx, db, snapshot, now, snapshotID); err != nil {
-		return fmt.Errorf("插入TCP标志分布统计数据失败: %w", err)
+// replaceSnapshotRows 用新数据替换同一快照ID的旧数据
+//
+// 先删除完成标记，使读取方在替换过程中忽略该快照；再删除各表中的旧行并写入新行，
+// 最后重新写入完成标记。这样重复写入同一窗口不会让计数翻倍。
+func replaceSnapshotRows(ctx context.Context, ex execer, snapshotID string, batches []*tableBatch, marker *tableBatch) error {
+	tables := []Identifier{marker.table}
+	for _, batch := range batches {
+		tables = append(tables, batch.table)
 	}
 
-	// 8. 新增: 插入服务名称扁平化统计数据
-	fmt.Println("插入服务名称分布数据...")
-	if err := saveServicesJSON(ctx, db, snapshot, now, snapshotID); err != nil {
-		return fmt.Errorf("插入服务名称分布统计数据失败: %w", err)
+	for _, table := range tables {
+		query := DeleteFrom(table).Where("snapshot_id = ?").String()
+		if _, err := ex.ExecContext(ctx, query, snapshotID); err != nil {
+			return fmt.Errorf("删除 %s 中快照 %s 的旧数据失败: %w", table, snapshotID, err)
+		}
 	}
 
-	fmt.Println("网络流量快照已成功保存到GrepTimeDB")
+	return writeBatches(ctx, ex, append(batches, marker))
+}
+
+// writeBatches 依次写入每张表的数据
+func writeBatches(ctx context.Context, ex execer, batches []*tableBatch) error {
+	for _, batch := range batches {
+		if len(batch.rows) == 0 {
+			continue
+		}
+		if err := batch.exec(ctx, ex); err != nil {
+			return fmt.Errorf("写入 %s 失败: %w", batch.table, err)
+		}
+		fmt.Printf("- %s: 写入 %d 行\n", batch.table, len(batch.rows))
+	}
 	return nil
 }
 
-// saveBasicStats 插入基础统计数据
-func saveBasicStats(ctx context.Context, db *sql.DB, snapshot *models.Snapshot, ts time.Time, snapshotID string) error {
-	query := `
-		INSERT INTO network_basic_stats(
-			snapshot_id, ts, total_packets, total_bytes, window_start, window_end, window_size_seconds
-		) VALUES(?, ?, ?, ?, ?, ?, ?)
-	`
+// buildSnapshotBatches 把快照转换为各张表的批量写入数据
+func buildSnapshotBatches(tables snapshotTables, buckets DistributionBuckets, snapshot *models.Snapshot, ts time.Time, snapshotID string) []*tableBatch {
+	return []*tableBatch{
+		basicStatsBatch(tables, snapshot, ts, snapshotID),
+		ipStatsBatch(tables, snapshot, ts, snapshotID),
+		topSourceIPsBatch(tables, snapshot, ts, snapshotID),
+		portStatsBatch(tables, snapshot, ts, snapshotID),
+		topDestinationPortsBatch(tables, snapshot, ts, snapshotID),
+		protocolStatsBatch(tables, snapshot, ts, snapshotID),
+		tcpFlagStatsBatch(tables, snapshot, ts, snapshotID),
+		protocolsJSONBatch(tables, snapshot, ts, snapshotID),
+		tcpFlagsJSONBatch(tables, snapshot, ts, snapshotID),
+		talkerStatsBatch(tables, snapshot, ts, snapshotID),
+		topDestinationIPsBatch(tables, snapshot, ts, snapshotID),
+		topConversationsBatch(tables, snapshot, ts, snapshotID),
+		topFlowsBatch(tables, snapshot, ts, snapshotID),
+		topTransportPortsBatch(tables, snapshot, ts, snapshotID),
+		serviceStatsBatch(tables, snapshot, ts, snapshotID),
+		distributionBucketsBatch(tables, buckets, snapshot, ts, snapshotID),
+		etherTypeStatsBatch(tables, snapshot, ts, snapshotID),
+		macCastStatsBatch(tables, snapshot, ts, snapshotID),
+		topDestinationMACsBatch(tables, snapshot, ts, snapshotID),
+		classificationStatsBatch(tables, snapshot, ts, snapshotID),
+		packetTypeStatsBatch(tables, snapshot, ts, snapshotID),
+		applicationCrosstabBatch(tables, snapshot, ts, snapshotID),
+		nonStandardPortsBatch(tables, snapshot, ts, snapshotID),
+		packetSizeStatsBatch(tables, snapshot, ts, snapshotID),
+		packetSizeHistogramBatch(tables, snapshot, ts, snapshotID),
+		throughputStatsBatch(tables, snapshot, ts, snapshotID),
+		microburstsBatch(tables, snapshot, ts, snapshotID),
+		directionStatsBatch(tables, snapshot, ts, snapshotID),
+		directionTopTalkersBatch(tables, snapshot, ts, snapshotID),
+		directionBreakdownBatch(tables, snapshot, ts, snapshotID),
+		prefixUniqueCountsBatch(tables, snapshot, ts, snapshotID),
+		topPrefixesBatch(tables, snapshot, ts, snapshotID),
+		topCountriesBatch(tables, snapshot, ts, snapshotID),
+		topASNsBatch(tables, snapshot, ts, snapshotID),
+		ipLocationsBatch(tables, snapshot, ts, snapshotID),
+	}
+}
+
+// basicStatsBatch 基础统计数据
+func basicStatsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.basicStats,
+		"snapshot_id", "ts", "total_packets", "total_bytes", "window_start", "window_end", "window_size_seconds",
+	)
 
 	// 计算时间窗口大小（秒）
-	windowSize := uint16(snapshot.Basic.EndTime.Sub(snapshot.Basic.StartTime).Seconds())
+	windowSize := uint32(snapshot.Basic.EndTime.Sub(snapshot.Basic.StartTime).Seconds())
 
-	_, err := db.ExecContext(ctx, query,
+	batch.add(
 		snapshotID,
 		ts,
 		snapshot.Basic.TotalPackets,
@@ -258,41 +292,22 @@ func saveBasicStats(ctx context.Context, db *sql.DB, snapshot *models.Snapshot,
 		snapshot.Basic.EndTime,
 		windowSize,
 	)
-
-	if err == nil {
-		fmt.Printf("- 保存了 %d 个数据包、%d 字节的基础统计数据\n",
-			snapshot.Basic.TotalPackets,
-			snapshot.Basic.TotalBytes)
-	}
-
-	return err
+	return batch
 }
 
-// saveIPStats 插入IP统计数据
-func saveIPStats(ctx context.Context, db *sql.DB, snapshot *models.Snapshot, ts time.Time, snapshotID string) error {
-	// 1. 插入IP统计摘要
-	query1 := `
-		INSERT INTO network_ip_stats(
-			snapshot_id, ts, unique_source_count
-		) VALUES(?, ?, ?)
-	`
-
-	if _, err := db.ExecContext(ctx, query1,
-		snapshotID,
-		ts,
-		snapshot.IP.UniqueSourceCount,
-	); err != nil {
-		return err
-	}
+// ipStatsBatch IP统计摘要
+func ipStatsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.ipStats, "snapshot_id", "ts", "unique_source_count", "rank_by")
+	batch.add(snapshotID, ts, snapshot.IP.UniqueSourceCount, string(snapshot.IP.RankBy.OrDefault()))
+	return batch
+}
 
-	// 2. 插入热门源IP
-	query2 := `
-		INSERT INTO network_top_source_ips(
-			snapshot_id, ts, source_ip, pos_rank, packet_count
-		) VALUES(?, ?, ?, ?, ?)
-	`
+// topSourceIPsBatch 热门源IP
+func topSourceIPsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.topSourceIPs,
+		"snapshot_id", "ts", "source_ip", "pos_rank", "packet_count", "byte_count",
+	)
 
-	insertCount := 0
 	for i, pair := range snapshot.IP.TopPairs {
 		if pair.Count == 0 {
 			continue // 跳过空记录
@@ -304,378 +319,484 @@ func saveIPStats(ctx context.Context, db *sql.DB, snapshot *models.Snapshot, ts
 			sourceIP = "unknown"
 		}
 
-		if _, err := db.ExecContext(ctx, query2,
+		batch.add(
 			snapshotID,
 			ts,
 			sourceIP,
 			uint8(i+1), // 排名从1开始，转换为UINT8
 			pair.Count,
-		); err != nil {
-			return err
-		}
-
-		insertCount++
+			pair.Bytes,
+		)
 	}
-
-	fmt.Printf("- 保存了 %d 个唯一源IP和 %d 个热门源IP地址\n",
-		snapshot.IP.UniqueSourceCount,
-		insertCount)
-
-	return nil
+	return batch
 }
 
-// savePortStats 插入端口统计数据
-func savePortStats(ctx context.Context, db *sql.DB, snapshot *models.Snapshot, ts time.Time, snapshotID string) error {
-	// 1. 插入端口统计摘要
-	query1 := `
-		INSERT INTO network_port_stats(
-			snapshot_id, ts, unique_dest_count
-		) VALUES(?, ?, ?)
-	`
-
-	if _, err := db.ExecContext(ctx, query1,
-		snapshotID,
-		ts,
-		snapshot.Port.UniqueDestCount,
-	); err != nil {
-		return err
-	}
+// portStatsBatch 端口统计摘要
+func portStatsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.portStats, "snapshot_id", "ts", "unique_dest_count", "rank_by")
+	batch.add(snapshotID, ts, snapshot.Port.UniqueDestCount, string(snapshot.Port.RankBy.OrDefault()))
+	return batch
+}
 
-	// 2. 插入热门目标端口
-	query2 := `
-		INSERT INTO network_top_destination_ports(
-			snapshot_id, ts, port, service_name, pos_rank, packet_count
-		) VALUES(?, ?, ?, ?, ?, ?)
-	`
+// topDestinationPortsBatch 热门目标端口
+func topDestinationPortsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.topDestinationPorts,
+		"snapshot_id", "ts", "port", "service_name", "pos_rank", "packet_count", "byte_count",
+	)
 
-	insertCount := 0
 	for i, pair := range snapshot.Port.TopPairs {
 		if pair.Count == 0 {
 			continue // 跳过空记录
 		}
 
-		// 获取服务名称
-		serviceName := getServiceNameByPort(pair.DestinationPort)
-
-		if _, err := db.ExecContext(ctx, query2,
+		batch.add(
 			snapshotID,
 			ts,
 			pair.DestinationPort,
-			serviceName,
+			services.Default().Name("", pair.DestinationPort),
 			uint8(i+1), // 排名从1开始，转换为UINT8
 			pair.Count,
-		); err != nil {
-			return err
-		}
+			pair.Bytes,
+		)
+	}
+	return batch
+}
+
+// protocolStatsBatch 协议统计
+func protocolStatsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.protocolStats,
+		"snapshot_id", "ts", "protocol_name", "packet_count", "byte_count", "percentage",
+	)
 
-		insertCount++
+	for _, proto := range snapshot.Protocol.Protocols {
+		batch.add(snapshotID, ts, proto.Name, proto.Count, proto.Bytes, proto.Percentage)
 	}
+	return batch
+}
 
-	fmt.Printf("- 保存了 %d 个唯一目标端口和 %d 个热门目标端口\n",
-		snapshot.Port.UniqueDestCount,
-		insertCount)
+// tcpFlagStatsBatch TCP标志统计
+func tcpFlagStatsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.tcpFlagStats,
+		"snapshot_id", "ts", "flag", "flag_name", "packet_count", "byte_count", "percentage",
+	)
 
-	return nil
+	for _, flag := range snapshot.TCPFlags.Flags {
+		batch.add(snapshotID, ts, flag.Flag, getTCPFlagName(flag.Flag), flag.Count, flag.Bytes, flag.Percentage)
+	}
+	return batch
 }
 
-// saveProtocolStats 插入协议统计数据
-func saveProtocolStats(ctx context.Context, db *sql.DB, snapshot *models.Snapshot, ts time.Time, snapshotID string) error {
-	query := `
-		INSERT INTO network_protocol_stats(
-			snapshot_id, ts, protocol_name, packet_count, percentage
-		) VALUES(?, ?, ?, ?, ?)
-	`
+// protocolsJSONBatch 协议分布统计数据（扁平化列结构），列由默认协议分组确定
+func protocolsJSONBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	return foldProtocols(DefaultProtocolBuckets(), snapshot.Protocol.Protocols).
+		wideBatch(tables.protocolsJSON, snapshotID, ts)
+}
 
-	insertCount := 0
-	for _, proto := range snapshot.Protocol.Protocols {
-		if _, err := db.ExecContext(ctx, query,
-			snapshotID,
-			ts,
-			proto.Name,
-			proto.Count,
-			proto.Percentage,
-		); err != nil {
-			return err
+// tcpFlagsJSONBatch TCP标志分布统计数据（扁平化列结构），列由默认TCP标志分组确定
+func tcpFlagsJSONBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	return foldTCPFlags(DefaultTCPFlagBuckets(), snapshot.TCPFlags.Flags).
+		wideBatch(tables.tcpFlagsJSON, snapshotID, ts)
+}
+
+// distributionBucketsBatch 按配置的分组汇总的协议和TCP标志分布（长格式），每个分组一行
+func distributionBucketsBatch(tables snapshotTables, buckets DistributionBuckets, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.distributionBuckets,
+		"snapshot_id", "ts", "distribution", "bucket", "packet_count", "byte_count", "percentage",
+	)
+
+	buckets = buckets.orDefault()
+	for _, distribution := range []struct {
+		name string
+		fold *bucketFold
+	}{
+		{"protocol", foldProtocols(buckets.Protocols, snapshot.Protocol.Protocols)},
+		{"tcp_flags", foldTCPFlags(buckets.TCPFlags, snapshot.TCPFlags.Flags)},
+	} {
+		for _, count := range distribution.fold.counts {
+			// 没有未分组的数据包时不写other，配置的分组即使为0也写入，便于仪表盘固定图例
+			if count.name == otherBucket && count.traffic.Packets == 0 {
+				continue
+			}
+			batch.add(snapshotID, ts, distribution.name, count.name,
+				count.traffic.Packets, count.traffic.Bytes, distribution.fold.percentage(count.traffic.Packets))
 		}
+	}
+	return batch
+}
+
+// serviceStatsBatch 服务分布，每个服务一行
+func serviceStatsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.serviceStats,
+		"snapshot_id", "ts", "service_name", "packet_count", "byte_count", "percentage",
+	)
 
-		insertCount++
+	for _, service := range snapshot.Service.Services {
+		batch.add(snapshotID, ts, service.Name, service.Count, service.Bytes, service.Percentage)
 	}
+	return batch
+}
 
-	fmt.Printf("- 保存了 %d 个协议统计记录\n", insertCount)
+// talkerStatsBatch 目标IP数量以及目标IP、会话和五元组流排行的排序依据
+func talkerStatsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.talkerStats,
+		"snapshot_id", "ts", "unique_dest_ip_count", "destination_rank_by", "conversation_rank_by", "flow_rank_by",
+	)
+	batch.add(
+		snapshotID,
+		ts,
+		snapshot.Destination.UniqueDestCount,
+		string(snapshot.Destination.RankBy.OrDefault()),
+		string(snapshot.Conversation.RankBy.OrDefault()),
+		string(snapshot.Flow.RankBy.OrDefault()),
+	)
+	return batch
+}
 
-	return nil
+// topDestinationIPsBatch 热门目标IP
+func topDestinationIPsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.topDestinationIPs,
+		"snapshot_id", "ts", "pos_rank", "destination_ip", "packet_count", "byte_count", "first_seen", "last_seen",
+	)
+
+	for i, dest := range snapshot.Destination.TopDestinations {
+		batch.add(snapshotID, ts, uint8(i+1), dest.DestinationIP,
+			dest.Count, dest.Bytes, dest.FirstSeen, dest.LastSeen)
+	}
+	return batch
 }
 
-// saveTCPFlagsStats 插入TCP标志统计数据
-func saveTCPFlagsStats(ctx context.Context, db *sql.DB, snapshot *models.Snapshot, ts time.Time, snapshotID string) error {
-	query := `
-		INSERT INTO network_tcp_flag_stats(
-			snapshot_id, ts, flag, flag_name, packet_count
-		) VALUES(?, ?, ?, ?, ?)
-	`
+// topConversationsBatch 流量最大的会话
+func topConversationsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.topConversations,
+		"snapshot_id", "ts", "pos_rank", "source_ip", "destination_ip", "packet_count", "byte_count", "first_seen", "last_seen",
+	)
 
-	insertCount := 0
-	for _, flag := range snapshot.TCPFlags.Flags {
-		// 获取标志名称
-		flagName := getTCPFlagName(flag.Flag)
+	for i, conv := range snapshot.Conversation.TopConversations {
+		batch.add(snapshotID, ts, uint8(i+1), conv.SourceIP, conv.DestinationIP,
+			conv.Count, conv.Bytes, conv.FirstSeen, conv.LastSeen)
+	}
+	return batch
+}
 
-		if _, err := db.ExecContext(ctx, query,
-			snapshotID,
-			ts,
-			flag.Flag,
-			flagName,
-			flag.Count,
-		); err != nil {
-			return err
-		}
+// topFlowsBatch 流量最大的五元组流
+func topFlowsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.topFlows,
+		"snapshot_id", "ts", "pos_rank", "source_ip", "destination_ip", "source_port", "destination_port", "protocol",
+		"packet_count", "byte_count", "first_seen", "last_seen",
+	)
 
-		insertCount++
+	for i, flow := range snapshot.Flow.TopFlows {
+		batch.add(snapshotID, ts, uint8(i+1), flow.SourceIP, flow.DestinationIP, flow.SourcePort, flow.DestinationPort, flow.Protocol,
+			flow.Count, flow.Bytes, flow.FirstSeen, flow.LastSeen)
 	}
+	return batch
+}
 
-	fmt.Printf("- 保存了 %d 个TCP标志统计记录\n", insertCount)
+// topTransportPortsBatch 按传输层协议区分的目标端口、源端口和服务端口排行，排名在每个角色和协议内从1开始
+func topTransportPortsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.topTransportPorts,
+		"snapshot_id", "ts", "port_role", "transport", "pos_rank", "port", "service_name", "packet_count", "byte_count",
+	)
 
-	return nil
+	ranks := make(map[string]int)
+	for _, port := range snapshot.TransportPort.Ports {
+		group := string(port.Role) + "/" + port.Transport
+		ranks[group]++
+		batch.add(snapshotID, ts, string(port.Role), port.Transport, uint8(ranks[group]), port.Port, port.Service,
+			port.Count, port.Bytes)
+	}
+	return batch
 }
 
-// saveProtocolsJSON 保存协议分布统计数据（扁平化列结构）
-func saveProtocolsJSON(ctx context.Context, db *sql.DB, snapshot *models.Snapshot, ts time.Time, snapshotID string) error {
-	// 计算总数据包数和各协议数量
-	var totalCount, tcpCount, udpCount, icmpCount, otherCount uint64
+// etherTypeStatsBatch EtherType分布，每个EtherType一行
+func etherTypeStatsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.etherTypeStats,
+		"snapshot_id", "ts", "ether_type", "ether_type_name", "packet_count", "byte_count", "percentage",
+	)
 
-	for _, proto := range snapshot.Protocol.Protocols {
-		totalCount += proto.Count
-
-		switch proto.Name {
-		case "TCP":
-			tcpCount = proto.Count
-		case "UDP":
-			udpCount = proto.Count
-		case "ICMP":
-			icmpCount = proto.Count
-		default:
-			otherCount += proto.Count
-		}
+	for _, etherType := range snapshot.L2.EtherTypes {
+		batch.add(snapshotID, ts, etherType.EtherType, etherType.Name, etherType.Count, etherType.Bytes, etherType.Percentage)
 	}
+	return batch
+}
 
-	// 构建并执行插入语句
-	query := `
-		INSERT INTO network_protocols_json(
-			snapshot_id, ts, total_packet_count, tcp_count, udp_count, icmp_count, other_count
-		) VALUES(?, ?, ?, ?, ?, ?, ?)
-	`
+// macCastStatsBatch 目标MAC地址的广播、组播和单播分布
+func macCastStatsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.macCastStats,
+		"snapshot_id", "ts", "mac_cast", "packet_count", "byte_count", "percentage",
+	)
 
-	_, err := db.ExecContext(ctx, query,
-		snapshotID,
-		ts,
-		totalCount,
-		tcpCount,
-		udpCount,
-		icmpCount,
-		otherCount,
+	for _, cast := range snapshot.L2.Casts {
+		batch.add(snapshotID, ts, string(cast.Cast), cast.Count, cast.Bytes, cast.Percentage)
+	}
+	return batch
+}
+
+// topDestinationMACsBatch 热门目标MAC地址，每行带上排行的排序依据
+func topDestinationMACsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.topDestinationMACs,
+		"snapshot_id", "ts", "pos_rank", "destination_mac", "mac_cast", "packet_count", "byte_count", "rank_by",
 	)
 
-	if err != nil {
-		return fmt.Errorf("保存协议分布数据失败: %w", err)
+	rankBy := string(snapshot.L2.RankBy.OrDefault())
+	for i, mac := range snapshot.L2.TopDestinations {
+		batch.add(snapshotID, ts, uint8(i+1), mac.Address, string(mac.Cast), mac.Count, mac.Bytes, rankBy)
 	}
+	return batch
+}
 
-	fmt.Println("- 保存了协议分布数据用于饼图展示")
-	return nil
+// classificationStatsBatch 未识别应用和非标准端口应用的总量
+func classificationStatsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.classificationStats,
+		"snapshot_id", "ts", "unknown_count", "unknown_bytes", "unknown_percentage",
+		"non_standard_count", "non_standard_bytes", "non_standard_percentage",
+	)
+
+	stats := snapshot.Classification
+	batch.add(snapshotID, ts, stats.UnknownCount, stats.UnknownBytes, stats.UnknownPercentage,
+		stats.NonStandardCount, stats.NonStandardBytes, stats.NonStandardPercentage)
+	return batch
 }
 
-// saveTCPFlagsJSON 保存TCP标志分布统计数据（扁平化列结构）
-func saveTCPFlagsJSON(ctx context.Context, db *sql.DB, snapshot *models.Snapshot, ts time.Time, snapshotID string) error {
-	// 计算总数据包数和各TCP标志数量
-	var totalCount, ackCount, synCount, finAckCount, pshAckCount, noneCount, otherCount uint64
+// packetTypeStatsBatch 数据包类型分布，每个类型一行
+func packetTypeStatsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.packetTypeStats,
+		"snapshot_id", "ts", "packet_type", "packet_count", "byte_count", "percentage",
+	)
 
-	for _, flag := range snapshot.TCPFlags.Flags {
-		totalCount += flag.Count
-
-		switch flag.Flag {
-		case "16": // ACK
-			ackCount = flag.Count
-		case "2": // SYN
-			synCount = flag.Count
-		case "17": // FIN+ACK
-			finAckCount = flag.Count
-		case "24": // PSH+ACK
-			pshAckCount = flag.Count
-		case "0": // None
-			noneCount = flag.Count
-		default:
-			otherCount += flag.Count
+	for _, packetType := range snapshot.Classification.PacketTypes {
+		batch.add(snapshotID, ts, packetType.Name, packetType.Count, packetType.Bytes, packetType.Percentage)
+	}
+	return batch
+}
+
+// applicationCrosstabBatch 应用按协议和目标端口的交叉统计（长格式），dimension为 protocol 或 destination_port
+func applicationCrosstabBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.applicationCrosstab,
+		"snapshot_id", "ts", "application", "dimension", "dimension_value", "packet_count", "byte_count", "percentage",
+	)
+
+	for _, dimension := range []struct {
+		name   string
+		counts []models.AppDimensionCount
+	}{
+		{"protocol", snapshot.Classification.AppProtocols},
+		{"destination_port", snapshot.Classification.AppPorts},
+	} {
+		for _, count := range dimension.counts {
+			batch.add(snapshotID, ts, count.Application, dimension.name, count.Value, count.Count, count.Bytes, count.Percentage)
 		}
 	}
+	return batch
+}
 
-	// 构建并执行插入语句
-	query := `
-		INSERT INTO network_tcp_flags_json(
-			snapshot_id, ts, total_packet_count, ack_count, syn_count, fin_ack_count, psh_ack_count, none_count, other_count
-		) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`
+// nonStandardPortsBatch 运行在非标准端口上的应用排行
+func nonStandardPortsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.nonStandardPorts,
+		"snapshot_id", "ts", "pos_rank", "application", "transport", "port", "service_name", "packet_count", "byte_count",
+	)
 
-	_, err := db.ExecContext(ctx, query,
-		snapshotID,
-		ts,
-		totalCount,
-		ackCount,
-		synCount,
-		finAckCount,
-		pshAckCount,
-		noneCount,
-		otherCount,
+	for i, port := range snapshot.Classification.NonStandard {
+		batch.add(snapshotID, ts, uint8(i+1), port.Application, port.Transport, port.Port, port.Service, port.Count, port.Bytes)
+	}
+	return batch
+}
+
+// packetSizeStatsBatch 数据包大小的最小/最大/平均值和百分位数，所有数据包(all)和每个协议各一行
+func packetSizeStatsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.packetSizeStats,
+		"snapshot_id", "ts", "protocol", "packet_count", "byte_count",
+		"min_size", "max_size", "mean_size", "p50_size", "p90_size", "p99_size",
 	)
 
-	if err != nil {
-		return fmt.Errorf("保存TCP标志分布数据失败: %w", err)
+	for _, h := range snapshot.PacketSize.Histograms() {
+		batch.add(snapshotID, ts, h.Protocol, h.Count, h.Bytes, h.Min, h.Max, h.Mean, h.P50, h.P90, h.P99)
 	}
+	return batch
+}
 
-	fmt.Println("- 保存了TCP标志分布数据用于饼图展示")
-	return nil
+// packetSizeHistogramBatch 数据包大小直方图（长格式），每个协议的每个区间一行，upper_bound为0表示没有上界
+func packetSizeHistogramBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.packetSizeHistogram,
+		"snapshot_id", "ts", "protocol", "bucket", "lower_bound", "upper_bound", "packet_count", "byte_count", "percentage",
+	)
+
+	for _, h := range snapshot.PacketSize.Histograms() {
+		for _, bucket := range h.Buckets {
+			batch.add(snapshotID, ts, h.Protocol, bucket.Bucket, bucket.Lower, bucket.Upper, bucket.Count, bucket.Bytes, bucket.Percentage)
+		}
+	}
+	return batch
 }
 
-// 新增: saveServicesJSON 保存服务名称分布统计数据（扁平化列结构）
-func saveServicesJSON(ctx context.Context, db *sql.DB, snapshot *models.Snapshot, ts time.Time, snapshotID string) error {
-	// 初始化计数器
-	var (
-		totalCount   uint64
-		httpCount    uint64
-		httpsCount   uint64
-		sshCount     uint64
-		dnsCount     uint64
-		smtpCount    uint64
-		ftpCount     uint64
-		mysqlCount   uint64
-		ntpCount     uint64
-		telnetCount  uint64
-		rdpCount     uint64
-		unknownCount uint64
-		otherCount   uint64
-	)
-
-	// 遍历所有热门端口记录，按服务名计数
-	for _, pair := range snapshot.Port.TopPairs {
-		if pair.Count == 0 {
-			continue
+// throughputStatsBatch 平均速率、峰值速率和微突发总量；没有采集时速率和微突发相关的列为NULL
+func throughputStatsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.throughputStats,
+		"snapshot_id", "ts", "window_seconds", "packets_per_second", "bits_per_second",
+		"bucket_ms", "burst_factor", "peak_pps", "peak_bps", "peak_at",
+		"burst_count", "burst_packets", "burst_bytes", "burst_percentage",
+		"packet_count", "byte_count",
+	)
+
+	stats := snapshot.Throughput
+	if stats.BucketMillis == 0 {
+		batch.add(snapshotID, ts, snapshot.Basic.WindowSeconds(), nil, nil,
+			nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+		return batch
+	}
+
+	var peakAt any
+	if !stats.PeakAt.IsZero() {
+		peakAt = stats.PeakAt
+	}
+	batch.add(snapshotID, ts, stats.Seconds, stats.PacketsPerSecond(), stats.BitsPerSecond(),
+		uint32(stats.BucketMillis), stats.BurstFactor, stats.PeakPPS, stats.PeakBPS, peakAt,
+		uint32(stats.BurstCount), stats.BurstPackets, stats.BurstBytes, stats.BurstPercentage,
+		stats.Packets, stats.Bytes)
+	return batch
+}
+
+// microburstsBatch 数据包速率最高的微突发
+func microburstsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.microbursts,
+		"snapshot_id", "ts", "pos_rank", "burst_start", "packet_count", "byte_count", "packets_per_second", "bits_per_second",
+	)
+
+	for i, burst := range snapshot.Throughput.Bursts {
+		batch.add(snapshotID, ts, uint8(i+1), burst.Start, burst.Packets, burst.Bytes, burst.PPS, burst.BPS)
+	}
+	return batch
+}
+
+// directionStatsBatch 各流量方向的总量，每个方向一行
+func directionStatsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.directionStats,
+		"snapshot_id", "ts", "direction", "packet_count", "byte_count", "percentage",
+	)
+
+	for _, d := range snapshot.Direction.Directions {
+		batch.add(snapshotID, ts, string(d.Direction), d.Count, d.Bytes, d.Percentage)
+	}
+	return batch
+}
+
+// directionTopTalkersBatch 每个流量方向的热门源地址和目标地址，排名在方向和角色内从1开始
+func directionTopTalkersBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.directionTopTalkers,
+		"snapshot_id", "ts", "direction", "role", "pos_rank", "address", "packet_count", "byte_count", "rank_by",
+	)
+
+	rankBy := string(snapshot.Direction.RankBy.OrDefault())
+	ranks := make(map[string]int)
+	for _, talker := range snapshot.Direction.TopTalkers {
+		key := string(talker.Direction) + "/" + string(talker.Role)
+		ranks[key]++
+		batch.add(snapshotID, ts, string(talker.Direction), string(talker.Role), uint8(ranks[key]), talker.Address,
+			talker.Count, talker.Bytes, rankBy)
+	}
+	return batch
+}
+
+// directionBreakdownBatch 每个流量方向的协议分布和目标端口排行（长格式），dimension为 protocol 或 destination_port
+func directionBreakdownBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.directionBreakdown,
+		"snapshot_id", "ts", "direction", "dimension", "dimension_value", "packet_count", "byte_count", "percentage",
+	)
+
+	for _, dimension := range []struct {
+		name   string
+		counts []models.DirectionDimensionCount
+	}{
+		{"protocol", snapshot.Direction.Protocols},
+		{"destination_port", snapshot.Direction.Ports},
+	} {
+		for _, count := range dimension.counts {
+			batch.add(snapshotID, ts, string(count.Direction), dimension.name, count.Value, count.Count, count.Bytes, count.Percentage)
 		}
+	}
+	return batch
+}
 
-		totalCount += pair.Count
-
-		// 根据端口号分类到相应的服务计数器
-		switch pair.DestinationPort {
-		case 80: // HTTP
-			httpCount += pair.Count
-		case 8080: // HTTP Alternate
-			httpCount += pair.Count
-		case 443, 8443: // HTTPS
-			httpsCount += pair.Count
-		case 22: // SSH
-			sshCount += pair.Count
-		case 53: // DNS
-			dnsCount += pair.Count
-		case 25: // SMTP
-			smtpCount += pair.Count
-		case 21: // FTP
-			ftpCount += pair.Count
-		case 3306: // MySQL
-			mysqlCount += pair.Count
-		case 123: // NTP
-			ntpCount += pair.Count
-		case 23: // Telnet
-			telnetCount += pair.Count
-		case 3389: // RDP
-			rdpCount += pair.Count
-		default:
-			// 检查是否是高端口（可能是未知服务）
-			if pair.DestinationPort >= 49152 {
-				unknownCount += pair.Count
-			} else {
-				otherCount += pair.Count
-			}
+// prefixUniqueCountsBatch 每个角色、地址族和前缀长度的唯一前缀数量
+func prefixUniqueCountsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.prefixUniqueCounts,
+		"snapshot_id", "ts", "role", "family", "prefix_length", "unique_count",
+	)
+
+	for _, u := range snapshot.Prefix.Unique {
+		batch.add(snapshotID, ts, string(u.Role), u.Family, uint8(u.Length), uint32(u.Count))
+	}
+	return batch
+}
+
+// topPrefixesBatch 热门源前缀和目标前缀，排名在角色、地址族和前缀长度内从1开始
+func topPrefixesBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.topPrefixes,
+		"snapshot_id", "ts", "role", "family", "prefix_length", "pos_rank", "prefix", "packet_count", "byte_count", "rank_by",
+	)
+
+	rankBy := string(snapshot.Prefix.RankBy.OrDefault())
+	for _, role := range []struct {
+		role     models.TalkerRole
+		prefixes []models.PrefixCount
+	}{
+		{models.TalkerSource, snapshot.Prefix.TopSources},
+		{models.TalkerDestination, snapshot.Prefix.TopDestinations},
+	} {
+		ranks := make(map[string]int)
+		for _, p := range role.prefixes {
+			key := p.Family + "/" + strconv.Itoa(p.Length)
+			ranks[key]++
+			batch.add(snapshotID, ts, string(role.role), p.Family, uint8(p.Length), uint8(ranks[key]), p.Prefix,
+				p.Count, p.Bytes, rankBy)
 		}
 	}
+	return batch
+}
 
-	// 构建并执行插入语句
-	query := `
-		INSERT INTO network_services_json(
-			snapshot_id, ts, total_packet_count, 
-			http_count, https_count, ssh_count, dns_count, smtp_count,
-			ftp_count, mysql_count, ntp_count, telnet_count, rdp_count,
-			unknown_count, other_count
-		) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`
+// topCountriesBatch 流量最大的源国家和目标国家，排名在角色内从1开始
+func topCountriesBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.topCountries,
+		"snapshot_id", "ts", "role", "pos_rank", "country_code", "country", "packet_count", "byte_count", "percentage", "rank_by",
+	)
 
-	_, err := db.ExecContext(ctx, query,
-		snapshotID,
-		ts,
-		totalCount,
-		httpCount,
-		httpsCount,
-		sshCount,
-		dnsCount,
-		smtpCount,
-		ftpCount,
-		mysqlCount,
-		ntpCount,
-		telnetCount,
-		rdpCount,
-		unknownCount,
-		otherCount,
-	)
-
-	if err != nil {
-		return fmt.Errorf("保存服务名称分布数据失败: %w", err)
-	}
-
-	fmt.Println("- 保存了服务名称分布数据用于饼图展示")
-	return nil
+	rankBy := string(snapshot.Geo.RankBy.OrDefault())
+	ranks := make(map[models.TalkerRole]int)
+	for _, country := range snapshot.Geo.TopCountries {
+		ranks[country.Role]++
+		batch.add(snapshotID, ts, string(country.Role), uint8(ranks[country.Role]), country.CountryCode, country.Country,
+			country.Count, country.Bytes, country.Percentage, rankBy)
+	}
+	return batch
+}
+
+// topASNsBatch 流量最大的源自治系统和目标自治系统，排名在角色内从1开始
+func topASNsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.topASNs,
+		"snapshot_id", "ts", "role", "pos_rank", "asn", "organization", "packet_count", "byte_count", "percentage", "rank_by",
+	)
+
+	rankBy := string(snapshot.Geo.RankBy.OrDefault())
+	ranks := make(map[models.TalkerRole]int)
+	for _, asn := range snapshot.Geo.TopASNs {
+		ranks[asn.Role]++
+		batch.add(snapshotID, ts, string(asn.Role), uint8(ranks[asn.Role]), asn.ASN, asn.Organization,
+			asn.Count, asn.Bytes, asn.Percentage, rankBy)
+	}
+	return batch
 }
 
-// getServiceNameByPort 根据端口号获取服务名称
-func getServiceNameByPort(port uint16) string {
-	portServiceMap := map[uint16]string{
-		20:    "FTP-data",
-		21:    "FTP",
-		22:    "SSH",
-		23:    "Telnet",
-		25:    "SMTP",
-		53:    "DNS",
-		67:    "DHCP-Server",
-		68:    "DHCP-Client",
-		80:    "HTTP",
-		110:   "POP3",
-		119:   "NNTP",
-		123:   "NTP",
-		143:   "IMAP",
-		161:   "SNMP",
-		162:   "SNMP-Trap",
-		389:   "LDAP",
-		443:   "HTTPS",
-		445:   "SMB",
-		465:   "SMTPS",
-		636:   "LDAPS",
-		993:   "IMAPS",
-		995:   "POP3S",
-		1433:  "MSSQL",
-		3306:  "MySQL",
-		3389:  "RDP",
-		5353:  "mDNS",
-		5432:  "PostgreSQL",
-		8080:  "HTTP-Alt",
-		8443:  "HTTPS-Alt",
-		27017: "MongoDB",
-	}
-
-	if service, exists := portServiceMap[port]; exists {
-		return service
-	}
-
-	if port < 1024 {
-		return "系统端口"
-	} else if port >= 1024 && port <= 49151 {
-		return "注册端口"
-	} else {
-		return "动态端口"
+// ipLocationsBatch 各排行中地址的国家、城市和自治系统，每个地址一行
+func ipLocationsBatch(tables snapshotTables, snapshot *models.Snapshot, ts time.Time, snapshotID string) *tableBatch {
+	batch := newTableBatch(tables.ipLocations,
+		"snapshot_id", "ts", "address", "country_code", "country", "city", "asn", "organization",
+	)
+
+	for _, location := range snapshot.Geo.Locations {
+		batch.add(snapshotID, ts, location.Address, location.CountryCode, location.Country, location.City,
+			location.ASN, location.Organization)
 	}
+	return batch
 }
 
 // getTCPFlagName 根据TCP标志值获取可读名称
@@ -2,7 +2,6 @@ package db
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"strconv"
 
@@ -10,26 +9,11 @@ import (
 )
 
 // FillTCPFlagsStats 填充TCP标志统计到snapshot中
-func FillTCPFlagsStats(ctx context.Context, db *sql.DB, tableName string, snapshot *models.Snapshot) error {
+func FillTCPFlagsStats(ctx context.Context, src *SourceDB, table Identifier, snapshot *models.Snapshot) error {
 	// 使用WITH语句计算TCP标志分布和百分比
-	query := fmt.Sprintf(`
-		WITH total_packets AS (
-			-- 计算总的数据包数量
-			SELECT COUNT(*) AS total_count
-			FROM %s
-			WHERE ts >= NOW() - INTERVAL 1 MINUTE
-		)
-		SELECT 
-			tcp_flags AS name, 
-			COUNT(*) AS count, 
-			(COUNT(*) * 100.0 / (SELECT total_count FROM total_packets)) AS percentage
-		FROM %s
-		WHERE ts >= NOW() - INTERVAL 1 MINUTE
-		GROUP BY tcp_flags
-		ORDER BY count DESC;
-	`, tableName, tableName)
-
-	rows, err := db.QueryContext(ctx, query)
+	query := distributionQuery(src.Dialect(), table, "tcp_flags", windowCondition).String()
+
+	rows, err := src.QueryContext(ctx, query, distributionArgs(snapshot)...)
 	if err != nil {
 		return fmt.Errorf("获取TCP标志统计失败: %w", err)
 	}
@@ -41,10 +25,10 @@ func FillTCPFlagsStats(ctx context.Context, db *sql.DB, tableName string, snapsh
 	// 扫描TCP标志数据
 	for rows.Next() {
 		var flagValue int
-		var count uint64
+		var count, bytes uint64
 		var percentage float64
 
-		if err := rows.Scan(&flagValue, &count, &percentage); err != nil {
+		if err := rows.Scan(&flagValue, &count, &bytes, &percentage); err != nil {
 			return fmt.Errorf("扫描TCP标志数据失败: %w", err)
 		}
 
@@ -53,8 +37,10 @@ func FillTCPFlagsStats(ctx context.Context, db *sql.DB, tableName string, snapsh
 
 		// 添加到结果集
 		tcpFlags = append(tcpFlags, models.TCPFlagCount{
-			Flag:  flagName,
-			Count: count,
+			Flag:       flagName,
+			Count:      count,
+			Bytes:      bytes,
+			Percentage: percentage,
 		})
 	}
 
@@ -130,50 +116,46 @@ func GetCommonTCPFlagCombinations() map[uint8]string {
 }
 
 // AnalyzeTCPFlagPatterns 分析TCP标志模式，检查连接建立和异常
-func AnalyzeTCPFlagPatterns(ctx context.Context, db *sql.DB, tableName string) (map[string]int, error) {
+func AnalyzeTCPFlagPatterns(ctx context.Context, src *SourceDB, table Identifier) (map[string]int, error) {
 	// 查询SYN次数
-	synQuery := fmt.Sprintf(`
-		SELECT COUNT(*) FROM %s 
-		WHERE ts >= NOW() - INTERVAL 1 MINUTE 
-		AND tcp_flags & 0x02 > 0
-	`, tableName)
+	synQuery := src.Select("COUNT(*)").From(table).
+		Where(recentWindowCondition(src.Dialect())).
+		Where("tcp_flags & 0x02 > 0").
+		String()
 
 	// 查询SYN+ACK次数
-	synAckQuery := fmt.Sprintf(`
-		SELECT COUNT(*) FROM %s 
-		WHERE ts >= NOW() - INTERVAL 1 MINUTE 
-		AND tcp_flags & 0x12 = 0x12
-	`, tableName)
+	synAckQuery := src.Select("COUNT(*)").From(table).
+		Where(recentWindowCondition(src.Dialect())).
+		Where("tcp_flags & 0x12 = 0x12").
+		String()
 
 	// 查询RST次数
-	rstQuery := fmt.Sprintf(`
-		SELECT COUNT(*) FROM %s 
-		WHERE ts >= NOW() - INTERVAL 1 MINUTE 
-		AND tcp_flags & 0x04 > 0
-	`, tableName)
+	rstQuery := src.Select("COUNT(*)").From(table).
+		Where(recentWindowCondition(src.Dialect())).
+		Where("tcp_flags & 0x04 > 0").
+		String()
 
 	// 查询FIN次数
-	finQuery := fmt.Sprintf(`
-		SELECT COUNT(*) FROM %s 
-		WHERE ts >= NOW() - INTERVAL 1 MINUTE 
-		AND tcp_flags & 0x01 > 0
-	`, tableName)
+	finQuery := src.Select("COUNT(*)").From(table).
+		Where(recentWindowCondition(src.Dialect())).
+		Where("tcp_flags & 0x01 > 0").
+		String()
 
 	var synCount, synAckCount, rstCount, finCount int
 
-	if err := db.QueryRowContext(ctx, synQuery).Scan(&synCount); err != nil {
+	if err := src.QueryRowContext(ctx, synQuery).Scan(&synCount); err != nil {
 		return nil, fmt.Errorf("查询SYN标志失败: %w", err)
 	}
 
-	if err := db.QueryRowContext(ctx, synAckQuery).Scan(&synAckCount); err != nil {
+	if err := src.QueryRowContext(ctx, synAckQuery).Scan(&synAckCount); err != nil {
 		return nil, fmt.Errorf("查询SYN+ACK标志失败: %w", err)
 	}
 
-	if err := db.QueryRowContext(ctx, rstQuery).Scan(&rstCount); err != nil {
+	if err := src.QueryRowContext(ctx, rstQuery).Scan(&rstCount); err != nil {
 		return nil, fmt.Errorf("查询RST标志失败: %w", err)
 	}
 
-	if err := db.QueryRowContext(ctx, finQuery).Scan(&finCount); err != nil {
+	if err := src.QueryRowContext(ctx, finQuery).Scan(&finCount); err != nil {
 		return nil, fmt.Errorf("查询FIN标志失败: %w", err)
 	}
 
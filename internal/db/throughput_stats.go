@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"SnapFlow/internal/models"
+)
+
+// FillThroughputStats 填充平均速率、峰值速率和微突发统计到snapshot中
+//
+// 按bucket大小的亚秒级时间桶分组扫描一次窗口，每个时间桶的速率为桶内流量除以桶的长度，
+// 平均速率为所有时间桶的流量之和除以窗口长度。
+// 数据包速率超过有流量时间桶平均速率factor倍的时间桶计为微突发。
+func FillThroughputStats(ctx context.Context, src *SourceDB, table Identifier, snapshot *models.Snapshot, bucket time.Duration, factor float64) error {
+	query := src.Select(src.Dialect().TimeSlot("ts", bucket)+" AS slot", "COUNT(*) AS count", byteSum(src.Dialect())).
+		From(table).
+		Where(windowCondition).
+		GroupBy("slot").
+		String()
+
+	rows, err := src.QueryContext(ctx, query, windowArgs(snapshot)...)
+	if err != nil {
+		return fmt.Errorf("获取吞吐速率统计失败: %w", err)
+	}
+	defer rows.Close()
+
+	counter := models.NewThroughputCounter(bucket, factor)
+	for rows.Next() {
+		// 时间桶编号在部分数据库中是浮点数或定点数
+		var slot float64
+		var traffic models.Traffic
+
+		if err := rows.Scan(&slot, &traffic.Packets, &traffic.Bytes); err != nil {
+			return fmt.Errorf("扫描吞吐速率数据失败: %w", err)
+		}
+
+		counter.Add(time.UnixMilli(int64(math.Round(slot))*bucket.Milliseconds()), traffic)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("扫描吞吐速率数据时发生错误: %w", err)
+	}
+
+	counter.Apply(snapshot)
+
+	// 打印获取的信息
+	stats := snapshot.Throughput
+	fmt.Printf("\n获取到的吞吐速率统计信息:\n")
+	fmt.Printf("- 平均速率: %.2f pps, %.2f bps (窗口 %.0f 秒)\n",
+		stats.PacketsPerSecond(), stats.BitsPerSecond(), stats.Seconds)
+	fmt.Printf("- 峰值速率 (%d 毫秒时间桶): %.2f pps, %.2f bps", stats.BucketMillis, stats.PeakPPS, stats.PeakBPS)
+	if !stats.PeakAt.IsZero() {
+		fmt.Printf("，出现在 %s", stats.PeakAt.Format("2006-01-02 15:04:05.000"))
+	}
+	fmt.Printf("\n- 微突发 (超过有流量时间桶平均速率 %.1f 倍): %d 个时间桶, %d 个数据包, %d 字节 (%.2f%%)\n",
+		stats.BurstFactor, stats.BurstCount, stats.BurstPackets, stats.BurstBytes, stats.BurstPercentage)
+	for i, burst := range stats.Bursts {
+		fmt.Printf("  %d. %s: %d 个数据包, %d 字节 (%.2f pps, %.2f bps)\n",
+			i+1, burst.Start.Format("15:04:05.000"), burst.Packets, burst.Bytes, burst.PPS, burst.BPS)
+	}
+
+	return nil
+}
@@ -0,0 +1,855 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Tier 快照的存储层级：原始快照，以及按固定时长汇总的1分钟、1小时、1天层级
+type Tier struct {
+	Name     string        // 层级名称，汇总层级的表名以 _<Name> 结尾
+	Duration time.Duration // 每个汇总快照覆盖的时长，原始层级为0
+	MaxSpan  time.Duration // 查询范围不超过该值时使用这个层级，0表示不限
+}
+
+// 所有存储层级，按粒度从细到粗排列
+var (
+	TierRaw = Tier{Name: "raw", MaxSpan: 6 * time.Hour}
+	Tier1m  = Tier{Name: "1m", Duration: time.Minute, MaxSpan: 7 * 24 * time.Hour}
+	Tier1h  = Tier{Name: "1h", Duration: time.Hour, MaxSpan: 90 * 24 * time.Hour}
+	Tier1d  = Tier{Name: "1d", Duration: 24 * time.Hour}
+)
+
+// Tiers 返回所有存储层级，按粒度从细到粗排列
+func Tiers() []Tier {
+	return []Tier{TierRaw, Tier1m, Tier1h, Tier1d}
+}
+
+// RollupTiers 返回需要汇总任务生成的层级，按粒度从细到粗排列
+func RollupTiers() []Tier {
+	return []Tier{Tier1m, Tier1h, Tier1d}
+}
+
+// ParseTier 根据名称查找存储层级
+func ParseTier(name string) (Tier, error) {
+	for _, tier := range Tiers() {
+		if tier.Name == name {
+			return tier, nil
+		}
+	}
+	return Tier{}, fmt.Errorf("未知的存储层级 %q（可选 raw、1m、1h、1d）", name)
+}
+
+// IsRaw 判断是否为原始快照层级
+func (t Tier) IsRaw() bool {
+	return t.Duration == 0
+}
+
+// Source 返回汇总时读取的上一级层级：1m读取原始快照，1h读取1m，1d读取1h
+func (t Tier) Source() Tier {
+	tiers := Tiers()
+	for i := 1; i < len(tiers); i++ {
+		if tiers[i].Name == t.Name {
+			return tiers[i-1]
+		}
+	}
+	return TierRaw
+}
+
+// SelectTier 根据查询范围选择最合适的层级：范围越大使用越粗的层级
+func SelectTier(from, to time.Time) Tier {
+	span := to.Sub(from)
+	for _, tier := range Tiers() {
+		if tier.MaxSpan == 0 || span <= tier.MaxSpan {
+			return tier
+		}
+	}
+	return Tier1d
+}
+
+// snapshotTables 一个层级中保存快照的各张表
+type snapshotTables struct {
+	basicStats          Identifier
+	ipStats             Identifier
+	topSourceIPs        Identifier
+	portStats           Identifier
+	topDestinationPorts Identifier
+	protocolStats       Identifier
+	tcpFlagStats        Identifier
+	tcpFlagsJSON        Identifier
+	protocolsJSON       Identifier
+	servicesJSON        Identifier
+	commits             Identifier
+	talkerStats         Identifier
+	topDestinationIPs   Identifier
+	topConversations    Identifier
+	topFlows            Identifier
+	topTransportPorts   Identifier
+	serviceStats        Identifier
+	distributionBuckets Identifier
+	etherTypeStats      Identifier
+	macCastStats        Identifier
+	topDestinationMACs  Identifier
+	classificationStats Identifier
+	packetTypeStats     Identifier
+	applicationCrosstab Identifier
+	nonStandardPorts    Identifier
+	packetSizeStats     Identifier
+	packetSizeHistogram Identifier
+	throughputStats     Identifier
+	microbursts         Identifier
+	directionStats      Identifier
+	directionTopTalkers Identifier
+	directionBreakdown  Identifier
+	prefixUniqueCounts  Identifier
+	topPrefixes         Identifier
+	topCountries        Identifier
+	topASNs             Identifier
+	ipLocations         Identifier
+}
+
+// rawTables 原始快照使用的表
+var rawTables = snapshotTables{
+	basicStats:          tableBasicStats,
+	ipStats:             tableIPStats,
+	topSourceIPs:        tableTopSourceIPs,
+	portStats:           tablePortStats,
+	topDestinationPorts: tableTopDestinationPorts,
+	protocolStats:       tableProtocolStats,
+	tcpFlagStats:        tableTCPFlagStats,
+	tcpFlagsJSON:        tableTCPFlagsJSON,
+	protocolsJSON:       tableProtocolsJSON,
+	servicesJSON:        tableServicesJSON,
+	commits:             tableSnapshotCommits,
+	talkerStats:         tableTalkerStats,
+	topDestinationIPs:   tableTopDestinationIPs,
+	topConversations:    tableTopConversations,
+	topFlows:            tableTopFlows,
+	topTransportPorts:   tableTopTransportPorts,
+	serviceStats:        tableServiceStats,
+	distributionBuckets: tableDistributionBuckets,
+	etherTypeStats:      tableEtherTypeStats,
+	macCastStats:        tableMACCastStats,
+	topDestinationMACs:  tableTopDestinationMACs,
+	classificationStats: tableClassificationStats,
+	packetTypeStats:     tablePacketTypeStats,
+	applicationCrosstab: tableApplicationCrosstab,
+	nonStandardPorts:    tableNonStandardPorts,
+	packetSizeStats:     tablePacketSizeStats,
+	packetSizeHistogram: tablePacketSizeHistogram,
+	throughputStats:     tableThroughputStats,
+	microbursts:         tableMicrobursts,
+	directionStats:      tableDirectionStats,
+	directionTopTalkers: tableDirectionTopTalkers,
+	directionBreakdown:  tableDirectionBreakdown,
+	prefixUniqueCounts:  tablePrefixUniqueCounts,
+	topPrefixes:         tableTopPrefixes,
+	topCountries:        tableTopCountries,
+	topASNs:             tableTopASNs,
+	ipLocations:         tableIPLocations,
+}
+
+// tables 返回层级对应的表，汇总层级的表名为原始表名加 _<层级名称>
+func (t Tier) tables() snapshotTables {
+	if t.IsRaw() {
+		return rawTables
+	}
+
+	suffix := func(id Identifier) Identifier {
+		tierID, err := id.WithSuffix("_" + t.Name)
+		if err != nil {
+			panic(err)
+		}
+		return tierID
+	}
+
+	return snapshotTables{
+		basicStats:          suffix(rawTables.basicStats),
+		ipStats:             suffix(rawTables.ipStats),
+		topSourceIPs:        suffix(rawTables.topSourceIPs),
+		portStats:           suffix(rawTables.portStats),
+		topDestinationPorts: suffix(rawTables.topDestinationPorts),
+		protocolStats:       suffix(rawTables.protocolStats),
+		tcpFlagStats:        suffix(rawTables.tcpFlagStats),
+		tcpFlagsJSON:        suffix(rawTables.tcpFlagsJSON),
+		protocolsJSON:       suffix(rawTables.protocolsJSON),
+		servicesJSON:        suffix(rawTables.servicesJSON),
+		commits:             suffix(rawTables.commits),
+		talkerStats:         suffix(rawTables.talkerStats),
+		topDestinationIPs:   suffix(rawTables.topDestinationIPs),
+		topConversations:    suffix(rawTables.topConversations),
+		topFlows:            suffix(rawTables.topFlows),
+		topTransportPorts:   suffix(rawTables.topTransportPorts),
+		serviceStats:        suffix(rawTables.serviceStats),
+		distributionBuckets: suffix(rawTables.distributionBuckets),
+		etherTypeStats:      suffix(rawTables.etherTypeStats),
+		macCastStats:        suffix(rawTables.macCastStats),
+		topDestinationMACs:  suffix(rawTables.topDestinationMACs),
+		classificationStats: suffix(rawTables.classificationStats),
+		packetTypeStats:     suffix(rawTables.packetTypeStats),
+		applicationCrosstab: suffix(rawTables.applicationCrosstab),
+		nonStandardPorts:    suffix(rawTables.nonStandardPorts),
+		packetSizeStats:     suffix(rawTables.packetSizeStats),
+		packetSizeHistogram: suffix(rawTables.packetSizeHistogram),
+		throughputStats:     suffix(rawTables.throughputStats),
+		microbursts:         suffix(rawTables.microbursts),
+		directionStats:      suffix(rawTables.directionStats),
+		directionTopTalkers: suffix(rawTables.directionTopTalkers),
+		directionBreakdown:  suffix(rawTables.directionBreakdown),
+		prefixUniqueCounts:  suffix(rawTables.prefixUniqueCounts),
+		topPrefixes:         suffix(rawTables.topPrefixes),
+		topCountries:        suffix(rawTables.topCountries),
+		topASNs:             suffix(rawTables.topASNs),
+		ipLocations:         suffix(rawTables.ipLocations),
+	}
+}
+
+// all 返回层级中的所有表，完成标记表在最后
+func (t snapshotTables) all() []Identifier {
+	return []Identifier{
+		t.basicStats,
+		t.ipStats,
+		t.topSourceIPs,
+		t.portStats,
+		t.topDestinationPorts,
+		t.protocolStats,
+		t.tcpFlagStats,
+		t.tcpFlagsJSON,
+		t.protocolsJSON,
+		t.servicesJSON,
+		t.talkerStats,
+		t.topDestinationIPs,
+		t.topConversations,
+		t.topFlows,
+		t.topTransportPorts,
+		t.serviceStats,
+		t.distributionBuckets,
+		t.etherTypeStats,
+		t.macCastStats,
+		t.topDestinationMACs,
+		t.classificationStats,
+		t.packetTypeStats,
+		t.applicationCrosstab,
+		t.nonStandardPorts,
+		t.packetSizeStats,
+		t.packetSizeHistogram,
+		t.throughputStats,
+		t.microbursts,
+		t.directionStats,
+		t.directionTopTalkers,
+		t.directionBreakdown,
+		t.prefixUniqueCounts,
+		t.topPrefixes,
+		t.topCountries,
+		t.topASNs,
+		t.ipLocations,
+		t.commits,
+	}
+}
+
+// TierTables 返回层级中的所有表，用于按表配置TTL等选项
+func TierTables(tier Tier) []Identifier {
+	return tier.tables().all()
+}
+
+// 以下 *TableDDL 函数返回各个迁移中的建表语句。已发布的迁移使用了这些语句，不能再修改；
+// 之后的结构变化需要通过新的迁移同时修改各层级的表。
+
+// tierTableDDL 汇总层级的建表语句，列与迁移到版本2后的原始表一致
+func tierTableDDL(tier Tier) []string {
+	tables := tier.tables()
+	return []string{
+		CreateTable(tables.basicStats,
+			"snapshot_id STRING",
+			"ts TIMESTAMP TIME INDEX",
+			"total_packets UINT64",
+			"total_bytes UINT64",
+			"window_start TIMESTAMP",
+			"window_end TIMESTAMP",
+			"window_size_seconds UINT32",
+			"PRIMARY KEY(snapshot_id)",
+		).String(),
+		CreateTable(tables.ipStats,
+			"snapshot_id STRING",
+			"ts TIMESTAMP TIME INDEX",
+			"unique_source_count UINT32",
+			"PRIMARY KEY(snapshot_id)",
+		).String(),
+		CreateTable(tables.topSourceIPs,
+			"snapshot_id STRING",
+			"ts TIMESTAMP TIME INDEX",
+			"source_ip STRING",
+			"pos_rank UINT8",
+			"packet_count UINT64",
+			"PRIMARY KEY(snapshot_id, pos_rank)",
+		).String(),
+		CreateTable(tables.portStats,
+			"snapshot_id STRING",
+			"ts TIMESTAMP TIME INDEX",
+			"unique_dest_count UINT32",
+			"PRIMARY KEY(snapshot_id)",
+		).String(),
+		CreateTable(tables.topDestinationPorts,
+			"snapshot_id STRING",
+			"ts TIMESTAMP TIME INDEX",
+			"port UINT16",
+			"service_name STRING",
+			"pos_rank UINT8",
+			"packet_count UINT64",
+			"PRIMARY KEY(snapshot_id, pos_rank)",
+		).String(),
+		CreateTable(tables.protocolStats,
+			"snapshot_id STRING",
+			"ts TIMESTAMP TIME INDEX",
+			"protocol_name STRING",
+			"packet_count UINT64",
+			"percentage DOUBLE",
+			"PRIMARY KEY(snapshot_id, protocol_name)",
+		).String(),
+		CreateTable(tables.tcpFlagStats,
+			"snapshot_id STRING",
+			"ts TIMESTAMP TIME INDEX",
+			"flag STRING",
+			"flag_name STRING",
+			"packet_count UINT64",
+			"percentage DOUBLE",
+			"PRIMARY KEY(snapshot_id, flag)",
+		).String(),
+		CreateTable(tables.tcpFlagsJSON,
+			"snapshot_id STRING",
+			"ts TIMESTAMP TIME INDEX",
+			"total_packet_count UINT64",
+			"ack_count UINT64",
+			"syn_count UINT64",
+			"fin_ack_count UINT64",
+			"psh_ack_count UINT64",
+			"none_count UINT64",
+			"other_count UINT64",
+			"PRIMARY KEY(snapshot_id)",
+		).String(),
+		CreateTable(tables.protocolsJSON,
+			"snapshot_id STRING",
+			"ts TIMESTAMP TIME INDEX",
+			"total_packet_count UINT64",
+			"tcp_count UINT64",
+			"udp_count UINT64",
+			"icmp_count UINT64",
+			"other_count UINT64",
+			"PRIMARY KEY(snapshot_id)",
+		).String(),
+		CreateTable(tables.servicesJSON,
+			"snapshot_id STRING",
+			"ts TIMESTAMP TIME INDEX",
+			"total_packet_count UINT64",
+			"http_count UINT64",
+			"https_count UINT64",
+			"ssh_count UINT64",
+			"dns_count UINT64",
+			"smtp_count UINT64",
+			"ftp_count UINT64",
+			"mysql_count UINT64",
+			"ntp_count UINT64",
+			"telnet_count UINT64",
+			"rdp_count UINT64",
+			"unknown_count UINT64",
+			"other_count UINT64",
+			"PRIMARY KEY(snapshot_id)",
+		).String(),
+		CreateTable(tables.commits,
+			"snapshot_id STRING",
+			"ts TIMESTAMP TIME INDEX",
+			"table_count UINT16",
+			"row_count UINT32",
+			"PRIMARY KEY(snapshot_id)",
+		).String(),
+	}
+}
+
+// talkerTableDDL 目标IP、会话和五元组流排行的建表语句，包含来源标签列
+func talkerTableDDL(tier Tier) []string {
+	tables := tier.tables()
+	labels := []string{"sensor STRING", "site STRING", "interface_name STRING", "profile STRING"}
+	traffic := []string{"packet_count UINT64", "byte_count UINT64", "first_seen TIMESTAMP", "last_seen TIMESTAMP"}
+
+	return []string{
+		CreateTable(tables.talkerStats, slices.Concat(
+			[]string{
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"unique_dest_ip_count UINT32",
+				"destination_rank_by STRING",
+				"conversation_rank_by STRING",
+				"flow_rank_by STRING",
+			},
+			labels,
+			[]string{"PRIMARY KEY(snapshot_id)"},
+		)...).String(),
+		CreateTable(tables.topDestinationIPs, slices.Concat(
+			[]string{
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"pos_rank UINT8",
+				"destination_ip STRING",
+			},
+			traffic,
+			labels,
+			[]string{"PRIMARY KEY(snapshot_id, pos_rank)"},
+		)...).String(),
+		CreateTable(tables.topConversations, slices.Concat(
+			[]string{
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"pos_rank UINT8",
+				"source_ip STRING",
+				"destination_ip STRING",
+			},
+			traffic,
+			labels,
+			[]string{"PRIMARY KEY(snapshot_id, pos_rank)"},
+		)...).String(),
+		CreateTable(tables.topFlows, slices.Concat(
+			[]string{
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"pos_rank UINT8",
+				"source_ip STRING",
+				"destination_ip STRING",
+				"source_port UINT16",
+				"destination_port UINT16",
+				"protocol STRING",
+			},
+			traffic,
+			labels,
+			[]string{"PRIMARY KEY(snapshot_id, pos_rank)"},
+		)...).String(),
+	}
+}
+
+// transportPortTableDDL 按传输层协议区分的端口排行的建表语句，包含来源标签列
+func transportPortTableDDL(tier Tier) []string {
+	return []string{
+		CreateTable(tier.tables().topTransportPorts,
+			"snapshot_id STRING",
+			"ts TIMESTAMP TIME INDEX",
+			"port_role STRING",
+			"transport STRING",
+			"pos_rank UINT8",
+			"port UINT16",
+			"service_name STRING",
+			"packet_count UINT64",
+			"byte_count UINT64",
+			"sensor STRING",
+			"site STRING",
+			"interface_name STRING",
+			"profile STRING",
+			"PRIMARY KEY(snapshot_id, port_role, transport, pos_rank)",
+		).String(),
+	}
+}
+
+// serviceTableDDL 长格式服务分布表的建表语句，包含来源标签列
+func serviceTableDDL(tier Tier) []string {
+	return []string{
+		CreateTable(tier.tables().serviceStats,
+			"snapshot_id STRING",
+			"ts TIMESTAMP TIME INDEX",
+			"service_name STRING",
+			"packet_count UINT64",
+			"byte_count UINT64",
+			"percentage DOUBLE",
+			"sensor STRING",
+			"site STRING",
+			"interface_name STRING",
+			"profile STRING",
+			"PRIMARY KEY(snapshot_id, service_name)",
+		).String(),
+	}
+}
+
+// bucketTableDDL 按分组汇总的协议和TCP标志分布表的建表语句，包含来源标签列
+func bucketTableDDL(tier Tier) []string {
+	return []string{
+		CreateTable(tier.tables().distributionBuckets,
+			"snapshot_id STRING",
+			"ts TIMESTAMP TIME INDEX",
+			"distribution STRING",
+			"bucket STRING",
+			"packet_count UINT64",
+			"byte_count UINT64",
+			"percentage DOUBLE",
+			"sensor STRING",
+			"site STRING",
+			"interface_name STRING",
+			"profile STRING",
+			"PRIMARY KEY(snapshot_id, distribution, bucket)",
+		).String(),
+	}
+}
+
+// l2TableDDL EtherType分布、目标MAC地址类型分布和热门目标MAC地址的建表语句，包含来源标签列
+func l2TableDDL(tier Tier) []string {
+	tables := tier.tables()
+	labels := []string{"sensor STRING", "site STRING", "interface_name STRING", "profile STRING"}
+
+	return []string{
+		CreateTable(tables.etherTypeStats, slices.Concat(
+			[]string{
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"ether_type UINT16",
+				"ether_type_name STRING",
+				"packet_count UINT64",
+				"byte_count UINT64",
+				"percentage DOUBLE",
+			},
+			labels,
+			[]string{"PRIMARY KEY(snapshot_id, ether_type)"},
+		)...).String(),
+		CreateTable(tables.macCastStats, slices.Concat(
+			[]string{
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"mac_cast STRING",
+				"packet_count UINT64",
+				"byte_count UINT64",
+				"percentage DOUBLE",
+			},
+			labels,
+			[]string{"PRIMARY KEY(snapshot_id, mac_cast)"},
+		)...).String(),
+		CreateTable(tables.topDestinationMACs, slices.Concat(
+			[]string{
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"pos_rank UINT8",
+				"destination_mac STRING",
+				"mac_cast STRING",
+				"packet_count UINT64",
+				"byte_count UINT64",
+				"rank_by STRING",
+			},
+			labels,
+			[]string{"PRIMARY KEY(snapshot_id, pos_rank)"},
+		)...).String(),
+	}
+}
+
+// classificationTableDDL 流量分类统计的建表语句，包含来源标签列
+func classificationTableDDL(tier Tier) []string {
+	tables := tier.tables()
+	labels := []string{"sensor STRING", "site STRING", "interface_name STRING", "profile STRING"}
+
+	return []string{
+		CreateTable(tables.classificationStats, slices.Concat(
+			[]string{
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"unknown_count UINT64",
+				"unknown_bytes UINT64",
+				"unknown_percentage DOUBLE",
+				"non_standard_count UINT64",
+				"non_standard_bytes UINT64",
+				"non_standard_percentage DOUBLE",
+			},
+			labels,
+			[]string{"PRIMARY KEY(snapshot_id)"},
+		)...).String(),
+		CreateTable(tables.packetTypeStats, slices.Concat(
+			[]string{
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"packet_type STRING",
+				"packet_count UINT64",
+				"byte_count UINT64",
+				"percentage DOUBLE",
+			},
+			labels,
+			[]string{"PRIMARY KEY(snapshot_id, packet_type)"},
+		)...).String(),
+		CreateTable(tables.applicationCrosstab, slices.Concat(
+			[]string{
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"application STRING",
+				"dimension STRING",
+				"dimension_value STRING",
+				"packet_count UINT64",
+				"byte_count UINT64",
+				"percentage DOUBLE",
+			},
+			labels,
+			[]string{"PRIMARY KEY(snapshot_id, application, dimension, dimension_value)"},
+		)...).String(),
+		CreateTable(tables.nonStandardPorts, slices.Concat(
+			[]string{
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"pos_rank UINT8",
+				"application STRING",
+				"transport STRING",
+				"port UINT16",
+				"service_name STRING",
+				"packet_count UINT64",
+				"byte_count UINT64",
+			},
+			labels,
+			[]string{"PRIMARY KEY(snapshot_id, pos_rank)"},
+		)...).String(),
+	}
+}
+
+// packetSizeTableDDL 数据包大小统计的建表语句，包含来源标签列
+func packetSizeTableDDL(tier Tier) []string {
+	tables := tier.tables()
+	labels := []string{"sensor STRING", "site STRING", "interface_name STRING", "profile STRING"}
+
+	return []string{
+		CreateTable(tables.packetSizeStats, slices.Concat(
+			[]string{
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"protocol STRING",
+				"packet_count UINT64",
+				"byte_count UINT64",
+				"min_size UINT16",
+				"max_size UINT16",
+				"mean_size DOUBLE",
+				"p50_size UINT16",
+				"p90_size UINT16",
+				"p99_size UINT16",
+			},
+			labels,
+			[]string{"PRIMARY KEY(snapshot_id, protocol)"},
+		)...).String(),
+		CreateTable(tables.packetSizeHistogram, slices.Concat(
+			[]string{
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"protocol STRING",
+				"bucket STRING",
+				"lower_bound UINT16",
+				"upper_bound UINT16",
+				"packet_count UINT64",
+				"byte_count UINT64",
+				"percentage DOUBLE",
+			},
+			labels,
+			[]string{"PRIMARY KEY(snapshot_id, protocol, lower_bound)"},
+		)...).String(),
+	}
+}
+
+// throughputTableDDL 吞吐速率和微突发的建表语句，包含来源标签列
+func throughputTableDDL(tier Tier) []string {
+	tables := tier.tables()
+	labels := []string{"sensor STRING", "site STRING", "interface_name STRING", "profile STRING"}
+
+	return []string{
+		CreateTable(tables.throughputStats, slices.Concat(
+			[]string{
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"window_seconds DOUBLE",
+				"packets_per_second DOUBLE",
+				"bits_per_second DOUBLE",
+				"bucket_ms UINT32",
+				"burst_factor DOUBLE",
+				"peak_pps DOUBLE",
+				"peak_bps DOUBLE",
+				"peak_at TIMESTAMP",
+				"burst_count UINT32",
+				"burst_packets UINT64",
+				"burst_bytes UINT64",
+				"burst_percentage DOUBLE",
+			},
+			labels,
+			[]string{"PRIMARY KEY(snapshot_id)"},
+		)...).String(),
+		CreateTable(tables.microbursts, slices.Concat(
+			[]string{
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"pos_rank UINT8",
+				"burst_start TIMESTAMP",
+				"packet_count UINT64",
+				"byte_count UINT64",
+				"packets_per_second DOUBLE",
+				"bits_per_second DOUBLE",
+			},
+			labels,
+			[]string{"PRIMARY KEY(snapshot_id, pos_rank)"},
+		)...).String(),
+	}
+}
+
+// directionTableDDL 流量方向统计的建表语句，包含来源标签列
+func directionTableDDL(tier Tier) []string {
+	tables := tier.tables()
+	labels := []string{"sensor STRING", "site STRING", "interface_name STRING", "profile STRING"}
+
+	return []string{
+		CreateTable(tables.directionStats, slices.Concat(
+			[]string{
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"direction STRING",
+				"packet_count UINT64",
+				"byte_count UINT64",
+				"percentage DOUBLE",
+			},
+			labels,
+			[]string{"PRIMARY KEY(snapshot_id, direction)"},
+		)...).String(),
+		CreateTable(tables.directionTopTalkers, slices.Concat(
+			[]string{
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"direction STRING",
+				"role STRING",
+				"pos_rank UINT8",
+				"address STRING",
+				"packet_count UINT64",
+				"byte_count UINT64",
+				"rank_by STRING",
+			},
+			labels,
+			[]string{"PRIMARY KEY(snapshot_id, direction, role, pos_rank)"},
+		)...).String(),
+		CreateTable(tables.directionBreakdown, slices.Concat(
+			[]string{
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"direction STRING",
+				"dimension STRING",
+				"dimension_value STRING",
+				"packet_count UINT64",
+				"byte_count UINT64",
+				"percentage DOUBLE",
+			},
+			labels,
+			[]string{"PRIMARY KEY(snapshot_id, direction, dimension, dimension_value)"},
+		)...).String(),
+	}
+}
+
+// prefixTableDDL 前缀统计的建表语句，包含来源标签列
+func prefixTableDDL(tier Tier) []string {
+	tables := tier.tables()
+	labels := []string{"sensor STRING", "site STRING", "interface_name STRING", "profile STRING"}
+
+	return []string{
+		CreateTable(tables.prefixUniqueCounts, slices.Concat(
+			[]string{
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"role STRING",
+				"family STRING",
+				"prefix_length UINT8",
+				"unique_count UINT32",
+			},
+			labels,
+			[]string{"PRIMARY KEY(snapshot_id, role, family, prefix_length)"},
+		)...).String(),
+		CreateTable(tables.topPrefixes, slices.Concat(
+			[]string{
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"role STRING",
+				"family STRING",
+				"prefix_length UINT8",
+				"pos_rank UINT8",
+				"prefix STRING",
+				"packet_count UINT64",
+				"byte_count UINT64",
+				"rank_by STRING",
+			},
+			labels,
+			[]string{"PRIMARY KEY(snapshot_id, role, family, prefix_length, pos_rank)"},
+		)...).String(),
+	}
+}
+
+// geoTableDDL 国家和自治系统统计的建表语句，包含来源标签列
+func geoTableDDL(tier Tier) []string {
+	tables := tier.tables()
+	labels := []string{"sensor STRING", "site STRING", "interface_name STRING", "profile STRING"}
+
+	return []string{
+		CreateTable(tables.topCountries, slices.Concat(
+			[]string{
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"role STRING",
+				"pos_rank UINT8",
+				"country_code STRING",
+				"country STRING",
+				"packet_count UINT64",
+				"byte_count UINT64",
+				"percentage DOUBLE",
+				"rank_by STRING",
+			},
+			labels,
+			[]string{"PRIMARY KEY(snapshot_id, role, pos_rank)"},
+		)...).String(),
+		CreateTable(tables.topASNs, slices.Concat(
+			[]string{
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"role STRING",
+				"pos_rank UINT8",
+				"asn UINT32",
+				"organization STRING",
+				"packet_count UINT64",
+				"byte_count UINT64",
+				"percentage DOUBLE",
+				"rank_by STRING",
+			},
+			labels,
+			[]string{"PRIMARY KEY(snapshot_id, role, pos_rank)"},
+		)...).String(),
+		CreateTable(tables.ipLocations, slices.Concat(
+			[]string{
+				"snapshot_id STRING",
+				"ts TIMESTAMP TIME INDEX",
+				"address STRING",
+				"country_code STRING",
+				"country STRING",
+				"city STRING",
+				"asn UINT32",
+				"organization STRING",
+			},
+			labels,
+			[]string{"PRIMARY KEY(snapshot_id, address)"},
+		)...).String(),
+	}
+}
+
+// ttlPattern GrepTimeDB的TTL取值：forever，或由数字加单位组成的时长，例如 7d、12h、1w
+var ttlPattern = regexp.MustCompile(`^(forever|([0-9]+(ns|us|ms|s|m|h|d|w|M|y))+)$`)
+
+// ValidateTTL 校验TTL取值，避免把任意字符串拼接到表选项中
+func ValidateTTL(ttl string) error {
+	if !ttlPattern.MatchString(strings.TrimSpace(ttl)) {
+		return fmt.Errorf("TTL %q 无效（例如 7d、12h、forever）", ttl)
+	}
+	return nil
+}
+
+// SetTableTTL 通过表选项设置单张表的TTL，超过TTL的数据由GrepTimeDB在压缩时删除
+func SetTableTTL(ctx context.Context, db *sql.DB, table Identifier, ttl string) error {
+	ttl = strings.TrimSpace(ttl)
+	if err := ValidateTTL(ttl); err != nil {
+		return err
+	}
+
+	query := AlterTable(table).SetOption("ttl", ttl).String()
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("设置 %s 的TTL失败: %w", table, err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"SnapFlow/internal/models"
+	"SnapFlow/internal/services"
+)
+
+// FillTransportPortStats 填充按传输层协议(TCP/UDP)区分的目标端口、源端口和服务端口排行，以及服务分布到snapshot中
+//
+// 按 (protocol, src_port, dst_port) 分组扫描一次窗口，各项统计在内存中由同一份分组结果得出。
+// 服务端口由服务注册表从每个端口对中选出，服务名称按传输层协议识别，TCP 53和UDP 53分别统计。
+// 排行使用端口统计的排序依据；服务分布覆盖窗口内全部TCP和UDP数据包，不只是排行中的端口。
+func FillTransportPortStats(ctx context.Context, src *SourceDB, table Identifier, snapshot *models.Snapshot) error {
+	query := src.Select("protocol", "src_port", "dst_port", "COUNT(*) AS count", byteSum(src.Dialect())).
+		From(table).
+		Where(windowCondition).
+		Where("protocol IN (6, 17)").
+		Where("src_port IS NOT NULL").
+		Where("dst_port IS NOT NULL").
+		GroupBy("protocol", "src_port", "dst_port").
+		String()
+
+	rows, err := src.QueryContext(ctx, query, windowArgs(snapshot)...)
+	if err != nil {
+		return fmt.Errorf("获取传输层端口统计失败: %w", err)
+	}
+	defer rows.Close()
+
+	registry := services.Default()
+	counter := models.NewTransportPortCounter()
+	serviceTraffic := make(map[string]models.Traffic)
+	var total uint64
+	for rows.Next() {
+		var protocolID int
+		var srcPort, dstPort uint16
+		var traffic models.Traffic
+
+		if err := rows.Scan(&protocolID, &srcPort, &dstPort, &traffic.Packets, &traffic.Bytes); err != nil {
+			return fmt.Errorf("扫描传输层端口数据失败: %w", err)
+		}
+
+		transport := getProtocolName(protocolID)
+		service := registry.ServicePort(transport, srcPort, dstPort)
+		serviceName := registry.Name(transport, service)
+		counter.Add(models.PortRoleDestination, transport, dstPort, registry.Name(transport, dstPort), traffic)
+		counter.Add(models.PortRoleSource, transport, srcPort, registry.Name(transport, srcPort), traffic)
+		counter.Add(models.PortRoleService, transport, service, serviceName, traffic)
+		accumulate(serviceTraffic, serviceName, traffic)
+		total += traffic.Packets
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("扫描传输层端口数据时发生错误: %w", err)
+	}
+
+	rankBy := snapshot.Port.RankBy.OrDefault()
+	snapshot.SetTransportPortStats(counter.Top(rankBy, 5))
+
+	var services []models.ServiceCount
+	for _, name := range models.RankTraffic(serviceTraffic, models.RankByPackets, 0) {
+		t := serviceTraffic[name]
+		services = append(services, models.ServiceCount{
+			Name:       name,
+			Count:      t.Packets,
+			Bytes:      t.Bytes,
+			Percentage: float64(t.Packets) * 100.0 / float64(total),
+		})
+	}
+	snapshot.SetServiceStats(services)
+
+	// 打印获取的信息
+	fmt.Printf("\n获取到的传输层端口统计信息 (按%s排序的前5个):\n", rankByLabel(rankBy))
+
+	for _, transport := range []string{"TCP", "UDP"} {
+		for _, role := range []struct {
+			role  models.PortRole
+			label string
+		}{
+			{models.PortRoleDestination, "目标端口"},
+			{models.PortRoleSource, "源端口"},
+			{models.PortRoleService, "服务端口"},
+		} {
+			ports := snapshot.TransportPort.Top(role.role, transport)
+			if len(ports) == 0 {
+				continue
+			}
+			fmt.Printf("- %s %s:\n", transport, role.label)
+			for i, port := range ports {
+				fmt.Printf("  %d. 端口 %d (%s): %d 个数据包, %d 字节\n",
+					i+1, port.Port, port.Service, port.Count, port.Bytes)
+			}
+		}
+	}
+
+	fmt.Printf("- 服务分布 (%d 个服务):\n", len(services))
+	for i, service := range services {
+		fmt.Printf("  %d. %s: %d 个数据包, %d 字节 (%.2f%%)\n",
+			i+1, service.Name, service.Count, service.Bytes, service.Percentage)
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"SnapFlow/internal/models"
+)
+
+// windowGroupColumns 单次扫描时的分组列，IP、端口、协议和TCP标志统计都由这几列推导
+var windowGroupColumns = []string{"src_ip", "dst_port", "protocol", "tcp_flags"}
+
+// FillWindowStats 只扫描一次快照窗口，推导出IP、端口、协议和TCP标志统计
+//
+// 按 (src_ip, dst_port, protocol, tcp_flags) 分组读取窗口内的数据包数和字节数，各项统计在内存中
+// 由同一份分组结果得出，结果与分别调用FillIPStats、FillPortStats、FillProtocolStats和
+// FillTCPFlagsStats一致。分组数不超过窗口内的数据包数；源IP和端口高度分散（例如扫描流量）时
+// 返回的行数会变多，但数据库只需扫描一遍窗口。
+func FillWindowStats(ctx context.Context, src *SourceDB, table Identifier, snapshot *models.Snapshot) error {
+	query := src.Select("src_ip", "dst_port", "protocol", "tcp_flags", "COUNT(*) AS count", byteSum(src.Dialect())).
+		From(table).
+		Where(windowCondition).
+		GroupBy(windowGroupColumns...).
+		String()
+
+	rows, err := src.QueryContext(ctx, query, windowArgs(snapshot)...)
+	if err != nil {
+		return fmt.Errorf("扫描快照窗口失败: %w", err)
+	}
+	defer rows.Close()
+
+	acc := newWindowAccumulator()
+	groups := 0
+	for rows.Next() {
+		var g packetGroup
+		if err := rows.Scan(&g.srcIP, &g.dstPort, &g.protocol, &g.tcpFlags, &g.traffic.Packets, &g.traffic.Bytes); err != nil {
+			return fmt.Errorf("扫描窗口分组数据失败: %w", err)
+		}
+		acc.add(g)
+		groups++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("扫描窗口分组数据时发生错误: %w", err)
+	}
+
+	acc.apply(snapshot)
+
+	// 打印获取的信息
+	fmt.Printf("\n单次扫描获取到的窗口统计信息:\n")
+	fmt.Printf("- 分组数量: %d，数据包数量: %d\n", groups, acc.total)
+	fmt.Printf("- 唯一源IP地址数量: %d，唯一目标端口数量: %d\n", snapshot.IP.UniqueSourceCount, snapshot.Port.UniqueDestCount)
+	fmt.Printf("- 协议数量: %d，TCP标志组合数量: %d\n", len(snapshot.Protocol.Protocols), len(snapshot.TCPFlags.Flags))
+
+	return nil
+}
+
+// packetGroup 分组查询返回的一行：一组列值相同的数据包及其数量和字节数
+type packetGroup struct {
+	srcIP    sql.NullString
+	dstPort  sql.NullInt64
+	protocol sql.NullInt64
+	tcpFlags sql.NullInt64
+	traffic  models.Traffic
+}
+
+// windowAccumulator 累加分组的数据包数和字节数，最后一次性推导快照的各项统计
+type windowAccumulator struct {
+	total      uint64
+	srcIPs     map[string]models.Traffic
+	nullSrcIPs models.Traffic // src_ip为NULL的数据包，不计入唯一数量，排行中显示为空字符串
+	dstPorts   map[uint16]models.Traffic
+	protocols  map[int]models.Traffic
+	tcpFlags   map[int]models.Traffic
+}
+
+// newWindowAccumulator 创建空的累加器
+func newWindowAccumulator() *windowAccumulator {
+	return &windowAccumulator{
+		srcIPs:    make(map[string]models.Traffic),
+		dstPorts:  make(map[uint16]models.Traffic),
+		protocols: make(map[int]models.Traffic),
+		tcpFlags:  make(map[int]models.Traffic),
+	}
+}
+
+// add 累加一个分组，与逐项查询一样，NULL值不计入对应的唯一数量和分布
+func (a *windowAccumulator) add(g packetGroup) {
+	a.total += g.traffic.Packets
+	a.addSourceIP(g.srcIP, g.traffic)
+	a.addDestPort(g.dstPort, g.traffic)
+	a.addProtocol(g.protocol, g.traffic)
+	a.addTCPFlags(g.tcpFlags, g.traffic)
+}
+
+// addSourceIP 累加一个源IP的数据包数和字节数
+func (a *windowAccumulator) addSourceIP(ip sql.NullString, traffic models.Traffic) {
+	if ip.Valid {
+		accumulate(a.srcIPs, ip.String, traffic)
+	} else {
+		a.nullSrcIPs.Add(traffic)
+	}
+}
+
+// addDestPort 累加一个目标端口的数据包数和字节数
+func (a *windowAccumulator) addDestPort(port sql.NullInt64, traffic models.Traffic) {
+	if port.Valid {
+		accumulate(a.dstPorts, uint16(port.Int64), traffic)
+	}
+}
+
+// addProtocol 累加一个协议的数据包数和字节数
+func (a *windowAccumulator) addProtocol(protocol sql.NullInt64, traffic models.Traffic) {
+	if protocol.Valid {
+		accumulate(a.protocols, int(protocol.Int64), traffic)
+	}
+}
+
+// addTCPFlags 累加一个TCP标志组合的数据包数和字节数
+func (a *windowAccumulator) addTCPFlags(flags sql.NullInt64, traffic models.Traffic) {
+	if flags.Valid {
+		accumulate(a.tcpFlags, int(flags.Int64), traffic)
+	}
+}
+
+// accumulate 把traffic累加到counts中key对应的值上
+func accumulate[K comparable](counts map[K]models.Traffic, key K, traffic models.Traffic) {
+	sum := counts[key]
+	sum.Add(traffic)
+	counts[key] = sum
+}
+
+// apply 把累加结果写入快照的IP、端口、协议和TCP标志统计，IP和端口排行使用快照中设置的排序依据
+func (a *windowAccumulator) apply(snapshot *models.Snapshot) {
+	snapshot.IP.RankBy = snapshot.IP.RankBy.OrDefault()
+	snapshot.Port.RankBy = snapshot.Port.RankBy.OrDefault()
+
+	uniqueIPs := len(a.srcIPs)
+	if a.nullSrcIPs.Packets > 0 {
+		accumulate(a.srcIPs, "", a.nullSrcIPs)
+	}
+	var topIPs []models.IPAddressPair
+	for _, ip := range models.RankTraffic(a.srcIPs, snapshot.IP.RankBy, 5) {
+		topIPs = append(topIPs, models.IPAddressPair{SourceIP: ip, Count: a.srcIPs[ip].Packets, Bytes: a.srcIPs[ip].Bytes})
+	}
+	snapshot.SetIPStats(uniqueIPs, topIPs)
+
+	var topPorts []models.PortPair
+	for _, port := range models.RankTraffic(a.dstPorts, snapshot.Port.RankBy, 5) {
+		topPorts = append(topPorts, models.PortPair{DestinationPort: port, Count: a.dstPorts[port].Packets, Bytes: a.dstPorts[port].Bytes})
+	}
+	snapshot.SetPortStats(len(a.dstPorts), topPorts)
+
+	var protocols []models.ProtocolCount
+	for _, id := range models.RankTraffic(a.protocols, models.RankByPackets, 0) {
+		protocols = append(protocols, models.ProtocolCount{
+			Name:       getProtocolName(id),
+			Count:      a.protocols[id].Packets,
+			Bytes:      a.protocols[id].Bytes,
+			Percentage: a.percentage(a.protocols[id].Packets),
+		})
+	}
+	snapshot.SetProtocolStats(protocols)
+
+	var flags []models.TCPFlagCount
+	for _, flag := range models.RankTraffic(a.tcpFlags, models.RankByPackets, 0) {
+		flags = append(flags, models.TCPFlagCount{
+			Flag:       tcpFlagToString(uint8(flag)),
+			Count:      a.tcpFlags[flag].Packets,
+			Bytes:      a.tcpFlags[flag].Bytes,
+			Percentage: a.percentage(a.tcpFlags[flag].Packets),
+		})
+	}
+	snapshot.SetTCPFlagsStats(flags)
+}
+
+// percentage 计算占窗口内全部数据包的百分比，与分布查询中的 COUNT(*) * 100.0 / total 一致
+func (a *windowAccumulator) percentage(count uint64) float64 {
+	if a.total == 0 {
+		return 0
+	}
+	return float64(count) * 100.0 / float64(a.total)
+}
@@ -0,0 +1,165 @@
+// Package geoip 从本地MaxMind格式的mmdb文件离线解析IP地址所在的国家、城市和自治系统，不访问任何在线服务
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/oschwald/maxminddb-golang"
+
+	"SnapFlow/internal/models"
+)
+
+// DefaultCacheSize 未配置时解析结果缓存的地址数量
+const DefaultCacheSize = 10000
+
+// cityRecord GeoLite2-City、GeoIP2-City或GeoLite2-Country数据库中使用的字段，
+// 国家数据库没有city，解析结果中城市为空
+type cityRecord struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"registered_country"`
+}
+
+// asnRecord GeoLite2-ASN数据库中使用的字段
+type asnRecord struct {
+	Number       uint32 `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// Resolver 从本地mmdb文件解析地址，解析结果按地址缓存在LRU缓存中
+//
+// 城市（或国家）数据库和ASN数据库可以只配置其中一个，未配置的部分在解析结果中为空。
+// Resolver可以被多个goroutine同时使用。
+type Resolver struct {
+	city  *maxminddb.Reader
+	asn   *maxminddb.Reader
+	cache *lru.Cache[netip.Addr, models.IPLocation]
+}
+
+// Open 打开城市（或国家）数据库和ASN数据库，路径为空表示不使用该数据库，两个路径都为空时返回nil
+func Open(cityPath, asnPath string, cacheSize int) (*Resolver, error) {
+	cityPath, asnPath = strings.TrimSpace(cityPath), strings.TrimSpace(asnPath)
+	if cityPath == "" && asnPath == "" {
+		return nil, nil
+	}
+	if cacheSize <= 0 {
+		cacheSize = DefaultCacheSize
+	}
+
+	r := &Resolver{}
+	var err error
+	if cityPath != "" {
+		if r.city, err = openDatabase(cityPath, "City", "Country"); err != nil {
+			return nil, err
+		}
+	}
+	if asnPath != "" {
+		if r.asn, err = openDatabase(asnPath, "ASN"); err != nil {
+			r.Close()
+			return nil, err
+		}
+	}
+	if r.cache, err = lru.New[netip.Addr, models.IPLocation](cacheSize); err != nil {
+		r.Close()
+		return nil, fmt.Errorf("创建GeoIP缓存失败: %w", err)
+	}
+	return r, nil
+}
+
+// openDatabase 打开mmdb文件，并检查数据库类型包含kinds中的任一名称，避免把城市数据库和ASN数据库配置反
+func openDatabase(path string, kinds ...string) (*maxminddb.Reader, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开mmdb文件 %s 失败: %w", path, err)
+	}
+	for _, kind := range kinds {
+		if strings.Contains(reader.Metadata.DatabaseType, kind) {
+			return reader, nil
+		}
+	}
+	reader.Close()
+	return nil, fmt.Errorf("mmdb文件 %s 的数据库类型为 %q，需要 %s 数据库", path, reader.Metadata.DatabaseType, strings.Join(kinds, " 或 "))
+}
+
+// Close 关闭打开的数据库
+func (r *Resolver) Close() error {
+	var errs []error
+	for _, reader := range []*maxminddb.Reader{r.city, r.asn} {
+		if reader != nil {
+			errs = append(errs, reader.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// String 返回数据库类型和构建时间的描述
+func (r *Resolver) String() string {
+	var texts []string
+	for _, reader := range []*maxminddb.Reader{r.city, r.asn} {
+		if reader != nil {
+			texts = append(texts, fmt.Sprintf("%s (构建于 %d)", reader.Metadata.DatabaseType, reader.Metadata.BuildEpoch))
+		}
+	}
+	return strings.Join(texts, ", ")
+}
+
+// Lookup 解析一个地址，IPv4映射的IPv6地址按IPv4解析；地址无法解析或不在任何数据库中时ok为false
+//
+// 私有地址等不在数据库中的地址也会被缓存，重复出现时不再查询数据库。
+func (r *Resolver) Lookup(address string) (location models.IPLocation, ok bool) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(address))
+	if err != nil {
+		return models.IPLocation{}, false
+	}
+	addr = addr.Unmap().WithZone("")
+
+	location, cached := r.cache.Get(addr)
+	if !cached {
+		location = r.lookup(addr)
+		r.cache.Add(addr, location)
+	}
+	location.Address = address
+	return location, location.Resolved()
+}
+
+// lookup 查询数据库，查询出错时按未找到处理
+func (r *Resolver) lookup(addr netip.Addr) models.IPLocation {
+	var location models.IPLocation
+	ip := net.IP(addr.AsSlice())
+
+	if r.city != nil {
+		var record cityRecord
+		if err := r.city.Lookup(ip, &record); err == nil {
+			location.CountryCode = record.Country.ISOCode
+			location.Country = record.Country.Names["en"]
+			// 任播和卫星等地址没有所在国家，使用注册国家
+			if location.CountryCode == "" {
+				location.CountryCode = record.RegisteredCountry.ISOCode
+				location.Country = record.RegisteredCountry.Names["en"]
+			}
+			location.City = record.City.Names["en"]
+		}
+	}
+
+	if r.asn != nil {
+		var record asnRecord
+		if err := r.asn.Lookup(ip, &record); err == nil {
+			location.ASN = record.Number
+			location.Organization = record.Organization
+		}
+	}
+	return location
+}
@@ -0,0 +1,206 @@
+package models
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+)
+
+// UnknownApplication 未识别应用的数据包在分类统计中使用的应用名称
+const UnknownApplication = "unknown"
+
+// ClassificationStats 流量分类统计：数据包类型分布、应用按协议和目标端口的交叉统计、
+// 未识别应用的占比，以及运行在非标准端口上的应用
+type ClassificationStats struct {
+	UnknownCount          uint64                 // 未识别应用的数据包数量
+	UnknownBytes          uint64                 // 未识别应用的字节数
+	UnknownPercentage     float64                // 未识别应用的数据包占比(百分比)
+	NonStandardCount      uint64                 // 运行在非标准端口上的应用的数据包数量
+	NonStandardBytes      uint64                 // 运行在非标准端口上的应用的字节数
+	NonStandardPercentage float64                // 运行在非标准端口上的应用的数据包占比(百分比)
+	PacketTypes           []PacketTypeCount      // 各数据包类型统计
+	AppProtocols          []AppDimensionCount    // 流量最大的应用(Top 10)按协议的交叉统计
+	AppPorts              []AppDimensionCount    // 流量最大的应用(Top 10)按目标端口的交叉统计(每个应用Top 5)
+	NonStandard           []NonStandardPortCount // 流量最大的非标准端口应用(Top 10)
+}
+
+// PacketTypeCount 数据包类型及其统计信息
+type PacketTypeCount struct {
+	Name       string  // 数据包类型
+	Count      uint64  // 数据包数量
+	Bytes      uint64  // 字节数
+	Percentage float64 // 占比(百分比)
+}
+
+// AppDimensionCount 一个应用在协议或目标端口上的流量
+type AppDimensionCount struct {
+	Application string  // 应用名称，未识别的为unknown
+	Value       string  // 协议名称或目标端口号
+	Count       uint64  // 数据包数量
+	Bytes       uint64  // 字节数
+	Percentage  float64 // 占该应用数据包的比例(百分比)
+}
+
+// NonStandardPortCount 运行在非标准端口上的应用及其流量
+type NonStandardPortCount struct {
+	Application string // 应用名称
+	Transport   string // 传输层协议(TCP或UDP)
+	Port        uint16 // 服务端端口
+	Service     string // 该端口在服务注册表中的名称
+	Count       uint64 // 数据包数量
+	Bytes       uint64 // 字节数
+}
+
+// SetClassificationStats 设置流量分类统计
+func (s *Snapshot) SetClassificationStats(stats ClassificationStats) {
+	s.Classification = stats
+}
+
+// 交叉统计和非标准端口排行的项数
+const (
+	classificationTopApps        = 10
+	classificationTopPortsPerApp = 5
+	classificationTopNonStandard = 10
+)
+
+// appDimensionKey 交叉统计的键：应用和协议名称或目标端口
+type appDimensionKey struct {
+	application string
+	value       string
+}
+
+// nonStandardKey 非标准端口排行的键
+type nonStandardKey struct {
+	application string
+	transport   string
+	port        uint16
+}
+
+// ClassificationCounter 累加分类统计的各项流量，最后一次性写入快照
+type ClassificationCounter struct {
+	unknown      Traffic
+	nonStandard  Traffic
+	packetTypes  map[string]Traffic
+	apps         map[string]Traffic
+	appProtocols map[appDimensionKey]Traffic
+	appPorts     map[appDimensionKey]Traffic
+	ports        map[nonStandardKey]Traffic
+	services     map[nonStandardKey]string
+}
+
+// NewClassificationCounter 创建空的计数器
+func NewClassificationCounter() *ClassificationCounter {
+	return &ClassificationCounter{
+		packetTypes:  make(map[string]Traffic),
+		apps:         make(map[string]Traffic),
+		appProtocols: make(map[appDimensionKey]Traffic),
+		appPorts:     make(map[appDimensionKey]Traffic),
+		ports:        make(map[nonStandardKey]Traffic),
+		services:     make(map[nonStandardKey]string),
+	}
+}
+
+// AddTotals 累加未识别应用和非标准端口应用的总流量，窗口内所有数据包都经过数据包类型计入总数
+func (c *ClassificationCounter) AddTotals(unknown, nonStandard Traffic) {
+	c.unknown.Add(unknown)
+	c.nonStandard.Add(nonStandard)
+}
+
+// AddPacketType 累加一个数据包类型的流量
+func (c *ClassificationCounter) AddPacketType(packetType string, traffic Traffic) {
+	addTraffic(c.packetTypes, packetType, traffic.Packets, traffic.Bytes)
+}
+
+// AddProtocol 累加一个应用在一个协议上的流量，应用的总流量由协议交叉统计求和得出
+func (c *ClassificationCounter) AddProtocol(application, protocol string, traffic Traffic) {
+	addTraffic(c.apps, application, traffic.Packets, traffic.Bytes)
+	addTraffic(c.appProtocols, appDimensionKey{application, protocol}, traffic.Packets, traffic.Bytes)
+}
+
+// AddPort 累加一个应用在一个目标端口上的流量
+func (c *ClassificationCounter) AddPort(application string, port uint16, traffic Traffic) {
+	addTraffic(c.appPorts, appDimensionKey{application, strconv.Itoa(int(port))}, traffic.Packets, traffic.Bytes)
+}
+
+// AddNonStandard 累加一个应用在非标准端口上的流量，只用于排行，总流量由AddTotals累加
+func (c *ClassificationCounter) AddNonStandard(application, transport string, port uint16, service string, traffic Traffic) {
+	key := nonStandardKey{application, transport, port}
+	addTraffic(c.ports, key, traffic.Packets, traffic.Bytes)
+	if _, exists := c.services[key]; !exists {
+		c.services[key] = service
+	}
+}
+
+// Apply 把累加结果写入快照的分类统计，百分比以各数据包类型的数据包数之和为总数
+func (c *ClassificationCounter) Apply(s *Snapshot) {
+	total := totalPackets(c.packetTypes)
+	stats := ClassificationStats{
+		UnknownCount:          c.unknown.Packets,
+		UnknownBytes:          c.unknown.Bytes,
+		UnknownPercentage:     percentage(c.unknown.Packets, total),
+		NonStandardCount:      c.nonStandard.Packets,
+		NonStandardBytes:      c.nonStandard.Bytes,
+		NonStandardPercentage: percentage(c.nonStandard.Packets, total),
+	}
+
+	for _, name := range RankTraffic(c.packetTypes, RankByPackets, 0) {
+		t := c.packetTypes[name]
+		stats.PacketTypes = append(stats.PacketTypes, PacketTypeCount{Name: name, Count: t.Packets, Bytes: t.Bytes, Percentage: percentage(t.Packets, total)})
+	}
+
+	// 交叉统计只保留流量最大的应用，每个应用内按流量排序
+	for _, app := range RankTraffic(c.apps, RankByPackets, classificationTopApps) {
+		appTotal := c.apps[app].Packets
+		stats.AppProtocols = append(stats.AppProtocols, rankDimensions(c.appProtocols, app, appTotal, 0)...)
+		stats.AppPorts = append(stats.AppPorts, rankDimensions(c.appPorts, app, appTotal, classificationTopPortsPerApp)...)
+	}
+
+	keys := make([]nonStandardKey, 0, len(c.ports))
+	for key := range c.ports {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b nonStandardKey) int {
+		return cmp.Or(
+			compareTraffic(c.ports[a], c.ports[b], RankByPackets),
+			cmp.Compare(a.application, b.application),
+			cmp.Compare(a.transport, b.transport),
+			cmp.Compare(a.port, b.port),
+		)
+	})
+	for _, key := range keys[:min(len(keys), classificationTopNonStandard)] {
+		t := c.ports[key]
+		stats.NonStandard = append(stats.NonStandard, NonStandardPortCount{
+			Application: key.application,
+			Transport:   key.transport,
+			Port:        key.port,
+			Service:     c.services[key],
+			Count:       t.Packets,
+			Bytes:       t.Bytes,
+		})
+	}
+
+	s.SetClassificationStats(stats)
+}
+
+// rankDimensions 返回一个应用在交叉统计中的前n项(n为0时返回全部)，百分比以应用的数据包数为总数
+func rankDimensions(counts map[appDimensionKey]Traffic, application string, appTotal uint64, n int) []AppDimensionCount {
+	values := make(map[string]Traffic)
+	for key, t := range counts {
+		if key.application == application {
+			values[key.value] = t
+		}
+	}
+
+	var result []AppDimensionCount
+	for _, value := range RankTraffic(values, RankByPackets, n) {
+		t := values[value]
+		result = append(result, AppDimensionCount{
+			Application: application,
+			Value:       value,
+			Count:       t.Packets,
+			Bytes:       t.Bytes,
+			Percentage:  percentage(t.Packets, appTotal),
+		})
+	}
+	return result
+}
@@ -0,0 +1,196 @@
+package models
+
+import (
+	"strconv"
+)
+
+// Direction 流量相对内部网络的方向
+type Direction string
+
+const (
+	DirectionInbound  Direction = "inbound"  // 外部地址到内部地址
+	DirectionOutbound Direction = "outbound" // 内部地址到外部地址
+	DirectionInternal Direction = "internal" // 内部地址之间
+	DirectionExternal Direction = "external" // 外部地址之间，例如经过本网段转发的流量
+	DirectionUnknown  Direction = "unknown"  // 源地址或目标地址为空或无法解析
+)
+
+// directions 所有流量方向，分布按此顺序排列
+var directions = []Direction{DirectionInbound, DirectionOutbound, DirectionInternal, DirectionExternal, DirectionUnknown}
+
+// TalkerRole 方向排行中的地址角色
+type TalkerRole string
+
+const (
+	TalkerSource      TalkerRole = "source"      // 源地址
+	TalkerDestination TalkerRole = "destination" // 目标地址
+)
+
+// 每个方向的排行项数
+const (
+	directionTopTalkers = 5
+	directionTopPorts   = 10
+)
+
+// DirectionStats 按流量方向的统计：各方向总量、热门源和目标地址，以及协议和目标端口分布
+type DirectionStats struct {
+	RankBy     RankBy                    // 地址和目标端口排行的排序依据
+	Directions []DirectionCount          // 各方向统计
+	TopTalkers []DirectionTalker         // 每个方向流量最大的源地址和目标地址(各Top 5)
+	Protocols  []DirectionDimensionCount // 每个方向的协议分布
+	Ports      []DirectionDimensionCount // 每个方向流量最大的目标端口(Top 10)
+}
+
+// DirectionCount 一个流量方向的统计信息
+type DirectionCount struct {
+	Direction  Direction // 流量方向
+	Count      uint64    // 数据包数量
+	Bytes      uint64    // 字节数
+	Percentage float64   // 占比(百分比)
+}
+
+// DirectionTalker 一个方向中的源地址或目标地址及其流量
+type DirectionTalker struct {
+	Direction Direction  // 流量方向
+	Role      TalkerRole // 地址角色
+	Address   string     // IP地址
+	Count     uint64     // 数据包数量
+	Bytes     uint64     // 字节数
+}
+
+// DirectionDimensionCount 一个方向在协议或目标端口上的流量
+type DirectionDimensionCount struct {
+	Direction  Direction // 流量方向
+	Value      string    // 协议名称或目标端口号
+	Count      uint64    // 数据包数量
+	Bytes      uint64    // 字节数
+	Percentage float64   // 占该方向数据包的比例(百分比)
+}
+
+// SetDirectionStats 设置流量方向统计，保留已设置的排序依据
+func (s *Snapshot) SetDirectionStats(stats DirectionStats) {
+	stats.RankBy = s.Direction.RankBy
+	s.Direction = stats
+}
+
+// directionKey 方向统计中各排行和分布的键
+type directionKey struct {
+	direction Direction
+	value     string
+}
+
+// talkerKey 方向排行中地址的键
+type talkerKey struct {
+	direction Direction
+	role      TalkerRole
+	address   string
+}
+
+// DirectionCounter 累加各流量方向的总量、地址、协议和目标端口的流量，最后一次性写入快照
+type DirectionCounter struct {
+	directions map[Direction]Traffic
+	talkers    map[talkerKey]Traffic
+	protocols  map[directionKey]Traffic
+	ports      map[directionKey]Traffic
+}
+
+// NewDirectionCounter 创建空的计数器
+func NewDirectionCounter() *DirectionCounter {
+	return &DirectionCounter{
+		directions: make(map[Direction]Traffic),
+		talkers:    make(map[talkerKey]Traffic),
+		protocols:  make(map[directionKey]Traffic),
+		ports:      make(map[directionKey]Traffic),
+	}
+}
+
+// AddDirection 累加一个方向的总流量，总量与地址、协议和端口分别累加
+func (c *DirectionCounter) AddDirection(direction Direction, traffic Traffic) {
+	addTraffic(c.directions, direction, traffic.Packets, traffic.Bytes)
+}
+
+// AddTalker 累加一个方向中源地址或目标地址的流量，地址为空时忽略
+func (c *DirectionCounter) AddTalker(direction Direction, role TalkerRole, address string, traffic Traffic) {
+	if address == "" {
+		return
+	}
+	addTraffic(c.talkers, talkerKey{direction, role, address}, traffic.Packets, traffic.Bytes)
+}
+
+// AddProtocol 累加一个方向在一个协议上的流量
+func (c *DirectionCounter) AddProtocol(direction Direction, protocol string, traffic Traffic) {
+	addTraffic(c.protocols, directionKey{direction, protocol}, traffic.Packets, traffic.Bytes)
+}
+
+// AddPort 累加一个方向在一个目标端口上的流量
+func (c *DirectionCounter) AddPort(direction Direction, port uint16, traffic Traffic) {
+	addTraffic(c.ports, directionKey{direction, strconv.Itoa(int(port))}, traffic.Packets, traffic.Bytes)
+}
+
+// Apply 把累加结果写入快照的方向统计，排行使用快照中设置的排序依据
+func (c *DirectionCounter) Apply(s *Snapshot) {
+	s.Direction.RankBy = s.Direction.RankBy.OrDefault()
+	rankBy := s.Direction.RankBy
+
+	var stats DirectionStats
+	total := totalPackets(c.directions)
+	for _, direction := range directions {
+		t, exists := c.directions[direction]
+		if !exists {
+			continue
+		}
+		stats.Directions = append(stats.Directions, DirectionCount{
+			Direction:  direction,
+			Count:      t.Packets,
+			Bytes:      t.Bytes,
+			Percentage: percentage(t.Packets, total),
+		})
+
+		for _, role := range []TalkerRole{TalkerSource, TalkerDestination} {
+			addresses := make(map[string]Traffic)
+			for key, traffic := range c.talkers {
+				if key.direction == direction && key.role == role {
+					addresses[key.address] = traffic
+				}
+			}
+			for _, address := range RankTraffic(addresses, rankBy, directionTopTalkers) {
+				at := addresses[address]
+				stats.TopTalkers = append(stats.TopTalkers, DirectionTalker{
+					Direction: direction,
+					Role:      role,
+					Address:   address,
+					Count:     at.Packets,
+					Bytes:     at.Bytes,
+				})
+			}
+		}
+
+		stats.Protocols = append(stats.Protocols, rankDirectionDimensions(c.protocols, direction, t.Packets, RankByPackets, 0)...)
+		stats.Ports = append(stats.Ports, rankDirectionDimensions(c.ports, direction, t.Packets, rankBy, directionTopPorts)...)
+	}
+
+	s.SetDirectionStats(stats)
+}
+
+// rankDirectionDimensions 返回一个方向在协议或目标端口上的前n项(n为0时返回全部)，百分比以该方向的数据包数为总数
+func rankDirectionDimensions(counts map[directionKey]Traffic, direction Direction, directionTotal uint64, by RankBy, n int) []DirectionDimensionCount {
+	values := make(map[string]Traffic)
+	for key, t := range counts {
+		if key.direction == direction {
+			values[key.value] = t
+		}
+	}
+
+	var result []DirectionDimensionCount
+	for _, value := range RankTraffic(values, by, n) {
+		t := values[value]
+		result = append(result, DirectionDimensionCount{
+			Direction:  direction,
+			Value:      value,
+			Count:      t.Packets,
+			Bytes:      t.Bytes,
+			Percentage: percentage(t.Packets, directionTotal),
+		})
+	}
+	return result
+}
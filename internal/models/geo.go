@@ -0,0 +1,217 @@
+package models
+
+import (
+	"cmp"
+	"slices"
+)
+
+// geoTopCount 每个角色的国家和自治系统排行项数
+const geoTopCount = 10
+
+// GeoStats 按国家和自治系统的流量统计，以及各排行中地址的地理位置和自治系统
+//
+// 地址由本地mmdb文件离线解析，不在数据库中的地址（例如私有地址）不计入国家和自治系统排行。
+type GeoStats struct {
+	RankBy       RankBy         // 国家和自治系统排行的排序依据
+	TopCountries []CountryCount // 每个角色流量最大的国家(各Top 10)
+	TopASNs      []ASNCount     // 每个角色流量最大的自治系统(各Top 10)
+	Locations    []IPLocation   // 源IP、目标IP、会话、五元组流和流量方向排行中地址的解析结果，按地址排列
+}
+
+// IPLocation 一个地址的国家、城市和自治系统，数据库中没有的字段为空
+type IPLocation struct {
+	Address      string // IP地址
+	CountryCode  string // ISO 3166-1国家代码，例如 CN、US
+	Country      string // 国家英文名称
+	City         string // 城市英文名称
+	ASN          uint32 // 自治系统编号
+	Organization string // 自治系统所属组织
+}
+
+// Resolved 判断地址是否解析到了国家或自治系统
+func (l IPLocation) Resolved() bool {
+	return l.CountryCode != "" || l.ASN != 0
+}
+
+// CountryCount 一个国家作为源或目标的流量
+type CountryCount struct {
+	Role        TalkerRole // 源地址或目标地址
+	CountryCode string     // ISO 3166-1国家代码
+	Country     string     // 国家英文名称
+	Count       uint64     // 数据包数量
+	Bytes       uint64     // 字节数
+	Percentage  float64    // 占窗口内所有数据包的比例(百分比)
+}
+
+// ASNCount 一个自治系统作为源或目标的流量
+type ASNCount struct {
+	Role         TalkerRole // 源地址或目标地址
+	ASN          uint32     // 自治系统编号
+	Organization string     // 自治系统所属组织
+	Count        uint64     // 数据包数量
+	Bytes        uint64     // 字节数
+	Percentage   float64    // 占窗口内所有数据包的比例(百分比)
+}
+
+// SetGeoStats 设置国家和自治系统排行，保留已设置的排序依据和地址解析结果
+func (s *Snapshot) SetGeoStats(topCountries []CountryCount, topASNs []ASNCount) {
+	s.Geo.TopCountries = topCountries
+	s.Geo.TopASNs = topASNs
+}
+
+// SetGeoLocations 设置排行中地址的解析结果，按地址排列
+func (s *Snapshot) SetGeoLocations(locations []IPLocation) {
+	slices.SortFunc(locations, func(a, b IPLocation) int { return cmp.Compare(a.Address, b.Address) })
+	s.Geo.Locations = locations
+}
+
+// RankedAddresses 返回源IP、目标IP、会话、五元组流和流量方向排行中出现的所有地址，去重后按地址排列
+func (s *Snapshot) RankedAddresses() []string {
+	seen := make(map[string]bool)
+	add := func(addresses ...string) {
+		for _, address := range addresses {
+			if address != "" {
+				seen[address] = true
+			}
+		}
+	}
+
+	for _, pair := range s.IP.TopPairs {
+		if pair.Count > 0 {
+			add(pair.SourceIP)
+		}
+	}
+	for _, dest := range s.Destination.TopDestinations {
+		add(dest.DestinationIP)
+	}
+	for _, conv := range s.Conversation.TopConversations {
+		add(conv.SourceIP, conv.DestinationIP)
+	}
+	for _, flow := range s.Flow.TopFlows {
+		add(flow.SourceIP, flow.DestinationIP)
+	}
+	for _, talker := range s.Direction.TopTalkers {
+		add(talker.Address)
+	}
+
+	addresses := make([]string, 0, len(seen))
+	for address := range seen {
+		addresses = append(addresses, address)
+	}
+	slices.Sort(addresses)
+	return addresses
+}
+
+// GeoCounter 按角色累加每个国家和自治系统的流量，最后一次性写入快照
+type GeoCounter struct {
+	countries     map[TalkerRole]map[string]Traffic
+	countryNames  map[string]string
+	asns          map[TalkerRole]map[uint32]Traffic
+	organizations map[uint32]string
+}
+
+// NewGeoCounter 创建空的计数器
+func NewGeoCounter() *GeoCounter {
+	return &GeoCounter{
+		countries:     make(map[TalkerRole]map[string]Traffic),
+		countryNames:  make(map[string]string),
+		asns:          make(map[TalkerRole]map[uint32]Traffic),
+		organizations: make(map[uint32]string),
+	}
+}
+
+// AddLocation 把一个地址的流量累加到它所在的国家和自治系统，没有解析到的部分忽略
+func (c *GeoCounter) AddLocation(role TalkerRole, location IPLocation, traffic Traffic) {
+	if location.CountryCode != "" {
+		c.AddCountry(role, location.CountryCode, location.Country, traffic)
+	}
+	if location.ASN != 0 {
+		c.AddASN(role, location.ASN, location.Organization, traffic)
+	}
+}
+
+// AddCountry 累加一个国家的流量
+func (c *GeoCounter) AddCountry(role TalkerRole, code, name string, traffic Traffic) {
+	countries, exists := c.countries[role]
+	if !exists {
+		countries = make(map[string]Traffic)
+		c.countries[role] = countries
+	}
+	addTraffic(countries, code, traffic.Packets, traffic.Bytes)
+	if name != "" {
+		c.countryNames[code] = name
+	}
+}
+
+// AddASN 累加一个自治系统的流量
+func (c *GeoCounter) AddASN(role TalkerRole, asn uint32, organization string, traffic Traffic) {
+	asns, exists := c.asns[role]
+	if !exists {
+		asns = make(map[uint32]Traffic)
+		c.asns[role] = asns
+	}
+	addTraffic(asns, asn, traffic.Packets, traffic.Bytes)
+	if organization != "" {
+		c.organizations[asn] = organization
+	}
+}
+
+// Apply 把累加结果写入快照的国家和自治系统排行，排行使用快照中设置的排序依据，
+// 百分比以快照的总数据包数为总数
+func (c *GeoCounter) Apply(s *Snapshot) {
+	s.Geo.RankBy = s.Geo.RankBy.OrDefault()
+	rankBy := s.Geo.RankBy
+	total := s.Basic.TotalPackets
+
+	var topCountries []CountryCount
+	var topASNs []ASNCount
+	for _, role := range []TalkerRole{TalkerSource, TalkerDestination} {
+		countries := c.countries[role]
+		for _, code := range RankTraffic(countries, rankBy, geoTopCount) {
+			t := countries[code]
+			topCountries = append(topCountries, CountryCount{
+				Role:        role,
+				CountryCode: code,
+				Country:     c.countryNames[code],
+				Count:       t.Packets,
+				Bytes:       t.Bytes,
+				Percentage:  percentage(t.Packets, total),
+			})
+		}
+
+		asns := c.asns[role]
+		for _, asn := range RankTraffic(asns, rankBy, geoTopCount) {
+			t := asns[asn]
+			topASNs = append(topASNs, ASNCount{
+				Role:         role,
+				ASN:          asn,
+				Organization: c.organizations[asn],
+				Count:        t.Packets,
+				Bytes:        t.Bytes,
+				Percentage:   percentage(t.Packets, total),
+			})
+		}
+	}
+
+	s.SetGeoStats(topCountries, topASNs)
+}
+
+// mergeGeoLocations 合并各快照的地址解析结果，只保留合并后仍在排行中的地址
+func mergeGeoLocations(parts []*Snapshot, merged *Snapshot) []IPLocation {
+	locations := make(map[string]IPLocation)
+	for _, part := range parts {
+		for _, location := range part.Geo.Locations {
+			if _, exists := locations[location.Address]; !exists {
+				locations[location.Address] = location
+			}
+		}
+	}
+
+	var result []IPLocation
+	for _, address := range merged.RankedAddresses() {
+		if location, exists := locations[address]; exists {
+			result = append(result, location)
+		}
+	}
+	return result
+}
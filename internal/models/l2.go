@@ -0,0 +1,157 @@
+package models
+
+import (
+	"net"
+	"slices"
+	"strings"
+)
+
+// MACCast 目标MAC地址的类型：广播、组播或单播
+type MACCast string
+
+const (
+	MACCastBroadcast MACCast = "broadcast" // 广播地址 ff:ff:ff:ff:ff:ff
+	MACCastMulticast MACCast = "multicast" // 组播地址，第一个字节的最低位为1
+	MACCastUnicast   MACCast = "unicast"   // 单播地址
+	MACCastUnknown   MACCast = "unknown"   // 为空或无法解析的地址
+)
+
+// macCasts 所有目标MAC地址类型，分布按此顺序排列
+var macCasts = []MACCast{MACCastBroadcast, MACCastMulticast, MACCastUnicast, MACCastUnknown}
+
+// ClassifyMAC 根据目标MAC地址判断广播、组播或单播
+func ClassifyMAC(address string) MACCast {
+	mac, err := net.ParseMAC(strings.TrimSpace(address))
+	if err != nil || len(mac) == 0 {
+		return MACCastUnknown
+	}
+	if slices.Equal(mac, net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}) {
+		return MACCastBroadcast
+	}
+	if mac[0]&0x01 != 0 {
+		return MACCastMulticast
+	}
+	return MACCastUnicast
+}
+
+// NormalizeMAC 把MAC地址统一为小写冒号分隔的格式，无法解析时原样返回
+func NormalizeMAC(address string) string {
+	mac, err := net.ParseMAC(strings.TrimSpace(address))
+	if err != nil {
+		return address
+	}
+	return mac.String()
+}
+
+// L2Stats 二层统计：EtherType分布、目标MAC地址类型分布和热门目标MAC地址
+type L2Stats struct {
+	RankBy          RankBy                // 目标MAC地址排行的排序依据
+	EtherTypes      []EtherTypeCount      // 各EtherType统计
+	Casts           []MACCastCount        // 广播、组播和单播统计
+	TopDestinations []DestinationMACCount // 流量最大的目标MAC地址(Top 5)
+}
+
+// EtherTypeCount EtherType及其统计信息
+type EtherTypeCount struct {
+	EtherType  uint16  // EtherType值
+	Name       string  // EtherType名称，例如 IPv4、ARP
+	Count      uint64  // 数据包数量
+	Bytes      uint64  // 字节数
+	Percentage float64 // 占比(百分比)
+}
+
+// MACCastCount 一种目标MAC地址类型及其统计信息
+type MACCastCount struct {
+	Cast       MACCast // 目标MAC地址类型
+	Count      uint64  // 数据包数量
+	Bytes      uint64  // 字节数
+	Percentage float64 // 占比(百分比)
+}
+
+// DestinationMACCount 目标MAC地址及其流量
+type DestinationMACCount struct {
+	Address string  // 目标MAC地址
+	Cast    MACCast // 目标MAC地址类型
+	Count   uint64  // 数据包数量
+	Bytes   uint64  // 字节数
+}
+
+// SetL2Stats 设置二层统计，保留已设置的排序依据
+func (s *Snapshot) SetL2Stats(etherTypes []EtherTypeCount, casts []MACCastCount, top []DestinationMACCount) {
+	s.L2 = L2Stats{
+		RankBy:          s.L2.RankBy,
+		EtherTypes:      etherTypes,
+		Casts:           casts,
+		TopDestinations: top,
+	}
+}
+
+// L2Counter 累加EtherType、目标MAC地址类型和目标MAC地址的数据包数和字节数，最后一次性写入快照
+type L2Counter struct {
+	etherTypes   map[uint16]Traffic
+	names        map[uint16]string
+	casts        map[MACCast]Traffic
+	destinations map[string]Traffic
+}
+
+// NewL2Counter 创建空的计数器
+func NewL2Counter() *L2Counter {
+	return &L2Counter{
+		etherTypes:   make(map[uint16]Traffic),
+		names:        make(map[uint16]string),
+		casts:        make(map[MACCast]Traffic),
+		destinations: make(map[string]Traffic),
+	}
+}
+
+// AddEtherType 累加一个EtherType的流量，名称以第一次出现时为准
+func (c *L2Counter) AddEtherType(etherType uint16, name string, traffic Traffic) {
+	addTraffic(c.etherTypes, etherType, traffic.Packets, traffic.Bytes)
+	if _, exists := c.names[etherType]; !exists {
+		c.names[etherType] = name
+	}
+}
+
+// AddCast 累加一种目标MAC地址类型的流量
+func (c *L2Counter) AddCast(cast MACCast, traffic Traffic) {
+	addTraffic(c.casts, cast, traffic.Packets, traffic.Bytes)
+}
+
+// AddDestination 累加一个目标MAC地址的流量，只用于排行，不计入地址类型分布
+func (c *L2Counter) AddDestination(address string, traffic Traffic) {
+	addTraffic(c.destinations, NormalizeMAC(address), traffic.Packets, traffic.Bytes)
+}
+
+// Apply 把累加结果写入快照的二层统计，目标MAC地址排行使用快照中设置的排序依据取前n项
+func (c *L2Counter) Apply(s *Snapshot, n int) {
+	s.L2.RankBy = s.L2.RankBy.OrDefault()
+
+	var etherTypes []EtherTypeCount
+	total := totalPackets(c.etherTypes)
+	for _, etherType := range RankTraffic(c.etherTypes, RankByPackets, 0) {
+		t := c.etherTypes[etherType]
+		etherTypes = append(etherTypes, EtherTypeCount{
+			EtherType:  etherType,
+			Name:       c.names[etherType],
+			Count:      t.Packets,
+			Bytes:      t.Bytes,
+			Percentage: percentage(t.Packets, total),
+		})
+	}
+
+	var casts []MACCastCount
+	total = totalPackets(c.casts)
+	for _, cast := range macCasts {
+		if t, exists := c.casts[cast]; exists {
+			casts = append(casts, MACCastCount{Cast: cast, Count: t.Packets, Bytes: t.Bytes, Percentage: percentage(t.Packets, total)})
+		}
+	}
+
+	var top []DestinationMACCount
+	for _, address := range RankTraffic(c.destinations, s.L2.RankBy, n) {
+		t := c.destinations[address]
+		top = append(top, DestinationMACCount{Address: address, Cast: ClassifyMAC(address), Count: t.Packets, Bytes: t.Bytes})
+	}
+
+	s.SetL2Stats(etherTypes, casts, top)
+}
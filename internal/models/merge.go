@@ -0,0 +1,295 @@
+package models
+
+import (
+	"strconv"
+	"time"
+)
+
+// MergeSnapshots 把多个互不重叠的快照合并为覆盖 [start, end) 的一个快照
+//
+// 合并规则：
+//   - 数据包数、字节数等计数直接求和
+//   - 协议、TCP标志、应用和服务分布按名称求和后重新计算百分比
+//   - Top N 排行按键求和数据包数和字节数，再按排序依据重新排序取前N项；
+//     各快照排行之外的数据已经丢失，因此合并后的排行是近似值
+//   - 按传输层协议区分的端口排行按角色、协议和端口求和，与端口排行使用相同的排序依据
+//   - EtherType和目标MAC地址类型分布按值求和，目标MAC地址排行按地址求和
+//   - 流量分类的未识别和非标准端口总量、数据包类型分布直接求和，应用交叉统计和非标准端口排行按键求和
+//   - 目标IP、会话和五元组流排行同样按键求和，第一次和最后一次出现的时间取各快照的并集
+//   - 数据包大小直方图按协议和区间求和，百分位数在区间内插值估算
+//   - 平均速率由采集了吞吐速率的各段的扫描总量和时间之和得出，峰值速率取最大值，微突发数量求和、排行取并集
+//   - 各流量方向的总量和协议分布直接求和，方向内的地址和目标端口排行按键求和
+//   - 前缀排行按角色、地址族、前缀长度和前缀求和
+//   - 国家和自治系统排行按角色和键求和，地址解析结果只保留合并后仍在排行中的地址
+//   - 唯一数量无法在没有明细的情况下求并集，取各快照中的最大值作为下界
+//
+// 调用方需要保证传入的快照互不重叠：同一来源的快照时间上不重叠，或同一窗口的快照来自
+// 观察不同流量的传感器，否则计数会重复累加。
+func MergeSnapshots(labels Labels, profile string, start, end time.Time, parts []*Snapshot) *Snapshot {
+	merged := NewSnapshotForWindow(labels, profile, start, end)
+
+	ipTraffic := make(map[string]Traffic)
+	macTraffic := make(map[string]Traffic)
+	portTraffic := make(map[uint16]Traffic)
+	transportPorts := NewTransportPortCounter()
+	l2 := NewL2Counter()
+	classification := NewClassificationCounter()
+	protocolTraffic := make(map[string]Traffic)
+	flagTraffic := make(map[string]Traffic)
+	appTraffic := make(map[string]Traffic)
+	serviceTraffic := make(map[string]Traffic)
+	var destinations []DestinationIPCount
+	var conversations []Conversation
+	var flows []FlowTuple
+	sizeHistograms := make(map[string][]PacketSizeHistogram)
+	var throughput []ThroughputStats
+	direction := NewDirectionCounter()
+	prefix := NewPrefixCounter()
+	geo := NewGeoCounter()
+
+	for _, part := range parts {
+		merged.Basic.TotalPackets += part.Basic.TotalPackets
+		merged.Basic.TotalBytes += part.Basic.TotalBytes
+
+		merged.IP.UniqueSourceCount = max(merged.IP.UniqueSourceCount, part.IP.UniqueSourceCount)
+		merged.MAC.UniqueSourceCount = max(merged.MAC.UniqueSourceCount, part.MAC.UniqueSourceCount)
+		merged.Port.UniqueDestCount = max(merged.Port.UniqueDestCount, part.Port.UniqueDestCount)
+		merged.Destination.UniqueDestCount = max(merged.Destination.UniqueDestCount, part.Destination.UniqueDestCount)
+
+		// 排序依据沿用第一个设置了排序依据的快照
+		if merged.IP.RankBy == "" {
+			merged.IP.RankBy = part.IP.RankBy
+		}
+		if merged.Port.RankBy == "" {
+			merged.Port.RankBy = part.Port.RankBy
+		}
+		if merged.L2.RankBy == "" {
+			merged.L2.RankBy = part.L2.RankBy
+		}
+		if merged.Direction.RankBy == "" {
+			merged.Direction.RankBy = part.Direction.RankBy
+		}
+		if merged.Prefix.RankBy == "" {
+			merged.Prefix.RankBy = part.Prefix.RankBy
+		}
+		if merged.Geo.RankBy == "" {
+			merged.Geo.RankBy = part.Geo.RankBy
+		}
+		if merged.Destination.RankBy == "" {
+			merged.Destination.RankBy = part.Destination.RankBy
+		}
+		if merged.Conversation.RankBy == "" {
+			merged.Conversation.RankBy = part.Conversation.RankBy
+		}
+		if merged.Flow.RankBy == "" {
+			merged.Flow.RankBy = part.Flow.RankBy
+		}
+
+		for _, pair := range part.IP.TopPairs {
+			if pair.Count > 0 {
+				addTraffic(ipTraffic, pair.SourceIP, pair.Count, pair.Bytes)
+			}
+		}
+		for _, mac := range part.MAC.TopSources {
+			if mac.Count > 0 {
+				addTraffic(macTraffic, mac.Address, mac.Count, 0)
+			}
+		}
+		for _, pair := range part.Port.TopPairs {
+			if pair.Count > 0 {
+				addTraffic(portTraffic, pair.DestinationPort, pair.Count, pair.Bytes)
+			}
+		}
+		for _, port := range part.TransportPort.Ports {
+			transportPorts.Add(port.Role, port.Transport, port.Port, port.Service, Traffic{Packets: port.Count, Bytes: port.Bytes})
+		}
+		for _, etherType := range part.L2.EtherTypes {
+			l2.AddEtherType(etherType.EtherType, etherType.Name, Traffic{Packets: etherType.Count, Bytes: etherType.Bytes})
+		}
+		for _, cast := range part.L2.Casts {
+			l2.AddCast(cast.Cast, Traffic{Packets: cast.Count, Bytes: cast.Bytes})
+		}
+		for _, mac := range part.L2.TopDestinations {
+			l2.AddDestination(mac.Address, Traffic{Packets: mac.Count, Bytes: mac.Bytes})
+		}
+		classification.AddTotals(
+			Traffic{Packets: part.Classification.UnknownCount, Bytes: part.Classification.UnknownBytes},
+			Traffic{Packets: part.Classification.NonStandardCount, Bytes: part.Classification.NonStandardBytes})
+		for _, packetType := range part.Classification.PacketTypes {
+			classification.AddPacketType(packetType.Name, Traffic{Packets: packetType.Count, Bytes: packetType.Bytes})
+		}
+		for _, app := range part.Classification.AppProtocols {
+			classification.AddProtocol(app.Application, app.Value, Traffic{Packets: app.Count, Bytes: app.Bytes})
+		}
+		for _, app := range part.Classification.AppPorts {
+			if port, err := strconv.ParseUint(app.Value, 10, 16); err == nil {
+				classification.AddPort(app.Application, uint16(port), Traffic{Packets: app.Count, Bytes: app.Bytes})
+			}
+		}
+		for _, port := range part.Classification.NonStandard {
+			classification.AddNonStandard(port.Application, port.Transport, port.Port, port.Service, Traffic{Packets: port.Count, Bytes: port.Bytes})
+		}
+		for _, proto := range part.Protocol.Protocols {
+			addTraffic(protocolTraffic, proto.Name, proto.Count, proto.Bytes)
+		}
+		for _, flag := range part.TCPFlags.Flags {
+			addTraffic(flagTraffic, flag.Flag, flag.Count, flag.Bytes)
+		}
+		for _, app := range part.Application.Apps {
+			addTraffic(appTraffic, app.Name, app.Count, app.Bytes)
+		}
+		for _, service := range part.Service.Services {
+			addTraffic(serviceTraffic, service.Name, service.Count, service.Bytes)
+		}
+		sizeHistograms[AllProtocols] = append(sizeHistograms[AllProtocols], part.PacketSize.All)
+		for _, h := range part.PacketSize.Protocols {
+			sizeHistograms[h.Protocol] = append(sizeHistograms[h.Protocol], h)
+		}
+		throughput = append(throughput, part.Throughput)
+		for _, d := range part.Direction.Directions {
+			direction.AddDirection(d.Direction, Traffic{Packets: d.Count, Bytes: d.Bytes})
+		}
+		for _, talker := range part.Direction.TopTalkers {
+			direction.AddTalker(talker.Direction, talker.Role, talker.Address, Traffic{Packets: talker.Count, Bytes: talker.Bytes})
+		}
+		for _, count := range part.Direction.Protocols {
+			direction.AddProtocol(count.Direction, count.Value, Traffic{Packets: count.Count, Bytes: count.Bytes})
+		}
+		for _, count := range part.Direction.Ports {
+			addTraffic(direction.ports, directionKey{count.Direction, count.Value}, count.Count, count.Bytes)
+		}
+		for _, count := range part.Prefix.TopSources {
+			prefix.Add(TalkerSource, count.Family, count.Length, count.Prefix, Traffic{Packets: count.Count, Bytes: count.Bytes})
+		}
+		for _, count := range part.Prefix.TopDestinations {
+			prefix.Add(TalkerDestination, count.Family, count.Length, count.Prefix, Traffic{Packets: count.Count, Bytes: count.Bytes})
+		}
+		for _, count := range part.Geo.TopCountries {
+			geo.AddCountry(count.Role, count.CountryCode, count.Country, Traffic{Packets: count.Count, Bytes: count.Bytes})
+		}
+		for _, count := range part.Geo.TopASNs {
+			geo.AddASN(count.Role, count.ASN, count.Organization, Traffic{Packets: count.Count, Bytes: count.Bytes})
+		}
+		destinations = append(destinations, part.Destination.TopDestinations...)
+		conversations = append(conversations, part.Conversation.TopConversations...)
+		flows = append(flows, part.Flow.TopFlows...)
+	}
+
+	// 合并后的排行，按各快照的排序依据重新排序
+	merged.IP.RankBy = merged.IP.RankBy.OrDefault()
+	merged.Port.RankBy = merged.Port.RankBy.OrDefault()
+
+	var topIPs []IPAddressPair
+	for _, ip := range RankTraffic(ipTraffic, merged.IP.RankBy, 5) {
+		topIPs = append(topIPs, IPAddressPair{SourceIP: ip, Count: ipTraffic[ip].Packets, Bytes: ipTraffic[ip].Bytes})
+	}
+	merged.SetIPStats(merged.IP.UniqueSourceCount, topIPs)
+
+	var topMACs []MACAddressCount
+	for _, mac := range RankTraffic(macTraffic, RankByPackets, 5) {
+		topMACs = append(topMACs, MACAddressCount{Address: mac, Count: macTraffic[mac].Packets})
+	}
+	merged.SetMACStats(merged.MAC.UniqueSourceCount, topMACs)
+
+	var topPorts []PortPair
+	for _, port := range RankTraffic(portTraffic, merged.Port.RankBy, 5) {
+		topPorts = append(topPorts, PortPair{DestinationPort: port, Count: portTraffic[port].Packets, Bytes: portTraffic[port].Bytes})
+	}
+	merged.SetPortStats(merged.Port.UniqueDestCount, topPorts)
+	merged.SetTransportPortStats(transportPorts.Top(merged.Port.RankBy, 5))
+
+	// 合并后的分布，百分比按合并后的总数重新计算
+	var protocols []ProtocolCount
+	total := totalPackets(protocolTraffic)
+	for _, name := range RankTraffic(protocolTraffic, RankByPackets, 0) {
+		t := protocolTraffic[name]
+		protocols = append(protocols, ProtocolCount{Name: name, Count: t.Packets, Bytes: t.Bytes, Percentage: percentage(t.Packets, total)})
+	}
+	merged.SetProtocolStats(protocols)
+
+	var flags []TCPFlagCount
+	total = totalPackets(flagTraffic)
+	for _, flag := range RankTraffic(flagTraffic, RankByPackets, 0) {
+		t := flagTraffic[flag]
+		flags = append(flags, TCPFlagCount{Flag: flag, Count: t.Packets, Bytes: t.Bytes, Percentage: percentage(t.Packets, total)})
+	}
+	merged.SetTCPFlagsStats(flags)
+
+	var apps []ApplicationCount
+	total = totalPackets(appTraffic)
+	for _, name := range RankTraffic(appTraffic, RankByPackets, 0) {
+		t := appTraffic[name]
+		apps = append(apps, ApplicationCount{Name: name, Count: t.Packets, Bytes: t.Bytes, Percentage: percentage(t.Packets, total)})
+	}
+	merged.SetApplicationStats(apps)
+
+	var services []ServiceCount
+	total = totalPackets(serviceTraffic)
+	for _, name := range RankTraffic(serviceTraffic, RankByPackets, 0) {
+		t := serviceTraffic[name]
+		services = append(services, ServiceCount{Name: name, Count: t.Packets, Bytes: t.Bytes, Percentage: percentage(t.Packets, total)})
+	}
+	merged.SetServiceStats(services)
+
+	l2.Apply(merged, 5)
+
+	var sizeProtocols []PacketSizeHistogram
+	for protocol, histograms := range sizeHistograms {
+		if protocol != AllProtocols {
+			sizeProtocols = append(sizeProtocols, mergeSizeHistograms(protocol, histograms))
+		}
+	}
+	sortSizeHistograms(sizeProtocols)
+	merged.SetPacketSizeStats(mergeSizeHistograms(AllProtocols, sizeHistograms[AllProtocols]), sizeProtocols)
+	classification.Apply(merged)
+	merged.SetThroughputStats(mergeThroughput(throughput))
+	direction.Apply(merged)
+	prefix.Apply(merged)
+	merged.Prefix.Unique = mergePrefixUnique(parts)
+
+	// 目标IP、会话和五元组流排行，出现时间取各快照的并集
+	merged.Destination.RankBy = merged.Destination.RankBy.OrDefault()
+	merged.Conversation.RankBy = merged.Conversation.RankBy.OrDefault()
+	merged.Flow.RankBy = merged.Flow.RankBy.OrDefault()
+
+	merged.SetDestinationStats(merged.Destination.UniqueDestCount, mergeTalkers(destinations,
+		func(d DestinationIPCount) string { return d.DestinationIP },
+		func(d *DestinationIPCount) *TalkerTraffic { return &d.TalkerTraffic },
+		merged.Destination.RankBy, 5))
+	merged.SetConversationStats(mergeTalkers(conversations, conversationKey,
+		func(c *Conversation) *TalkerTraffic { return &c.TalkerTraffic },
+		merged.Conversation.RankBy, 5))
+	merged.SetFlowStats(mergeTalkers(flows, flowTupleKey,
+		func(f *FlowTuple) *TalkerTraffic { return &f.TalkerTraffic },
+		merged.Flow.RankBy, 5))
+
+	// 地址解析结果依赖合并后的排行
+	geo.Apply(merged)
+	merged.SetGeoLocations(mergeGeoLocations(parts, merged))
+
+	return merged
+}
+
+// addTraffic 把一个键的数据包数和字节数累加到traffic中
+func addTraffic[K comparable](traffic map[K]Traffic, key K, packets, bytes uint64) {
+	t := traffic[key]
+	t.Add(Traffic{Packets: packets, Bytes: bytes})
+	traffic[key] = t
+}
+
+// totalPackets 计算所有键的数据包数之和
+func totalPackets[K comparable](traffic map[K]Traffic) uint64 {
+	var total uint64
+	for _, t := range traffic {
+		total += t.Packets
+	}
+	return total
+}
+
+// percentage 计算占比(百分比)，总数为0时返回0
+func percentage(count, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(count) * 100 / float64(total)
+}
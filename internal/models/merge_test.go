@@ -0,0 +1,121 @@
+package models
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// testPart 创建一个覆盖 [start, start+d) 的快照
+func testPart(start time.Time, d time.Duration) *Snapshot {
+	return NewSnapshotForWindow(Labels{Sensor: "edge-1"}, "default", start, start.Add(d))
+}
+
+func TestMergeSnapshots(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	a := testPart(start, 30*time.Second)
+	a.Basic.TotalPackets, a.Basic.TotalBytes = 300, 30000
+	a.SetIPStats(4, []IPAddressPair{
+		{SourceIP: "10.0.0.1", Count: 200, Bytes: 20000},
+		{SourceIP: "10.0.0.2", Count: 100, Bytes: 10000},
+	})
+	a.SetProtocolStats([]ProtocolCount{
+		{Name: "TCP", Count: 200, Bytes: 20000, Percentage: 66.7},
+		{Name: "UDP", Count: 100, Bytes: 10000, Percentage: 33.3},
+	})
+	a.SetThroughputStats(ThroughputStats{
+		BucketMillis: 100, BurstFactor: 3, Seconds: 30, Packets: 300, Bytes: 30000,
+		PeakPPS: 500, PeakBPS: 400000, PeakAt: start.Add(time.Second),
+		BurstCount: 1, BurstPackets: 50, BurstBytes: 5000,
+		Bursts: []Burst{{Start: start.Add(time.Second), Packets: 50, Bytes: 5000, PPS: 500, BPS: 400000}},
+	})
+
+	b := testPart(start.Add(30*time.Second), 30*time.Second)
+	b.Basic.TotalPackets, b.Basic.TotalBytes = 200, 10000
+	b.SetIPStats(6, []IPAddressPair{
+		{SourceIP: "10.0.0.2", Count: 150, Bytes: 7500},
+		{SourceIP: "10.0.0.3", Count: 50, Bytes: 2500},
+	})
+	b.SetProtocolStats([]ProtocolCount{
+		{Name: "UDP", Count: 200, Bytes: 10000, Percentage: 100},
+	})
+	// 没有采集吞吐速率的快照不参与速率和微突发占比的合并
+	b.SetThroughputStats(ThroughputStats{})
+
+	merged := MergeSnapshots(Labels{Sensor: "edge-1"}, "default", start, start.Add(time.Minute), []*Snapshot{a, b})
+
+	if merged.ID != SnapshotID(Labels{Sensor: "edge-1"}, "default", start, time.Minute) {
+		t.Errorf("ID = %s，需要由合并后的窗口确定", merged.ID)
+	}
+	if !merged.Basic.StartTime.Equal(start) || !merged.Basic.EndTime.Equal(start.Add(time.Minute)) {
+		t.Errorf("窗口 = [%s, %s)", merged.Basic.StartTime, merged.Basic.EndTime)
+	}
+	if merged.Basic.TotalPackets != 500 || merged.Basic.TotalBytes != 40000 {
+		t.Errorf("总量 = %d 个数据包, %d 字节", merged.Basic.TotalPackets, merged.Basic.TotalBytes)
+	}
+
+	// 唯一数量取最大值作为下界
+	if merged.IP.UniqueSourceCount != 6 {
+		t.Errorf("UniqueSourceCount = %d, want 6", merged.IP.UniqueSourceCount)
+	}
+
+	// 排行按键求和后重新排序
+	wantIPs := []IPAddressPair{
+		{SourceIP: "10.0.0.2", Count: 250, Bytes: 17500},
+		{SourceIP: "10.0.0.1", Count: 200, Bytes: 20000},
+		{SourceIP: "10.0.0.3", Count: 50, Bytes: 2500},
+	}
+	for i, want := range wantIPs {
+		if got := merged.IP.TopPairs[i]; got != want {
+			t.Errorf("TopPairs[%d] = %+v, want %+v", i, got, want)
+		}
+	}
+	if merged.IP.RankBy != RankByPackets {
+		t.Errorf("RankBy = %q，未设置时应使用默认值", merged.IP.RankBy)
+	}
+
+	// 分布按名称求和，百分比按合并后的总数重新计算
+	wantProtocols := map[string]ProtocolCount{
+		"UDP": {Name: "UDP", Count: 300, Bytes: 20000, Percentage: 60},
+		"TCP": {Name: "TCP", Count: 200, Bytes: 20000, Percentage: 40},
+	}
+	if len(merged.Protocol.Protocols) != len(wantProtocols) {
+		t.Fatalf("Protocols = %+v", merged.Protocol.Protocols)
+	}
+	if merged.Protocol.Protocols[0].Name != "UDP" {
+		t.Errorf("协议分布应按数据包数从大到小排列: %+v", merged.Protocol.Protocols)
+	}
+	for _, got := range merged.Protocol.Protocols {
+		want := wantProtocols[got.Name]
+		if got.Count != want.Count || got.Bytes != want.Bytes || math.Abs(got.Percentage-want.Percentage) > 1e-9 {
+			t.Errorf("协议 %s = %+v, want %+v", got.Name, got, want)
+		}
+	}
+
+	throughput := merged.Throughput
+	if throughput.BucketMillis != 100 || throughput.Seconds != 30 || throughput.Packets != 300 {
+		t.Errorf("吞吐速率只合并采集了时间桶的快照: %+v", throughput)
+	}
+	if got := throughput.PacketsPerSecond(); got != 10 {
+		t.Errorf("PacketsPerSecond = %v, want 10", got)
+	}
+	if got := throughput.BurstPercentage; math.Abs(got-50.0/3) > 1e-9 {
+		t.Errorf("BurstPercentage = %v, want %v", got, 50.0/3)
+	}
+	if throughput.PeakPPS != 500 || !throughput.PeakAt.Equal(start.Add(time.Second)) || len(throughput.Bursts) != 1 {
+		t.Errorf("峰值和微突发排行 = %+v", throughput)
+	}
+}
+
+func TestMergeSnapshotsEmpty(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	merged := MergeSnapshots(Labels{}, "", start, start.Add(time.Hour), nil)
+
+	if merged.Basic.TotalPackets != 0 || len(merged.Protocol.Protocols) != 0 {
+		t.Errorf("没有快照时合并结果应为空: %+v", merged.Basic)
+	}
+	if merged.Throughput.BucketMillis != 0 || merged.Throughput.PacketsPerSecond() != 0 {
+		t.Errorf("没有快照时不应有吞吐速率: %+v", merged.Throughput)
+	}
+}
@@ -0,0 +1,261 @@
+package models
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strconv"
+)
+
+// AllProtocols 包含所有协议数据包的直方图使用的协议名称
+const AllProtocols = "all"
+
+// SizeBucket 数据包大小直方图的一个区间，包含上下界；Upper为0表示没有上界
+type SizeBucket struct {
+	Lower uint16
+	Upper uint16
+}
+
+// PacketSizeBuckets 固定的数据包大小区间，1501以上为超过以太网标准MTU的巨型帧
+var PacketSizeBuckets = []SizeBucket{
+	{0, 64},
+	{65, 128},
+	{129, 256},
+	{257, 512},
+	{513, 1024},
+	{1025, 1500},
+	{1501, 0},
+}
+
+// Label 返回区间的名称，例如 65-128、1501+
+func (b SizeBucket) Label() string {
+	if b.Upper == 0 {
+		return strconv.Itoa(int(b.Lower)) + "+"
+	}
+	return strconv.Itoa(int(b.Lower)) + "-" + strconv.Itoa(int(b.Upper))
+}
+
+// contains 判断数据包大小是否在区间内
+func (b SizeBucket) contains(size uint16) bool {
+	return size >= b.Lower && (b.Upper == 0 || size <= b.Upper)
+}
+
+// sizeBucketIndex 返回数据包大小所在区间的下标
+func sizeBucketIndex(size uint16) int {
+	for i, bucket := range PacketSizeBuckets {
+		if bucket.contains(size) {
+			return i
+		}
+	}
+	return len(PacketSizeBuckets) - 1
+}
+
+// PacketSizeStats 数据包大小统计：所有数据包以及每个协议的直方图
+type PacketSizeStats struct {
+	All       PacketSizeHistogram   // 所有数据包，协议名称为all
+	Protocols []PacketSizeHistogram // 各协议，按数据包数排列
+}
+
+// PacketSizeHistogram 一组数据包的大小分布
+type PacketSizeHistogram struct {
+	Protocol string                  // 协议名称，所有数据包为all
+	Count    uint64                  // 数据包数量
+	Bytes    uint64                  // 字节数
+	Min      uint16                  // 最小数据包大小
+	Max      uint16                  // 最大数据包大小
+	Mean     float64                 // 平均数据包大小
+	P50      uint16                  // 数据包大小的50百分位数
+	P90      uint16                  // 数据包大小的90百分位数
+	P99      uint16                  // 数据包大小的99百分位数
+	Buckets  []PacketSizeBucketCount // 各区间统计，与PacketSizeBuckets一一对应
+}
+
+// PacketSizeBucketCount 一个数据包大小区间的统计信息
+type PacketSizeBucketCount struct {
+	Bucket     string  // 区间名称，例如 65-128
+	Lower      uint16  // 区间下界
+	Upper      uint16  // 区间上界，0表示没有上界
+	Count      uint64  // 数据包数量
+	Bytes      uint64  // 字节数
+	Percentage float64 // 占比(百分比)
+}
+
+// SetPacketSizeStats 设置数据包大小统计
+func (s *Snapshot) SetPacketSizeStats(all PacketSizeHistogram, protocols []PacketSizeHistogram) {
+	s.PacketSize = PacketSizeStats{
+		All:       all,
+		Protocols: protocols,
+	}
+}
+
+// Histograms 返回所有数据包和各协议的直方图，所有数据包在最前；没有数据包时返回空
+func (s PacketSizeStats) Histograms() []PacketSizeHistogram {
+	if s.All.Count == 0 && len(s.Protocols) == 0 {
+		return nil
+	}
+	return append([]PacketSizeHistogram{s.All}, s.Protocols...)
+}
+
+// PacketSizeCounter 按协议累加每种数据包大小的数量，得出精确的百分位数
+type PacketSizeCounter struct {
+	all       map[uint16]uint64
+	protocols map[string]map[uint16]uint64
+}
+
+// NewPacketSizeCounter 创建空的计数器
+func NewPacketSizeCounter() *PacketSizeCounter {
+	return &PacketSizeCounter{
+		all:       make(map[uint16]uint64),
+		protocols: make(map[string]map[uint16]uint64),
+	}
+}
+
+// Add 累加一个协议中大小为size的packets个数据包
+func (c *PacketSizeCounter) Add(protocol string, size uint16, packets uint64) {
+	c.all[size] += packets
+	sizes, exists := c.protocols[protocol]
+	if !exists {
+		sizes = make(map[uint16]uint64)
+		c.protocols[protocol] = sizes
+	}
+	sizes[size] += packets
+}
+
+// Apply 把累加结果写入快照的数据包大小统计
+func (c *PacketSizeCounter) Apply(s *Snapshot) {
+	var protocols []PacketSizeHistogram
+	for protocol, sizes := range c.protocols {
+		h := newSizeHistogram(sizes)
+		h.Protocol = protocol
+		protocols = append(protocols, h)
+	}
+	sortSizeHistograms(protocols)
+
+	all := newSizeHistogram(c.all)
+	all.Protocol = AllProtocols
+	s.SetPacketSizeStats(all, protocols)
+}
+
+// newSizeHistogram 由每种数据包大小的数量计算直方图、极值、平均值和精确的百分位数
+func newSizeHistogram(sizes map[uint16]uint64) PacketSizeHistogram {
+	h := PacketSizeHistogram{Buckets: emptySizeBuckets()}
+	if len(sizes) == 0 {
+		return h
+	}
+
+	ordered := sortedKeys(sizes)
+	h.Min, h.Max = ordered[0], ordered[len(ordered)-1]
+	for _, size := range ordered {
+		packets := sizes[size]
+		bytes := uint64(size) * packets
+		h.Count += packets
+		h.Bytes += bytes
+		bucket := &h.Buckets[sizeBucketIndex(size)]
+		bucket.Count += packets
+		bucket.Bytes += bytes
+	}
+	h.Mean = float64(h.Bytes) / float64(h.Count)
+
+	// 最近秩法：第p百分位数为累计数量第一次达到 ceil(p% * N) 的数据包大小
+	percentile := func(p float64) uint16 {
+		rank := uint64(math.Ceil(p / 100 * float64(h.Count)))
+		var cumulative uint64
+		for _, size := range ordered {
+			cumulative += sizes[size]
+			if cumulative >= rank {
+				return size
+			}
+		}
+		return h.Max
+	}
+	h.P50, h.P90, h.P99 = percentile(50), percentile(90), percentile(99)
+
+	h.fillBucketPercentages()
+	return h
+}
+
+// mergeSizeHistograms 合并多段时间的同一协议直方图
+//
+// 区间计数、极值和平均值是精确的；原始的大小明细已经丢失，百分位数在所在区间内按线性插值估算。
+func mergeSizeHistograms(protocol string, parts []PacketSizeHistogram) PacketSizeHistogram {
+	merged := PacketSizeHistogram{Protocol: protocol, Buckets: emptySizeBuckets()}
+	for _, part := range parts {
+		if part.Count == 0 {
+			continue
+		}
+		if merged.Count == 0 || part.Min < merged.Min {
+			merged.Min = part.Min
+		}
+		merged.Max = max(merged.Max, part.Max)
+		merged.Count += part.Count
+		merged.Bytes += part.Bytes
+		for _, bucket := range part.Buckets {
+			i := sizeBucketIndex(bucket.Lower)
+			merged.Buckets[i].Count += bucket.Count
+			merged.Buckets[i].Bytes += bucket.Bytes
+		}
+	}
+	if merged.Count == 0 {
+		return merged
+	}
+	merged.Mean = float64(merged.Bytes) / float64(merged.Count)
+
+	percentile := func(p float64) uint16 {
+		rank := p / 100 * float64(merged.Count)
+		var cumulative float64
+		for _, bucket := range merged.Buckets {
+			if bucket.Count == 0 {
+				continue
+			}
+			if cumulative+float64(bucket.Count) >= rank {
+				// 区间边界限制在观察到的最小值和最大值之内
+				lower := float64(max(bucket.Lower, merged.Min))
+				upper := float64(merged.Max)
+				if bucket.Upper != 0 {
+					upper = float64(min(bucket.Upper, merged.Max))
+				}
+				fraction := (rank - cumulative) / float64(bucket.Count)
+				return uint16(math.Round(lower + fraction*(upper-lower)))
+			}
+			cumulative += float64(bucket.Count)
+		}
+		return merged.Max
+	}
+	merged.P50, merged.P90, merged.P99 = percentile(50), percentile(90), percentile(99)
+
+	merged.fillBucketPercentages()
+	return merged
+}
+
+// fillBucketPercentages 计算各区间占直方图数据包数的百分比
+func (h *PacketSizeHistogram) fillBucketPercentages() {
+	for i := range h.Buckets {
+		h.Buckets[i].Percentage = percentage(h.Buckets[i].Count, h.Count)
+	}
+}
+
+// emptySizeBuckets 返回所有区间计数为0的直方图
+func emptySizeBuckets() []PacketSizeBucketCount {
+	buckets := make([]PacketSizeBucketCount, len(PacketSizeBuckets))
+	for i, bucket := range PacketSizeBuckets {
+		buckets[i] = PacketSizeBucketCount{Bucket: bucket.Label(), Lower: bucket.Lower, Upper: bucket.Upper}
+	}
+	return buckets
+}
+
+// sortSizeHistograms 按数据包数从大到小排列各协议的直方图，数量相同时按协议名称排列
+func sortSizeHistograms(histograms []PacketSizeHistogram) {
+	slices.SortFunc(histograms, func(a, b PacketSizeHistogram) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Protocol, b.Protocol))
+	})
+}
+
+// sortedKeys 返回map中从小到大排列的键
+func sortedKeys[K cmp.Ordered, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
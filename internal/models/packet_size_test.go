@@ -0,0 +1,113 @@
+package models
+
+import (
+	"testing"
+)
+
+// sizeHistogram 由每种数据包大小的数量得出一个快照的直方图
+func sizeHistogram(sizes map[uint16]uint64) PacketSizeHistogram {
+	c := NewPacketSizeCounter()
+	for size, packets := range sizes {
+		c.Add("TCP", size, packets)
+	}
+	s := &Snapshot{}
+	c.Apply(s)
+	return s.PacketSize.All
+}
+
+func TestPacketSizeCounterPercentiles(t *testing.T) {
+	sizes := make(map[uint16]uint64)
+	for size := uint16(1); size <= 100; size++ {
+		sizes[size] = 1
+	}
+	h := sizeHistogram(sizes)
+
+	if h.Count != 100 || h.Min != 1 || h.Max != 100 || h.Mean != 50.5 {
+		t.Errorf("Count/Min/Max/Mean = %d/%d/%d/%v", h.Count, h.Min, h.Max, h.Mean)
+	}
+	if h.P50 != 50 || h.P90 != 90 || h.P99 != 99 {
+		t.Errorf("P50/P90/P99 = %d/%d/%d, want 50/90/99", h.P50, h.P90, h.P99)
+	}
+}
+
+func TestMergeSizeHistogramsPercentiles(t *testing.T) {
+	tests := []struct {
+		name          string
+		parts         []PacketSizeHistogram
+		min, max      uint16
+		mean          float64
+		p50, p90, p99 uint16
+	}{
+		{
+			// 百分位数在所在区间内按观察到的极值限制后线性插值
+			name: "小包和大包各一半",
+			parts: []PacketSizeHistogram{
+				sizeHistogram(map[uint16]uint64{60: 100}),
+				sizeHistogram(map[uint16]uint64{1400: 100}),
+			},
+			min: 60, max: 1400, mean: 730,
+			p50: 64, p90: 1325, p99: 1393,
+		},
+		{
+			name: "所有数据包大小相同",
+			parts: []PacketSizeHistogram{
+				sizeHistogram(map[uint16]uint64{100: 10}),
+				sizeHistogram(map[uint16]uint64{100: 30}),
+			},
+			min: 100, max: 100, mean: 100,
+			p50: 100, p90: 100, p99: 100,
+		},
+		{
+			// 巨型帧区间没有上界，以观察到的最大值为上界
+			name: "巨型帧",
+			parts: []PacketSizeHistogram{
+				sizeHistogram(map[uint16]uint64{1500: 50}),
+				sizeHistogram(map[uint16]uint64{9000: 50}),
+			},
+			min: 1500, max: 9000, mean: 5250,
+			p50: 1500, p90: 7500, p99: 8850,
+		},
+		{
+			name: "没有数据包的快照不影响结果",
+			parts: []PacketSizeHistogram{
+				sizeHistogram(nil),
+				sizeHistogram(map[uint16]uint64{200: 4}),
+			},
+			min: 200, max: 200, mean: 200,
+			p50: 200, p90: 200, p99: 200,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := mergeSizeHistograms("TCP", tt.parts)
+
+			if h.Min != tt.min || h.Max != tt.max || h.Mean != tt.mean {
+				t.Errorf("Min/Max/Mean = %d/%d/%v, want %d/%d/%v", h.Min, h.Max, h.Mean, tt.min, tt.max, tt.mean)
+			}
+			if h.P50 != tt.p50 || h.P90 != tt.p90 || h.P99 != tt.p99 {
+				t.Errorf("P50/P90/P99 = %d/%d/%d, want %d/%d/%d", h.P50, h.P90, h.P99, tt.p50, tt.p90, tt.p99)
+			}
+
+			// 区间计数直接求和，百分比按合并后的总数计算
+			var count uint64
+			var pct float64
+			for _, part := range tt.parts {
+				count += part.Count
+			}
+			for _, bucket := range h.Buckets {
+				pct += bucket.Percentage
+			}
+			if h.Count != count || pct < 99.999 || pct > 100.001 {
+				t.Errorf("Count = %d, want %d; 区间百分比之和 = %v", h.Count, count, pct)
+			}
+		})
+	}
+}
+
+func TestMergeSizeHistogramsEmpty(t *testing.T) {
+	h := mergeSizeHistograms(AllProtocols, nil)
+	if h.Protocol != AllProtocols || h.Count != 0 || h.P50 != 0 || len(h.Buckets) != len(PacketSizeBuckets) {
+		t.Errorf("没有数据包时应返回空的直方图: %+v", h)
+	}
+}
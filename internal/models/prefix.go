@@ -0,0 +1,142 @@
+package models
+
+import (
+	"cmp"
+	"slices"
+)
+
+// prefixTopPrefixes 每个角色、地址族和前缀长度的排行项数
+const prefixTopPrefixes = 5
+
+// PrefixStats 按前缀汇总的源地址和目标地址统计，每种地址族和前缀长度分别统计
+//
+// 单个IPv6客户端会使用很多临时地址、一个NAT地址段对应多个地址，按前缀汇总后排行不再被分散。
+type PrefixStats struct {
+	RankBy          RankBy              // 前缀排行的排序依据
+	Unique          []PrefixUniqueCount // 每个角色、地址族和前缀长度的唯一前缀数量
+	TopSources      []PrefixCount       // 每种地址族和前缀长度流量最大的源前缀(各Top 5)
+	TopDestinations []PrefixCount       // 每种地址族和前缀长度流量最大的目标前缀(各Top 5)
+}
+
+// PrefixUniqueCount 一个角色、地址族和前缀长度下窗口内出现的唯一前缀数量
+type PrefixUniqueCount struct {
+	Role   TalkerRole // 源地址或目标地址
+	Family string     // 地址族，ipv4或ipv6
+	Length int        // 前缀长度
+	Count  int        // 唯一前缀数量
+}
+
+// PrefixCount 一个前缀及其流量
+type PrefixCount struct {
+	Prefix string // 前缀，例如 192.0.2.0/24、2001:db8::/48
+	Family string // 地址族，ipv4或ipv6
+	Length int    // 前缀长度
+	Count  uint64 // 数据包数量
+	Bytes  uint64 // 字节数
+}
+
+// SetPrefixStats 设置前缀统计，保留已设置的排序依据
+func (s *Snapshot) SetPrefixStats(unique []PrefixUniqueCount, topSources, topDestinations []PrefixCount) {
+	s.Prefix = PrefixStats{
+		RankBy:          s.Prefix.RankBy,
+		Unique:          unique,
+		TopSources:      topSources,
+		TopDestinations: topDestinations,
+	}
+}
+
+// prefixGroup 前缀统计的分组：角色、地址族和前缀长度
+type prefixGroup struct {
+	role   TalkerRole
+	family string
+	length int
+}
+
+// comparePrefixGroups 分组的排列顺序：源地址在前，IPv4在前，前缀从长到短
+func comparePrefixGroups(a, b prefixGroup) int {
+	roleOrder := func(role TalkerRole) int {
+		if role == TalkerSource {
+			return 0
+		}
+		return 1
+	}
+	return cmp.Or(
+		cmp.Compare(roleOrder(a.role), roleOrder(b.role)),
+		cmp.Compare(a.family, b.family),
+		cmp.Compare(b.length, a.length),
+	)
+}
+
+// PrefixCounter 按角色、地址族和前缀长度累加每个前缀的流量，最后一次性写入快照
+type PrefixCounter struct {
+	groups map[prefixGroup]map[string]Traffic
+}
+
+// NewPrefixCounter 创建空的计数器
+func NewPrefixCounter() *PrefixCounter {
+	return &PrefixCounter{groups: make(map[prefixGroup]map[string]Traffic)}
+}
+
+// Add 累加一个前缀的流量
+func (c *PrefixCounter) Add(role TalkerRole, family string, length int, prefix string, traffic Traffic) {
+	group := prefixGroup{role, family, length}
+	prefixes, exists := c.groups[group]
+	if !exists {
+		prefixes = make(map[string]Traffic)
+		c.groups[group] = prefixes
+	}
+	addTraffic(prefixes, prefix, traffic.Packets, traffic.Bytes)
+}
+
+// Apply 把累加结果写入快照的前缀统计，唯一数量为每个分组中的前缀数，排行使用快照中设置的排序依据
+func (c *PrefixCounter) Apply(s *Snapshot) {
+	s.Prefix.RankBy = s.Prefix.RankBy.OrDefault()
+
+	groups := make([]prefixGroup, 0, len(c.groups))
+	for group := range c.groups {
+		groups = append(groups, group)
+	}
+	slices.SortFunc(groups, comparePrefixGroups)
+
+	var unique []PrefixUniqueCount
+	var topSources, topDestinations []PrefixCount
+	for _, group := range groups {
+		prefixes := c.groups[group]
+		unique = append(unique, PrefixUniqueCount{Role: group.role, Family: group.family, Length: group.length, Count: len(prefixes)})
+
+		for _, prefix := range RankTraffic(prefixes, s.Prefix.RankBy, prefixTopPrefixes) {
+			t := prefixes[prefix]
+			count := PrefixCount{Prefix: prefix, Family: group.family, Length: group.length, Count: t.Packets, Bytes: t.Bytes}
+			if group.role == TalkerSource {
+				topSources = append(topSources, count)
+			} else {
+				topDestinations = append(topDestinations, count)
+			}
+		}
+	}
+
+	s.SetPrefixStats(unique, topSources, topDestinations)
+}
+
+// mergePrefixUnique 合并各快照的唯一前缀数量，每个分组取最大值作为下界
+func mergePrefixUnique(parts []*Snapshot) []PrefixUniqueCount {
+	counts := make(map[prefixGroup]int)
+	for _, part := range parts {
+		for _, u := range part.Prefix.Unique {
+			group := prefixGroup{u.Role, u.Family, u.Length}
+			counts[group] = max(counts[group], u.Count)
+		}
+	}
+
+	groups := make([]prefixGroup, 0, len(counts))
+	for group := range counts {
+		groups = append(groups, group)
+	}
+	slices.SortFunc(groups, comparePrefixGroups)
+
+	var unique []PrefixUniqueCount
+	for _, group := range groups {
+		unique = append(unique, PrefixUniqueCount{Role: group.role, Family: group.family, Length: group.length, Count: counts[group]})
+	}
+	return unique
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"cmp"
+	"fmt"
+	"sort"
+)
+
+// RankBy Top N 排行的排序依据
+type RankBy string
+
+const (
+	RankByPackets RankBy = "packets" // 按数据包数排序
+	RankByBytes   RankBy = "bytes"   // 按字节数排序
+)
+
+// ParseRankBy 解析排序依据，空字符串表示按数据包数排序
+func ParseRankBy(value string) (RankBy, error) {
+	switch RankBy(value) {
+	case "", RankByPackets:
+		return RankByPackets, nil
+	case RankByBytes:
+		return RankByBytes, nil
+	}
+	return "", fmt.Errorf("不支持的排序依据 %q，可选 packets 或 bytes", value)
+}
+
+// OrDefault 未设置时返回按数据包数排序，用于读取旧版本保存的快照
+func (r RankBy) OrDefault() RankBy {
+	if r == "" {
+		return RankByPackets
+	}
+	return r
+}
+
+// Traffic 一个键对应的数据包数和字节数
+type Traffic struct {
+	Packets uint64
+	Bytes   uint64
+}
+
+// Value 返回排序依据对应的数值
+func (t Traffic) Value(by RankBy) uint64 {
+	if by == RankByBytes {
+		return t.Bytes
+	}
+	return t.Packets
+}
+
+// Add 累加另一组数据包数和字节数
+func (t *Traffic) Add(other Traffic) {
+	t.Packets += other.Packets
+	t.Bytes += other.Bytes
+}
+
+// RankTraffic 按排序依据从大到小返回前n个键，n为0时返回全部
+//
+// 排序依据相同时比较另一项，再按键排序，保证结果稳定。
+func RankTraffic[K cmp.Ordered](traffic map[K]Traffic, by RankBy, n int) []K {
+	keys := make([]K, 0, len(traffic))
+	for key := range traffic {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if c := compareTraffic(traffic[keys[i]], traffic[keys[j]], by); c != 0 {
+			return c < 0
+		}
+		return keys[i] < keys[j]
+	})
+	if n > 0 && len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+// compareTraffic 按排序依据从大到小比较，依据相同时比较另一项；a应排在b之前时返回负数
+func compareTraffic(a, b Traffic, by RankBy) int {
+	other := RankByBytes
+	if by == RankByBytes {
+		other = RankByPackets
+	}
+	if c := cmp.Compare(b.Value(by), a.Value(by)); c != 0 {
+		return c
+	}
+	return cmp.Compare(b.Value(other), a.Value(other))
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -8,14 +10,36 @@ import (
 
 // Snapshot 表示网络流量快照的主结构体
 type Snapshot struct {
-	Timestamp   time.Time        // 快照创建时间
-	Basic       BasicStats       // 基本流量统计
-	MAC         MACStats         // MAC地址统计
-	IP          IPStats          // IP地址统计
-	Port        PortStats        // 端口统计
-	Protocol    ProtocolStats    // 协议统计
-	TCPFlags    TCPFlagsStats    // TCP标志统计
-	Application ApplicationStats // 应用层协议统计
+	ID             string              // 快照ID，由来源标签、配置档和时间窗口确定
+	Labels                             // 采集快照的传感器、站点和网卡
+	Profile        string              // 采集配置档名称
+	Timestamp      time.Time           // 快照创建时间
+	Basic          BasicStats          // 基本流量统计
+	PacketSize     PacketSizeStats     // 数据包大小统计
+	Throughput     ThroughputStats     // 峰值速率和微突发统计
+	Direction      DirectionStats      // 按流量方向(相对内部网络)的统计
+	Prefix         PrefixStats         // 按IPv4和IPv6前缀汇总的统计
+	Geo            GeoStats            // 按国家和自治系统的统计
+	MAC            MACStats            // MAC地址统计
+	L2             L2Stats             // 二层统计
+	IP             IPStats             // IP地址统计
+	Port           PortStats           // 端口统计
+	TransportPort  TransportPortStats  // 按传输层协议区分的端口统计
+	Protocol       ProtocolStats       // 协议统计
+	TCPFlags       TCPFlagsStats       // TCP标志统计
+	Application    ApplicationStats    // 应用层协议统计
+	Service        ServiceStats        // 服务分布
+	Classification ClassificationStats // 流量分类统计
+	Destination    DestinationStats    // 目标IP地址统计
+	Conversation   ConversationStats   // 源IP到目标IP的会话统计
+	Flow           FlowStats           // 五元组流统计
+}
+
+// Labels 快照来源的标识标签
+type Labels struct {
+	Sensor    string // 传感器标识，在整个部署中唯一
+	Site      string // 传感器所在站点
+	Interface string // 采集数据的网卡
 }
 
 // BasicStats 基本流量统计快照
@@ -41,6 +65,7 @@ type MACAddressCount struct {
 // IPStats IP地址统计
 type IPStats struct {
 	UniqueSourceCount int              // 唯一源IP地址数量
+	RankBy            RankBy           // 排行的排序依据
 	TopPairs          [5]IPAddressPair // 出现频率最高的源IP地址对(Top 5)
 }
 
@@ -48,11 +73,13 @@ type IPStats struct {
 type IPAddressPair struct {
 	SourceIP string // 源IP地址
 	Count    uint64 // 出现次数
+	Bytes    uint64 // 字节数
 }
 
 // PortStats 端口统计
 type PortStats struct {
 	UniqueDestCount int         // 唯一目标端口数量
+	RankBy          RankBy      // 排行的排序依据
 	TopPairs        [5]PortPair // 出现频率最高的端口对(Top 5)
 }
 
@@ -60,6 +87,7 @@ type PortStats struct {
 type PortPair struct {
 	DestinationPort uint16 // 目标端口
 	Count           uint64 // 出现次数
+	Bytes           uint64 // 字节数
 }
 
 // ProtocolStats 协议统计
@@ -71,6 +99,7 @@ type ProtocolStats struct {
 type ProtocolCount struct {
 	Name       string  // 协议名称
 	Count      uint64  // 数据包数量
+	Bytes      uint64  // 字节数
 	Percentage float64 // 占比(百分比)
 }
 
@@ -81,8 +110,10 @@ type TCPFlagsStats struct {
 
 // TCPFlagCount TCP标志及其统计信息
 type TCPFlagCount struct {
-	Flag  string // 标志名称(SYN, ACK, FIN, PSH, RST等)
-	Count uint64 // 出现次数
+	Flag       string  // 标志名称(SYN, ACK, FIN, PSH, RST等)
+	Count      uint64  // 出现次数
+	Bytes      uint64  // 字节数
+	Percentage float64 // 占比(百分比)
 }
 
 // ApplicationStats 应用层协议统计
@@ -94,9 +125,23 @@ type ApplicationStats struct {
 type ApplicationCount struct {
 	Name       string  // 应用名称
 	Count      uint64  // 数据包数量
+	Bytes      uint64  // 字节数
 	Percentage float64 // 占比(百分比)
 }
 
+// ServiceStats 服务分布，由服务注册表按每个TCP/UDP端口对的服务端端口命名
+type ServiceStats struct {
+	Services []ServiceCount // 各服务统计
+}
+
+// ServiceCount 服务及其统计信息
+type ServiceCount struct {
+	Name       string  // 服务名称，注册表中没有的端口按端口范围归类
+	Count      uint64  // 数据包数量
+	Bytes      uint64  // 字节数
+	Percentage float64 // 占TCP和UDP数据包的比例(百分比)
+}
+
 // NewSnapshot 创建一个新的快照实例
 func NewSnapshot() *Snapshot {
 	return &Snapshot{
@@ -104,6 +149,49 @@ func NewSnapshot() *Snapshot {
 	}
 }
 
+// NewSnapshotForWindow 为指定的时间窗口创建快照，快照ID由窗口确定
+//
+// 对同一个窗口重复采集（重试或回填）会得到相同的ID，写入时据此覆盖旧数据。
+func NewSnapshotForWindow(labels Labels, profile string, start, end time.Time) *Snapshot {
+	return &Snapshot{
+		ID:        SnapshotID(labels, profile, start, end.Sub(start)),
+		Labels:    labels,
+		Profile:   profile,
+		Timestamp: time.Now().UTC(),
+		Basic: BasicStats{
+			StartTime: start,
+			EndTime:   end,
+		},
+	}
+}
+
+// SnapshotID 根据(传感器, 网卡, 配置档, 窗口开始时间, 窗口长度)生成确定性的快照ID
+//
+// 站点只是描述信息，不参与计算；未设置网卡时与加入标签之前生成的ID相同。
+func SnapshotID(labels Labels, profile string, windowStart time.Time, windowLength time.Duration) string {
+	source := labels.Sensor
+	if labels.Interface != "" {
+		source += "/" + labels.Interface
+	}
+	key := fmt.Sprintf("%s|%s|%d|%d", source, profile, windowStart.UTC().UnixNano(), int64(windowLength))
+	sum := sha256.Sum256([]byte(key))
+	return "snap_" + hex.EncodeToString(sum[:16])
+}
+
+// AlignWindow 把当前时间对齐到采集间隔，返回以对齐时间结束、长度为length的窗口
+func AlignWindow(now time.Time, interval, length time.Duration) (start, end time.Time) {
+	end = now.UTC().Truncate(interval)
+	return end.Add(-length), end
+}
+
+// WindowEnd 返回快照数据对应的时间点：窗口结束时间，未设置窗口时使用创建时间
+func (s *Snapshot) WindowEnd() time.Time {
+	if s.Basic.EndTime.IsZero() {
+		return s.Timestamp
+	}
+	return s.Basic.EndTime
+}
+
 // SetBasicStats 设置基本流量统计
 func (s *Snapshot) SetBasicStats(startTime, endTime time.Time, totalPackets, totalBytes uint64) {
 	s.Basic = BasicStats{
@@ -134,10 +222,11 @@ func (s *Snapshot) SetMACStats(uniqueCount int, topSources []MACAddressCount) {
 	}
 }
 
-// SetIPStats 设置IP地址统计
+// SetIPStats 设置IP地址统计，保留已设置的排序依据
 func (s *Snapshot) SetIPStats(uniqueCount int, topPairs []IPAddressPair) {
 	s.IP = IPStats{
 		UniqueSourceCount: uniqueCount,
+		RankBy:            s.IP.RankBy,
 	}
 
 	// 填充前5项，不足的用空值填充
@@ -154,10 +243,11 @@ func (s *Snapshot) SetIPStats(uniqueCount int, topPairs []IPAddressPair) {
 	}
 }
 
-// SetPortStats 设置端口统计
+// SetPortStats 设置端口统计，保留已设置的排序依据
 func (s *Snapshot) SetPortStats(uniqueCount int, topPairs []PortPair) {
 	s.Port = PortStats{
 		UniqueDestCount: uniqueCount,
+		RankBy:          s.Port.RankBy,
 	}
 
 	// 填充前5项，不足的用空值填充
@@ -195,10 +285,22 @@ func (s *Snapshot) SetApplicationStats(apps []ApplicationCount) {
 	}
 }
 
+// SetServiceStats 设置服务分布
+func (s *Snapshot) SetServiceStats(services []ServiceCount) {
+	s.Service = ServiceStats{
+		Services: services,
+	}
+}
+
 // ToJSON 将 Snapshot 序列化为格式化的 JSON 字符串
 func (s *Snapshot) ToJSON() (string, error) {
 	// 创建一个可读性更强的时间格式转换
 	type jsonSnapshot struct {
+		ID        string     `json:"snapshot_id"`
+		Sensor    string     `json:"sensor"`
+		Site      string     `json:"site,omitempty"`
+		Interface string     `json:"interface,omitempty"`
+		Profile   string     `json:"profile"`
 		Timestamp string     `json:"timestamp"`
 		Basic     BasicStats `json:"basic"`
 		IP        IPStats    `json:"ip"`
@@ -210,26 +312,69 @@ func (s *Snapshot) ToJSON() (string, error) {
 		Application struct {
 			Apps []ApplicationCount `json:"apps"`
 		} `json:"application"`
+		Service struct {
+			Services []ServiceCount `json:"services"`
+		} `json:"service"`
 		TCPFlags struct {
 			Flags []TCPFlagCount `json:"flags"`
 		} `json:"tcp_flags"`
+		Destination    DestinationStats    `json:"destination"`
+		Conversation   ConversationStats   `json:"conversation"`
+		Flow           FlowStats           `json:"flow"`
+		TransportPort  TransportPortStats  `json:"transport_port"`
+		L2             L2Stats             `json:"l2"`
+		Classification ClassificationStats `json:"classification"`
+		PacketSize     PacketSizeStats     `json:"packet_size"`
+		Rates          struct {
+			WindowSeconds    float64 `json:"window_seconds"`
+			PacketsPerSecond float64 `json:"packets_per_second"`
+			BitsPerSecond    float64 `json:"bits_per_second"`
+		} `json:"rates"`
+		Throughput ThroughputStats `json:"throughput"`
+		Direction  DirectionStats  `json:"direction"`
+		Prefix     PrefixStats     `json:"prefix"`
+		Geo        GeoStats        `json:"geo"`
 	}
 
 	// 创建JSON结构
 	jsonData := jsonSnapshot{
-		Timestamp: time.Now().UTC().Format("2006-01-02 15:04:05"),
-		Basic:     s.Basic,
-		IP:        s.IP,
-		MAC:       s.MAC,
-		Port:      s.Port,
+		ID:             s.ID,
+		Sensor:         s.Sensor,
+		Site:           s.Site,
+		Interface:      s.Interface,
+		Profile:        s.Profile,
+		Timestamp:      time.Now().UTC().Format("2006-01-02 15:04:05"),
+		Basic:          s.Basic,
+		IP:             s.IP,
+		MAC:            s.MAC,
+		Port:           s.Port,
+		Destination:    s.Destination,
+		Conversation:   s.Conversation,
+		Flow:           s.Flow,
+		TransportPort:  s.TransportPort,
+		L2:             s.L2,
+		Classification: s.Classification,
+		PacketSize:     s.PacketSize,
+		Throughput:     s.Throughput,
+		Direction:      s.Direction,
+		Prefix:         s.Prefix,
+		Geo:            s.Geo,
 	}
 
+	// 计算平均速率
+	jsonData.Rates.WindowSeconds = s.Basic.WindowSeconds()
+	jsonData.Rates.PacketsPerSecond = s.Throughput.PacketsPerSecond()
+	jsonData.Rates.BitsPerSecond = s.Throughput.BitsPerSecond()
+
 	// 复制Protocol数据
 	jsonData.Protocol.Protocols = s.Protocol.Protocols
 
 	// 复制Application数据
 	jsonData.Application.Apps = s.Application.Apps
 
+	// 复制Service数据
+	jsonData.Service.Services = s.Service.Services
+
 	// 复制TCPFlags数据
 	jsonData.TCPFlags.Flags = s.TCPFlags.Flags
 
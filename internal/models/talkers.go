@@ -0,0 +1,136 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// TalkerTraffic 目标IP、会话和五元组流排行项的流量，以及在窗口内第一次和最后一次出现的时间
+type TalkerTraffic struct {
+	Count     uint64    // 数据包数量
+	Bytes     uint64    // 字节数
+	FirstSeen time.Time // 窗口内第一个数据包的时间
+	LastSeen  time.Time // 窗口内最后一个数据包的时间
+}
+
+// Traffic 返回数据包数和字节数，用于按排序依据比较
+func (t TalkerTraffic) Traffic() Traffic {
+	return Traffic{Packets: t.Count, Bytes: t.Bytes}
+}
+
+// merge 累加另一段时间的流量，出现时间取两者的并集
+func (t *TalkerTraffic) merge(other TalkerTraffic) {
+	t.Count += other.Count
+	t.Bytes += other.Bytes
+	if t.FirstSeen.IsZero() || (!other.FirstSeen.IsZero() && other.FirstSeen.Before(t.FirstSeen)) {
+		t.FirstSeen = other.FirstSeen
+	}
+	if other.LastSeen.After(t.LastSeen) {
+		t.LastSeen = other.LastSeen
+	}
+}
+
+// DestinationStats 目标IP地址统计
+type DestinationStats struct {
+	UniqueDestCount int                  // 唯一目标IP地址数量
+	RankBy          RankBy               // 排行的排序依据
+	TopDestinations []DestinationIPCount // 最活跃的目标IP地址(Top 5)
+}
+
+// DestinationIPCount 目标IP地址及其流量
+type DestinationIPCount struct {
+	DestinationIP string // 目标IP地址
+	TalkerTraffic
+}
+
+// ConversationStats 源IP到目标IP的会话统计，同一对IP不区分端口和协议
+type ConversationStats struct {
+	RankBy           RankBy         // 排行的排序依据
+	TopConversations []Conversation // 流量最大的会话(Top 5)
+}
+
+// Conversation 一对源IP和目标IP之间的流量
+type Conversation struct {
+	SourceIP      string // 源IP地址
+	DestinationIP string // 目标IP地址
+	TalkerTraffic
+}
+
+// FlowStats 五元组流统计
+type FlowStats struct {
+	RankBy   RankBy      // 排行的排序依据
+	TopFlows []FlowTuple // 流量最大的五元组流(Top 5)
+}
+
+// FlowTuple 五元组(源IP, 目标IP, 源端口, 目标端口, 协议)及其流量
+type FlowTuple struct {
+	SourceIP        string // 源IP地址
+	DestinationIP   string // 目标IP地址
+	SourcePort      uint16 // 源端口
+	DestinationPort uint16 // 目标端口
+	Protocol        string // 协议名称
+	TalkerTraffic
+}
+
+// SetDestinationStats 设置目标IP地址统计，保留已设置的排序依据
+func (s *Snapshot) SetDestinationStats(uniqueCount int, top []DestinationIPCount) {
+	s.Destination = DestinationStats{
+		UniqueDestCount: uniqueCount,
+		RankBy:          s.Destination.RankBy,
+		TopDestinations: top,
+	}
+}
+
+// SetConversationStats 设置会话统计，保留已设置的排序依据
+func (s *Snapshot) SetConversationStats(top []Conversation) {
+	s.Conversation = ConversationStats{
+		RankBy:           s.Conversation.RankBy,
+		TopConversations: top,
+	}
+}
+
+// SetFlowStats 设置五元组流统计，保留已设置的排序依据
+func (s *Snapshot) SetFlowStats(top []FlowTuple) {
+	s.Flow = FlowStats{
+		RankBy:   s.Flow.RankBy,
+		TopFlows: top,
+	}
+}
+
+// conversationKey 合并时识别同一会话的键
+func conversationKey(c Conversation) string {
+	return c.SourceIP + " " + c.DestinationIP
+}
+
+// flowTupleKey 合并时识别同一五元组流的键
+func flowTupleKey(f FlowTuple) string {
+	return fmt.Sprintf("%s %s %d %d %s", f.SourceIP, f.DestinationIP, f.SourcePort, f.DestinationPort, f.Protocol)
+}
+
+// mergeTalkers 按键合并各快照的排行项，再按排序依据取前n项，排序规则与RankTraffic一致
+func mergeTalkers[T any](items []T, key func(T) string, traffic func(*T) *TalkerTraffic, by RankBy, n int) []T {
+	index := make(map[string]int)
+	var merged []T
+	for _, item := range items {
+		k := key(item)
+		if i, ok := index[k]; ok {
+			traffic(&merged[i]).merge(*traffic(&item))
+			continue
+		}
+		index[k] = len(merged)
+		merged = append(merged, item)
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		if c := compareTraffic(traffic(&merged[i]).Traffic(), traffic(&merged[j]).Traffic(), by); c != 0 {
+			return c < 0
+		}
+		return key(merged[i]) < key(merged[j])
+	})
+
+	if n > 0 && len(merged) > n {
+		merged = merged[:n]
+	}
+	return merged
+}
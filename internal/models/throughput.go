@@ -0,0 +1,178 @@
+package models
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// WindowSeconds 时间窗口的长度(秒)
+func (b BasicStats) WindowSeconds() float64 {
+	return b.EndTime.Sub(b.StartTime).Seconds()
+}
+
+// rate 计算一段时间内的每秒速率
+func rate(count uint64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(count) / d.Seconds()
+}
+
+// throughputTopBursts 微突发排行的项数
+const throughputTopBursts = 10
+
+// ThroughputStats 窗口内按亚秒级时间桶统计的平均速率、峰值速率和微突发
+//
+// 平均速率和峰值速率来自同一次时间桶扫描。基本统计的总量取自统计表的最新一行，
+// 不一定是窗口内的流量，不能用来计算速率。
+type ThroughputStats struct {
+	BucketMillis    int64     // 时间桶大小(毫秒)
+	Seconds         float64   // 扫描的时间长度(秒)，合并后为各段之和
+	Packets         uint64    // 扫描到的数据包总数
+	Bytes           uint64    // 扫描到的字节总数
+	BurstFactor     float64   // 时间桶速率超过有流量时间桶平均速率的倍数时计为微突发
+	PeakPPS         float64   // 峰值每秒数据包数
+	PeakBPS         float64   // 峰值每秒比特数
+	PeakAt          time.Time // 数据包速率达到峰值的时间桶开始时间
+	BurstCount      int       // 微突发的时间桶数量
+	BurstPackets    uint64    // 微突发时间桶内的数据包数量
+	BurstBytes      uint64    // 微突发时间桶内的字节数
+	BurstPercentage float64   // 微突发时间桶内的数据包占比(百分比)
+	Bursts          []Burst   // 数据包速率最高的微突发(Top 10)
+}
+
+// Burst 一个数据包速率超过阈值的时间桶
+type Burst struct {
+	Start   time.Time // 时间桶开始时间
+	Packets uint64    // 数据包数量
+	Bytes   uint64    // 字节数
+	PPS     float64   // 每秒数据包数
+	BPS     float64   // 每秒比特数
+}
+
+// PacketsPerSecond 扫描时间内的平均每秒数据包数，没有采集时为0
+func (t ThroughputStats) PacketsPerSecond() float64 {
+	return rate(t.Packets, time.Duration(t.Seconds*float64(time.Second)))
+}
+
+// BitsPerSecond 扫描时间内的平均每秒比特数，没有采集时为0
+func (t ThroughputStats) BitsPerSecond() float64 {
+	return rate(t.Bytes*8, time.Duration(t.Seconds*float64(time.Second)))
+}
+
+// SetThroughputStats 设置峰值速率和微突发统计
+func (s *Snapshot) SetThroughputStats(stats ThroughputStats) {
+	s.Throughput = stats
+}
+
+// ThroughputCounter 累加窗口内各时间桶的流量，得出峰值速率和微突发
+type ThroughputCounter struct {
+	bucket  time.Duration
+	factor  float64
+	buckets map[time.Time]Traffic
+}
+
+// NewThroughputCounter 创建计数器，bucket为时间桶大小，factor为微突发阈值相对有流量时间桶平均速率的倍数
+func NewThroughputCounter(bucket time.Duration, factor float64) *ThroughputCounter {
+	return &ThroughputCounter{
+		bucket:  bucket,
+		factor:  factor,
+		buckets: make(map[time.Time]Traffic),
+	}
+}
+
+// Add 累加一个时间桶的流量，start为时间桶开始时间
+func (c *ThroughputCounter) Add(start time.Time, traffic Traffic) {
+	addTraffic(c.buckets, start.UTC(), traffic.Packets, traffic.Bytes)
+}
+
+// Apply 把平均速率、峰值速率和微突发写入快照，平均速率以快照的窗口长度为时间
+//
+// 微突发阈值为有数据包的时间桶平均数据包速率的factor倍。不计入空的时间桶，
+// 否则流量稀疏时单个数据包所在的时间桶也会超过阈值。
+func (c *ThroughputCounter) Apply(s *Snapshot) {
+	stats := ThroughputStats{BucketMillis: c.bucket.Milliseconds(), BurstFactor: c.factor}
+
+	var total Traffic
+	for _, t := range c.buckets {
+		total.Add(t)
+	}
+	stats.Seconds = s.Basic.WindowSeconds()
+	stats.Packets, stats.Bytes = total.Packets, total.Bytes
+	threshold := c.factor * rate(total.Packets, c.bucket*time.Duration(len(c.buckets)))
+
+	var bursts []Burst
+	for _, start := range sortedTimes(c.buckets) {
+		t := c.buckets[start]
+		pps := rate(t.Packets, c.bucket)
+		bps := rate(t.Bytes*8, c.bucket)
+		if pps > stats.PeakPPS {
+			stats.PeakPPS = pps
+			stats.PeakAt = start
+		}
+		stats.PeakBPS = max(stats.PeakBPS, bps)
+
+		if threshold > 0 && pps > threshold {
+			stats.BurstCount++
+			stats.BurstPackets += t.Packets
+			stats.BurstBytes += t.Bytes
+			bursts = append(bursts, Burst{Start: start, Packets: t.Packets, Bytes: t.Bytes, PPS: pps, BPS: bps})
+		}
+	}
+	stats.BurstPercentage = percentage(stats.BurstPackets, total.Packets)
+	stats.Bursts = topBursts(bursts)
+
+	s.SetThroughputStats(stats)
+}
+
+// mergeThroughput 合并多段时间的吞吐速率，没有采集的快照(时间桶为0)不参与合并
+//
+// 时间和总量直接求和，平均速率和微突发占比只以参与合并的各段为总数；
+// 峰值取各段的最大值，微突发数量直接求和，排行取各段排行的并集中速率最高的项；
+// 各段的微突发阈值以各自有流量时间桶的平均速率计算，合并后不重新判断。
+func mergeThroughput(parts []ThroughputStats) ThroughputStats {
+	var merged ThroughputStats
+	var bursts []Burst
+	for _, part := range parts {
+		if part.BucketMillis == 0 {
+			continue
+		}
+		if merged.BucketMillis == 0 {
+			merged.BucketMillis, merged.BurstFactor = part.BucketMillis, part.BurstFactor
+		}
+		if part.PeakPPS > merged.PeakPPS {
+			merged.PeakPPS = part.PeakPPS
+			merged.PeakAt = part.PeakAt
+		}
+		merged.Seconds += part.Seconds
+		merged.Packets += part.Packets
+		merged.Bytes += part.Bytes
+		merged.PeakBPS = max(merged.PeakBPS, part.PeakBPS)
+		merged.BurstCount += part.BurstCount
+		merged.BurstPackets += part.BurstPackets
+		merged.BurstBytes += part.BurstBytes
+		bursts = append(bursts, part.Bursts...)
+	}
+	merged.BurstPercentage = percentage(merged.BurstPackets, merged.Packets)
+	merged.Bursts = topBursts(bursts)
+	return merged
+}
+
+// topBursts 按数据包速率从大到小排列微突发，速率相同时按时间排列，返回前throughputTopBursts项
+func topBursts(bursts []Burst) []Burst {
+	slices.SortFunc(bursts, func(a, b Burst) int {
+		return cmp.Or(cmp.Compare(b.PPS, a.PPS), a.Start.Compare(b.Start))
+	})
+	return bursts[:min(len(bursts), throughputTopBursts)]
+}
+
+// sortedTimes 返回map中从早到晚排列的时间
+func sortedTimes[V any](m map[time.Time]V) []time.Time {
+	times := make([]time.Time, 0, len(m))
+	for t := range m {
+		times = append(times, t)
+	}
+	slices.SortFunc(times, time.Time.Compare)
+	return times
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"cmp"
+	"slices"
+)
+
+// PortRole 端口在排行中的角色
+type PortRole string
+
+const (
+	PortRoleDestination PortRole = "destination" // 目标端口
+	PortRoleSource      PortRole = "source"      // 源端口
+	PortRoleService     PortRole = "service"     // 服务端端口，由启发式规则从端口对中选出
+)
+
+// portRoles 所有端口角色，排行按此顺序排列
+var portRoles = []PortRole{PortRoleDestination, PortRoleSource, PortRoleService}
+
+// TransportPortStats 按传输层协议(TCP/UDP)区分的端口统计，排序依据与端口统计相同
+type TransportPortStats struct {
+	Ports []TransportPortCount // 各角色、各传输层协议的端口排行(各Top 5)，按角色、协议和排名排列
+}
+
+// TransportPortCount 一个传输层协议端口及其统计信息
+type TransportPortCount struct {
+	Role      PortRole // 端口角色
+	Transport string   // 传输层协议(TCP或UDP)
+	Port      uint16   // 端口号
+	Service   string   // 服务名称
+	Count     uint64   // 数据包数量
+	Bytes     uint64   // 字节数
+}
+
+// SetTransportPortStats 设置按传输层协议区分的端口统计
+func (s *Snapshot) SetTransportPortStats(ports []TransportPortCount) {
+	s.TransportPort = TransportPortStats{
+		Ports: ports,
+	}
+}
+
+// Top 返回指定角色和传输层协议的端口排行
+func (t TransportPortStats) Top(role PortRole, transport string) []TransportPortCount {
+	var ports []TransportPortCount
+	for _, port := range t.Ports {
+		if port.Role == role && port.Transport == transport {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+// transportPortGroup 排行的分组：一个角色在一个传输层协议下的所有端口
+type transportPortGroup struct {
+	role      PortRole
+	transport string
+}
+
+// TransportPortCounter 按角色和传输层协议累加每个端口的数据包数和字节数，最后分组取排行
+type TransportPortCounter struct {
+	traffic  map[transportPortGroup]map[uint16]Traffic
+	services map[transportPortGroup]map[uint16]string
+}
+
+// NewTransportPortCounter 创建空的端口计数器
+func NewTransportPortCounter() *TransportPortCounter {
+	return &TransportPortCounter{
+		traffic:  make(map[transportPortGroup]map[uint16]Traffic),
+		services: make(map[transportPortGroup]map[uint16]string),
+	}
+}
+
+// Add 累加一个端口的数据包数和字节数，服务名称沿用第一次累加时的值
+func (c *TransportPortCounter) Add(role PortRole, transport string, port uint16, service string, traffic Traffic) {
+	group := transportPortGroup{role: role, transport: transport}
+	if c.traffic[group] == nil {
+		c.traffic[group] = make(map[uint16]Traffic)
+		c.services[group] = make(map[uint16]string)
+	}
+	addTraffic(c.traffic[group], port, traffic.Packets, traffic.Bytes)
+	if _, ok := c.services[group][port]; !ok {
+		c.services[group][port] = service
+	}
+}
+
+// Top 按排序依据返回每个角色、每个传输层协议的前n个端口，按角色、协议名称和排名排列
+func (c *TransportPortCounter) Top(by RankBy, n int) []TransportPortCount {
+	groups := make([]transportPortGroup, 0, len(c.traffic))
+	for group := range c.traffic {
+		groups = append(groups, group)
+	}
+	slices.SortFunc(groups, func(a, b transportPortGroup) int {
+		return cmp.Or(
+			cmp.Compare(slices.Index(portRoles, a.role), slices.Index(portRoles, b.role)),
+			cmp.Compare(a.transport, b.transport),
+		)
+	})
+
+	var ports []TransportPortCount
+	for _, group := range groups {
+		traffic := c.traffic[group]
+		for _, port := range RankTraffic(traffic, by, n) {
+			ports = append(ports, TransportPortCount{
+				Role:      group.role,
+				Transport: group.transport,
+				Port:      port,
+				Service:   c.services[group][port],
+				Count:     traffic[port].Packets,
+				Bytes:     traffic[port].Bytes,
+			})
+		}
+	}
+	return ports
+}
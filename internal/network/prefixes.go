@@ -0,0 +1,114 @@
+// Package network 提供基于netip的IPv4和IPv6前缀处理：判断地址是否属于内部网络，以及流量方向分类
+package network
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"SnapFlow/internal/models"
+)
+
+// DefaultInternalPrefixes 未配置内部网络时使用的前缀：RFC 1918私有地址和IPv6唯一本地地址
+const DefaultInternalPrefixes = "10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,fc00::/7"
+
+// PrefixSet 一组IPv4和IPv6前缀，用于判断地址是否属于内部网络
+type PrefixSet struct {
+	prefixes []netip.Prefix
+}
+
+// ParsePrefixes 解析前缀列表，前缀之间用逗号、分号、空白或换行分隔，# 之后为注释
+//
+// 每个条目为 地址/长度，例如 10.0.0.0/8、2001:db8::/32；不带长度的地址视为单个主机。
+// 前缀中主机位不为0时按长度截断，例如 10.1.2.3/8 等同于 10.0.0.0/8。
+func ParsePrefixes(text string) (*PrefixSet, error) {
+	set := &PrefixSet{}
+	for _, line := range strings.Split(text, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ';' || r == ' ' || r == '\t' || r == '\r'
+		})
+		for _, field := range fields {
+			prefix, err := parsePrefix(field)
+			if err != nil {
+				return nil, err
+			}
+			set.prefixes = append(set.prefixes, prefix)
+		}
+	}
+	return set, nil
+}
+
+// parsePrefix 解析单个前缀或地址，IPv4映射的IPv6地址转换为IPv4
+func parsePrefix(text string) (netip.Prefix, error) {
+	if !strings.Contains(text, "/") {
+		addr, err := netip.ParseAddr(text)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("前缀 %q 无效: %w", text, err)
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+
+	prefix, err := netip.ParsePrefix(text)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("前缀 %q 无效: %w", text, err)
+	}
+	if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+	return prefix.Masked(), nil
+}
+
+// Len 返回前缀数量
+func (s *PrefixSet) Len() int {
+	return len(s.prefixes)
+}
+
+// Prefixes 返回所有前缀
+func (s *PrefixSet) Prefixes() []netip.Prefix {
+	return append([]netip.Prefix(nil), s.prefixes...)
+}
+
+// String 返回逗号分隔的前缀列表
+func (s *PrefixSet) String() string {
+	texts := make([]string, len(s.prefixes))
+	for i, prefix := range s.prefixes {
+		texts[i] = prefix.String()
+	}
+	return strings.Join(texts, ",")
+}
+
+// Contains 判断地址是否属于任一前缀，IPv4映射的IPv6地址按IPv4判断
+func (s *PrefixSet) Contains(addr netip.Addr) bool {
+	addr = addr.Unmap().WithZone("")
+	for _, prefix := range s.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Direction 根据源地址和目标地址是否属于内部网络判断流量方向，任一地址为空或无法解析时为unknown
+func (s *PrefixSet) Direction(src, dst string) models.Direction {
+	srcAddr, err := netip.ParseAddr(strings.TrimSpace(src))
+	if err != nil {
+		return models.DirectionUnknown
+	}
+	dstAddr, err := netip.ParseAddr(strings.TrimSpace(dst))
+	if err != nil {
+		return models.DirectionUnknown
+	}
+
+	switch srcInternal, dstInternal := s.Contains(srcAddr), s.Contains(dstAddr); {
+	case srcInternal && dstInternal:
+		return models.DirectionInternal
+	case srcInternal:
+		return models.DirectionOutbound
+	case dstInternal:
+		return models.DirectionInbound
+	default:
+		return models.DirectionExternal
+	}
+}
@@ -0,0 +1,105 @@
+package network
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// 地址族名称，用于统计、持久化和输出
+const (
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+)
+
+// PrefixLengths 前缀汇总使用的IPv4和IPv6前缀长度，例如IPv4的/24、/16和IPv6的/64、/48
+type PrefixLengths struct {
+	IPv4 []int // IPv4前缀长度，从长到短排列
+	IPv6 []int // IPv6前缀长度，从长到短排列
+}
+
+// ParsePrefixLengths 解析逗号分隔的IPv4和IPv6前缀长度，例如 "24,16" 和 "64,48"；为空表示不汇总该地址族
+//
+// 长度可以带前导的 /，重复的长度只保留一个。
+func ParsePrefixLengths(ipv4, ipv6 string) (PrefixLengths, error) {
+	var lengths PrefixLengths
+	var err error
+	if lengths.IPv4, err = parseLengths(ipv4, 32); err != nil {
+		return lengths, fmt.Errorf("IPv4前缀长度: %w", err)
+	}
+	if lengths.IPv6, err = parseLengths(ipv6, 128); err != nil {
+		return lengths, fmt.Errorf("IPv6前缀长度: %w", err)
+	}
+	return lengths, nil
+}
+
+// parseLengths 解析一个地址族的前缀长度，长度必须在1到maxBits之间
+func parseLengths(text string, maxBits int) ([]int, error) {
+	var lengths []int
+	for _, field := range strings.Split(text, ",") {
+		field = strings.TrimPrefix(strings.TrimSpace(field), "/")
+		if field == "" {
+			continue
+		}
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 1 || n > maxBits {
+			return nil, fmt.Errorf("前缀长度 %q 无效（1-%d）", field, maxBits)
+		}
+		if !slices.Contains(lengths, n) {
+			lengths = append(lengths, n)
+		}
+	}
+	slices.SortFunc(lengths, func(a, b int) int { return b - a })
+	return lengths, nil
+}
+
+// IsZero 判断是否没有配置任何前缀长度
+func (l PrefixLengths) IsZero() bool {
+	return len(l.IPv4) == 0 && len(l.IPv6) == 0
+}
+
+// String 返回 ipv4=/24,/16 ipv6=/64,/48 形式的描述
+func (l PrefixLengths) String() string {
+	format := func(lengths []int) string {
+		texts := make([]string, len(lengths))
+		for i, n := range lengths {
+			texts[i] = "/" + strconv.Itoa(n)
+		}
+		return strings.Join(texts, ",")
+	}
+	return FamilyIPv4 + "=" + format(l.IPv4) + " " + FamilyIPv6 + "=" + format(l.IPv6)
+}
+
+// Rollup 返回地址在每个配置长度下所在的前缀，IPv4映射的IPv6地址按IPv4处理；
+// 地址为空或无法解析时返回nil
+func (l PrefixLengths) Rollup(address string) []netip.Prefix {
+	addr, err := netip.ParseAddr(strings.TrimSpace(address))
+	if err != nil {
+		return nil
+	}
+	addr = addr.Unmap().WithZone("")
+
+	lengths := l.IPv6
+	if addr.Is4() {
+		lengths = l.IPv4
+	}
+	prefixes := make([]netip.Prefix, 0, len(lengths))
+	for _, bits := range lengths {
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes
+}
+
+// Family 返回前缀的地址族名称
+func Family(prefix netip.Prefix) string {
+	if prefix.Addr().Is4() {
+		return FamilyIPv4
+	}
+	return FamilyIPv6
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Applications 应用的标准端口，用于识别运行在非标准端口上的应用，例如运行在443端口上的SSH
+//
+// 应用名称不区分大小写；同一张表中重复定义的应用以第一次定义为准。
+type Applications struct {
+	ports map[string]map[portKey]bool
+}
+
+// NewApplications 创建空表
+func NewApplications() *Applications {
+	return &Applications{ports: make(map[string]map[portKey]bool)}
+}
+
+// Add 添加应用的标准端口，transport为空表示TCP和UDP通用
+func (a *Applications) Add(application string, ports ...portKey) error {
+	key := normalizeApplication(application)
+	if key == "" {
+		return fmt.Errorf("应用名称为空")
+	}
+	if _, exists := a.ports[key]; exists {
+		return nil
+	}
+
+	set := make(map[portKey]bool, len(ports))
+	for _, port := range ports {
+		set[port] = true
+	}
+	a.ports[key] = set
+	return nil
+}
+
+// lookup 判断端口是否为应用的标准端口，known为false表示表中没有该应用
+func (a *Applications) lookup(application, transport string, port uint16) (standard, known bool) {
+	set, known := a.ports[normalizeApplication(application)]
+	if !known {
+		return false, false
+	}
+	return set[portKey{transport: transport, port: port}] || set[portKey{port: port}], true
+}
+
+// ParseApplications 解析应用的标准端口，应用之间用换行或分号分隔，# 之后为注释
+//
+// 每个条目为 应用=端口[/协议]|端口[/协议]，例如 SSH=22/tcp|2222/tcp、QUIC=443/udp；
+// 省略协议时TCP和UDP通用。
+func ParseApplications(text string) (*Applications, error) {
+	apps := NewApplications()
+	for _, line := range strings.Split(text, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		for _, entry := range strings.Split(line, ";") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+
+			name, list, ok := strings.Cut(entry, "=")
+			if !ok {
+				return nil, fmt.Errorf("应用端口条目 %q 缺少 =", entry)
+			}
+			var ports []portKey
+			for _, spec := range strings.Split(list, "|") {
+				if strings.TrimSpace(spec) == "" {
+					continue
+				}
+				value, transport, _ := strings.Cut(strings.TrimSpace(spec), "/")
+				port, err := parsePort(value)
+				if err != nil {
+					return nil, fmt.Errorf("应用端口条目 %q: %w", entry, err)
+				}
+				ports = append(ports, portKey{transport: normalizeTransport(transport), port: port})
+			}
+			if len(ports) == 0 {
+				return nil, fmt.Errorf("应用端口条目 %q 没有端口", entry)
+			}
+			if err := apps.Add(name, ports...); err != nil {
+				return nil, fmt.Errorf("应用端口条目 %q: %w", entry, err)
+			}
+		}
+	}
+	return apps, nil
+}
+
+// builtinApplications 内置的常见应用标准端口，覆盖应用识别结果与服务名称不一致的情况
+const builtinApplications = `
+HTTP = 80|8000|8008|8080|8888
+HTTPS = 443|8443
+TLS = 443|465|636|853|993|995|8443
+SSL = 443|465|636|993|995|8443
+QUIC = 443/udp
+DNS = 53|853|5353
+SSH = 22
+`
+
+// BuiltinApplications 返回内置的常见应用标准端口表
+func BuiltinApplications() *Applications {
+	apps, err := ParseApplications(builtinApplications)
+	if err != nil {
+		panic(err)
+	}
+	return apps
+}
+
+// normalizeApplication 应用名称统一使用小写，例如 SSH 和 ssh 相同
+func normalizeApplication(application string) string {
+	return strings.ToLower(strings.TrimSpace(application))
+}
@@ -0,0 +1,56 @@
+package services
+
+// builtinServices 内置的常见服务，使用与站点自定义相同的格式
+//
+// 名称与加入注册表之前的输出保持一致，仪表盘和服务分布表按这些名称分类。
+const builtinServices = `
+20 = FTP-data
+21 = FTP
+22 = SSH
+23 = Telnet
+25 = SMTP
+53 = DNS
+67 = DHCP-Server
+68 = DHCP-Client
+69/udp = TFTP
+80 = HTTP
+110 = POP3
+119 = NNTP
+123 = NTP
+137/udp = NetBIOS-NS
+138/udp = NetBIOS-DGM
+139/tcp = NetBIOS-SSN
+143 = IMAP
+161 = SNMP
+162 = SNMP-Trap
+179/tcp = BGP
+389 = LDAP
+443 = HTTPS
+443/udp = QUIC
+445 = SMB
+465 = SMTPS
+500/udp = IKE
+514/udp = Syslog
+636 = LDAPS
+993 = IMAPS
+995 = POP3S
+1433 = MSSQL
+1900/udp = SSDP
+3306 = MySQL
+3389 = RDP
+4500/udp = IPsec-NAT-T
+5353 = mDNS
+5432 = PostgreSQL
+8080 = HTTP-Alt
+8443 = HTTPS-Alt
+27017 = MongoDB
+`
+
+// Builtin 返回内置的常见服务表
+func Builtin() *Table {
+	table, err := ParseOverrides(builtinServices)
+	if err != nil {
+		panic(err)
+	}
+	return table
+}
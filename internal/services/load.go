@@ -0,0 +1,180 @@
+package services
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LoadFile 读取服务数据文件，.csv 文件按IANA的 service-names-port-numbers.csv 解析，
+// 其余按 /etc/services 格式解析
+func LoadFile(path string) (*Table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开服务数据文件失败: %w", err)
+	}
+	defer f.Close()
+
+	var table *Table
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		table, err = ParseIANACSV(f)
+	} else {
+		table, err = ParseServicesFile(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析服务数据文件 %s 失败: %w", path, err)
+	}
+	return table, nil
+}
+
+// ParseIANACSV 解析IANA发布的服务名称和端口号CSV
+//
+// 按表头定位 Service Name、Port Number 和 Transport Protocol 三列，跳过没有服务名称、
+// 端口或传输层协议的保留行；端口号可以是 6000-6063 形式的范围。
+func ParseIANACSV(r io.Reader) (*Table, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("读取CSV表头失败: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	nameCol, okName := columns["Service Name"]
+	portCol, okPort := columns["Port Number"]
+	transportCol, okTransport := columns["Transport Protocol"]
+	if !okName || !okPort || !okTransport {
+		return nil, fmt.Errorf("CSV缺少 Service Name、Port Number 或 Transport Protocol 列")
+	}
+
+	table := NewTable()
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取CSV第 %d 行失败: %w", line, err)
+		}
+		if len(record) <= max(nameCol, portCol, transportCol) {
+			continue
+		}
+
+		name := strings.TrimSpace(record[nameCol])
+		ports := strings.TrimSpace(record[portCol])
+		transport := strings.TrimSpace(record[transportCol])
+		if name == "" || ports == "" || transport == "" {
+			continue
+		}
+
+		first, last, err := parsePortRange(ports)
+		if err != nil {
+			return nil, fmt.Errorf("CSV第 %d 行: %w", line, err)
+		}
+		if err := table.Add(transport, first, last, name); err != nil {
+			return nil, fmt.Errorf("CSV第 %d 行: %w", line, err)
+		}
+	}
+	return table, nil
+}
+
+// ParseServicesFile 解析 /etc/services 格式的文件：每行为 服务名称 端口/协议 [别名...]，# 之后为注释
+func ParseServicesFile(r io.Reader) (*Table, error) {
+	table := NewTable()
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("第 %d 行缺少端口/协议", line)
+		}
+
+		ports, transport, ok := strings.Cut(fields[1], "/")
+		if !ok || transport == "" {
+			return nil, fmt.Errorf("第 %d 行的端口/协议 %q 无效", line, fields[1])
+		}
+		first, last, err := parsePortRange(ports)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行: %w", line, err)
+		}
+		if err := table.Add(transport, first, last, fields[0]); err != nil {
+			return nil, fmt.Errorf("第 %d 行: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取服务数据失败: %w", err)
+	}
+	return table, nil
+}
+
+// ParseOverrides 解析站点自定义的服务名称，条目之间用换行、逗号或分号分隔，# 之后为注释
+//
+// 每个条目为 端口[-端口][/协议] = 服务名称，例如 9092/tcp = kafka-internal、
+// 8000-8099 = internal-web；省略协议时TCP和UDP通用。
+func ParseOverrides(text string) (*Table, error) {
+	table := NewTable()
+	for _, line := range strings.Split(text, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		for _, entry := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ';' }) {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+
+			spec, name, ok := strings.Cut(entry, "=")
+			if !ok {
+				return nil, fmt.Errorf("服务名称条目 %q 缺少 =", entry)
+			}
+			ports, transport, _ := strings.Cut(strings.TrimSpace(spec), "/")
+			first, last, err := parsePortRange(ports)
+			if err != nil {
+				return nil, fmt.Errorf("服务名称条目 %q: %w", entry, err)
+			}
+			if err := table.Add(transport, first, last, name); err != nil {
+				return nil, fmt.Errorf("服务名称条目 %q: %w", entry, err)
+			}
+		}
+	}
+	return table, nil
+}
+
+// parsePortRange 解析单个端口或 first-last 形式的端口范围
+func parsePortRange(value string) (first, last uint16, err error) {
+	low, high, isRange := strings.Cut(strings.TrimSpace(value), "-")
+	first, err = parsePort(low)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !isRange {
+		return first, first, nil
+	}
+	if last, err = parsePort(high); err != nil {
+		return 0, 0, err
+	}
+	if first > last {
+		return 0, 0, fmt.Errorf("端口范围 %q 无效", value)
+	}
+	return first, last, nil
+}
+
+// parsePort 解析0到65535之间的端口号
+func parsePort(value string) (uint16, error) {
+	port, err := strconv.ParseUint(strings.TrimSpace(value), 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("端口号 %q 无效", value)
+	}
+	return uint16(port), nil
+}
@@ -0,0 +1,202 @@
+// Package services 提供端口到服务名称的注册表，统计、持久化和输出中的服务名称都由它确定
+package services
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Table 一组端口到服务名称的映射，支持单个端口和端口范围
+//
+// 同一张表中重复定义的端口以第一次定义为准；需要覆盖时放到优先级更高的表中。
+type Table struct {
+	ports  map[portKey]string
+	ranges []portRange
+	names  map[string]bool // 表中出现过的服务名称（小写），用于判断应用是否有标准端口
+}
+
+// portKey 传输层协议和端口号，transport为空表示不区分传输层协议
+type portKey struct {
+	transport string
+	port      uint16
+}
+
+// portRange 一段端口范围对应的服务，包含首尾端口
+type portRange struct {
+	transport   string
+	first, last uint16
+	name        string
+}
+
+// NewTable 创建空表
+func NewTable() *Table {
+	return &Table{ports: make(map[portKey]string), names: make(map[string]bool)}
+}
+
+// Add 添加端口范围 [first, last] 对应的服务，first等于last时为单个端口；transport为空表示TCP和UDP通用
+func (t *Table) Add(transport string, first, last uint16, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("端口 %d 的服务名称为空", first)
+	}
+	if first > last {
+		return fmt.Errorf("端口范围 %d-%d 无效", first, last)
+	}
+
+	transport = normalizeTransport(transport)
+	t.names[normalizeApplication(name)] = true
+	if first == last {
+		key := portKey{transport: transport, port: first}
+		if _, exists := t.ports[key]; !exists {
+			t.ports[key] = name
+		}
+		return nil
+	}
+	t.ranges = append(t.ranges, portRange{transport: transport, first: first, last: last, name: name})
+	return nil
+}
+
+// Len 返回表中单个端口和端口范围的条目数
+func (t *Table) Len() int {
+	return len(t.ports) + len(t.ranges)
+}
+
+// lookup 在表中查找指定传输层协议的端口：先查单个端口，再查包含该端口的最小范围
+func (t *Table) lookup(transport string, port uint16) (string, bool) {
+	if name, exists := t.ports[portKey{transport: transport, port: port}]; exists {
+		return name, true
+	}
+
+	var best *portRange
+	for i := range t.ranges {
+		r := &t.ranges[i]
+		if r.transport != transport || port < r.first || port > r.last {
+			continue
+		}
+		if best == nil || r.last-r.first < best.last-best.first {
+			best = r
+		}
+	}
+	if best != nil {
+		return best.name, true
+	}
+	return "", false
+}
+
+// Registry 按优先级叠加的多张服务表，以及应用的标准端口
+type Registry struct {
+	tables []*Table
+	apps   []*Applications
+}
+
+// New 创建注册表，tables按优先级从高到低排列
+func New(tables ...*Table) *Registry {
+	return &Registry{tables: tables}
+}
+
+// WithApplications 返回使用apps判断应用标准端口的注册表，apps按优先级从高到低排列
+func (r *Registry) WithApplications(apps ...*Applications) *Registry {
+	return &Registry{tables: r.tables, apps: apps}
+}
+
+// Lookup 查找端口对应的服务名称，按表的优先级依次查找
+//
+// 每张表中先查指定传输层协议的条目，再查不区分协议的条目；transport为空时依次尝试
+// 不区分协议、TCP和UDP的条目。
+func (r *Registry) Lookup(transport string, port uint16) (string, bool) {
+	transports := []string{normalizeTransport(transport), ""}
+	if transports[0] == "" {
+		transports = []string{"", "tcp", "udp"}
+	}
+
+	for _, table := range r.tables {
+		for _, t := range transports {
+			if name, exists := table.lookup(t, port); exists {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Name 返回端口对应的服务名称，注册表中没有时按端口范围返回通用分类
+func (r *Registry) Name(transport string, port uint16) string {
+	if name, exists := r.Lookup(transport, port); exists {
+		return name
+	}
+
+	// 一些端口范围的通用规则
+	if port < 1024 {
+		return "系统/保留端口"
+	} else if port <= 49151 {
+		return "注册端口"
+	} else {
+		return "动态/私有端口"
+	}
+}
+
+// IsWellKnown 判断端口是否为系统端口或注册表中有服务的端口
+func (r *Registry) IsWellKnown(transport string, port uint16) bool {
+	_, known := r.Lookup(transport, port)
+	return known || port < 1024
+}
+
+// ServicePort 启发式地从一对端口中选出服务端的端口
+//
+// 只有一端是知名端口时取该端；两端都是或都不是知名端口时取较小的端口，
+// 客户端的临时端口通常从较大的范围中分配。
+func (r *Registry) ServicePort(transport string, srcPort, dstPort uint16) uint16 {
+	srcKnown, dstKnown := r.IsWellKnown(transport, srcPort), r.IsWellKnown(transport, dstPort)
+	switch {
+	case srcKnown && !dstKnown:
+		return srcPort
+	case dstKnown && !srcKnown:
+		return dstPort
+	default:
+		return min(srcPort, dstPort)
+	}
+}
+
+// StandardPort 判断应用是否运行在标准端口上，known为false表示不知道该应用的标准端口，无法判断
+//
+// 先按优先级查找应用标准端口表；表中没有该应用时，如果服务表中有同名的服务，则端口对应的
+// 服务名称与应用名称相同时为标准端口，例如服务表中22端口为SSH时，SSH只有运行在22端口上才是标准端口。
+func (r *Registry) StandardPort(application, transport string, port uint16) (standard, known bool) {
+	transport = normalizeTransport(transport)
+	for _, apps := range r.apps {
+		if standard, known := apps.lookup(application, transport, port); known {
+			return standard, true
+		}
+	}
+
+	name := normalizeApplication(application)
+	for _, table := range r.tables {
+		if table.names[name] {
+			return strings.EqualFold(r.Name(transport, port), name), true
+		}
+	}
+	return false, false
+}
+
+// defaultRegistry 进程内共享的注册表，启动时由SetDefault替换
+var defaultRegistry atomic.Pointer[Registry]
+
+func init() {
+	defaultRegistry.Store(New(Builtin()).WithApplications(BuiltinApplications()))
+}
+
+// Default 返回进程内共享的注册表，未设置时只包含内置的常见服务和应用标准端口
+func Default() *Registry {
+	return defaultRegistry.Load()
+}
+
+// SetDefault 替换进程内共享的注册表，应在开始采集之前调用
+func SetDefault(r *Registry) {
+	defaultRegistry.Store(r)
+}
+
+// normalizeTransport 传输层协议统一使用小写，例如 TCP 和 tcp 相同
+func normalizeTransport(transport string) string {
+	return strings.ToLower(strings.TrimSpace(transport))
+}
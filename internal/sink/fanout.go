@@ -0,0 +1,125 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"SnapFlow/internal/models"
+)
+
+// FanOutConfig 多输出目标分发的配置
+type FanOutConfig struct {
+	QueueSize    int           // 每个输出目标的待写队列长度
+	WriteTimeout time.Duration // 单次写入的超时时间
+}
+
+// FanOutSink 把快照同时分发给多个输出目标
+//
+// 每个输出目标拥有独立的队列和写入协程，某个目标写入失败或变慢
+// 只会影响它自己：队列满时丢弃该目标的快照并返回错误，其他目标不受影响。
+type FanOutSink struct {
+	cfg     FanOutConfig
+	workers []*sinkWorker
+	wg      sync.WaitGroup
+	closed  bool
+	mu      sync.Mutex
+}
+
+// sinkWorker 单个输出目标的写入队列
+type sinkWorker struct {
+	sink  SnapshotSink
+	queue chan *models.Snapshot
+}
+
+// NewFanOutSink 为每个输出目标启动独立的写入协程
+func NewFanOutSink(cfg FanOutConfig, sinks ...SnapshotSink) *FanOutSink {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 16
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = 30 * time.Second
+	}
+
+	f := &FanOutSink{cfg: cfg}
+	for _, s := range sinks {
+		w := &sinkWorker{
+			sink:  s,
+			queue: make(chan *models.Snapshot, cfg.QueueSize),
+		}
+		f.workers = append(f.workers, w)
+
+		f.wg.Add(1)
+		go f.run(w)
+	}
+	return f
+}
+
+// Name 返回输出目标名称
+func (f *FanOutSink) Name() string {
+	return "fanout"
+}
+
+// Write 把快照放入每个输出目标的队列，不等待实际写入完成
+func (f *FanOutSink) Write(ctx context.Context, snapshot *models.Snapshot) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return fmt.Errorf("输出目标已关闭")
+	}
+
+	var errs []error
+	for _, w := range f.workers {
+		select {
+		case w.queue <- snapshot:
+		default:
+			errs = append(errs, fmt.Errorf("%s: 写入队列已满，丢弃本次快照", w.sink.Name()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close 等待队列中的快照写完后关闭所有输出目标
+func (f *FanOutSink) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+	f.closed = true
+	for _, w := range f.workers {
+		close(w.queue)
+	}
+	f.mu.Unlock()
+
+	f.wg.Wait()
+
+	var errs []error
+	for _, w := range f.workers {
+		if err := w.sink.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", w.sink.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// run 持续消费单个输出目标的队列
+func (f *FanOutSink) run(w *sinkWorker) {
+	defer f.wg.Done()
+
+	for snapshot := range w.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), f.cfg.WriteTimeout)
+		err := w.sink.Write(ctx, snapshot)
+		cancel()
+
+		if err != nil {
+			log.Printf("输出目标 %s 写入快照失败: %v", w.sink.Name(), err)
+			continue
+		}
+		fmt.Printf("✓ 快照已写入 %s\n", w.sink.Name())
+	}
+}
@@ -0,0 +1,38 @@
+package sink
+
+import (
+	"context"
+	"database/sql"
+
+	"SnapFlow/internal/db"
+	"SnapFlow/internal/models"
+)
+
+// GreptimeSink 通过SQL把快照写入GrepTimeDB
+type GreptimeSink struct {
+	db   *sql.DB
+	opts db.SaveOptions
+}
+
+// NewGreptimeSink 创建GrepTimeDB输出目标，数据库结构版本与程序不一致时拒绝创建
+func NewGreptimeSink(ctx context.Context, database *sql.DB, opts db.SaveOptions) (*GreptimeSink, error) {
+	if err := db.CheckSchemaVersion(ctx, database); err != nil {
+		return nil, err
+	}
+	return &GreptimeSink{db: database, opts: opts}, nil
+}
+
+// Name 返回输出目标名称
+func (s *GreptimeSink) Name() string {
+	return "greptime"
+}
+
+// Write 将快照保存到GrepTimeDB
+func (s *GreptimeSink) Write(ctx context.Context, snapshot *models.Snapshot) error {
+	return db.SaveSnapshotToGrepTimeDB(ctx, s.db, snapshot, s.opts)
+}
+
+// Close 数据库连接由调用方管理，这里不做处理
+func (s *GreptimeSink) Close() error {
+	return nil
+}
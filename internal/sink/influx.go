@@ -0,0 +1,135 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"SnapFlow/internal/models"
+)
+
+// InfluxEndpointConfig 单个行协议写入端点的配置
+type InfluxEndpointConfig struct {
+	Name              string            // 端点名称，用于日志
+	URL               string            // 写入地址，例如 http://localhost:4000/v1/influxdb/write
+	Database          string            // 目标数据库，作为db参数传递
+	Precision         string            // 时间戳精度：ns、us、ms或s，默认ns
+	Username          string            // Basic认证用户名
+	Password          string            // Basic认证密码
+	Token             string            // Token认证，设置后优先于Basic认证
+	Headers           map[string]string // 额外的请求头
+	Gzip              bool              // 是否使用gzip压缩请求体
+	Timeout           time.Duration     // 请求超时时间
+	MeasurementPrefix string            // 测量名称前缀
+}
+
+// InfluxSink 把快照编码为InfluxDB行协议，一次HTTP请求批量写入
+//
+// GrepTimeDB和大多数时序数据库都支持该协议，相比逐行INSERT开销小得多。
+type InfluxSink struct {
+	cfg       InfluxEndpointConfig
+	precision time.Duration
+	client    *http.Client
+	target    string
+}
+
+// NewInfluxSink 创建行协议输出目标
+func NewInfluxSink(cfg InfluxEndpointConfig) (*InfluxSink, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("行协议端点 %s 未配置URL", cfg.Name)
+	}
+	if cfg.Precision == "" {
+		cfg.Precision = "ns"
+	}
+	precision, err := parseLinePrecision(cfg.Precision)
+	if err != nil {
+		return nil, fmt.Errorf("行协议端点 %s 配置无效: %w", cfg.Name, err)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	target, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("行协议端点 %s 的URL无效: %w", cfg.Name, err)
+	}
+	query := target.Query()
+	if cfg.Database != "" {
+		query.Set("db", cfg.Database)
+	}
+	query.Set("precision", cfg.Precision)
+	target.RawQuery = query.Encode()
+
+	return &InfluxSink{
+		cfg:       cfg,
+		precision: precision,
+		client:    &http.Client{Timeout: cfg.Timeout},
+		target:    target.String(),
+	}, nil
+}
+
+// Name 返回输出目标名称
+func (s *InfluxSink) Name() string {
+	return "influx:" + s.cfg.Name
+}
+
+// Write 编码快照并一次性POST到端点
+func (s *InfluxSink) Write(ctx context.Context, snapshot *models.Snapshot) error {
+	payload := EncodeLineProtocol(s.cfg.MeasurementPrefix, s.precision, snapshot)
+
+	body := payload
+	if s.cfg.Gzip {
+		var compressed bytes.Buffer
+		zw := gzip.NewWriter(&compressed)
+		if _, err := zw.Write(payload); err != nil {
+			return fmt.Errorf("压缩行协议数据失败: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("压缩行协议数据失败: %w", err)
+		}
+		body = compressed.Bytes()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("创建行协议请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.cfg.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	switch {
+	case s.cfg.Token != "":
+		req.Header.Set("Authorization", "Token "+s.cfg.Token)
+	case s.cfg.Username != "":
+		req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+	}
+	for key, value := range s.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("发送行协议数据失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("行协议端点返回 %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	io.Copy(io.Discard, resp.Body)
+
+	return nil
+}
+
+// Close 关闭空闲连接
+func (s *InfluxSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
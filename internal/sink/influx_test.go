@@ -0,0 +1,201 @@
+package sink
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"SnapFlow/internal/models"
+)
+
+// influxRequest 测试服务器收到的一次写入请求
+type influxRequest struct {
+	header http.Header
+	query  string
+	body   string
+}
+
+// newInfluxServer 启动记录请求的测试服务器，请求体按Content-Encoding解压
+func newInfluxServer(t *testing.T) (*httptest.Server, <-chan influxRequest) {
+	t.Helper()
+	requests := make(chan influxRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("解压请求体失败: %v", err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			defer zr.Close()
+			body = zr
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			t.Errorf("读取请求体失败: %v", err)
+		}
+		requests <- influxRequest{header: r.Header.Clone(), query: r.URL.RawQuery, body: string(data)}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+// testLineSnapshot 标签和字符串字段中带有需要转义字符的快照
+func testLineSnapshot() *models.Snapshot {
+	end := time.Date(2024, 5, 1, 12, 1, 0, 0, time.UTC)
+	s := &models.Snapshot{Timestamp: end}
+	s.Sensor = "edge 1,rack=a"
+	s.Site = "dc1"
+	s.Interface = "eth0"
+	s.Basic.StartTime = end.Add(-time.Minute)
+	s.Basic.EndTime = end
+	s.Basic.TotalPackets = 10
+	s.Basic.TotalBytes = 1500
+	s.IP.TopPairs[0] = models.IPAddressPair{SourceIP: `10.0.0.1 "nat\a"`, Count: 7, Bytes: 700}
+	s.SetApplicationStats([]models.ApplicationCount{{Name: "app 1,tier=web", Count: 7, Bytes: 700, Percentage: 70}})
+	return s
+}
+
+// findLine 返回以measurement开头的第一行
+func findLine(t *testing.T, body, measurement string) string {
+	t.Helper()
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, measurement+",") || strings.HasPrefix(line, measurement+" ") {
+			return line
+		}
+	}
+	t.Fatalf("请求体中没有 %s:\n%s", measurement, body)
+	return ""
+}
+
+func TestInfluxSinkWrite(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        InfluxEndpointConfig
+		gzip       bool
+		authHeader string
+		query      string
+		ts         string
+	}{
+		{
+			name:       "token",
+			cfg:        InfluxEndpointConfig{Token: "secret", Gzip: true},
+			gzip:       true,
+			authHeader: "Token secret",
+			query:      "db=netflow&precision=ns",
+			ts:         "1714564860000000000",
+		},
+		{
+			name:       "basic",
+			cfg:        InfluxEndpointConfig{Username: "user", Password: "pass"},
+			authHeader: "Basic dXNlcjpwYXNz",
+			query:      "db=netflow&precision=ns",
+			ts:         "1714564860000000000",
+		},
+		{
+			name:       "token优先于basic",
+			cfg:        InfluxEndpointConfig{Token: "secret", Username: "user", Password: "pass"},
+			authHeader: "Token secret",
+			query:      "db=netflow&precision=ns",
+			ts:         "1714564860000000000",
+		},
+		{
+			name:       "秒精度",
+			cfg:        InfluxEndpointConfig{Token: "secret", Precision: "s"},
+			authHeader: "Token secret",
+			query:      "db=netflow&precision=s",
+			ts:         "1714564860",
+		},
+		{
+			name:       "毫秒精度",
+			cfg:        InfluxEndpointConfig{Token: "secret", Precision: "ms"},
+			authHeader: "Token secret",
+			query:      "db=netflow&precision=ms",
+			ts:         "1714564860000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := newInfluxServer(t)
+
+			cfg := tt.cfg
+			cfg.Name = tt.name
+			cfg.URL = server.URL + "/v1/influxdb/write"
+			cfg.Database = "netflow"
+			cfg.MeasurementPrefix = "snapflow_"
+			cfg.Headers = map[string]string{"X-Tenant": "ops"}
+			sink, err := NewInfluxSink(cfg)
+			if err != nil {
+				t.Fatalf("创建行协议输出目标失败: %v", err)
+			}
+			defer sink.Close()
+
+			if err := sink.Write(context.Background(), testLineSnapshot()); err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+			req := <-requests
+
+			if got := req.header.Get("Content-Encoding"); (got == "gzip") != tt.gzip {
+				t.Errorf("Content-Encoding = %q, gzip = %v", got, tt.gzip)
+			}
+			if got := req.header.Get("Authorization"); got != tt.authHeader {
+				t.Errorf("Authorization = %q, want %q", got, tt.authHeader)
+			}
+			if got := req.header.Get("X-Tenant"); got != "ops" {
+				t.Errorf("X-Tenant = %q, want ops", got)
+			}
+			if req.query != tt.query {
+				t.Errorf("query = %q, want %q", req.query, tt.query)
+			}
+
+			const labels = `sensor=edge\ 1\,rack\=a,site=dc1,interface=eth0`
+			ts := tt.ts
+			wantLines := map[string]string{
+				"snapflow_basic_stats": "snapflow_basic_stats," + labels +
+					" total_packets=10i,total_bytes=1500i,window_size_seconds=60i " + ts,
+				"snapflow_top_source_ips": "snapflow_top_source_ips," + labels +
+					`,pos_rank=1 source_ip="10.0.0.1 \"nat\\a\"",packet_count=7i,byte_count=700i ` + ts,
+				"snapflow_application_stats": "snapflow_application_stats," + labels +
+					`,application=app\ 1\,tier\=web packet_count=7i,byte_count=700i,percentage=70 ` + ts,
+			}
+			for measurement, want := range wantLines {
+				if got := findLine(t, req.body, measurement); got != want {
+					t.Errorf("%s:\ngot  %s\nwant %s", measurement, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewInfluxSinkInvalidPrecision(t *testing.T) {
+	_, err := NewInfluxSink(InfluxEndpointConfig{Name: "bad", URL: "http://localhost", Precision: "h"})
+	if err == nil {
+		t.Fatal("不支持的时间戳精度应返回错误")
+	}
+}
+
+func TestInfluxSinkWriteError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid line protocol", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	sink, err := NewInfluxSink(InfluxEndpointConfig{Name: "bad", URL: server.URL})
+	if err != nil {
+		t.Fatalf("创建行协议输出目标失败: %v", err)
+	}
+	defer sink.Close()
+
+	err = sink.Write(context.Background(), testLineSnapshot())
+	if err == nil || !strings.Contains(err.Error(), "invalid line protocol") {
+		t.Fatalf("错误 = %v，需要包含端点返回的内容", err)
+	}
+}
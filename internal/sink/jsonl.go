@@ -0,0 +1,142 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"SnapFlow/internal/models"
+)
+
+// JSONLinesConfig JSON Lines文件输出的配置
+type JSONLinesConfig struct {
+	Path     string // 当前写入的文件路径，轮转后的文件为 Path.1、Path.2 ...
+	MaxBytes int64  // 单个文件的最大字节数，<=0 表示不轮转
+	MaxFiles int    // 保留的历史文件数量
+}
+
+// JSONLinesSink 把每个快照作为一行JSON追加到文件中，按大小轮转
+//
+// 文件只追加不修改，重新采集同一窗口会产生相同ID的新行，读取方按ID保留最后一行即可。
+type JSONLinesSink struct {
+	cfg  JSONLinesConfig
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewJSONLinesSink 打开(或创建)JSON Lines文件
+func NewJSONLinesSink(cfg JSONLinesConfig) (*JSONLinesSink, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("JSON Lines输出路径不能为空")
+	}
+	if cfg.MaxFiles < 0 {
+		cfg.MaxFiles = 0
+	}
+
+	s := &JSONLinesSink{cfg: cfg}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Name 返回输出目标名称
+func (s *JSONLinesSink) Name() string {
+	return "jsonl"
+}
+
+// Write 追加一行快照JSON，必要时先轮转文件
+func (s *JSONLinesSink) Write(ctx context.Context, snapshot *models.Snapshot) error {
+	line, err := snapshot.ToCompactJSON()
+	if err != nil {
+		return err
+	}
+	data := append([]byte(line), '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return fmt.Errorf("JSON Lines文件已关闭")
+	}
+
+	if s.cfg.MaxBytes > 0 && s.size > 0 && s.size+int64(len(data)) > s.cfg.MaxBytes {
+		if err := s.rotate(); err != nil {
+			return fmt.Errorf("轮转JSON Lines文件失败: %w", err)
+		}
+	}
+
+	n, err := s.file.Write(data)
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("写入JSON Lines文件失败: %w", err)
+	}
+	return nil
+}
+
+// Close 关闭当前文件
+func (s *JSONLinesSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// open 以追加模式打开当前文件并记录已有大小
+func (s *JSONLinesSink) open() error {
+	file, err := os.OpenFile(s.cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("打开JSON Lines文件失败: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("读取JSON Lines文件信息失败: %w", err)
+	}
+
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// rotate 关闭当前文件，依次重命名历史文件并删除超出数量的最旧文件
+func (s *JSONLinesSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	s.file = nil
+
+	if s.cfg.MaxFiles == 0 {
+		if err := os.Remove(s.cfg.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return s.open()
+	}
+
+	oldest := fmt.Sprintf("%s.%d", s.cfg.Path, s.cfg.MaxFiles)
+	if err := os.Remove(oldest); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for i := s.cfg.MaxFiles - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", s.cfg.Path, i)
+		to := fmt.Sprintf("%s.%d", s.cfg.Path, i+1)
+		if err := os.Rename(from, to); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := os.Rename(s.cfg.Path, s.cfg.Path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return s.open()
+}
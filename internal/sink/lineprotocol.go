@@ -0,0 +1,561 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"SnapFlow/internal/models"
+)
+
+// lineProtocolEncoder 把快照编码为InfluxDB行协议
+type lineProtocolEncoder struct {
+	prefix    string        // 测量名称前缀，避免与SQL表重名
+	precision time.Duration // 时间戳单位，与请求的precision参数一致
+	labels    []lineTag     // 每条记录都带上的来源标签
+	buf       bytes.Buffer
+}
+
+// linePrecisions 行协议支持的时间戳精度
+var linePrecisions = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+}
+
+// parseLinePrecision 解析时间戳精度参数
+func parseLinePrecision(precision string) (time.Duration, error) {
+	unit, ok := linePrecisions[precision]
+	if !ok {
+		return 0, fmt.Errorf("不支持的时间戳精度 %q，可选 ns、us、ms、s", precision)
+	}
+	return unit, nil
+}
+
+// lineTag 行协议中的一个标签
+type lineTag struct {
+	key   string
+	value string
+}
+
+// lineField 行协议中的一个字段，value必须已按行协议格式编码
+type lineField struct {
+	key   string
+	value string
+}
+
+// EncodeLineProtocol 把快照的各个部分编码为多条行协议记录
+//
+// 时间戳使用窗口结束时间，按precision的单位编码。重新写入同一窗口时序列和时间戳都相同，数据库会覆盖旧值。
+func EncodeLineProtocol(prefix string, precision time.Duration, snapshot *models.Snapshot) []byte {
+	e := &lineProtocolEncoder{
+		prefix:    prefix,
+		precision: precision,
+		labels: []lineTag{
+			{key: "sensor", value: snapshot.Sensor},
+			{key: "site", value: snapshot.Site},
+			{key: "interface", value: snapshot.Interface},
+			{key: "profile", value: snapshot.Profile},
+		},
+	}
+	ts := snapshot.WindowEnd()
+
+	// 1. 基础统计
+	windowSize := int64(snapshot.Basic.EndTime.Sub(snapshot.Basic.StartTime).Seconds())
+	e.write("basic_stats", nil, []lineField{
+		intField("total_packets", snapshot.Basic.TotalPackets),
+		intField("total_bytes", snapshot.Basic.TotalBytes),
+		{key: "window_size_seconds", value: strconv.FormatInt(windowSize, 10) + "i"},
+	}, ts)
+
+	// 2. IP统计与热门源IP
+	e.write("ip_stats", nil, []lineField{
+		{key: "unique_source_count", value: strconv.Itoa(snapshot.IP.UniqueSourceCount) + "i"},
+		stringField("rank_by", string(snapshot.IP.RankBy.OrDefault())),
+	}, ts)
+	for i, pair := range snapshot.IP.TopPairs {
+		if pair.Count == 0 {
+			continue
+		}
+		e.write("top_source_ips", []lineTag{
+			{key: "pos_rank", value: strconv.Itoa(i + 1)},
+		}, []lineField{
+			stringField("source_ip", pair.SourceIP),
+			intField("packet_count", pair.Count),
+			intField("byte_count", pair.Bytes),
+		}, ts)
+	}
+
+	// 3. MAC统计与热门源MAC
+	e.write("mac_stats", nil, []lineField{
+		{key: "unique_source_count", value: strconv.Itoa(snapshot.MAC.UniqueSourceCount) + "i"},
+	}, ts)
+	for i, mac := range snapshot.MAC.TopSources {
+		if mac.Count == 0 {
+			continue
+		}
+		e.write("top_source_macs", []lineTag{
+			{key: "pos_rank", value: strconv.Itoa(i + 1)},
+		}, []lineField{
+			stringField("source_mac", mac.Address),
+			intField("packet_count", mac.Count),
+		}, ts)
+	}
+
+	// 4. 端口统计与热门目标端口
+	e.write("port_stats", nil, []lineField{
+		{key: "unique_dest_count", value: strconv.Itoa(snapshot.Port.UniqueDestCount) + "i"},
+		stringField("rank_by", string(snapshot.Port.RankBy.OrDefault())),
+	}, ts)
+	for i, pair := range snapshot.Port.TopPairs {
+		if pair.Count == 0 {
+			continue
+		}
+		e.write("top_destination_ports", []lineTag{
+			{key: "pos_rank", value: strconv.Itoa(i + 1)},
+			{key: "port", value: strconv.Itoa(int(pair.DestinationPort))},
+		}, []lineField{
+			intField("packet_count", pair.Count),
+			intField("byte_count", pair.Bytes),
+		}, ts)
+	}
+
+	// 按传输层协议区分的端口排行，排名在每个角色和协议内从1开始
+	ranks := make(map[string]int)
+	for _, port := range snapshot.TransportPort.Ports {
+		group := string(port.Role) + "/" + port.Transport
+		ranks[group]++
+		e.write("top_transport_ports", []lineTag{
+			{key: "pos_rank", value: strconv.Itoa(ranks[group])},
+			{key: "port", value: strconv.Itoa(int(port.Port))},
+			{key: "port_role", value: string(port.Role)},
+			{key: "transport", value: port.Transport},
+		}, []lineField{
+			stringField("service", port.Service),
+			intField("packet_count", port.Count),
+			intField("byte_count", port.Bytes),
+		}, ts)
+	}
+
+	// 5. 协议分布
+	for _, proto := range snapshot.Protocol.Protocols {
+		e.write("protocol_stats", []lineTag{
+			{key: "protocol", value: proto.Name},
+		}, []lineField{
+			intField("packet_count", proto.Count),
+			intField("byte_count", proto.Bytes),
+			floatField("percentage", proto.Percentage),
+		}, ts)
+	}
+
+	// 6. TCP标志分布
+	for _, flag := range snapshot.TCPFlags.Flags {
+		e.write("tcp_flag_stats", []lineTag{
+			{key: "flag", value: flag.Flag},
+		}, []lineField{
+			intField("packet_count", flag.Count),
+			intField("byte_count", flag.Bytes),
+			floatField("percentage", flag.Percentage),
+		}, ts)
+	}
+
+	// 7. 应用层协议分布
+	for _, app := range snapshot.Application.Apps {
+		e.write("application_stats", []lineTag{
+			{key: "application", value: app.Name},
+		}, []lineField{
+			intField("packet_count", app.Count),
+			intField("byte_count", app.Bytes),
+			floatField("percentage", app.Percentage),
+		}, ts)
+	}
+
+	// 8. 服务分布
+	for _, service := range snapshot.Service.Services {
+		e.write("service_stats", []lineTag{
+			{key: "service", value: service.Name},
+		}, []lineField{
+			intField("packet_count", service.Count),
+			intField("byte_count", service.Bytes),
+			floatField("percentage", service.Percentage),
+		}, ts)
+	}
+
+	// 9. 目标IP、会话和五元组流排行
+	e.write("destination_stats", nil, []lineField{
+		{key: "unique_dest_ip_count", value: strconv.Itoa(snapshot.Destination.UniqueDestCount) + "i"},
+		stringField("rank_by", string(snapshot.Destination.RankBy.OrDefault())),
+	}, ts)
+	for i, dest := range snapshot.Destination.TopDestinations {
+		e.write("top_destination_ips", []lineTag{
+			{key: "pos_rank", value: strconv.Itoa(i + 1)},
+		}, append([]lineField{
+			stringField("destination_ip", dest.DestinationIP),
+		}, talkerFields(dest.TalkerTraffic)...), ts)
+	}
+	for i, conv := range snapshot.Conversation.TopConversations {
+		e.write("top_conversations", []lineTag{
+			{key: "pos_rank", value: strconv.Itoa(i + 1)},
+		}, append([]lineField{
+			stringField("source_ip", conv.SourceIP),
+			stringField("destination_ip", conv.DestinationIP),
+		}, talkerFields(conv.TalkerTraffic)...), ts)
+	}
+	for i, flow := range snapshot.Flow.TopFlows {
+		e.write("top_flows", []lineTag{
+			{key: "pos_rank", value: strconv.Itoa(i + 1)},
+			{key: "protocol", value: flow.Protocol},
+		}, append([]lineField{
+			stringField("source_ip", flow.SourceIP),
+			stringField("destination_ip", flow.DestinationIP),
+			intField("source_port", uint64(flow.SourcePort)),
+			intField("destination_port", uint64(flow.DestinationPort)),
+		}, talkerFields(flow.TalkerTraffic)...), ts)
+	}
+
+	// 10. EtherType分布、目标MAC地址类型分布与热门目标MAC
+	for _, etherType := range snapshot.L2.EtherTypes {
+		e.write("ethertype_stats", []lineTag{
+			{key: "ether_type", value: fmt.Sprintf("0x%04X", etherType.EtherType)},
+		}, []lineField{
+			stringField("name", etherType.Name),
+			intField("packet_count", etherType.Count),
+			intField("byte_count", etherType.Bytes),
+			floatField("percentage", etherType.Percentage),
+		}, ts)
+	}
+	for _, cast := range snapshot.L2.Casts {
+		e.write("mac_cast_stats", []lineTag{
+			{key: "mac_cast", value: string(cast.Cast)},
+		}, []lineField{
+			intField("packet_count", cast.Count),
+			intField("byte_count", cast.Bytes),
+			floatField("percentage", cast.Percentage),
+		}, ts)
+	}
+	for i, mac := range snapshot.L2.TopDestinations {
+		e.write("top_destination_macs", []lineTag{
+			{key: "pos_rank", value: strconv.Itoa(i + 1)},
+			{key: "mac_cast", value: string(mac.Cast)},
+		}, []lineField{
+			stringField("destination_mac", mac.Address),
+			intField("packet_count", mac.Count),
+			intField("byte_count", mac.Bytes),
+			stringField("rank_by", string(snapshot.L2.RankBy.OrDefault())),
+		}, ts)
+	}
+
+	// 11. 流量分类：未识别和非标准端口应用的总量、数据包类型分布、应用交叉统计和非标准端口排行
+	classification := snapshot.Classification
+	if len(classification.PacketTypes) > 0 {
+		e.write("classification_stats", nil, []lineField{
+			intField("unknown_count", classification.UnknownCount),
+			intField("unknown_bytes", classification.UnknownBytes),
+			floatField("unknown_percentage", classification.UnknownPercentage),
+			intField("non_standard_count", classification.NonStandardCount),
+			intField("non_standard_bytes", classification.NonStandardBytes),
+			floatField("non_standard_percentage", classification.NonStandardPercentage),
+		}, ts)
+	}
+	for _, packetType := range classification.PacketTypes {
+		e.write("packet_type_stats", []lineTag{
+			{key: "packet_type", value: packetType.Name},
+		}, []lineField{
+			intField("packet_count", packetType.Count),
+			intField("byte_count", packetType.Bytes),
+			floatField("percentage", packetType.Percentage),
+		}, ts)
+	}
+	for _, dimension := range []struct {
+		name   string
+		counts []models.AppDimensionCount
+	}{
+		{"protocol", classification.AppProtocols},
+		{"destination_port", classification.AppPorts},
+	} {
+		for _, count := range dimension.counts {
+			e.write("application_crosstab", []lineTag{
+				{key: "application", value: count.Application},
+				{key: "dimension", value: dimension.name},
+				{key: "dimension_value", value: count.Value},
+			}, []lineField{
+				intField("packet_count", count.Count),
+				intField("byte_count", count.Bytes),
+				floatField("percentage", count.Percentage),
+			}, ts)
+		}
+	}
+	for i, port := range classification.NonStandard {
+		e.write("non_standard_ports", []lineTag{
+			{key: "pos_rank", value: strconv.Itoa(i + 1)},
+			{key: "application", value: port.Application},
+			{key: "transport", value: port.Transport},
+			{key: "port", value: strconv.Itoa(int(port.Port))},
+		}, []lineField{
+			stringField("service", port.Service),
+			intField("packet_count", port.Count),
+			intField("byte_count", port.Bytes),
+		}, ts)
+	}
+
+	// 12. 数据包大小：所有数据包(protocol=all)和各协议的极值、平均值、百分位数及直方图区间
+	for _, h := range snapshot.PacketSize.Histograms() {
+		e.write("packet_size_stats", []lineTag{
+			{key: "protocol", value: h.Protocol},
+		}, []lineField{
+			intField("packet_count", h.Count),
+			intField("byte_count", h.Bytes),
+			intField("min_size", uint64(h.Min)),
+			intField("max_size", uint64(h.Max)),
+			floatField("mean_size", h.Mean),
+			intField("p50_size", uint64(h.P50)),
+			intField("p90_size", uint64(h.P90)),
+			intField("p99_size", uint64(h.P99)),
+		}, ts)
+		for _, bucket := range h.Buckets {
+			e.write("packet_size_histogram", []lineTag{
+				{key: "protocol", value: h.Protocol},
+				{key: "bucket", value: bucket.Bucket},
+			}, []lineField{
+				intField("lower_bound", uint64(bucket.Lower)),
+				intField("upper_bound", uint64(bucket.Upper)),
+				intField("packet_count", bucket.Count),
+				intField("byte_count", bucket.Bytes),
+				floatField("percentage", bucket.Percentage),
+			}, ts)
+		}
+	}
+
+	// 13. 吞吐速率：窗口长度，采集了时间桶时附带平均速率、峰值速率和微突发总量；微突发排行的时间为时间桶开始时间(Unix毫秒)
+	rates := []lineField{
+		floatField("window_seconds", snapshot.Basic.WindowSeconds()),
+	}
+	throughput := snapshot.Throughput
+	if throughput.BucketMillis > 0 {
+		rates = append(rates,
+			floatField("packets_per_second", throughput.PacketsPerSecond()),
+			floatField("bits_per_second", throughput.BitsPerSecond()),
+			intField("bucket_ms", uint64(throughput.BucketMillis)),
+			floatField("burst_factor", throughput.BurstFactor),
+			floatField("peak_pps", throughput.PeakPPS),
+			floatField("peak_bps", throughput.PeakBPS),
+			intField("burst_count", uint64(throughput.BurstCount)),
+			intField("burst_packets", throughput.BurstPackets),
+			intField("burst_bytes", throughput.BurstBytes),
+			floatField("burst_percentage", throughput.BurstPercentage),
+		)
+		if !throughput.PeakAt.IsZero() {
+			rates = append(rates, lineField{key: "peak_at", value: strconv.FormatInt(throughput.PeakAt.UnixMilli(), 10) + "i"})
+		}
+	}
+	e.write("throughput_stats", nil, rates, ts)
+	for i, burst := range throughput.Bursts {
+		e.write("microbursts", []lineTag{
+			{key: "pos_rank", value: strconv.Itoa(i + 1)},
+		}, []lineField{
+			{key: "burst_start", value: strconv.FormatInt(burst.Start.UnixMilli(), 10) + "i"},
+			intField("packet_count", burst.Packets),
+			intField("byte_count", burst.Bytes),
+			floatField("packets_per_second", burst.PPS),
+			floatField("bits_per_second", burst.BPS),
+		}, ts)
+	}
+
+	// 14. 流量方向：各方向总量、每个方向的热门源和目标地址、协议分布和目标端口排行
+	for _, d := range snapshot.Direction.Directions {
+		e.write("direction_stats", []lineTag{
+			{key: "direction", value: string(d.Direction)},
+		}, []lineField{
+			intField("packet_count", d.Count),
+			intField("byte_count", d.Bytes),
+			floatField("percentage", d.Percentage),
+		}, ts)
+	}
+	talkerRanks := make(map[string]int)
+	for _, talker := range snapshot.Direction.TopTalkers {
+		key := string(talker.Direction) + "/" + string(talker.Role)
+		talkerRanks[key]++
+		e.write("direction_top_talkers", []lineTag{
+			{key: "direction", value: string(talker.Direction)},
+			{key: "role", value: string(talker.Role)},
+			{key: "pos_rank", value: strconv.Itoa(talkerRanks[key])},
+		}, []lineField{
+			stringField("address", talker.Address),
+			intField("packet_count", talker.Count),
+			intField("byte_count", talker.Bytes),
+			stringField("rank_by", string(snapshot.Direction.RankBy.OrDefault())),
+		}, ts)
+	}
+	for _, dimension := range []struct {
+		name   string
+		counts []models.DirectionDimensionCount
+	}{
+		{"protocol", snapshot.Direction.Protocols},
+		{"destination_port", snapshot.Direction.Ports},
+	} {
+		for _, count := range dimension.counts {
+			e.write("direction_breakdown", []lineTag{
+				{key: "direction", value: string(count.Direction)},
+				{key: "dimension", value: dimension.name},
+				{key: "dimension_value", value: count.Value},
+			}, []lineField{
+				intField("packet_count", count.Count),
+				intField("byte_count", count.Bytes),
+				floatField("percentage", count.Percentage),
+			}, ts)
+		}
+	}
+
+	// 15. 前缀：每个角色、地址族和前缀长度的唯一前缀数量和热门前缀
+	for _, u := range snapshot.Prefix.Unique {
+		e.write("prefix_unique_counts", []lineTag{
+			{key: "role", value: string(u.Role)},
+			{key: "family", value: u.Family},
+			{key: "prefix_length", value: strconv.Itoa(u.Length)},
+		}, []lineField{
+			intField("unique_count", uint64(u.Count)),
+		}, ts)
+	}
+	for _, role := range []struct {
+		role     models.TalkerRole
+		prefixes []models.PrefixCount
+	}{
+		{models.TalkerSource, snapshot.Prefix.TopSources},
+		{models.TalkerDestination, snapshot.Prefix.TopDestinations},
+	} {
+		prefixRanks := make(map[string]int)
+		for _, p := range role.prefixes {
+			key := p.Family + "/" + strconv.Itoa(p.Length)
+			prefixRanks[key]++
+			e.write("top_prefixes", []lineTag{
+				{key: "role", value: string(role.role)},
+				{key: "family", value: p.Family},
+				{key: "prefix_length", value: strconv.Itoa(p.Length)},
+				{key: "pos_rank", value: strconv.Itoa(prefixRanks[key])},
+			}, []lineField{
+				stringField("prefix", p.Prefix),
+				intField("packet_count", p.Count),
+				intField("byte_count", p.Bytes),
+				stringField("rank_by", string(snapshot.Prefix.RankBy.OrDefault())),
+			}, ts)
+		}
+	}
+
+	// 16. 国家和自治系统：每个角色的排行，以及排行中地址的解析结果
+	geoRanks := make(map[string]int)
+	for _, country := range snapshot.Geo.TopCountries {
+		key := "country/" + string(country.Role)
+		geoRanks[key]++
+		e.write("top_countries", []lineTag{
+			{key: "role", value: string(country.Role)},
+			{key: "pos_rank", value: strconv.Itoa(geoRanks[key])},
+		}, []lineField{
+			stringField("country_code", country.CountryCode),
+			stringField("country", country.Country),
+			intField("packet_count", country.Count),
+			intField("byte_count", country.Bytes),
+			floatField("percentage", country.Percentage),
+			stringField("rank_by", string(snapshot.Geo.RankBy.OrDefault())),
+		}, ts)
+	}
+	for _, asn := range snapshot.Geo.TopASNs {
+		key := "asn/" + string(asn.Role)
+		geoRanks[key]++
+		e.write("top_asns", []lineTag{
+			{key: "role", value: string(asn.Role)},
+			{key: "pos_rank", value: strconv.Itoa(geoRanks[key])},
+		}, []lineField{
+			intField("asn", uint64(asn.ASN)),
+			stringField("organization", asn.Organization),
+			intField("packet_count", asn.Count),
+			intField("byte_count", asn.Bytes),
+			floatField("percentage", asn.Percentage),
+			stringField("rank_by", string(snapshot.Geo.RankBy.OrDefault())),
+		}, ts)
+	}
+	for _, location := range snapshot.Geo.Locations {
+		e.write("ip_locations", []lineTag{
+			{key: "address", value: location.Address},
+		}, []lineField{
+			stringField("country_code", location.CountryCode),
+			stringField("country", location.Country),
+			stringField("city", location.City),
+			intField("asn", uint64(location.ASN)),
+			stringField("organization", location.Organization),
+		}, ts)
+	}
+
+	return e.buf.Bytes()
+}
+
+// talkerFields 排行项的流量字段，出现时间为Unix毫秒
+func talkerFields(traffic models.TalkerTraffic) []lineField {
+	return []lineField{
+		intField("packet_count", traffic.Count),
+		intField("byte_count", traffic.Bytes),
+		{key: "first_seen", value: strconv.FormatInt(traffic.FirstSeen.UnixMilli(), 10) + "i"},
+		{key: "last_seen", value: strconv.FormatInt(traffic.LastSeen.UnixMilli(), 10) + "i"},
+	}
+}
+
+// write 写入一条记录：measurement,tag=v field=v timestamp
+func (e *lineProtocolEncoder) write(measurement string, tags []lineTag, fields []lineField, ts time.Time) {
+	if len(fields) == 0 {
+		return
+	}
+
+	e.buf.WriteString(escapeMeasurement(e.prefix + measurement))
+	for _, tag := range append(e.labels, tags...) {
+		// 行协议不允许空的标签值
+		if tag.value == "" {
+			continue
+		}
+		e.buf.WriteByte(',')
+		e.buf.WriteString(escapeTag(tag.key))
+		e.buf.WriteByte('=')
+		e.buf.WriteString(escapeTag(tag.value))
+	}
+
+	e.buf.WriteByte(' ')
+	for i, field := range fields {
+		if i > 0 {
+			e.buf.WriteByte(',')
+		}
+		e.buf.WriteString(escapeTag(field.key))
+		e.buf.WriteByte('=')
+		e.buf.WriteString(field.value)
+	}
+
+	e.buf.WriteByte(' ')
+	e.buf.WriteString(strconv.FormatInt(ts.UnixNano()/int64(e.precision), 10))
+	e.buf.WriteByte('\n')
+}
+
+// intField 整数字段（行协议整数需要i后缀）
+func intField(key string, value uint64) lineField {
+	return lineField{key: key, value: strconv.FormatUint(value, 10) + "i"}
+}
+
+// floatField 浮点数字段
+func floatField(key string, value float64) lineField {
+	return lineField{key: key, value: strconv.FormatFloat(value, 'f', -1, 64)}
+}
+
+// stringField 字符串字段，需要转义双引号和反斜杠
+func stringField(key, value string) lineField {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+	return lineField{key: key, value: `"` + escaped + `"`}
+}
+
+// escapeMeasurement 转义测量名称中的逗号和空格
+func escapeMeasurement(s string) string {
+	return strings.NewReplacer(",", `\,`, " ", `\ `).Replace(s)
+}
+
+// escapeTag 转义标签键、标签值和字段键中的逗号、等号和空格
+func escapeTag(s string) string {
+	return strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `).Replace(s)
+}
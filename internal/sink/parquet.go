@@ -0,0 +1,568 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"SnapFlow/internal/models"
+)
+
+// ParquetConfig Parquet文件输出的配置
+type ParquetConfig struct {
+	Dir         string        // 输出目录
+	RowsPerFile int           // 每个文件最多写入的快照数量
+	MaxFileAge  time.Duration // 单个文件最长写入时间，到期后关闭并开始新文件
+}
+
+// parquetSnapshotRow Parquet文件中的一行，对应一个快照
+type parquetSnapshotRow struct {
+	SnapshotID       string                 `parquet:"snapshot_id"`
+	Sensor           string                 `parquet:"sensor,dict"`
+	Site             string                 `parquet:"site,dict"`
+	Interface        string                 `parquet:"interface,dict"`
+	Profile          string                 `parquet:"profile,dict"`
+	Timestamp        int64                  `parquet:"ts,timestamp(millisecond)"`
+	WindowStart      int64                  `parquet:"window_start,timestamp(millisecond)"`
+	WindowEnd        int64                  `parquet:"window_end,timestamp(millisecond)"`
+	TotalPackets     uint64                 `parquet:"total_packets"`
+	TotalBytes       uint64                 `parquet:"total_bytes"`
+	UniqueSourceIPs  int64                  `parquet:"unique_source_ips"`
+	UniqueDestPorts  int64                  `parquet:"unique_dest_ports"`
+	UniqueSourceMACs int64                  `parquet:"unique_source_macs"`
+	RankIPsBy        string                 `parquet:"rank_ips_by,dict"`
+	RankPortsBy      string                 `parquet:"rank_ports_by,dict"`
+	UniqueDestIPs    int64                  `parquet:"unique_dest_ips"`
+	TopSourceIPs     []parquetNamedCount    `parquet:"top_source_ips,list"`
+	TopSourceMACs    []parquetNamedCount    `parquet:"top_source_macs,list"`
+	TopDestPorts     []parquetPortCount     `parquet:"top_destination_ports,list"`
+	TransportPorts   []parquetTransportPort `parquet:"transport_ports,list"`
+	Protocols        []parquetNamedCount    `parquet:"protocols,list"`
+	TCPFlags         []parquetNamedCount    `parquet:"tcp_flags,list"`
+	Applications     []parquetNamedCount    `parquet:"applications,list"`
+	Services         []parquetNamedCount    `parquet:"services,list"`
+	TopDestIPs       []parquetTalker        `parquet:"top_destination_ips,list"`
+	TopConversations []parquetTalker        `parquet:"top_conversations,list"`
+	TopFlows         []parquetTalker        `parquet:"top_flows,list"`
+	EtherTypes       []parquetNamedCount    `parquet:"ether_types,list"`
+	MACCasts         []parquetNamedCount    `parquet:"destination_mac_casts,list"`
+	RankMACsBy       string                 `parquet:"rank_macs_by,dict"`
+	TopDestMACs      []parquetNamedCount    `parquet:"top_destination_macs,list"`
+	UnknownApps      parquetNamedCount      `parquet:"unknown_applications"`
+	NonStandardApps  parquetNamedCount      `parquet:"non_standard_applications"`
+	PacketTypes      []parquetNamedCount    `parquet:"packet_types,list"`
+	AppCrosstab      []parquetAppDimension  `parquet:"application_crosstab,list"`
+	NonStandard      []parquetNonStandard   `parquet:"non_standard_ports,list"`
+	PacketSizes      []parquetPacketSize    `parquet:"packet_sizes,list"`
+	PacketsPerSecond float64                `parquet:"packets_per_second"`
+	BitsPerSecond    float64                `parquet:"bits_per_second"`
+	BurstBucketMS    int64                  `parquet:"burst_bucket_ms"`
+	PeakPPS          float64                `parquet:"peak_pps"`
+	PeakBPS          float64                `parquet:"peak_bps"`
+	PeakAt           int64                  `parquet:"peak_at,timestamp(millisecond),optional"`
+	BurstCount       int64                  `parquet:"microburst_count"`
+	Bursts           parquetNamedCount      `parquet:"microburst_traffic"`
+	TopBursts        []parquetBurst         `parquet:"top_microbursts,list"`
+	Directions       []parquetNamedCount    `parquet:"directions,list"`
+	RankDirectionsBy string                 `parquet:"rank_directions_by,dict"`
+	DirectionTalkers []parquetDirectionItem `parquet:"direction_top_talkers,list"`
+	DirectionCounts  []parquetDirectionItem `parquet:"direction_breakdown,list"`
+	RankPrefixesBy   string                 `parquet:"rank_prefixes_by,dict"`
+	UniquePrefixes   []parquetPrefix        `parquet:"unique_prefixes,list"`
+	TopPrefixes      []parquetPrefix        `parquet:"top_prefixes,list"`
+	RankGeoBy        string                 `parquet:"rank_geo_by,dict"`
+	TopCountries     []parquetGeoCount      `parquet:"top_countries,list"`
+	TopASNs          []parquetGeoCount      `parquet:"top_asns,list"`
+	Locations        []parquetLocation      `parquet:"ip_locations,list"`
+}
+
+// parquetGeoCount 国家或自治系统排行项：国家的Key为国家代码，自治系统的Key为 AS 加编号
+type parquetGeoCount struct {
+	Role       string  `parquet:"role,dict"`
+	Key        string  `parquet:"key,dict"`
+	Name       string  `parquet:"name,dict"`
+	Count      uint64  `parquet:"count"`
+	Bytes      uint64  `parquet:"bytes"`
+	Percentage float64 `parquet:"percentage"`
+}
+
+// parquetLocation 排行中地址的国家、城市和自治系统
+type parquetLocation struct {
+	Address      string `parquet:"address"`
+	CountryCode  string `parquet:"country_code,dict"`
+	Country      string `parquet:"country,dict"`
+	City         string `parquet:"city,dict"`
+	ASN          uint32 `parquet:"asn"`
+	Organization string `parquet:"organization,dict"`
+}
+
+// parquetPrefix 前缀统计的一项：Role为 source 或 destination；
+// 唯一数量没有Prefix和Bytes，Count为唯一前缀数量
+type parquetPrefix struct {
+	Role   string `parquet:"role,dict"`
+	Family string `parquet:"family,dict"`
+	Length int32  `parquet:"length"`
+	Prefix string `parquet:"prefix,dict"`
+	Count  uint64 `parquet:"count"`
+	Bytes  uint64 `parquet:"bytes"`
+}
+
+// parquetDirectionItem 流量方向内的一项：地址排行的Kind为 source 或 destination，
+// 分布的Kind为 protocol 或 destination_port
+type parquetDirectionItem struct {
+	Direction  string  `parquet:"direction,dict"`
+	Kind       string  `parquet:"kind,dict"`
+	Value      string  `parquet:"value,dict"`
+	Count      uint64  `parquet:"count"`
+	Bytes      uint64  `parquet:"bytes"`
+	Percentage float64 `parquet:"percentage"`
+}
+
+// parquetBurst 微突发排行项，Start为时间桶开始时间
+type parquetBurst struct {
+	Start int64   `parquet:"start,timestamp(millisecond)"`
+	Count uint64  `parquet:"count"`
+	Bytes uint64  `parquet:"bytes"`
+	PPS   float64 `parquet:"pps"`
+	BPS   float64 `parquet:"bps"`
+}
+
+// parquetPacketSize 一个协议的数据包大小统计，协议为all表示所有数据包；区间的名称例如 65-128
+type parquetPacketSize struct {
+	Protocol string              `parquet:"protocol,dict"`
+	Count    uint64              `parquet:"count"`
+	Bytes    uint64              `parquet:"bytes"`
+	Min      int32               `parquet:"min"`
+	Max      int32               `parquet:"max"`
+	Mean     float64             `parquet:"mean"`
+	P50      int32               `parquet:"p50"`
+	P90      int32               `parquet:"p90"`
+	P99      int32               `parquet:"p99"`
+	Buckets  []parquetNamedCount `parquet:"buckets,list"`
+}
+
+// parquetNonStandard 运行在非标准端口上的应用排行项
+type parquetNonStandard struct {
+	Application string `parquet:"application,dict"`
+	Transport   string `parquet:"transport,dict"`
+	Port        int32  `parquet:"port"`
+	Service     string `parquet:"service,dict"`
+	Count       uint64 `parquet:"count"`
+	Bytes       uint64 `parquet:"bytes"`
+}
+
+// parquetAppDimension 应用按协议或目标端口的交叉统计项
+type parquetAppDimension struct {
+	Application string  `parquet:"application,dict"`
+	Dimension   string  `parquet:"dimension,dict"`
+	Value       string  `parquet:"value,dict"`
+	Count       uint64  `parquet:"count"`
+	Bytes       uint64  `parquet:"bytes"`
+	Percentage  float64 `parquet:"percentage"`
+}
+
+// parquetNamedCount 名称及其数据包数量和字节数
+type parquetNamedCount struct {
+	Name       string  `parquet:"name,dict"`
+	Count      uint64  `parquet:"count"`
+	Bytes      uint64  `parquet:"bytes"`
+	Percentage float64 `parquet:"percentage"`
+}
+
+// parquetPortCount 端口及其数据包数量和字节数
+type parquetPortCount struct {
+	Port  int32  `parquet:"port"`
+	Count uint64 `parquet:"count"`
+	Bytes uint64 `parquet:"bytes"`
+}
+
+// parquetTransportPort 按传输层协议区分的端口排行项
+type parquetTransportPort struct {
+	Role      string `parquet:"port_role,dict"`
+	Transport string `parquet:"transport,dict"`
+	Port      int32  `parquet:"port"`
+	Service   string `parquet:"service,dict"`
+	Count     uint64 `parquet:"count"`
+	Bytes     uint64 `parquet:"bytes"`
+}
+
+// parquetTalker 目标IP、会话或五元组流排行项，该排行不区分的列为零值
+type parquetTalker struct {
+	SourceIP        string `parquet:"source_ip,dict"`
+	DestinationIP   string `parquet:"destination_ip,dict"`
+	SourcePort      int32  `parquet:"source_port"`
+	DestinationPort int32  `parquet:"destination_port"`
+	Protocol        string `parquet:"protocol,dict"`
+	Count           uint64 `parquet:"count"`
+	Bytes           uint64 `parquet:"bytes"`
+	FirstSeen       int64  `parquet:"first_seen,timestamp(millisecond)"`
+	LastSeen        int64  `parquet:"last_seen,timestamp(millisecond)"`
+}
+
+// newParquetTalker 用排行项的流量和出现时间创建Parquet行
+func newParquetTalker(traffic models.TalkerTraffic) parquetTalker {
+	return parquetTalker{
+		Count:     traffic.Count,
+		Bytes:     traffic.Bytes,
+		FirstSeen: traffic.FirstSeen.UnixMilli(),
+		LastSeen:  traffic.LastSeen.UnixMilli(),
+	}
+}
+
+// ParquetSink 把快照写入按行数和时间滚动的Parquet文件
+//
+// 文件尾只在滚动或关闭时写入，写入中的文件以.tmp结尾且无法读取。
+// 进程异常退出时会丢失当前文件中的全部快照，最多 RowsPerFile 个或 MaxFileAge 内的数据；
+// 需要缩小该窗口时调小这两个配置。
+type ParquetSink struct {
+	cfg ParquetConfig
+
+	mu       sync.Mutex
+	file     *os.File
+	writer   *parquet.GenericWriter[parquetSnapshotRow]
+	tmpPath  string
+	rows     int
+	openedAt time.Time
+}
+
+// NewParquetSink 创建Parquet输出目标
+func NewParquetSink(cfg ParquetConfig) (*ParquetSink, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("Parquet输出目录不能为空")
+	}
+	if cfg.RowsPerFile <= 0 {
+		cfg.RowsPerFile = 720
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建Parquet输出目录失败: %w", err)
+	}
+	if err := setAsideIncompleteParquet(cfg.Dir); err != nil {
+		return nil, err
+	}
+	return &ParquetSink{cfg: cfg}, nil
+}
+
+// setAsideIncompleteParquet 把上次异常退出时留下的临时文件重命名为.partial
+//
+// 这些文件缺少文件尾，不能直接读取，保留下来供手动恢复已刷新的行组，
+// 同时不会再被当作写入中的文件或与新文件重名。
+func setAsideIncompleteParquet(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.parquet.tmp"))
+	if err != nil {
+		return fmt.Errorf("查找未完成的Parquet文件失败: %w", err)
+	}
+	for _, path := range paths {
+		partial := strings.TrimSuffix(path, ".tmp") + ".partial"
+		if err := os.Rename(path, partial); err != nil {
+			return fmt.Errorf("重命名未完成的Parquet文件失败: %w", err)
+		}
+		log.Printf("发现上次未完成的Parquet文件，缺少文件尾无法直接读取，已重命名为 %s", partial)
+	}
+	return nil
+}
+
+// Name 返回输出目标名称
+func (s *ParquetSink) Name() string {
+	return "parquet"
+}
+
+// Write 写入一行快照，文件达到行数或时间上限时滚动
+func (s *ParquetSink) Write(ctx context.Context, snapshot *models.Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.writer != nil && s.shouldRoll() {
+		if err := s.finish(); err != nil {
+			return err
+		}
+	}
+	if s.writer == nil {
+		if err := s.start(snapshot.Timestamp); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.writer.Write([]parquetSnapshotRow{toParquetRow(snapshot)}); err != nil {
+		return fmt.Errorf("写入Parquet行失败: %w", err)
+	}
+	// 每个快照单独作为一个行组刷新，行数据不在内存中积累到文件滚动；
+	// 文件尾写入前文件仍不可读，不能缩小异常退出时的丢失范围
+	if err := s.writer.Flush(); err != nil {
+		return fmt.Errorf("刷新Parquet行组失败: %w", err)
+	}
+
+	s.rows++
+	return nil
+}
+
+// Close 写入文件尾并关闭当前文件
+func (s *ParquetSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.writer == nil {
+		return nil
+	}
+	return s.finish()
+}
+
+// shouldRoll 判断当前文件是否需要滚动
+func (s *ParquetSink) shouldRoll() bool {
+	if s.rows >= s.cfg.RowsPerFile {
+		return true
+	}
+	return s.cfg.MaxFileAge > 0 && time.Since(s.openedAt) >= s.cfg.MaxFileAge
+}
+
+// start 创建新的临时文件，完成后再重命名为.parquet，避免读取到不完整的文件
+func (s *ParquetSink) start(ts time.Time) error {
+	name := fmt.Sprintf("snapflow_%s.parquet", ts.UTC().Format("20060102T150405.000Z"))
+	s.tmpPath = filepath.Join(s.cfg.Dir, name+".tmp")
+
+	file, err := os.Create(s.tmpPath)
+	if err != nil {
+		return fmt.Errorf("创建Parquet文件失败: %w", err)
+	}
+
+	s.file = file
+	s.writer = parquet.NewGenericWriter[parquetSnapshotRow](file, parquet.Compression(&parquet.Zstd))
+	s.rows = 0
+	s.openedAt = time.Now()
+	return nil
+}
+
+// finish 关闭写入器并把临时文件重命名为正式文件
+func (s *ParquetSink) finish() error {
+	writerErr := s.writer.Close()
+	fileErr := s.file.Close()
+	tmpPath := s.tmpPath
+
+	s.writer = nil
+	s.file = nil
+	s.tmpPath = ""
+
+	if writerErr != nil {
+		return fmt.Errorf("关闭Parquet写入器失败: %w", writerErr)
+	}
+	if fileErr != nil {
+		return fmt.Errorf("关闭Parquet文件失败: %w", fileErr)
+	}
+
+	finalPath := tmpPath[:len(tmpPath)-len(".tmp")]
+	if err := os.Rename(tmpPath, finalPath); err != nil {
+		return fmt.Errorf("重命名Parquet文件失败: %w", err)
+	}
+	return nil
+}
+
+// toParquetRow 把快照转换为Parquet行
+func toParquetRow(snapshot *models.Snapshot) parquetSnapshotRow {
+	row := parquetSnapshotRow{
+		SnapshotID:       snapshot.ID,
+		Sensor:           snapshot.Sensor,
+		Site:             snapshot.Site,
+		Interface:        snapshot.Interface,
+		Profile:          snapshot.Profile,
+		Timestamp:        snapshot.Timestamp.UnixMilli(),
+		WindowStart:      snapshot.Basic.StartTime.UnixMilli(),
+		WindowEnd:        snapshot.Basic.EndTime.UnixMilli(),
+		TotalPackets:     snapshot.Basic.TotalPackets,
+		TotalBytes:       snapshot.Basic.TotalBytes,
+		UniqueSourceIPs:  int64(snapshot.IP.UniqueSourceCount),
+		UniqueDestPorts:  int64(snapshot.Port.UniqueDestCount),
+		UniqueSourceMACs: int64(snapshot.MAC.UniqueSourceCount),
+		RankIPsBy:        string(snapshot.IP.RankBy.OrDefault()),
+		RankPortsBy:      string(snapshot.Port.RankBy.OrDefault()),
+		UniqueDestIPs:    int64(snapshot.Destination.UniqueDestCount),
+		RankMACsBy:       string(snapshot.L2.RankBy.OrDefault()),
+	}
+
+	for _, pair := range snapshot.IP.TopPairs {
+		if pair.Count > 0 {
+			row.TopSourceIPs = append(row.TopSourceIPs, parquetNamedCount{Name: pair.SourceIP, Count: pair.Count, Bytes: pair.Bytes})
+		}
+	}
+	for _, mac := range snapshot.MAC.TopSources {
+		if mac.Count > 0 {
+			row.TopSourceMACs = append(row.TopSourceMACs, parquetNamedCount{Name: mac.Address, Count: mac.Count})
+		}
+	}
+	for _, pair := range snapshot.Port.TopPairs {
+		if pair.Count > 0 {
+			row.TopDestPorts = append(row.TopDestPorts, parquetPortCount{Port: int32(pair.DestinationPort), Count: pair.Count, Bytes: pair.Bytes})
+		}
+	}
+	for _, port := range snapshot.TransportPort.Ports {
+		row.TransportPorts = append(row.TransportPorts, parquetTransportPort{
+			Role:      string(port.Role),
+			Transport: port.Transport,
+			Port:      int32(port.Port),
+			Service:   port.Service,
+			Count:     port.Count,
+			Bytes:     port.Bytes,
+		})
+	}
+	for _, proto := range snapshot.Protocol.Protocols {
+		row.Protocols = append(row.Protocols, parquetNamedCount{Name: proto.Name, Count: proto.Count, Bytes: proto.Bytes, Percentage: proto.Percentage})
+	}
+	for _, flag := range snapshot.TCPFlags.Flags {
+		row.TCPFlags = append(row.TCPFlags, parquetNamedCount{Name: flag.Flag, Count: flag.Count, Bytes: flag.Bytes, Percentage: flag.Percentage})
+	}
+	for _, app := range snapshot.Application.Apps {
+		row.Applications = append(row.Applications, parquetNamedCount{Name: app.Name, Count: app.Count, Bytes: app.Bytes, Percentage: app.Percentage})
+	}
+	for _, service := range snapshot.Service.Services {
+		row.Services = append(row.Services, parquetNamedCount{Name: service.Name, Count: service.Count, Bytes: service.Bytes, Percentage: service.Percentage})
+	}
+	for _, dest := range snapshot.Destination.TopDestinations {
+		talker := newParquetTalker(dest.TalkerTraffic)
+		talker.DestinationIP = dest.DestinationIP
+		row.TopDestIPs = append(row.TopDestIPs, talker)
+	}
+	for _, conv := range snapshot.Conversation.TopConversations {
+		talker := newParquetTalker(conv.TalkerTraffic)
+		talker.SourceIP, talker.DestinationIP = conv.SourceIP, conv.DestinationIP
+		row.TopConversations = append(row.TopConversations, talker)
+	}
+	for _, flow := range snapshot.Flow.TopFlows {
+		talker := newParquetTalker(flow.TalkerTraffic)
+		talker.SourceIP, talker.DestinationIP = flow.SourceIP, flow.DestinationIP
+		talker.SourcePort, talker.DestinationPort = int32(flow.SourcePort), int32(flow.DestinationPort)
+		talker.Protocol = flow.Protocol
+		row.TopFlows = append(row.TopFlows, talker)
+	}
+	for _, etherType := range snapshot.L2.EtherTypes {
+		row.EtherTypes = append(row.EtherTypes, parquetNamedCount{Name: etherType.Name, Count: etherType.Count, Bytes: etherType.Bytes, Percentage: etherType.Percentage})
+	}
+	for _, cast := range snapshot.L2.Casts {
+		row.MACCasts = append(row.MACCasts, parquetNamedCount{Name: string(cast.Cast), Count: cast.Count, Bytes: cast.Bytes, Percentage: cast.Percentage})
+	}
+	for _, mac := range snapshot.L2.TopDestinations {
+		row.TopDestMACs = append(row.TopDestMACs, parquetNamedCount{Name: mac.Address, Count: mac.Count, Bytes: mac.Bytes})
+	}
+
+	// 流量分类
+	classification := snapshot.Classification
+	row.UnknownApps = parquetNamedCount{Name: models.UnknownApplication, Count: classification.UnknownCount,
+		Bytes: classification.UnknownBytes, Percentage: classification.UnknownPercentage}
+	row.NonStandardApps = parquetNamedCount{Name: "non_standard", Count: classification.NonStandardCount,
+		Bytes: classification.NonStandardBytes, Percentage: classification.NonStandardPercentage}
+	for _, packetType := range classification.PacketTypes {
+		row.PacketTypes = append(row.PacketTypes, parquetNamedCount{Name: packetType.Name, Count: packetType.Count, Bytes: packetType.Bytes, Percentage: packetType.Percentage})
+	}
+	for _, count := range classification.AppProtocols {
+		row.AppCrosstab = append(row.AppCrosstab, parquetAppDimension{Application: count.Application, Dimension: "protocol",
+			Value: count.Value, Count: count.Count, Bytes: count.Bytes, Percentage: count.Percentage})
+	}
+	for _, count := range classification.AppPorts {
+		row.AppCrosstab = append(row.AppCrosstab, parquetAppDimension{Application: count.Application, Dimension: "destination_port",
+			Value: count.Value, Count: count.Count, Bytes: count.Bytes, Percentage: count.Percentage})
+	}
+	for _, port := range classification.NonStandard {
+		row.NonStandard = append(row.NonStandard, parquetNonStandard{
+			Application: port.Application,
+			Transport:   port.Transport,
+			Port:        int32(port.Port),
+			Service:     port.Service,
+			Count:       port.Count,
+			Bytes:       port.Bytes,
+		})
+	}
+
+	// 数据包大小
+	for _, h := range snapshot.PacketSize.Histograms() {
+		size := parquetPacketSize{
+			Protocol: h.Protocol,
+			Count:    h.Count,
+			Bytes:    h.Bytes,
+			Min:      int32(h.Min),
+			Max:      int32(h.Max),
+			Mean:     h.Mean,
+			P50:      int32(h.P50),
+			P90:      int32(h.P90),
+			P99:      int32(h.P99),
+		}
+		for _, bucket := range h.Buckets {
+			size.Buckets = append(size.Buckets, parquetNamedCount{Name: bucket.Bucket, Count: bucket.Count, Bytes: bucket.Bytes, Percentage: bucket.Percentage})
+		}
+		row.PacketSizes = append(row.PacketSizes, size)
+	}
+
+	// 吞吐速率
+	throughput := snapshot.Throughput
+	row.PacketsPerSecond = throughput.PacketsPerSecond()
+	row.BitsPerSecond = throughput.BitsPerSecond()
+	row.BurstBucketMS = throughput.BucketMillis
+	row.PeakPPS = throughput.PeakPPS
+	row.PeakBPS = throughput.PeakBPS
+	if !throughput.PeakAt.IsZero() {
+		row.PeakAt = throughput.PeakAt.UnixMilli()
+	}
+	row.BurstCount = int64(throughput.BurstCount)
+	row.Bursts = parquetNamedCount{Name: "microbursts", Count: throughput.BurstPackets,
+		Bytes: throughput.BurstBytes, Percentage: throughput.BurstPercentage}
+	for _, burst := range throughput.Bursts {
+		row.TopBursts = append(row.TopBursts, parquetBurst{Start: burst.Start.UnixMilli(), Count: burst.Packets,
+			Bytes: burst.Bytes, PPS: burst.PPS, BPS: burst.BPS})
+	}
+
+	// 流量方向
+	row.RankDirectionsBy = string(snapshot.Direction.RankBy.OrDefault())
+	for _, d := range snapshot.Direction.Directions {
+		row.Directions = append(row.Directions, parquetNamedCount{Name: string(d.Direction), Count: d.Count, Bytes: d.Bytes, Percentage: d.Percentage})
+	}
+	for _, talker := range snapshot.Direction.TopTalkers {
+		row.DirectionTalkers = append(row.DirectionTalkers, parquetDirectionItem{Direction: string(talker.Direction),
+			Kind: string(talker.Role), Value: talker.Address, Count: talker.Count, Bytes: talker.Bytes})
+	}
+	for _, count := range snapshot.Direction.Protocols {
+		row.DirectionCounts = append(row.DirectionCounts, parquetDirectionItem{Direction: string(count.Direction),
+			Kind: "protocol", Value: count.Value, Count: count.Count, Bytes: count.Bytes, Percentage: count.Percentage})
+	}
+	for _, count := range snapshot.Direction.Ports {
+		row.DirectionCounts = append(row.DirectionCounts, parquetDirectionItem{Direction: string(count.Direction),
+			Kind: "destination_port", Value: count.Value, Count: count.Count, Bytes: count.Bytes, Percentage: count.Percentage})
+	}
+
+	// 前缀
+	row.RankPrefixesBy = string(snapshot.Prefix.RankBy.OrDefault())
+	for _, u := range snapshot.Prefix.Unique {
+		row.UniquePrefixes = append(row.UniquePrefixes, parquetPrefix{Role: string(u.Role), Family: u.Family,
+			Length: int32(u.Length), Count: uint64(u.Count)})
+	}
+	for _, role := range []struct {
+		role     models.TalkerRole
+		prefixes []models.PrefixCount
+	}{
+		{models.TalkerSource, snapshot.Prefix.TopSources},
+		{models.TalkerDestination, snapshot.Prefix.TopDestinations},
+	} {
+		for _, p := range role.prefixes {
+			row.TopPrefixes = append(row.TopPrefixes, parquetPrefix{Role: string(role.role), Family: p.Family,
+				Length: int32(p.Length), Prefix: p.Prefix, Count: p.Count, Bytes: p.Bytes})
+		}
+	}
+
+	// 国家和自治系统
+	row.RankGeoBy = string(snapshot.Geo.RankBy.OrDefault())
+	for _, country := range snapshot.Geo.TopCountries {
+		row.TopCountries = append(row.TopCountries, parquetGeoCount{Role: string(country.Role), Key: country.CountryCode,
+			Name: country.Country, Count: country.Count, Bytes: country.Bytes, Percentage: country.Percentage})
+	}
+	for _, asn := range snapshot.Geo.TopASNs {
+		row.TopASNs = append(row.TopASNs, parquetGeoCount{Role: string(asn.Role), Key: fmt.Sprintf("AS%d", asn.ASN),
+			Name: asn.Organization, Count: asn.Count, Bytes: asn.Bytes, Percentage: asn.Percentage})
+	}
+	for _, location := range snapshot.Geo.Locations {
+		row.Locations = append(row.Locations, parquetLocation(location))
+	}
+
+	return row
+}
@@ -0,0 +1,48 @@
+package sink
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"SnapFlow/internal/models"
+)
+
+func TestParquetSinkSetsAsideIncompleteFiles(t *testing.T) {
+	dir := t.TempDir()
+	leftover := filepath.Join(dir, "snapflow_20240501T120000.000Z.parquet.tmp")
+	if err := os.WriteFile(leftover, []byte("PAR1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sink, err := NewParquetSink(ParquetConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("创建Parquet输出目标失败: %v", err)
+	}
+	if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+		t.Errorf("上次留下的临时文件应被重命名: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "snapflow_20240501T120000.000Z.parquet.partial")); err != nil {
+		t.Errorf("缺少.partial文件: %v", err)
+	}
+
+	// 与遗留文件同名的新文件正常写入和完成
+	s := &models.Snapshot{Timestamp: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), ID: "a"}
+	if err := sink.Write(context.Background(), s); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+	rows, err := parquet.ReadFile[parquetSnapshotRow](filepath.Join(dir, "snapflow_20240501T120000.000Z.parquet"))
+	if err != nil {
+		t.Fatalf("读取Parquet文件失败: %v", err)
+	}
+	if len(rows) != 1 || rows[0].SnapshotID != "a" {
+		t.Errorf("rows = %+v", rows)
+	}
+}
@@ -0,0 +1,84 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"SnapFlow/internal/models"
+)
+
+// PushConfig 推送到汇总中心的配置
+type PushConfig struct {
+	URL     string        // 汇总中心的接收地址，例如 https://aggregator:8480/v1/snapshots
+	Token   string        // 汇总中心为本传感器分配的令牌
+	Timeout time.Duration // 请求超时时间
+}
+
+// PushSink 通过HTTP把快照推送到汇总中心，由汇总中心合并为全局快照
+type PushSink struct {
+	cfg    PushConfig
+	client *http.Client
+}
+
+// NewPushSink 创建推送输出目标
+func NewPushSink(cfg PushConfig) (*PushSink, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("汇总中心地址不能为空")
+	}
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("汇总中心令牌不能为空")
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	return &PushSink{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}, nil
+}
+
+// Name 返回输出目标名称
+func (s *PushSink) Name() string {
+	return "push"
+}
+
+// Write 把快照以JSON格式POST到汇总中心
+func (s *PushSink) Write(ctx context.Context, snapshot *models.Snapshot) error {
+	body, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("序列化快照失败: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("创建推送请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.cfg.Token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("推送快照失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("汇总中心返回 %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	io.Copy(io.Discard, resp.Body)
+
+	return nil
+}
+
+// Close 关闭空闲连接
+func (s *PushSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
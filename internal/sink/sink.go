@@ -0,0 +1,17 @@
+package sink
+
+import (
+	"context"
+
+	"SnapFlow/internal/models"
+)
+
+// SnapshotSink 快照的输出目标，每个实现负责把快照持久化到一种存储中
+type SnapshotSink interface {
+	// Name 返回用于日志的输出目标名称
+	Name() string
+	// Write 写入一个快照
+	Write(ctx context.Context, snapshot *models.Snapshot) error
+	// Close 刷新缓冲并释放资源
+	Close() error
+}
@@ -0,0 +1,181 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"SnapFlow/internal/models"
+	"SnapFlow/internal/spool"
+)
+
+// BackoffConfig 回放失败后的指数退避配置
+type BackoffConfig struct {
+	Min time.Duration // 首次重试等待时间
+	Max time.Duration // 最长等待时间
+}
+
+// SpooledSink 在输出目标不可用时把快照写入本地磁盘缓冲，恢复后按顺序回放
+//
+// 只要缓冲中还有未回放的快照，新的快照也会先进入缓冲，以保证写入顺序。
+type SpooledSink struct {
+	inner   SnapshotSink
+	spool   *spool.Spool
+	backoff BackoffConfig
+	timeout time.Duration
+
+	mu     sync.Mutex // 保证同一时间只有一个协程写入inner
+	wake   chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+	closed bool
+}
+
+// NewSpooledSink 包装一个输出目标并启动后台回放协程
+func NewSpooledSink(inner SnapshotSink, sp *spool.Spool, backoff BackoffConfig, timeout time.Duration) *SpooledSink {
+	if backoff.Min <= 0 {
+		backoff.Min = time.Second
+	}
+	if backoff.Max < backoff.Min {
+		backoff.Max = 5 * time.Minute
+	}
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	s := &SpooledSink{
+		inner:   inner,
+		spool:   sp,
+		backoff: backoff,
+		timeout: timeout,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.replayLoop()
+	s.notify()
+	return s
+}
+
+// Name 返回被包装的输出目标名称
+func (s *SpooledSink) Name() string {
+	return s.inner.Name()
+}
+
+// Write 缓冲为空时直接写入，写入失败或缓冲中有积压时追加到缓冲
+func (s *SpooledSink) Write(ctx context.Context, snapshot *models.Snapshot) error {
+	// 检查缓冲和追加缓冲需要在同一把锁内完成，否则可能与回放交错打乱顺序
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.spool.Empty() {
+		err := s.inner.Write(ctx, snapshot)
+		if err == nil {
+			return nil
+		}
+		log.Printf("输出目标 %s 写入失败，快照转入本地缓冲: %v", s.inner.Name(), err)
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("序列化快照失败: %w", err)
+	}
+	if err := s.spool.Append(data); err != nil {
+		return fmt.Errorf("写入本地缓冲失败: %w", err)
+	}
+
+	s.notify()
+	return nil
+}
+
+// Close 停止回放，关闭缓冲和被包装的输出目标
+func (s *SpooledSink) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	close(s.stop)
+	<-s.done
+
+	spoolErr := s.spool.Close()
+	if err := s.inner.Close(); err != nil {
+		return err
+	}
+	return spoolErr
+}
+
+// notify 唤醒回放协程
+func (s *SpooledSink) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// replayLoop 按顺序回放缓冲中的快照，失败时指数退避
+func (s *SpooledSink) replayLoop() {
+	defer close(s.done)
+
+	delay := s.backoff.Min
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-s.wake:
+		}
+
+		for {
+			replayed, err := s.replayOne()
+			if err != nil {
+				log.Printf("回放缓冲快照到 %s 失败，%s 后重试: %v", s.inner.Name(), delay, err)
+
+				// 加入抖动，避免多个实例同时重试
+				wait := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+				select {
+				case <-s.stop:
+					return
+				case <-time.After(wait):
+				}
+				delay = min(delay*2, s.backoff.Max)
+				continue
+			}
+			if !replayed {
+				break
+			}
+			delay = s.backoff.Min
+		}
+	}
+}
+
+// replayOne 回放最旧的一条记录，缓冲为空时返回false
+func (s *SpooledSink) replayOne() (bool, error) {
+	record, err := s.spool.Peek()
+	if err != nil || record == nil {
+		return false, err
+	}
+
+	var snapshot models.Snapshot
+	if err := json.Unmarshal(record.Data, &snapshot); err != nil {
+		// 无法解析的记录不会在重试后好转，直接丢弃
+		log.Printf("缓冲中的快照无法解析，已丢弃: %v", err)
+		return true, s.spool.Commit(record)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	s.mu.Lock()
+	err = s.inner.Write(ctx, &snapshot)
+	s.mu.Unlock()
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Printf("✓ 已回放缓冲快照到 %s（%s）\n", s.inner.Name(), snapshot.Timestamp.Format("2006-01-02 15:04:05"))
+	return true, s.spool.Commit(record)
+}
@@ -0,0 +1,421 @@
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"SnapFlow/internal/models"
+)
+
+// sqliteSchema SQLite输出使用的表结构：快照汇总表加一张长格式明细表
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS snapshots (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		snapshot_id TEXT NOT NULL UNIQUE,
+		sensor TEXT NOT NULL DEFAULT '',
+		site TEXT NOT NULL DEFAULT '',
+		interface_name TEXT NOT NULL DEFAULT '',
+		profile TEXT NOT NULL DEFAULT '',
+		ts INTEGER NOT NULL,
+		window_start INTEGER NOT NULL,
+		window_end INTEGER NOT NULL,
+		total_packets INTEGER NOT NULL,
+		total_bytes INTEGER NOT NULL,
+		unique_source_ips INTEGER NOT NULL,
+		unique_dest_ports INTEGER NOT NULL,
+		unique_source_macs INTEGER NOT NULL,
+		rank_ips_by TEXT NOT NULL DEFAULT 'packets',
+		rank_ports_by TEXT NOT NULL DEFAULT 'packets',
+		unique_dest_ips INTEGER NOT NULL DEFAULT 0,
+		packets_per_second REAL,
+		bits_per_second REAL,
+		peak_pps REAL,
+		peak_bps REAL,
+		payload TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_snapshots_ts ON snapshots(ts)`,
+	`CREATE TABLE IF NOT EXISTS snapshot_entries (
+		snapshot_rowid INTEGER NOT NULL REFERENCES snapshots(id) ON DELETE CASCADE,
+		section TEXT NOT NULL,
+		pos_rank INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		packet_count INTEGER NOT NULL,
+		byte_count INTEGER,
+		percentage REAL,
+		first_seen INTEGER,
+		last_seen INTEGER,
+		PRIMARY KEY(snapshot_rowid, section, pos_rank)
+	)`,
+}
+
+// sqliteColumn 建表之后新增的一列
+type sqliteColumn struct {
+	table      string
+	name       string
+	definition string
+}
+
+// sqliteAddedColumns 旧版本创建的数据库需要补充的列：来源标签、排行的排序依据、目标IP数量、
+// 平均和峰值速率，以及明细的字节数和出现时间
+var sqliteAddedColumns = []sqliteColumn{
+	{table: "snapshots", name: "sensor", definition: "TEXT NOT NULL DEFAULT ''"},
+	{table: "snapshots", name: "site", definition: "TEXT NOT NULL DEFAULT ''"},
+	{table: "snapshots", name: "interface_name", definition: "TEXT NOT NULL DEFAULT ''"},
+	{table: "snapshots", name: "profile", definition: "TEXT NOT NULL DEFAULT ''"},
+	{table: "snapshots", name: "rank_ips_by", definition: "TEXT NOT NULL DEFAULT 'packets'"},
+	{table: "snapshots", name: "rank_ports_by", definition: "TEXT NOT NULL DEFAULT 'packets'"},
+	{table: "snapshots", name: "unique_dest_ips", definition: "INTEGER NOT NULL DEFAULT 0"},
+	{table: "snapshots", name: "packets_per_second", definition: "REAL"},
+	{table: "snapshots", name: "bits_per_second", definition: "REAL"},
+	{table: "snapshots", name: "peak_pps", definition: "REAL"},
+	{table: "snapshots", name: "peak_bps", definition: "REAL"},
+	{table: "snapshot_entries", name: "byte_count", definition: "INTEGER"},
+	{table: "snapshot_entries", name: "first_seen", definition: "INTEGER"},
+	{table: "snapshot_entries", name: "last_seen", definition: "INTEGER"},
+}
+
+// SQLiteSink 把快照写入本地SQLite数据库，适用于没有GrepTimeDB的边缘站点
+type SQLiteSink struct {
+	db *sql.DB
+}
+
+// NewSQLiteSink 打开SQLite数据库文件并创建所需的表
+func NewSQLiteSink(ctx context.Context, path string) (*SQLiteSink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("SQLite数据库路径不能为空")
+	}
+
+	database, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("打开SQLite数据库失败: %w", err)
+	}
+	// SQLite同一时间只允许一个写入者
+	database.SetMaxOpenConns(1)
+
+	for _, pragma := range []string{"PRAGMA journal_mode=WAL", "PRAGMA foreign_keys=ON"} {
+		if _, err := database.ExecContext(ctx, pragma); err != nil {
+			database.Close()
+			return nil, fmt.Errorf("设置SQLite参数失败: %w", err)
+		}
+	}
+
+	for _, stmt := range sqliteSchema {
+		if _, err := database.ExecContext(ctx, stmt); err != nil {
+			database.Close()
+			return nil, fmt.Errorf("创建SQLite表失败: %w", err)
+		}
+	}
+
+	if err := addSQLiteColumns(ctx, database); err != nil {
+		database.Close()
+		return nil, err
+	}
+
+	return &SQLiteSink{db: database}, nil
+}
+
+// addSQLiteColumns 为旧版本创建的表补充缺少的列
+func addSQLiteColumns(ctx context.Context, database *sql.DB) error {
+	existing := make(map[string]bool)
+	for _, table := range []string{"snapshots", "snapshot_entries"} {
+		rows, err := database.QueryContext(ctx, `SELECT name FROM pragma_table_info(?)`, table)
+		if err != nil {
+			return fmt.Errorf("读取SQLite表结构失败: %w", err)
+		}
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return fmt.Errorf("读取SQLite表结构失败: %w", err)
+			}
+			existing[table+"."+name] = true
+		}
+		rows.Close()
+	}
+
+	for _, column := range sqliteAddedColumns {
+		if existing[column.table+"."+column.name] {
+			continue
+		}
+		stmt := fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, column.table, column.name, column.definition)
+		if _, err := database.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("添加SQLite列 %s.%s 失败: %w", column.table, column.name, err)
+		}
+	}
+	return nil
+}
+
+// Name 返回输出目标名称
+func (s *SQLiteSink) Name() string {
+	return "sqlite"
+}
+
+// Write 在一个事务中写入快照汇总和明细，同一快照ID的旧数据会被替换
+func (s *SQLiteSink) Write(ctx context.Context, snapshot *models.Snapshot) error {
+	payload, err := snapshot.ToCompactJSON()
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("开启SQLite事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 明细行通过外键级联删除
+	if _, err := tx.ExecContext(ctx, `DELETE FROM snapshots WHERE snapshot_id = ?`, snapshot.ID); err != nil {
+		return fmt.Errorf("删除SQLite旧快照失败: %w", err)
+	}
+
+	// 没有采集吞吐速率时平均速率和峰值列为NULL
+	var pps, bps, peakPPS, peakBPS sql.NullFloat64
+	if snapshot.Throughput.BucketMillis > 0 {
+		pps = sql.NullFloat64{Float64: snapshot.Throughput.PacketsPerSecond(), Valid: true}
+		bps = sql.NullFloat64{Float64: snapshot.Throughput.BitsPerSecond(), Valid: true}
+		peakPPS = sql.NullFloat64{Float64: snapshot.Throughput.PeakPPS, Valid: true}
+		peakBPS = sql.NullFloat64{Float64: snapshot.Throughput.PeakBPS, Valid: true}
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO snapshots(
+			snapshot_id, sensor, site, interface_name, profile,
+			ts, window_start, window_end, total_packets, total_bytes,
+			unique_source_ips, unique_dest_ports, unique_source_macs,
+			rank_ips_by, rank_ports_by, unique_dest_ips,
+			packets_per_second, bits_per_second, peak_pps, peak_bps, payload
+		) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		snapshot.ID,
+		snapshot.Sensor,
+		snapshot.Site,
+		snapshot.Interface,
+		snapshot.Profile,
+		snapshot.WindowEnd().UnixMilli(),
+		snapshot.Basic.StartTime.UnixMilli(),
+		snapshot.Basic.EndTime.UnixMilli(),
+		int64(snapshot.Basic.TotalPackets),
+		int64(snapshot.Basic.TotalBytes),
+		snapshot.IP.UniqueSourceCount,
+		snapshot.Port.UniqueDestCount,
+		snapshot.MAC.UniqueSourceCount,
+		string(snapshot.IP.RankBy.OrDefault()),
+		string(snapshot.Port.RankBy.OrDefault()),
+		snapshot.Destination.UniqueDestCount,
+		pps,
+		bps,
+		peakPPS,
+		peakBPS,
+		payload,
+	)
+	if err != nil {
+		return fmt.Errorf("写入SQLite快照失败: %w", err)
+	}
+
+	rowID, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("获取SQLite快照ID失败: %w", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO snapshot_entries(
+			snapshot_rowid, section, pos_rank, name, packet_count, byte_count, percentage, first_seen, last_seen
+		) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return fmt.Errorf("准备SQLite明细语句失败: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, entry := range sqliteEntries(snapshot) {
+		if _, err := stmt.ExecContext(ctx,
+			rowID,
+			entry.section,
+			entry.rank,
+			entry.name,
+			int64(entry.count),
+			entry.bytes,
+			entry.percentage,
+			entry.firstSeen,
+			entry.lastSeen,
+		); err != nil {
+			return fmt.Errorf("写入SQLite明细失败: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交SQLite事务失败: %w", err)
+	}
+	return nil
+}
+
+// Close 关闭SQLite数据库
+func (s *SQLiteSink) Close() error {
+	return s.db.Close()
+}
+
+// sqliteEntry 长格式明细表中的一行
+type sqliteEntry struct {
+	section    string
+	rank       int
+	name       string
+	count      uint64
+	bytes      sql.NullInt64 // MAC排行没有字节数
+	percentage sql.NullFloat64
+	firstSeen  sql.NullInt64 // 目标IP、会话和五元组流的出现时间，Unix毫秒
+	lastSeen   sql.NullInt64
+}
+
+// sqliteEntries 把快照中的各个排行和分布展开为明细行
+func sqliteEntries(snapshot *models.Snapshot) []sqliteEntry {
+	var entries []sqliteEntry
+	ranks := make(map[string]int)
+
+	add := func(section, name string, count uint64, bytes *uint64, percentage *float64) {
+		ranks[section]++
+		entry := sqliteEntry{section: section, rank: ranks[section], name: name, count: count}
+		if bytes != nil {
+			entry.bytes = sql.NullInt64{Int64: int64(*bytes), Valid: true}
+		}
+		if percentage != nil {
+			entry.percentage = sql.NullFloat64{Float64: *percentage, Valid: true}
+		}
+		entries = append(entries, entry)
+	}
+
+	for _, pair := range snapshot.IP.TopPairs {
+		if pair.Count > 0 {
+			add("top_source_ip", pair.SourceIP, pair.Count, &pair.Bytes, nil)
+		}
+	}
+	for _, mac := range snapshot.MAC.TopSources {
+		if mac.Count > 0 {
+			add("top_source_mac", mac.Address, mac.Count, nil, nil)
+		}
+	}
+	for _, pair := range snapshot.Port.TopPairs {
+		if pair.Count > 0 {
+			add("top_destination_port", strconv.Itoa(int(pair.DestinationPort)), pair.Count, &pair.Bytes, nil)
+		}
+	}
+	// 按传输层协议区分的端口排行，每个协议和角色一个分区，例如 tcp_service_port
+	for _, port := range snapshot.TransportPort.Ports {
+		section := strings.ToLower(port.Transport) + "_" + string(port.Role) + "_port"
+		add(section, strconv.Itoa(int(port.Port)), port.Count, &port.Bytes, nil)
+	}
+	for _, proto := range snapshot.Protocol.Protocols {
+		add("protocol", proto.Name, proto.Count, &proto.Bytes, &proto.Percentage)
+	}
+	for _, flag := range snapshot.TCPFlags.Flags {
+		add("tcp_flag", flag.Flag, flag.Count, &flag.Bytes, &flag.Percentage)
+	}
+	for _, app := range snapshot.Application.Apps {
+		add("application", app.Name, app.Count, &app.Bytes, &app.Percentage)
+	}
+	for _, service := range snapshot.Service.Services {
+		add("service", service.Name, service.Count, &service.Bytes, &service.Percentage)
+	}
+	for _, etherType := range snapshot.L2.EtherTypes {
+		add("ether_type", etherType.Name, etherType.Count, &etherType.Bytes, &etherType.Percentage)
+	}
+	for _, cast := range snapshot.L2.Casts {
+		add("mac_cast", string(cast.Cast), cast.Count, &cast.Bytes, &cast.Percentage)
+	}
+	for _, mac := range snapshot.L2.TopDestinations {
+		add("top_destination_mac", mac.Address, mac.Count, &mac.Bytes, nil)
+	}
+
+	// 流量分类：交叉统计的名称为 应用/协议 或 应用/端口，非标准端口的名称为 应用 协议/端口
+	classification := snapshot.Classification
+	if len(classification.PacketTypes) > 0 {
+		add("unknown_application", models.UnknownApplication, classification.UnknownCount, &classification.UnknownBytes, &classification.UnknownPercentage)
+		add("non_standard_application", "non_standard", classification.NonStandardCount, &classification.NonStandardBytes, &classification.NonStandardPercentage)
+	}
+	for _, packetType := range classification.PacketTypes {
+		add("packet_type", packetType.Name, packetType.Count, &packetType.Bytes, &packetType.Percentage)
+	}
+	for _, count := range classification.AppProtocols {
+		add("application_protocol", count.Application+"/"+count.Value, count.Count, &count.Bytes, &count.Percentage)
+	}
+	for _, count := range classification.AppPorts {
+		add("application_port", count.Application+"/"+count.Value, count.Count, &count.Bytes, &count.Percentage)
+	}
+	for _, port := range classification.NonStandard {
+		add("non_standard_port", fmt.Sprintf("%s %s/%d", port.Application, port.Transport, port.Port), port.Count, &port.Bytes, nil)
+	}
+
+	// 数据包大小直方图的名称为 协议/区间，例如 all/65-128；极值、平均值和百分位数只在payload中
+	for _, h := range snapshot.PacketSize.Histograms() {
+		for _, bucket := range h.Buckets {
+			add("packet_size", h.Protocol+"/"+bucket.Bucket, bucket.Count, &bucket.Bytes, &bucket.Percentage)
+		}
+	}
+
+	// 微突发的名称为时间桶开始时间，出现时间为时间桶的开始和结束
+	bucket := time.Duration(snapshot.Throughput.BucketMillis) * time.Millisecond
+	for _, burst := range snapshot.Throughput.Bursts {
+		add("microburst", burst.Start.UTC().Format("2006-01-02 15:04:05.000"), burst.Packets, &burst.Bytes, nil)
+		entry := &entries[len(entries)-1]
+		entry.firstSeen = sql.NullInt64{Int64: burst.Start.UnixMilli(), Valid: true}
+		entry.lastSeen = sql.NullInt64{Int64: burst.Start.Add(bucket).UnixMilli(), Valid: true}
+	}
+
+	// 流量方向：地址排行的名称为 方向/角色/地址，分布的名称为 方向/协议 或 方向/端口
+	for _, d := range snapshot.Direction.Directions {
+		add("direction", string(d.Direction), d.Count, &d.Bytes, &d.Percentage)
+	}
+	for _, talker := range snapshot.Direction.TopTalkers {
+		add("direction_talker", string(talker.Direction)+"/"+string(talker.Role)+"/"+talker.Address, talker.Count, &talker.Bytes, nil)
+	}
+	for _, count := range snapshot.Direction.Protocols {
+		add("direction_protocol", string(count.Direction)+"/"+count.Value, count.Count, &count.Bytes, &count.Percentage)
+	}
+	for _, count := range snapshot.Direction.Ports {
+		add("direction_port", string(count.Direction)+"/"+count.Value, count.Count, &count.Bytes, &count.Percentage)
+	}
+
+	// 前缀：唯一数量的名称为 角色/地址族/长度，数量记在count中；热门前缀的名称为前缀本身
+	for _, u := range snapshot.Prefix.Unique {
+		add("prefix_unique", fmt.Sprintf("%s/%s/%d", u.Role, u.Family, u.Length), uint64(u.Count), nil, nil)
+	}
+	for _, p := range snapshot.Prefix.TopSources {
+		add("top_source_prefix", p.Prefix, p.Count, &p.Bytes, nil)
+	}
+	for _, p := range snapshot.Prefix.TopDestinations {
+		add("top_destination_prefix", p.Prefix, p.Count, &p.Bytes, nil)
+	}
+
+	// 国家和自治系统：名称为 角色/国家代码 或 角色/AS编号；地址解析结果只在payload中
+	for _, country := range snapshot.Geo.TopCountries {
+		add("top_country", string(country.Role)+"/"+country.CountryCode, country.Count, &country.Bytes, &country.Percentage)
+	}
+	for _, asn := range snapshot.Geo.TopASNs {
+		add("top_asn", fmt.Sprintf("%s/AS%d", asn.Role, asn.ASN), asn.Count, &asn.Bytes, &asn.Percentage)
+	}
+
+	// 目标IP、会话和五元组流的名称由各键拼接，附带出现时间
+	addTalker := func(section, name string, traffic models.TalkerTraffic) {
+		add(section, name, traffic.Count, &traffic.Bytes, nil)
+		entry := &entries[len(entries)-1]
+		entry.firstSeen = sql.NullInt64{Int64: traffic.FirstSeen.UnixMilli(), Valid: true}
+		entry.lastSeen = sql.NullInt64{Int64: traffic.LastSeen.UnixMilli(), Valid: true}
+	}
+	for _, dest := range snapshot.Destination.TopDestinations {
+		addTalker("top_destination_ip", dest.DestinationIP, dest.TalkerTraffic)
+	}
+	for _, conv := range snapshot.Conversation.TopConversations {
+		addTalker("top_conversation", conv.SourceIP+" -> "+conv.DestinationIP, conv.TalkerTraffic)
+	}
+	for _, flow := range snapshot.Flow.TopFlows {
+		name := fmt.Sprintf("%s %s:%d -> %s:%d", flow.Protocol, flow.SourceIP, flow.SourcePort, flow.DestinationIP, flow.DestinationPort)
+		addTalker("top_flow", name, flow.TalkerTraffic)
+	}
+
+	return entries
+}
@@ -0,0 +1,536 @@
+package spool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FsyncPolicy 控制写入缓冲文件后何时调用fsync
+type FsyncPolicy string
+
+const (
+	FsyncAlways   FsyncPolicy = "always"   // 每条记录写入后立即fsync
+	FsyncInterval FsyncPolicy = "interval" // 按固定间隔在后台fsync
+	FsyncNever    FsyncPolicy = "never"    // 交给操作系统决定
+)
+
+// ParseFsyncPolicy 解析fsync策略配置
+func ParseFsyncPolicy(value string) (FsyncPolicy, error) {
+	switch FsyncPolicy(value) {
+	case FsyncAlways, FsyncInterval, FsyncNever:
+		return FsyncPolicy(value), nil
+	case "":
+		return FsyncInterval, nil
+	default:
+		return "", fmt.Errorf("未知的fsync策略 %q（可选 always、interval、never）", value)
+	}
+}
+
+const (
+	segmentSuffix  = ".seg"
+	cursorFileName = "cursor"
+
+	// recordHeaderSize 记录头：4字节长度 + 4字节CRC32C + 8字节入队时间
+	recordHeaderSize = 16
+	// maxRecordSize 单条记录的上限，超过则认为长度字段已损坏
+	maxRecordSize = 64 << 20
+)
+
+// crcTable 使用Castagnoli多项式计算校验和
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Config 本地缓冲的配置
+type Config struct {
+	Dir           string        // 缓冲目录
+	MaxBytes      int64         // 缓冲总大小上限，超出时丢弃最旧的段
+	MaxAge        time.Duration // 记录最长保留时间，过期记录在回放时丢弃
+	SegmentBytes  int64         // 单个段文件的大小，超过后切换到新段
+	Fsync         FsyncPolicy   // fsync策略
+	FsyncInterval time.Duration // interval策略下的fsync间隔
+}
+
+// Record 从缓冲中读出的一条记录
+type Record struct {
+	Data       []byte
+	EnqueuedAt time.Time
+
+	seq  uint64 // 所在段的序号
+	next int64  // 下一条记录在段内的偏移量
+}
+
+// position 缓冲中的读取位置
+type position struct {
+	seq    uint64
+	offset int64
+}
+
+// Spool 按顺序保存记录的磁盘缓冲（预写日志）
+//
+// 记录追加到按序号命名的段文件中，读取位置保存在cursor文件里，
+// 一个段的记录全部确认后该段文件被删除。
+type Spool struct {
+	cfg Config
+
+	mu         sync.Mutex
+	segments   []uint64         // 所有段序号，升序
+	sizes      map[uint64]int64 // 各段文件大小
+	active     *os.File         // 当前追加的段
+	activeSeq  uint64
+	writer     *bufio.Writer
+	cursor     position
+	dirty      bool
+	closed     bool
+	stopSync   chan struct{}
+	syncDone   chan struct{}
+	readerFile *os.File // 回放时缓存打开的段文件
+	readerSeq  uint64
+}
+
+// Open 打开(或创建)缓冲目录；上次进程留下的段只读，新的记录总是写入新段
+func Open(cfg Config) (*Spool, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("缓冲目录不能为空")
+	}
+	if cfg.SegmentBytes <= 0 {
+		cfg.SegmentBytes = 16 << 20
+	}
+	if cfg.Fsync == "" {
+		cfg.Fsync = FsyncInterval
+	}
+	if cfg.FsyncInterval <= 0 {
+		cfg.FsyncInterval = time.Second
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建缓冲目录失败: %w", err)
+	}
+
+	s := &Spool{cfg: cfg, sizes: make(map[uint64]int64)}
+
+	entries, err := os.ReadDir(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取缓冲目录失败: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("读取缓冲段信息失败: %w", err)
+		}
+		s.segments = append(s.segments, seq)
+		s.sizes[seq] = info.Size()
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i] < s.segments[j] })
+
+	s.cursor = s.loadCursor()
+
+	var nextSeq uint64 = 1
+	if n := len(s.segments); n > 0 {
+		nextSeq = s.segments[n-1] + 1
+	}
+	if err := s.openSegment(nextSeq); err != nil {
+		return nil, err
+	}
+
+	// 读取位置不在任何现存段中时，从最旧的段开始
+	if _, ok := s.sizes[s.cursor.seq]; !ok {
+		s.cursor = position{seq: s.segments[0]}
+	}
+
+	if cfg.Fsync == FsyncInterval {
+		s.stopSync = make(chan struct{})
+		s.syncDone = make(chan struct{})
+		go s.syncLoop()
+	}
+
+	return s, nil
+}
+
+// Append 追加一条记录
+func (s *Spool) Append(data []byte) error {
+	if len(data) > maxRecordSize {
+		return fmt.Errorf("记录大小 %d 超过上限 %d", len(data), maxRecordSize)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("缓冲已关闭")
+	}
+
+	recordSize := int64(recordHeaderSize + len(data))
+
+	if s.sizes[s.activeSeq] > 0 && s.sizes[s.activeSeq]+recordSize > s.cfg.SegmentBytes {
+		if err := s.rollSegment(); err != nil {
+			return err
+		}
+	}
+
+	s.dropExpiredSegments()
+	if err := s.enforceMaxBytes(recordSize); err != nil {
+		return err
+	}
+
+	var header [recordHeaderSize]byte
+	binary.BigEndian.PutUint32(header[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(header[4:8], crc32.Checksum(data, crcTable))
+	binary.BigEndian.PutUint64(header[8:16], uint64(time.Now().UnixNano()))
+
+	if _, err := s.writer.Write(header[:]); err != nil {
+		return fmt.Errorf("写入缓冲记录失败: %w", err)
+	}
+	if _, err := s.writer.Write(data); err != nil {
+		return fmt.Errorf("写入缓冲记录失败: %w", err)
+	}
+	if err := s.writer.Flush(); err != nil {
+		return fmt.Errorf("写入缓冲记录失败: %w", err)
+	}
+	s.sizes[s.activeSeq] += recordSize
+
+	switch s.cfg.Fsync {
+	case FsyncAlways:
+		if err := s.active.Sync(); err != nil {
+			return fmt.Errorf("同步缓冲文件失败: %w", err)
+		}
+	case FsyncInterval:
+		s.dirty = true
+	}
+	return nil
+}
+
+// Peek 返回最旧的未确认记录，缓冲为空时返回nil
+//
+// 过期记录、校验失败的记录和被截断的段会被跳过并记录日志。
+func (s *Spool) Peek() (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		if s.closed {
+			return nil, fmt.Errorf("缓冲已关闭")
+		}
+
+		size, ok := s.sizes[s.cursor.seq]
+		if !ok {
+			return nil, nil
+		}
+
+		if s.cursor.offset >= size {
+			if s.cursor.seq == s.activeSeq {
+				return nil, nil
+			}
+			// 当前段已读完，删除后继续下一个段
+			if err := s.removeSegment(s.cursor.seq); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		record, err := s.readRecord(s.cursor)
+		if err != nil {
+			log.Printf("缓冲段 %d 在偏移 %d 处损坏，跳过该段剩余内容: %v", s.cursor.seq, s.cursor.offset, err)
+			s.cursor.offset = size
+			continue
+		}
+		if record == nil {
+			// 校验和不匹配，跳过这一条
+			log.Printf("缓冲段 %d 在偏移 %d 处的记录校验失败，已跳过", s.cursor.seq, s.cursor.offset)
+			continue
+		}
+
+		if s.cfg.MaxAge > 0 && time.Since(record.EnqueuedAt) > s.cfg.MaxAge {
+			log.Printf("丢弃过期的缓冲记录（入队于 %s）", record.EnqueuedAt.Format(time.RFC3339))
+			s.cursor = position{seq: record.seq, offset: record.next}
+			continue
+		}
+
+		return record, nil
+	}
+}
+
+// Commit 确认一条记录已处理，读取位置前进到它之后
+func (s *Spool) Commit(record *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record.seq != s.cursor.seq || record.next <= s.cursor.offset {
+		return nil
+	}
+	s.cursor = position{seq: record.seq, offset: record.next}
+	return s.saveCursor()
+}
+
+// Empty 判断缓冲中是否还有未确认的记录
+func (s *Spool) Empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cursor.seq != s.activeSeq {
+		return false
+	}
+	return s.cursor.offset >= s.sizes[s.activeSeq]
+}
+
+// Close 同步并关闭缓冲文件
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	if s.stopSync != nil {
+		close(s.stopSync)
+		<-s.syncDone
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closeReader()
+	err := s.saveCursor()
+	if syncErr := s.active.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := s.active.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// syncLoop interval策略下定期fsync
+func (s *Spool) syncLoop() {
+	defer close(s.syncDone)
+
+	ticker := time.NewTicker(s.cfg.FsyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.dirty && !s.closed {
+				if err := s.active.Sync(); err != nil {
+					log.Printf("同步缓冲文件失败: %v", err)
+				}
+				s.dirty = false
+			}
+			s.mu.Unlock()
+		case <-s.stopSync:
+			return
+		}
+	}
+}
+
+// segmentPath 段文件路径
+func (s *Spool) segmentPath(seq uint64) string {
+	return filepath.Join(s.cfg.Dir, fmt.Sprintf("%020d%s", seq, segmentSuffix))
+}
+
+// openSegment 创建新的活动段
+func (s *Spool) openSegment(seq uint64) error {
+	file, err := os.OpenFile(s.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("创建缓冲段失败: %w", err)
+	}
+
+	s.active = file
+	s.activeSeq = seq
+	s.writer = bufio.NewWriter(file)
+	s.segments = append(s.segments, seq)
+	s.sizes[seq] = 0
+	return nil
+}
+
+// rollSegment 关闭当前段并开始新段
+func (s *Spool) rollSegment() error {
+	if err := s.active.Sync(); err != nil {
+		return fmt.Errorf("同步缓冲段失败: %w", err)
+	}
+	if err := s.active.Close(); err != nil {
+		return fmt.Errorf("关闭缓冲段失败: %w", err)
+	}
+	s.dirty = false
+	return s.openSegment(s.activeSeq + 1)
+}
+
+// removeSegment 删除一个非活动段，读取位置在该段时移动到下一个段
+func (s *Spool) removeSegment(seq uint64) error {
+	if seq == s.readerSeq {
+		s.closeReader()
+	}
+	if err := os.Remove(s.segmentPath(seq)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除缓冲段失败: %w", err)
+	}
+
+	delete(s.sizes, seq)
+	for i, existing := range s.segments {
+		if existing == seq {
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			break
+		}
+	}
+
+	if s.cursor.seq == seq {
+		s.cursor = position{seq: s.segments[0]}
+		return s.saveCursor()
+	}
+	return nil
+}
+
+// dropExpiredSegments 删除最后修改时间已超过保留时间的段
+func (s *Spool) dropExpiredSegments() {
+	if s.cfg.MaxAge <= 0 {
+		return
+	}
+	for len(s.segments) > 1 {
+		seq := s.segments[0]
+		info, err := os.Stat(s.segmentPath(seq))
+		if err != nil || time.Since(info.ModTime()) <= s.cfg.MaxAge {
+			return
+		}
+		log.Printf("缓冲段 %d 已超过保留时间 %s，丢弃", seq, s.cfg.MaxAge)
+		if err := s.removeSegment(seq); err != nil {
+			log.Printf("%v", err)
+			return
+		}
+	}
+}
+
+// enforceMaxBytes 写入前检查总大小，超出时丢弃最旧的段
+func (s *Spool) enforceMaxBytes(incoming int64) error {
+	if s.cfg.MaxBytes <= 0 {
+		return nil
+	}
+
+	for {
+		var total int64
+		for _, size := range s.sizes {
+			total += size
+		}
+		if total+incoming <= s.cfg.MaxBytes {
+			return nil
+		}
+		if len(s.segments) <= 1 {
+			return fmt.Errorf("缓冲已满（上限 %d 字节）", s.cfg.MaxBytes)
+		}
+
+		seq := s.segments[0]
+		log.Printf("缓冲超过 %d 字节，丢弃最旧的缓冲段 %d", s.cfg.MaxBytes, seq)
+		if err := s.removeSegment(seq); err != nil {
+			return err
+		}
+	}
+}
+
+// readRecord 读取指定位置的记录；校验和不匹配时返回nil记录并前移读取位置
+func (s *Spool) readRecord(pos position) (*Record, error) {
+	if s.readerFile == nil || s.readerSeq != pos.seq {
+		s.closeReader()
+		file, err := os.Open(s.segmentPath(pos.seq))
+		if err != nil {
+			return nil, err
+		}
+		s.readerFile = file
+		s.readerSeq = pos.seq
+	}
+
+	var header [recordHeaderSize]byte
+	if _, err := s.readerFile.ReadAt(header[:], pos.offset); err != nil {
+		return nil, fmt.Errorf("读取记录头失败: %w", err)
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	checksum := binary.BigEndian.Uint32(header[4:8])
+	enqueuedAt := time.Unix(0, int64(binary.BigEndian.Uint64(header[8:16])))
+
+	if length > maxRecordSize {
+		return nil, fmt.Errorf("记录长度 %d 无效", length)
+	}
+
+	data := make([]byte, length)
+	if _, err := s.readerFile.ReadAt(data, pos.offset+recordHeaderSize); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("记录被截断")
+		}
+		return nil, err
+	}
+
+	next := pos.offset + recordHeaderSize + int64(length)
+	if crc32.Checksum(data, crcTable) != checksum {
+		s.cursor = position{seq: pos.seq, offset: next}
+		return nil, nil
+	}
+
+	return &Record{Data: data, EnqueuedAt: enqueuedAt, seq: pos.seq, next: next}, nil
+}
+
+// closeReader 关闭回放时缓存的段文件
+func (s *Spool) closeReader() {
+	if s.readerFile != nil {
+		s.readerFile.Close()
+		s.readerFile = nil
+		s.readerSeq = 0
+	}
+}
+
+// loadCursor 读取持久化的读取位置
+func (s *Spool) loadCursor() position {
+	data, err := os.ReadFile(filepath.Join(s.cfg.Dir, cursorFileName))
+	if err != nil {
+		return position{}
+	}
+
+	var pos position
+	if _, err := fmt.Sscanf(string(data), "%d %d", &pos.seq, &pos.offset); err != nil {
+		log.Printf("缓冲读取位置文件损坏，将从最旧的记录开始回放: %v", err)
+		return position{}
+	}
+	return pos
+}
+
+// saveCursor 原子地持久化读取位置
+func (s *Spool) saveCursor() error {
+	path := filepath.Join(s.cfg.Dir, cursorFileName)
+	tmp := path + ".tmp"
+
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("保存缓冲读取位置失败: %w", err)
+	}
+	if _, err := fmt.Fprintf(file, "%d %d\n", s.cursor.seq, s.cursor.offset); err != nil {
+		file.Close()
+		return fmt.Errorf("保存缓冲读取位置失败: %w", err)
+	}
+	if s.cfg.Fsync == FsyncAlways {
+		if err := file.Sync(); err != nil {
+			file.Close()
+			return fmt.Errorf("同步缓冲读取位置失败: %w", err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("保存缓冲读取位置失败: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,167 @@
+package spool
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// openTestSpool 在临时目录中打开不启动后台fsync的缓冲
+func openTestSpool(t *testing.T, dir string) *Spool {
+	t.Helper()
+	s, err := Open(Config{Dir: dir, Fsync: FsyncNever})
+	if err != nil {
+		t.Fatalf("打开缓冲失败: %v", err)
+	}
+	return s
+}
+
+// appendAll 依次追加记录
+func appendAll(t *testing.T, s *Spool, records ...string) {
+	t.Helper()
+	for _, record := range records {
+		if err := s.Append([]byte(record)); err != nil {
+			t.Fatalf("追加记录失败: %v", err)
+		}
+	}
+}
+
+// expectNext 读取下一条记录并检查内容，commit为true时确认该记录
+func expectNext(t *testing.T, s *Spool, want string, commit bool) {
+	t.Helper()
+	record, err := s.Peek()
+	if err != nil {
+		t.Fatalf("读取记录失败: %v", err)
+	}
+	if record == nil {
+		t.Fatalf("缓冲为空，需要记录 %q", want)
+	}
+	if string(record.Data) != want {
+		t.Fatalf("记录 = %q, want %q", record.Data, want)
+	}
+	if commit {
+		if err := s.Commit(record); err != nil {
+			t.Fatalf("确认记录失败: %v", err)
+		}
+	}
+}
+
+// expectEmpty 检查缓冲中没有未确认的记录
+func expectEmpty(t *testing.T, s *Spool) {
+	t.Helper()
+	record, err := s.Peek()
+	if err != nil {
+		t.Fatalf("读取记录失败: %v", err)
+	}
+	if record != nil {
+		t.Fatalf("缓冲应为空，读到 %q", record.Data)
+	}
+	if !s.Empty() {
+		t.Fatal("Empty() = false")
+	}
+}
+
+func TestSpoolCursorResume(t *testing.T) {
+	dir := t.TempDir()
+
+	s := openTestSpool(t, dir)
+	appendAll(t, s, "first", "second", "third")
+	expectNext(t, s, "first", true)
+	// 读取但没有确认的记录在重新打开后再次回放
+	expectNext(t, s, "second", false)
+	if err := s.Close(); err != nil {
+		t.Fatalf("关闭缓冲失败: %v", err)
+	}
+
+	s = openTestSpool(t, dir)
+	defer s.Close()
+	expectNext(t, s, "second", true)
+	expectNext(t, s, "third", true)
+
+	// 新记录写入新段，在旧段之后回放
+	appendAll(t, s, "fourth")
+	expectNext(t, s, "fourth", true)
+	expectEmpty(t, s)
+}
+
+func TestSpoolSkipsCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	s := openTestSpool(t, dir)
+	appendAll(t, s, "first", "second", "third")
+	path := s.segmentPath(s.activeSeq)
+	if err := s.Close(); err != nil {
+		t.Fatalf("关闭缓冲失败: %v", err)
+	}
+
+	// 修改第二条记录的数据，使校验和不匹配
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[recordHeaderSize+len("first")+recordHeaderSize] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openTestSpool(t, dir)
+	defer s.Close()
+	expectNext(t, s, "first", true)
+	expectNext(t, s, "third", true)
+	expectEmpty(t, s)
+}
+
+func TestSpoolSkipsTruncatedSegment(t *testing.T) {
+	dir := t.TempDir()
+
+	s := openTestSpool(t, dir)
+	appendAll(t, s, "first", "second")
+	path := s.segmentPath(s.activeSeq)
+	if err := s.Close(); err != nil {
+		t.Fatalf("关闭缓冲失败: %v", err)
+	}
+
+	// 模拟写入第二条记录时进程退出：记录只写入了一部分
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, info.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openTestSpool(t, dir)
+	defer s.Close()
+	expectNext(t, s, "first", true)
+
+	// 被截断的段剩余内容被跳过，之后写入的记录正常回放
+	appendAll(t, s, "third")
+	expectNext(t, s, "third", true)
+	expectEmpty(t, s)
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("读完的段应被删除: %v", err)
+	}
+}
+
+func TestSpoolCorruptCursorReplaysFromOldest(t *testing.T) {
+	dir := t.TempDir()
+
+	s := openTestSpool(t, dir)
+	appendAll(t, s, "first", "second")
+	expectNext(t, s, "first", true)
+	if err := s.Close(); err != nil {
+		t.Fatalf("关闭缓冲失败: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, cursorFileName), []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 读取位置损坏时宁可重复回放，也不丢失记录
+	s = openTestSpool(t, dir)
+	defer s.Close()
+	expectNext(t, s, "first", true)
+	expectNext(t, s, "second", true)
+	expectEmpty(t, s)
+}